@@ -2,30 +2,41 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"flag"
 	"os"
-	"os/signal"
-	"syscall"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Alwanly/service-distribute-management/internal/config"
+	"github.com/Alwanly/service-distribute-management/internal/models"
 	"github.com/Alwanly/service-distribute-management/internal/server/agent/handler"
+	authentication "github.com/Alwanly/service-distribute-management/pkg/auth"
 	"github.com/Alwanly/service-distribute-management/pkg/deps"
 	"github.com/Alwanly/service-distribute-management/pkg/logger"
 	"github.com/Alwanly/service-distribute-management/pkg/middleware"
 	"github.com/Alwanly/service-distribute-management/pkg/poll"
 	"github.com/Alwanly/service-distribute-management/pkg/pubsub"
+	"github.com/Alwanly/service-distribute-management/pkg/shutdown"
+	"github.com/Alwanly/service-distribute-management/pkg/tracing"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/gofiber/fiber/v2/middleware/requestid"
-	"golang.org/x/sync/errgroup"
 )
 
+// version is the agent build reported to the controller at registration,
+// set with -ldflags "-X main.version=..."
+var version = "dev"
+
 func main() {
+	validateOnly := flag.Bool("validate", false, "check the configuration and connectivity to the controller and worker, then exit")
+	flag.Parse()
+
 	log, err := logger.NewLoggerFromEnv("agent")
 	if err != nil {
 		panic(err)
 	}
-	defer log.Sync()
+	defer log.Close()
 
 	log.Info("starting agent service")
 
@@ -33,12 +44,36 @@ func main() {
 	if err != nil {
 		log.WithError(err).Fatal("failed to load configuration")
 	}
+	cfg.Version = version
+	if *validateOnly {
+		cfg.ValidateOnly = true
+	}
+	if err := cfg.Validate(); err != nil {
+		log.WithError(err).Fatal("invalid configuration")
+	}
 
 	log.Info("configuration loaded",
 		logger.String("controller_url", cfg.ControllerURL),
 		logger.String("worker_url", cfg.WorkerURL),
 		logger.String("agent_addr", cfg.AgentAddr),
 	)
+	if cfg.WorkerForwardingDisabled {
+		log.Warn("worker forwarding disabled; configurations are fetched and stored but never sent to a worker",
+			logger.String("setting", "WORKER_FORWARDING_DISABLED"))
+	}
+
+	if cfg.ValidateOnly {
+		os.Exit(validate(log, cfg))
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName: "agent",
+		Endpoint:    cfg.Tracing.Endpoint,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		log.WithError(err).Fatal("failed to initialize tracing")
+	}
 
 	poller := poll.NewPoller(log)
 
@@ -47,11 +82,17 @@ func main() {
 	app.Use(recover.New())
 	app.Use(requestid.New())
 	app.Use(middleware.CanonicalLoggerMiddleware(log))
+	app.Use(middleware.TracingMiddleware())
 
 	deps := deps.App{
 		Fiber:  app,
 		Logger: log,
 		Poller: poller,
+		// Agent credentials guard the local debug endpoints
+		Middleware: middleware.NewAuthMiddleware(middleware.SetBasicAuth(&authentication.BasicAuthTConfig{
+			Username: cfg.AgentUsername,
+			Password: cfg.AgentPassword,
+		})),
 	}
 
 	if cfg.Redis != nil {
@@ -60,6 +101,8 @@ func main() {
 			Port:     cfg.Redis.Port,
 			Password: cfg.Redis.Password,
 			DB:       cfg.Redis.DB,
+			// Both services share the setting; only the agent subscribes
+			MessageBuffer: cfg.Redis.MessageBuffer,
 		}
 		if redisPub, err := pubsub.NewRedisPubSub(redisCfg, log); err != nil {
 			log.WithError(err).Error("failed to initialize Redis subscriber, continuing with poll-only mode")
@@ -72,71 +115,143 @@ func main() {
 
 	h := handler.NewHandler(deps, cfg)
 
-	regResp, err := h.RegisterAgent(context.Background())
-	if err != nil {
-		log.WithError(err).Fatal("agent registration failed")
-		os.Exit(1)
-	}
-
-	interval := 50
-	if regResp != nil && regResp.PollIntervalSeconds > 0 {
-		interval = regResp.PollIntervalSeconds
-	}
-	deps.Poller.RegisterFetchFunc("get-configure", h.GetConfigure, poll.PollerConfig{PollIntervalSeconds: interval})
-
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	if err := h.StartBackgroundServices(ctx); err != nil {
-		log.WithError(err).Error("failed to start background services")
-	}
-
-	g, gCtx := errgroup.WithContext(ctx)
+	// Cleanups run in reverse order: stop serving, stop the poller, stop the
+	// background listeners started from ctx and the worker forwards, then
+	// flush the remaining spans
+	sd := shutdown.New(log, shutdown.DefaultTimeout)
+	sd.Add("tracing", shutdownTracing)
+	sd.Add("worker forwards", func(context.Context) error {
+		h.StopWorkerForwards()
+		return nil
+	})
+	sd.Add("background services", func(context.Context) error {
+		cancel()
+		return nil
+	})
 
-	g.Go(func() error {
+	// Serve /health while registering so operators can see the attempts and last error
+	go func() {
 		log.Info("starting HTTP server", logger.String("address", cfg.AgentAddr))
 		if err := app.Listen(cfg.AgentAddr); err != nil {
-			return fmt.Errorf("failed to start server: %w", err)
+			log.WithError(err).Error("agent HTTP server stopped")
+			cancel()
 		}
-		return nil
-	})
+	}()
 
-	g.Go(func() error {
-		log.Info("starting poller")
-		if err := poller.Start(gCtx); err != nil {
-			return fmt.Errorf("poller stopped with error: %w", err)
+	// The poller starts once registration succeeds, which may be after
+	// startup when the agent comes up from its cached config
+	var servicesMu sync.Mutex
+	var servicesStarted, stopping bool
+	startServices := func(regResp *models.RegistrationResponse) {
+		servicesMu.Lock()
+		defer servicesMu.Unlock()
+		if stopping {
+			return
 		}
-		return nil
-	})
-
-	g.Go(func() error {
-		<-gCtx.Done()
 
-		if err := app.Shutdown(); err != nil {
-			log.WithError(err).Error("failed to shutdown fiber app")
-			return err
+		interval := 50
+		if regResp != nil && regResp.PollIntervalSeconds > 0 {
+			interval = regResp.PollIntervalSeconds
 		}
+		deps.Poller.RegisterFetchFunc(handler.ConfigPollName, h.GetConfigure, poll.PollerConfig{PollIntervalSeconds: interval})
 
-		if err := poller.Stop(); err != nil {
-			log.WithError(err).Error("failed to stop poller")
-			return err
+		if err := h.StartBackgroundServices(ctx); err != nil {
+			log.WithError(err).Error("failed to start background services")
 		}
 
-		return nil
+		log.Info("starting poller")
+		if err := poller.Start(ctx); err != nil {
+			log.WithError(err).Error("failed to start poller")
+		}
+		servicesStarted = true
+	}
+	sd.Add("poller", func(context.Context) error {
+		servicesMu.Lock()
+		defer servicesMu.Unlock()
+		stopping = true
+		if !servicesStarted {
+			return nil
+		}
+		return poller.Stop()
+	})
+	sd.Add("http server", func(ctx context.Context) error {
+		return app.ShutdownWithContext(ctx)
 	})
 
-	go func() {
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
-		log.Info("listening for OS signals")
-		<-sigChan
-		log.Info("shutdown signal received")
-		cancel()
-	}()
+	// Catch a misconfigured worker before the first config forward fails
+	if err := h.PreflightWorker(ctx); err != nil {
+		log.WithError(err).Fatal("worker preflight check failed")
+	}
+
+	var exitCode atomic.Int32
+	regResp, err := h.RegisterAgent(ctx)
+	if err != nil {
+		cached, cacheErr := h.ServeCachedConfig(ctx)
+		if cached == nil {
+			if cacheErr != nil {
+				log.WithError(cacheErr).Error("failed to load cached configuration")
+			}
+			// Stay up so /health keeps reporting why registration failed
+			// instead of the agent vanishing in a restart loop
+			log.WithError(err).Error("agent registration failed; serving /health in the failed state")
+			if exitAfter := cfg.RegistrationFailedExitAfter; exitAfter > 0 {
+				go func() {
+					timer := time.NewTimer(exitAfter)
+					defer timer.Stop()
+					select {
+					case <-ctx.Done():
+					case <-timer.C:
+						log.Error("exiting after failed registration", logger.Duration("exit_after", exitAfter))
+						exitCode.Store(1)
+						cancel()
+					}
+				}()
+			}
+		} else {
+			log.WithError(err).Warn("agent registration failed; running offline from cached configuration",
+				logger.String("etag", cached.ETag))
+
+			go func() {
+				regResp, err := h.RetryRegistration(ctx)
+				if err != nil {
+					return
+				}
+				log.Info("agent registered with controller; leaving offline mode")
+				startServices(regResp)
+			}()
+		}
+	} else {
+		startServices(regResp)
+	}
 
-	if err := g.Wait(); err != nil {
-		log.WithError(err).Error("agent service stopped with error")
+	if err := sd.Wait(ctx); err != nil {
+		log.WithError(err).Error("agent service did not shut down cleanly")
 	}
 
 	log.Info("agent service stopped gracefully")
+	if code := exitCode.Load(); code != 0 {
+		log.Close()
+		os.Exit(int(code))
+	}
+}
+
+// validate checks that the agent could run with cfg, for deployment
+// pipelines: the controller and worker must be reachable and a test
+// registration must succeed. It returns the process exit code.
+func validate(log *logger.CanonicalLogger, cfg *config.AgentConfig) int {
+	defer log.Close()
+
+	// The handler registers its routes on an app that is never started
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	h := handler.NewHandler(deps.App{Fiber: app, Logger: log}, cfg)
+
+	if err := h.ValidateConnectivity(context.Background()); err != nil {
+		log.WithError(err).Error("agent validation failed")
+		return 1
+	}
+	log.Info("agent validation passed")
+	return 0
 }
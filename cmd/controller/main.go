@@ -8,11 +8,7 @@ package main
 
 import (
 	"context"
-	"os"
-	"os/signal"
-	"syscall"
-
-	"golang.org/x/sync/errgroup"
+	"crypto/tls"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/recover"
@@ -24,9 +20,12 @@ import (
 	authentication "github.com/Alwanly/service-distribute-management/pkg/auth"
 	"github.com/Alwanly/service-distribute-management/pkg/database"
 	"github.com/Alwanly/service-distribute-management/pkg/deps"
+	"github.com/Alwanly/service-distribute-management/pkg/lock"
 	"github.com/Alwanly/service-distribute-management/pkg/logger"
 	"github.com/Alwanly/service-distribute-management/pkg/middleware"
 	"github.com/Alwanly/service-distribute-management/pkg/pubsub"
+	"github.com/Alwanly/service-distribute-management/pkg/shutdown"
+	"github.com/Alwanly/service-distribute-management/pkg/tracing"
 	swagger "github.com/gofiber/swagger"
 )
 
@@ -35,7 +34,7 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	defer log.Sync()
+	defer log.Close()
 
 	log.Info("starting controller service")
 
@@ -43,6 +42,9 @@ func main() {
 	if err != nil {
 		log.WithError(err).Fatal("failed to load configuration")
 	}
+	if err := cfg.Validate(); err != nil {
+		log.WithError(err).Fatal("invalid configuration")
+	}
 
 	log.Info("configuration loaded",
 		logger.String("server_addr", cfg.ServerAddr),
@@ -50,6 +52,15 @@ func main() {
 		logger.Duration("poll_interval", cfg.PollInterval),
 	)
 
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName: "controller",
+		Endpoint:    cfg.Tracing.Endpoint,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		log.WithError(err).Fatal("failed to initialize tracing")
+	}
+
 	auth := middleware.SetBasicAuth(&authentication.BasicAuthTConfig{
 		Username:      cfg.AgentUsername,
 		Password:      cfg.AgentPassword,
@@ -70,7 +81,7 @@ func main() {
 	}
 	log.Info("database migrations applied successfully")
 
-	if err := database.SeedInitialData(db); err != nil {
+	if err := database.SeedInitialData(db, cfg.DefaultConfig); err != nil {
 		log.WithError(err).Fatal("failed to seed initial data into database")
 	}
 
@@ -83,6 +94,7 @@ func main() {
 	app.Use(recover.New())
 	app.Use(requestid.New())
 	app.Use(middleware.CanonicalLoggerMiddleware(log))
+	app.Use(middleware.TracingMiddleware())
 
 	deps := deps.App{
 		Fiber:      app,
@@ -93,10 +105,11 @@ func main() {
 
 	if cfg.Redis != nil {
 		redisCfg := pubsub.RedisConfig{
-			Host:     cfg.Redis.Host,
-			Port:     cfg.Redis.Port,
-			Password: cfg.Redis.Password,
-			DB:       cfg.Redis.DB,
+			Host:          cfg.Redis.Host,
+			Port:          cfg.Redis.Port,
+			Password:      cfg.Redis.Password,
+			DB:            cfg.Redis.DB,
+			MessageBuffer: cfg.Redis.MessageBuffer,
 		}
 		redisPub, err := pubsub.NewRedisPubSub(redisCfg, log)
 		if err != nil {
@@ -105,6 +118,9 @@ func main() {
 				logger.String("mode", "poll-only"))
 		} else {
 			deps.Pub = redisPub
+			if p, ok := redisPub.(pubsub.RedisClientProvider); ok {
+				deps.Locker = lock.NewRedisLocker(p.RedisClient())
+			}
 			log.Info("Redis pub/sub initialized successfully",
 				logger.String("host", cfg.Redis.Host),
 				logger.Int("port", cfg.Redis.Port),
@@ -115,54 +131,64 @@ func main() {
 		log.Info("no Redis configuration provided; skipping pub/sub initialization")
 	}
 
-	handler.NewHandler(deps, cfg)
+	h := handler.NewHandler(deps, cfg)
 
 	app.Get("/swagger/*", swagger.HandlerDefault)
 
 	ctx, cancel := context.WithCancel(context.Background())
-	gErr, gCtx := errgroup.WithContext(ctx)
-
-	gErr.Go(func() error {
-		log.Info("controller service is running", logger.String("address", cfg.ServerAddr))
-		if err := app.Listen(cfg.ServerAddr); err != nil {
-			cancel()
-			return err
-		}
-		return nil
+	defer cancel()
+
+	go h.UseCase.WatchReload(ctx, func(next *config.ControllerConfig) {
+		mid.Basic.SetCredentials(&authentication.BasicAuthTConfig{
+			Username:      next.AgentUsername,
+			Password:      next.AgentPassword,
+			AdminUsername: next.AdminUsername,
+			AdminPassword: next.AdminPassword,
+		})
 	})
-
-	gErr.Go(func() error {
-		<-gCtx.Done()
-
-		if err := app.Shutdown(); err != nil {
-			log.WithError(err).Error("failed to shutdown fiber app")
-			return err
-		}
-
+	go h.UseCase.RunConfigPruner(ctx)
+
+	// Cleanups run in reverse order: stop serving first, publish the queued
+	// config notifications, then close the database and flush the remaining
+	// spans
+	sd := shutdown.New(log, shutdown.DefaultTimeout)
+	sd.Add("tracing", shutdownTracing)
+	sd.Add("database", func(ctx context.Context) error {
 		conn, err := db.DB()
 		if err != nil {
-			log.WithError(err).Error("failed to get database connection")
-			return err
-		}
-		if err := conn.Close(); err != nil {
-			log.WithError(err).Error("failed to close database")
 			return err
 		}
-
-		return nil
+		return conn.Close()
+	})
+	sd.Add("config notifications", h.UseCase.DrainNotifications)
+	sd.Add("http server", func(ctx context.Context) error {
+		return app.ShutdownWithContext(ctx)
 	})
 
 	go func() {
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
-		log.Info("listening for shutdown signals")
-		<-sigChan
-		log.Info("shutdown signal received")
-		cancel()
+		log.Info("controller service is running", logger.String("address", cfg.ServerAddr))
+		if err := app.Listen(cfg.ServerAddr); err != nil {
+			log.WithError(err).Error("controller listener stopped")
+			cancel()
+		}
 	}()
 
-	if err := gErr.Wait(); err != nil {
-		log.WithError(err).Fatal("controller service encountered an error")
+	if cfg.TLS != nil {
+		ln, err := tls.Listen("tcp", cfg.MTLSAddr, cfg.TLS)
+		if err != nil {
+			log.WithError(err).Fatal("failed to start mTLS listener")
+		}
+		go func() {
+			log.Info("controller mTLS listener is running", logger.String("address", cfg.MTLSAddr))
+			if err := app.Listener(ln); err != nil {
+				log.WithError(err).Error("controller mTLS listener stopped")
+				cancel()
+			}
+		}()
+	}
+
+	if err := sd.Wait(ctx); err != nil {
+		log.WithError(err).Fatal("controller service did not shut down cleanly")
 	}
 
 	log.Info("controller service stopped gracefully")
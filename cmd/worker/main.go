@@ -7,10 +7,6 @@ package main
 
 import (
 	"context"
-	"os"
-	"os/signal"
-	"syscall"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/recover"
@@ -22,6 +18,8 @@ import (
 	"github.com/Alwanly/service-distribute-management/pkg/deps"
 	"github.com/Alwanly/service-distribute-management/pkg/logger"
 	"github.com/Alwanly/service-distribute-management/pkg/middleware"
+	"github.com/Alwanly/service-distribute-management/pkg/shutdown"
+	"github.com/Alwanly/service-distribute-management/pkg/tracing"
 	swagger "github.com/gofiber/swagger"
 )
 
@@ -30,20 +28,35 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	defer log.Sync()
+	defer log.Close()
 
 	log.Info("Starting Worker Service...")
 
 	cfg, err := config.LoadWorkerConfig()
 	if err != nil {
-		log.Fatal("Failed to load configuration")
+		log.WithError(err).Fatal("failed to load configuration")
+	}
+	if err := cfg.Validate(); err != nil {
+		log.WithError(err).Fatal("invalid configuration")
 	}
 
 	log.Info("configuration loaded",
 		logger.String("server_addr", cfg.ServerAddr),
 		logger.Duration("request_timeout", cfg.RequestTimeout),
+		logger.Int("hit_history_size", cfg.HitHistorySize),
+		logger.Int("max_in_flight", cfg.MaxInFlight),
+		logger.Duration("queue_timeout", cfg.QueueTimeout),
 	)
 
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName: "worker",
+		Endpoint:    cfg.Tracing.Endpoint,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		log.WithError(err).Fatal("failed to initialize tracing")
+	}
+
 	app := fiber.New(fiber.Config{
 		AppName:               "Worker Service",
 		DisableStartupMessage: true,
@@ -53,13 +66,14 @@ func main() {
 	app.Use(recover.New())
 	app.Use(requestid.New())
 	app.Use(middleware.CanonicalLoggerMiddleware(log))
+	app.Use(middleware.TracingMiddleware())
 
 	dependencies := deps.App{
 		Fiber:  app,
 		Logger: log,
 	}
 
-	handler.NewHandler(dependencies, cfg.RequestTimeout)
+	h := handler.NewHandler(dependencies, cfg)
 
 	app.Get("/swagger/*", swagger.HandlerDefault)
 
@@ -68,25 +82,37 @@ func main() {
 		logger.Duration("request_timeout", cfg.RequestTimeout),
 	)
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Cleanups run in reverse order: stop collecting, stop serving (letting
+	// in-flight proxy requests drain, then cancelling the rest so slow
+	// upstreams don't hold the server open), then flush the remaining spans
+	sd := shutdown.New(log, shutdown.DefaultTimeout)
+	sd.Add("tracing", shutdownTracing)
+	sd.Add("http server", func(ctx context.Context) error {
+		return h.Shutdown(ctx, app)
+	})
+
+	// Collect mode runs in the background and idles until a config enables it
+	collectCtx, stopCollector := context.WithCancel(context.Background())
+	go h.UseCase.RunCollector(collectCtx, log)
+	sd.Add("collector", func(context.Context) error {
+		stopCollector()
+		return nil
+	})
+
 	go func() {
 		addr := cfg.ServerAddr
 		log.Info("Worker Service starting", logger.String("address", addr))
 		if err := app.Listen(addr); err != nil {
-			log.Fatal("Failed to start server")
+			log.WithError(err).Error("Worker Service listener stopped")
+			cancel()
 		}
 	}()
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	log.Info("Shutting down Worker Service...")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	if err := app.ShutdownWithContext(ctx); err != nil {
-		log.Error("Server forced to shutdown")
+	if err := sd.Wait(ctx); err != nil {
+		log.WithError(err).Error("Server forced to shutdown")
 	}
 
 	log.Info("Worker Service stopped")
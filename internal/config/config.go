@@ -1,25 +1,110 @@
 package config
 
 import (
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"os"
-	"strconv"
+	"strings"
 	"time"
+
+	"github.com/Alwanly/service-distribute-management/pkg/httpclient"
+	"github.com/Alwanly/service-distribute-management/pkg/httpurl"
+	"github.com/Alwanly/service-distribute-management/pkg/pubsub"
+	"github.com/Alwanly/service-distribute-management/pkg/tlsconfig"
 )
 
 type ControllerConfig struct {
-	ServerAddr    string
-	DatabasePath  string
-	PollInterval  time.Duration
-	AdminUsername string
-	AdminPassword string
-	AgentUsername string
-	AgentPassword string
-	Redis         *RedisConfig
+	ServerAddr   string
+	DatabasePath string
+	PollInterval time.Duration
+	// PollIntervalJitter spreads agents' default poll intervals over a band of
+	// ±PollIntervalJitter*PollInterval so they do not poll in lockstep.
+	PollIntervalJitter float64
+	// FetchQuotaPerInterval is how many config fetches an agent may make per
+	// poll interval before getting 429. Zero disables the quota.
+	FetchQuotaPerInterval int
+	AdminUsername         string
+	AdminPassword         string
+	AgentUsername         string
+	AgentPassword         string
+	Redis                 *RedisConfig
+	// MTLSAddr, when set, starts a second listener that requires agents to
+	// present a client certificate signed by TLSClientCAFile
+	MTLSAddr        string
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSClientCAFile string
+	// TLS is built from the files above when MTLSAddr is set
+	TLS *tls.Config
+	// DefaultConfig is the worker config JSON seeded at startup when the
+	// database has no default configuration yet; empty seeds "{}"
+	DefaultConfig string
+	// DebugEvents publishes agent-targeted diagnostics on the agent-debug
+	// Redis channel
+	DebugEvents bool
+	// HeartbeatLateAfter is the heartbeat gap reported as a heartbeat_late
+	// debug event
+	HeartbeatLateAfter time.Duration
+	// AgentOfflineAfter is how long after its last heartbeat an agent counts
+	// as offline; between HeartbeatLateAfter and this it is stale
+	AgentOfflineAfter time.Duration
+	// HeartbeatHistoryRetention is how long each heartbeat is kept in the
+	// agent heartbeat history before it is pruned
+	HeartbeatHistoryRetention time.Duration
+	// MaxConfigBytes caps the serialized size of a stored config; zero
+	// disables the limit
+	MaxConfigBytes int
+	// ConfigRetentionKeep and ConfigRetentionMaxAge are the default
+	// retention policy for config versions: a version is kept while it is
+	// one of the newest ConfigRetentionKeep of its profile or younger than
+	// ConfigRetentionMaxAge. Zero disables either rule.
+	ConfigRetentionKeep   int
+	ConfigRetentionMaxAge time.Duration
+	// ConfigPruneInterval is how often the retention policy is applied in
+	// the background; zero leaves pruning to POST /admin/config/prune
+	ConfigPruneInterval time.Duration
+	// IdempotencyKeyTTL is how long the result of a config mutation sent
+	// with an Idempotency-Key is replayed for a repeat of that key; zero
+	// ignores the header
+	IdempotencyKeyTTL time.Duration
+	Tracing           TracingConfig
+
+	// problems are settings that could not be parsed
+	problems []string
 }
 
+// DefaultMaxConfigBytes is the config size limit when CONFIG_MAX_BYTES is unset
+const DefaultMaxConfigBytes = 64 * 1024
+
 type WorkerConfig struct {
 	ServerAddr     string
 	RequestTimeout time.Duration
+	// HitHistorySize is how many recent /hit outcomes are kept for
+	// GET /debug/hits; 0 disables the history
+	HitHistorySize int
+	// MaxInFlight caps concurrent outbound /hit requests; 0 means unlimited
+	MaxInFlight int
+	// QueueTimeout is how long a /hit waits for a free slot before it is
+	// rejected with 429; 0 rejects immediately when the limit is reached
+	QueueTimeout time.Duration
+	// CollectResultsSize is how many collect mode results GET /results keeps
+	CollectResultsSize int
+	// DisableKeepAlives opens a new connection for every direct /hit
+	DisableKeepAlives bool
+	// ProxyKeepAlives reuses connections through configured proxies; off by
+	// default so rotating proxies hand out a fresh exit per request
+	ProxyKeepAlives bool
+	// MaxIdleConnsPerHost bounds idle connections kept per upstream host
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout is how long an idle connection is kept for reuse
+	IdleConnTimeout time.Duration
+	// AllowedHosts lists the target hosts configs may point at: an exact
+	// hostname, or *.domain for any of its subdomains. Empty allows all.
+	AllowedHosts []string
+	Tracing      TracingConfig
+
+	problems []string
 }
 
 type AgentConfig struct {
@@ -29,170 +114,245 @@ type AgentConfig struct {
 	RequestTimeout time.Duration
 	AgentUsername  string
 	AgentPassword  string
-	AgentAddr      string
-	Redis          *RedisConfig
-	Heartbeat      HeartbeatConfig
-	FallbackPoll   FallbackPollConfig
+	// BootstrapToken, when set, is used for registration instead of the
+	// shared AgentUsername/AgentPassword credentials
+	BootstrapToken string
+	// Metadata is reported at registration so the controller can evaluate
+	// config match rules, e.g. region=us-east
+	Metadata  map[string]string
+	AgentAddr string
+	Redis     *RedisConfig
+	Heartbeat HeartbeatConfig
 	// Registration retry configuration
 	RegistrationMaxRetries        int
 	RegistrationInitialBackoff    time.Duration
 	RegistrationMaxBackoff        time.Duration
 	RegistrationBackoffMultiplier float64
+	// RegistrationTimeout bounds the total time spent registering, across
+	// all retries. Zero disables the deadline.
+	RegistrationTimeout time.Duration
+	// RegistrationFailedExitAfter makes an agent whose registration failed,
+	// with no cached config to run from, exit after this long. Until then it
+	// stays up so /health reports the failure. Zero keeps it running.
+	RegistrationFailedExitAfter time.Duration
+	// HealthProbeCacheTTL is how long /health?deep=true reuses dependency probe results
+	HealthProbeCacheTTL time.Duration
+	// TLSCertFile and TLSKeyFile are the client certificate presented to the
+	// controller; TLSCAFile optionally pins the CA that signed the controller's
+	// certificate
+	TLSCertFile string
+	TLSKeyFile  string
+	TLSCAFile   string
+	// TLS is built from the files above when TLSCertFile is set
+	TLS *tls.Config
 	// Hostname used for registration
 	Hostname string
+	// Version is the agent build reported at registration; set by the agent
+	// binary, not the environment
+	Version string
+	// DebugEvents subscribes to controller diagnostics addressed to this
+	// agent and logs them
+	DebugEvents bool
+	// WorkerForwardingDisabled runs the agent without a worker: configs are
+	// fetched and stored but never forwarded. WorkerURL is empty when set.
+	WorkerForwardingDisabled bool
+	// ConfigCachePath is where the last config received from the controller
+	// is saved, so the agent can serve it to the worker when it starts while
+	// the controller is unreachable. Empty disables the cache.
+	ConfigCachePath string
+	Tracing         TracingConfig
+	// WorkerPreflight is what the agent does when the worker's /health is
+	// unreachable at startup: WorkerPreflightWarn, WorkerPreflightFail or
+	// WorkerPreflightOff
+	WorkerPreflight string
+	// ValidateOnly makes the agent check its settings and connectivity, then
+	// exit instead of starting. The --validate flag sets it too.
+	ValidateOnly bool
+	// RetryableStatusCodes are the controller and worker responses the
+	// agent's retried calls (registration, heartbeats, worker forwards) try
+	// again; other statuses fail at once. Errors without a response are
+	// always retried.
+	RetryableStatusCodes []int
+
+	problems []string
 }
 
+// Agent startup behaviors when the worker is unreachable (AGENT_WORKER_PREFLIGHT)
+const (
+	WorkerPreflightWarn = "warn"
+	WorkerPreflightFail = "fail"
+	WorkerPreflightOff  = "off"
+)
+
 // RedisConfig holds Redis connection configuration
 type RedisConfig struct {
 	Host     string
 	Port     int
 	Password string
 	DB       int
+	// MessageBuffer is how many received push notifications wait for the
+	// subscriber before the oldest is dropped
+	MessageBuffer int
 }
 
 type HeartbeatConfig struct {
 	Enabled  bool
 	Interval time.Duration
+	// MaxRetries is how many times a failed heartbeat is retried within the
+	// interval before it counts as missed
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry; it doubles per retry
+	RetryBackoff time.Duration
 }
 
-type FallbackPollConfig struct {
-	Enabled  bool
-	Interval time.Duration
+// TracingConfig controls OpenTelemetry trace export
+type TracingConfig struct {
+	// Endpoint is the collector's OTLP/HTTP URL, e.g.
+	// http://otel-collector:4318. Empty disables export; trace context is
+	// still propagated.
+	Endpoint string
+	// SampleRatio is the fraction of new traces recorded
+	SampleRatio float64
 }
 
 // LoadControllerConfig reads controller config from environment or returns defaults
 func LoadControllerConfig() (*ControllerConfig, error) {
-	poll := 5 * time.Second
-	if v := os.Getenv("POLL_INTERVAL"); v != "" {
-		if i, err := strconv.Atoi(v); err == nil {
-			poll = time.Duration(i) * time.Second
-		}
+	src, err := loadSource()
+	if err != nil {
+		return nil, err
 	}
 
 	cfg := &ControllerConfig{
-		ServerAddr:    envOrDefault("CONTROLLER_ADDR", ":8080"),
-		DatabasePath:  envOrDefault("DATABASE_PATH", "./data/data.db"),
-		PollInterval:  poll,
-		AdminUsername: envOrDefault("ADMIN_USER", "admin"),
-		AdminPassword: envOrDefault("ADMIN_PASSWORD", "password"),
-		AgentUsername: envOrDefault("AGENT_USER", "agent"),
-		AgentPassword: envOrDefault("AGENT_PASSWORD", "agentpass"),
+		ServerAddr:                src.getOr("CONTROLLER_ADDR", ":8080"),
+		DatabasePath:              src.getOr("DATABASE_PATH", "./data/data.db"),
+		PollInterval:              src.seconds("POLL_INTERVAL", 5*time.Second),
+		PollIntervalJitter:        src.float("POLL_INTERVAL_JITTER", 0.1),
+		FetchQuotaPerInterval:     src.int("FETCH_QUOTA_PER_INTERVAL", 2),
+		AdminUsername:             src.getOr("ADMIN_USER", "admin"),
+		AdminPassword:             src.getOr("ADMIN_PASSWORD", "password"),
+		AgentUsername:             src.getOr("AGENT_USER", "agent"),
+		AgentPassword:             src.getOr("AGENT_PASSWORD", "agentpass"),
+		MTLSAddr:                  src.get("CONTROLLER_MTLS_ADDR"),
+		TLSCertFile:               src.get("CONTROLLER_TLS_CERT"),
+		TLSKeyFile:                src.get("CONTROLLER_TLS_KEY"),
+		TLSClientCAFile:           src.get("CONTROLLER_TLS_CLIENT_CA"),
+		DefaultConfig:             src.get("DEFAULT_CONFIG"),
+		DebugEvents:               src.bool("CONTROLLER_DEBUG_EVENTS", false),
+		HeartbeatLateAfter:        src.seconds("HEARTBEAT_LATE_AFTER", 90*time.Second),
+		AgentOfflineAfter:         src.seconds("AGENT_OFFLINE_AFTER", 5*time.Minute),
+		HeartbeatHistoryRetention: src.seconds("HEARTBEAT_HISTORY_RETENTION", 7*24*time.Hour),
+		MaxConfigBytes:            src.int("CONFIG_MAX_BYTES", DefaultMaxConfigBytes),
+		ConfigRetentionKeep:       src.int("CONFIG_RETENTION_KEEP", 0),
+		ConfigRetentionMaxAge:     src.seconds("CONFIG_RETENTION_MAX_AGE", 0),
+		ConfigPruneInterval:       src.seconds("CONFIG_PRUNE_INTERVAL", 0),
+		IdempotencyKeyTTL:         src.seconds("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+	}
+	if path := src.get("DEFAULT_CONFIG_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read DEFAULT_CONFIG_FILE: %w", err)
+		}
+		cfg.DefaultConfig = string(b)
 	}
 
-	cfg.Redis = LoadRedisConfig()
+	cfg.Redis = loadRedisConfig(src)
+	cfg.Tracing = loadTracingConfig(src)
+	cfg.problems = src.problems
+
+	if cfg.MTLSAddr != "" {
+		tlsCfg, err := tlsconfig.ServerConfig(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mTLS configuration: %w", err)
+		}
+		cfg.TLS = tlsCfg
+	}
 
 	return cfg, nil
 }
 
 // LoadWorkerConfig reads worker config from environment or returns defaults
 func LoadWorkerConfig() (*WorkerConfig, error) {
-	reqTimeout := 10 * time.Second
-	if v := os.Getenv("REQUEST_TIMEOUT"); v != "" {
-		if i, err := strconv.Atoi(v); err == nil {
-			reqTimeout = time.Duration(i) * time.Second
-		}
+	src, err := loadSource()
+	if err != nil {
+		return nil, err
 	}
 
-	return &WorkerConfig{
-		ServerAddr:     envOrDefault("WORKER_ADDR", ":8082"),
-		RequestTimeout: reqTimeout,
-	}, nil
+	cfg := &WorkerConfig{
+		ServerAddr:          src.getOr("WORKER_ADDR", ":8082"),
+		RequestTimeout:      src.seconds("REQUEST_TIMEOUT", 10*time.Second),
+		HitHistorySize:      src.int("WORKER_HIT_HISTORY_SIZE", 0),
+		MaxInFlight:         src.int("WORKER_MAX_IN_FLIGHT", 0),
+		QueueTimeout:        src.seconds("WORKER_QUEUE_TIMEOUT", 0),
+		CollectResultsSize:  src.int("WORKER_COLLECT_RESULTS_SIZE", 100),
+		DisableKeepAlives:   src.bool("WORKER_DISABLE_KEEP_ALIVES", false),
+		ProxyKeepAlives:     src.bool("WORKER_PROXY_KEEP_ALIVES", false),
+		MaxIdleConnsPerHost: src.int("WORKER_MAX_IDLE_CONNS_PER_HOST", 10),
+		IdleConnTimeout:     src.seconds("WORKER_IDLE_CONN_TIMEOUT", 90*time.Second),
+		AllowedHosts:        parseList(src.getOr("WORKER_ALLOWED_HOSTS", "")),
+		Tracing:             loadTracingConfig(src),
+	}
+	cfg.problems = src.problems
+	return cfg, nil
 }
 
 // LoadAgentConfig reads agent config from environment or returns defaults
 func LoadAgentConfig() (*AgentConfig, error) {
-	poll := 5 * time.Second
-	if v := os.Getenv("POLL_INTERVAL"); v != "" {
-		if i, err := strconv.Atoi(v); err == nil {
-			poll = time.Duration(i) * time.Second
-		}
-	}
-
-	reqTimeout := 10 * time.Second
-	if v := os.Getenv("REQUEST_TIMEOUT"); v != "" {
-		if i, err := strconv.Atoi(v); err == nil {
-			reqTimeout = time.Duration(i) * time.Second
-		}
-	}
-
-	maxRetries := 5
-	if v := os.Getenv("REGISTRATION_MAX_RETRIES"); v != "" {
-		if i, err := strconv.Atoi(v); err == nil {
-			maxRetries = i
-		}
+	src, err := loadSource()
+	if err != nil {
+		return nil, err
 	}
 
-	initialBackoff := 1 * time.Second
-	if v := os.Getenv("REGISTRATION_INITIAL_BACKOFF"); v != "" {
-		if i, err := strconv.Atoi(v); err == nil {
-			initialBackoff = time.Duration(i) * time.Second
-		}
+	cfg := &AgentConfig{
+		AgentAddr:                     src.getOr("AGENT_ADDR", ":8081"),
+		ControllerURL:                 src.getOr("CONTROLLER_URL", "http://localhost:8080"),
+		WorkerURL:                     src.getOr("WORKER_URL", "http://localhost:8082"),
+		PollInterval:                  src.seconds("POLL_INTERVAL", 5*time.Second),
+		RequestTimeout:                src.seconds("REQUEST_TIMEOUT", 10*time.Second),
+		AgentUsername:                 src.getOr("AGENT_USER", "agent"),
+		AgentPassword:                 src.getOr("AGENT_PASSWORD", "agentpass"),
+		BootstrapToken:                src.get("AGENT_BOOTSTRAP_TOKEN"),
+		Metadata:                      parseKeyValues(src.get("AGENT_METADATA")),
+		RegistrationMaxRetries:        src.int("REGISTRATION_MAX_RETRIES", 5),
+		RegistrationInitialBackoff:    src.seconds("REGISTRATION_INITIAL_BACKOFF", time.Second),
+		RegistrationMaxBackoff:        src.seconds("REGISTRATION_MAX_BACKOFF", 30*time.Second),
+		RegistrationBackoffMultiplier: src.float("REGISTRATION_BACKOFF_MULTIPLIER", 2.0),
+		RegistrationTimeout:           src.seconds("REGISTRATION_TIMEOUT", 5*time.Minute),
+		RegistrationFailedExitAfter:   src.seconds("REGISTRATION_FAILED_EXIT_AFTER", 0),
+		HealthProbeCacheTTL:           src.seconds("HEALTH_PROBE_CACHE_TTL", 5*time.Second),
+		TLSCertFile:                   src.get("AGENT_TLS_CERT"),
+		TLSKeyFile:                    src.get("AGENT_TLS_KEY"),
+		TLSCAFile:                     src.get("AGENT_TLS_CA"),
+		Hostname:                      src.get("AGENT_HOSTNAME"),
+		DebugEvents:                   src.bool("AGENT_DEBUG_EVENTS", false),
+		WorkerForwardingDisabled:      src.bool("WORKER_FORWARDING_DISABLED", false),
+		ConfigCachePath:               src.get("AGENT_CONFIG_CACHE"),
+		WorkerPreflight:               src.getOr("AGENT_WORKER_PREFLIGHT", WorkerPreflightWarn),
+		ValidateOnly:                  src.bool("AGENT_VALIDATE_ONLY", false),
+		RetryableStatusCodes:          src.ints("AGENT_RETRYABLE_STATUS_CODES", httpclient.DefaultRetryableStatusCodes),
 	}
 
-	maxBackoff := 30 * time.Second
-	if v := os.Getenv("REGISTRATION_MAX_BACKOFF"); v != "" {
-		if i, err := strconv.Atoi(v); err == nil {
-			maxBackoff = time.Duration(i) * time.Second
-		}
+	if cfg.WorkerForwardingDisabled {
+		cfg.WorkerURL = ""
 	}
 
-	multiplier := 2.0
-	if v := os.Getenv("REGISTRATION_BACKOFF_MULTIPLIER"); v != "" {
-		if f, err := strconv.ParseFloat(v, 64); err == nil {
-			multiplier = f
+	if cfg.TLSCertFile != "" {
+		tlsCfg, err := tlsconfig.ClientConfig(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TLS client configuration: %w", err)
 		}
+		cfg.TLS = tlsCfg
 	}
 
-	cfg := &AgentConfig{
-		AgentAddr:                     envOrDefault("AGENT_ADDR", ":8081"),
-		ControllerURL:                 envOrDefault("CONTROLLER_URL", "http://localhost:8080"),
-		WorkerURL:                     envOrDefault("WORKER_URL", "http://localhost:8082"),
-		PollInterval:                  poll,
-		RequestTimeout:                reqTimeout,
-		AgentUsername:                 envOrDefault("AGENT_USER", "agent"),
-		AgentPassword:                 envOrDefault("AGENT_PASSWORD", "agentpass"),
-		RegistrationMaxRetries:        maxRetries,
-		RegistrationInitialBackoff:    initialBackoff,
-		RegistrationMaxBackoff:        maxBackoff,
-		RegistrationBackoffMultiplier: multiplier,
-		Hostname:                      os.Getenv("AGENT_HOSTNAME"),
-	}
-
-	cfg.Redis = LoadRedisConfig()
-
-	// Heartbeat defaults
-	hbEnabled := true
-	if v := os.Getenv("AGENT_HEARTBEAT_ENABLED"); v != "" {
-		if b, err := strconv.ParseBool(v); err == nil {
-			hbEnabled = b
-		}
-	}
-	hbInterval := 30 * time.Second
-	if v := os.Getenv("AGENT_HEARTBEAT_INTERVAL"); v != "" {
-		if d, err := time.ParseDuration(v); err == nil {
-			hbInterval = d
-		} else if i, err := strconv.Atoi(v); err == nil {
-			hbInterval = time.Duration(i) * time.Second
-		}
-	}
-	cfg.Heartbeat = HeartbeatConfig{Enabled: hbEnabled, Interval: hbInterval}
+	cfg.Redis = loadRedisConfig(src)
+	cfg.Tracing = loadTracingConfig(src)
 
-	// Fallback poll defaults
-	fbEnabled := true
-	if v := os.Getenv("AGENT_FALLBACK_POLL_ENABLED"); v != "" {
-		if b, err := strconv.ParseBool(v); err == nil {
-			fbEnabled = b
-		}
+	cfg.Heartbeat = HeartbeatConfig{
+		Enabled:      src.bool("AGENT_HEARTBEAT_ENABLED", true),
+		Interval:     src.duration("AGENT_HEARTBEAT_INTERVAL", 30*time.Second),
+		MaxRetries:   src.int("AGENT_HEARTBEAT_MAX_RETRIES", 2),
+		RetryBackoff: src.duration("AGENT_HEARTBEAT_RETRY_BACKOFF", time.Second),
 	}
-	fbInterval := 60 * time.Second
-	if v := os.Getenv("AGENT_FALLBACK_POLL_INTERVAL"); v != "" {
-		if d, err := time.ParseDuration(v); err == nil {
-			fbInterval = d
-		} else if i, err := strconv.Atoi(v); err == nil {
-			fbInterval = time.Duration(i) * time.Second
-		}
-	}
-	cfg.FallbackPoll = FallbackPollConfig{Enabled: fbEnabled, Interval: fbInterval}
+	cfg.problems = src.problems
 
 	if cfg.Hostname == "" {
 		if hn, err := os.Hostname(); err == nil {
@@ -205,33 +365,66 @@ func LoadAgentConfig() (*AgentConfig, error) {
 	return cfg, nil
 }
 
-// LoadRedisConfig loads Redis configuration from environment variables
-func LoadRedisConfig() *RedisConfig {
-	port := 6379
-	if v := os.Getenv("REDIS_PORT"); v != "" {
-		if p, err := strconv.Atoi(v); err == nil {
-			port = p
-		}
+// ValidateWorkerURL checks that raw is an absolute http(s) URL the agent can
+// forward configs to
+func ValidateWorkerURL(raw string) error {
+	if strings.TrimSpace(raw) == "" {
+		return errors.New("WORKER_URL is empty; set WORKER_FORWARDING_DISABLED=true to run without a worker")
 	}
+	return validateHTTPURL("WORKER_URL", raw)
+}
 
-	db := 0
-	if v := os.Getenv("REDIS_DB"); v != "" {
-		if d, err := strconv.Atoi(v); err == nil {
-			db = d
-		}
+// validateHTTPURL checks that raw is an absolute http or https URL
+func validateHTTPURL(key, raw string) error {
+	if _, err := httpurl.Parse(raw); err != nil {
+		return fmt.Errorf("invalid %s %q: %w", key, raw, err)
 	}
+	return nil
+}
 
+// loadRedisConfig loads Redis configuration from environment variables and CONFIG_FILE
+func loadRedisConfig(src *source) *RedisConfig {
 	return &RedisConfig{
-		Host:     envOrDefault("REDIS_HOST", "localhost"),
-		Port:     port,
-		Password: envOrDefault("REDIS_PASSWORD", ""),
-		DB:       db,
+		Host:          src.getOr("REDIS_HOST", "localhost"),
+		Port:          src.int("REDIS_PORT", 6379),
+		Password:      src.getOr("REDIS_PASSWORD", ""),
+		DB:            src.int("REDIS_DB", 0),
+		MessageBuffer: src.int("REDIS_MESSAGE_BUFFER", pubsub.DefaultMessageBuffer),
+	}
+}
+
+// loadTracingConfig loads trace export configuration
+func loadTracingConfig(src *source) TracingConfig {
+	return TracingConfig{
+		Endpoint:    src.get("TRACING_OTLP_ENDPOINT"),
+		SampleRatio: src.float("TRACING_SAMPLE_RATIO", 1),
 	}
 }
 
-func envOrDefault(key, def string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
+// parseList parses "a,b" into its non-empty, trimmed items
+func parseList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// parseKeyValues parses "k1=v1,k2=v2" into a map, skipping malformed pairs
+func parseKeyValues(s string) map[string]string {
+	if s == "" {
+		return nil
+	}
+	out := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		out[key] = strings.TrimSpace(value)
 	}
-	return def
+	return out
 }
@@ -0,0 +1,375 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateWorkerURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr string
+	}{
+		{name: "http", raw: "http://worker:8082"},
+		{name: "https with path", raw: "https://worker.example/api"},
+		{name: "empty", raw: "", wantErr: "WORKER_FORWARDING_DISABLED"},
+		{name: "blank", raw: "  ", wantErr: "empty"},
+		{name: "missing scheme", raw: "worker:8082", wantErr: "scheme"},
+		{name: "unsupported scheme", raw: "ftp://worker", wantErr: "scheme"},
+		{name: "missing host", raw: "http://", wantErr: "missing host"},
+		{name: "malformed", raw: "http://[::1", wantErr: "invalid WORKER_URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateWorkerURL(tt.raw)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidateWorkerURL(%q) = %v, want nil", tt.raw, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ValidateWorkerURL(%q) = %v, want error containing %q", tt.raw, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadAgentConfig_WorkerURL(t *testing.T) {
+	t.Setenv("WORKER_URL", "not a url")
+	cfg, err := LoadAgentConfig()
+	if err != nil {
+		t.Fatalf("LoadAgentConfig: %v", err)
+	}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "WORKER_URL") {
+		t.Fatalf("expected a malformed WORKER_URL to fail validation, got %v", err)
+	}
+
+	t.Setenv("WORKER_FORWARDING_DISABLED", "true")
+	cfg, err = LoadAgentConfig()
+	if err != nil {
+		t.Fatalf("LoadAgentConfig with forwarding disabled: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate with forwarding disabled: %v", err)
+	}
+	if !cfg.WorkerForwardingDisabled || cfg.WorkerURL != "" {
+		t.Errorf("got disabled=%v worker_url=%q, want forwarding disabled and no worker URL", cfg.WorkerForwardingDisabled, cfg.WorkerURL)
+	}
+}
+
+func TestLoadControllerConfig_MaxConfigBytes(t *testing.T) {
+	cfg, err := LoadControllerConfig()
+	if err != nil {
+		t.Fatalf("LoadControllerConfig: %v", err)
+	}
+	if cfg.MaxConfigBytes != DefaultMaxConfigBytes {
+		t.Fatalf("MaxConfigBytes = %d, want default %d", cfg.MaxConfigBytes, DefaultMaxConfigBytes)
+	}
+
+	t.Setenv("CONFIG_MAX_BYTES", "0")
+	if cfg, _ = LoadControllerConfig(); cfg.MaxConfigBytes != 0 {
+		t.Fatalf("MaxConfigBytes = %d, want 0 (disabled)", cfg.MaxConfigBytes)
+	}
+
+	t.Setenv("CONFIG_MAX_BYTES", "-5")
+	if cfg, _ = LoadControllerConfig(); cfg.Validate() == nil {
+		t.Fatal("expected a negative CONFIG_MAX_BYTES to fail validation")
+	}
+}
+
+func writeConfigFile(t *testing.T, name, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+}
+
+func TestLoadControllerConfig_Precedence(t *testing.T) {
+	writeConfigFile(t, "controller.yaml", `
+poll_interval: 20
+fetch_quota_per_interval: 7
+ADMIN_USER: file-admin
+redis:
+  host: file-redis
+  port: 6380
+`)
+	// Environment overrides only some of the file values
+	t.Setenv("POLL_INTERVAL", "40")
+	t.Setenv("REDIS_HOST", "env-redis")
+
+	cfg, err := LoadControllerConfig()
+	if err != nil {
+		t.Fatalf("LoadControllerConfig: %v", err)
+	}
+
+	if cfg.PollInterval != 40*time.Second {
+		t.Errorf("PollInterval = %s, want env value 40s", cfg.PollInterval)
+	}
+	if cfg.FetchQuotaPerInterval != 7 {
+		t.Errorf("FetchQuotaPerInterval = %d, want file value 7", cfg.FetchQuotaPerInterval)
+	}
+	if cfg.AdminUsername != "file-admin" {
+		t.Errorf("AdminUsername = %q, want file value", cfg.AdminUsername)
+	}
+	if cfg.Redis.Host != "env-redis" || cfg.Redis.Port != 6380 {
+		t.Errorf("Redis = %s:%d, want env host and file port", cfg.Redis.Host, cfg.Redis.Port)
+	}
+	if cfg.AgentUsername != "agent" || cfg.PollIntervalJitter != 0.1 {
+		t.Errorf("unset values should keep defaults, got agent user %q jitter %v", cfg.AgentUsername, cfg.PollIntervalJitter)
+	}
+}
+
+func TestLoadAgentConfig_JSONFile(t *testing.T) {
+	writeConfigFile(t, "agent.json", `{
+		"worker_url": "http://file-worker:8082",
+		"request_timeout": 3,
+		"agent_metadata": {"region": "eu", "os": "linux"}
+	}`)
+	t.Setenv("REQUEST_TIMEOUT", "")
+
+	cfg, err := LoadAgentConfig()
+	if err != nil {
+		t.Fatalf("LoadAgentConfig: %v", err)
+	}
+	if cfg.WorkerURL != "http://file-worker:8082" {
+		t.Errorf("WorkerURL = %q, want file value", cfg.WorkerURL)
+	}
+	// An empty environment variable does not hide the file value
+	if cfg.RequestTimeout != 3*time.Second {
+		t.Errorf("RequestTimeout = %s, want 3s", cfg.RequestTimeout)
+	}
+	if cfg.Metadata["region"] != "eu" || cfg.Metadata["os"] != "linux" {
+		t.Errorf("Metadata = %v, want map from file", cfg.Metadata)
+	}
+}
+
+func TestLoadWorkerConfig_BadConfigFile(t *testing.T) {
+	writeConfigFile(t, "worker.yaml", "request_timeout: [unclosed")
+	if _, err := LoadWorkerConfig(); err == nil || !strings.Contains(err.Error(), "CONFIG_FILE") {
+		t.Fatalf("expected a CONFIG_FILE parse error, got %v", err)
+	}
+
+	t.Setenv("CONFIG_FILE", filepath.Join(t.TempDir(), "missing.yaml"))
+	if _, err := LoadWorkerConfig(); err == nil {
+		t.Fatal("expected an error for a missing CONFIG_FILE")
+	}
+}
+
+func TestValidate_Defaults(t *testing.T) {
+	controller, err := LoadControllerConfig()
+	if err != nil {
+		t.Fatalf("LoadControllerConfig: %v", err)
+	}
+	worker, err := LoadWorkerConfig()
+	if err != nil {
+		t.Fatalf("LoadWorkerConfig: %v", err)
+	}
+	agent, err := LoadAgentConfig()
+	if err != nil {
+		t.Fatalf("LoadAgentConfig: %v", err)
+	}
+
+	for name, cfg := range map[string]interface{ Validate() error }{
+		"controller": controller,
+		"worker":     worker,
+		"agent":      agent,
+	} {
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("%s defaults: %v", name, err)
+		}
+	}
+}
+
+func TestValidate_ReportsEveryProblem(t *testing.T) {
+	tests := []struct {
+		name    string
+		load    func() (interface{ Validate() error }, error)
+		env     map[string]string
+		wantErr []string
+	}{
+		{
+			name: "controller",
+			load: func() (interface{ Validate() error }, error) { return LoadControllerConfig() },
+			env: map[string]string{
+				"POLL_INTERVAL":            "soon",
+				"POLL_INTERVAL_JITTER":     "1.5",
+				"FETCH_QUOTA_PER_INTERVAL": "-1",
+				"HEARTBEAT_LATE_AFTER":     "0",
+				"AGENT_OFFLINE_AFTER":      "-3",
+				"CONTROLLER_DEBUG_EVENTS":  "maybe",
+				"CONFIG_MAX_BYTES":         "-1",
+				"CONFIG_RETENTION_KEEP":    "-2",
+				"CONFIG_PRUNE_INTERVAL":    "3600",
+				"IDEMPOTENCY_KEY_TTL":      "-1",
+				"REDIS_PORT":               "70000",
+				"REDIS_DB":                 "x",
+				"REDIS_MESSAGE_BUFFER":     "0",
+			},
+			wantErr: []string{
+				`POLL_INTERVAL="soon"`, "POLL_INTERVAL_JITTER", "FETCH_QUOTA_PER_INTERVAL",
+				"HEARTBEAT_LATE_AFTER", "AGENT_OFFLINE_AFTER", `CONTROLLER_DEBUG_EVENTS="maybe"`,
+				"CONFIG_MAX_BYTES", "CONFIG_RETENTION_KEEP", "CONFIG_PRUNE_INTERVAL needs", "IDEMPOTENCY_KEY_TTL",
+				"REDIS_PORT", `REDIS_DB="x"`, "REDIS_MESSAGE_BUFFER",
+			},
+		},
+		{
+			name: "worker",
+			load: func() (interface{ Validate() error }, error) { return LoadWorkerConfig() },
+			env: map[string]string{
+				"REQUEST_TIMEOUT":                "0",
+				"WORKER_HIT_HISTORY_SIZE":        "-1",
+				"WORKER_MAX_IN_FLIGHT":           "lots",
+				"WORKER_QUEUE_TIMEOUT":           "-5",
+				"WORKER_COLLECT_RESULTS_SIZE":    "0",
+				"WORKER_PROXY_KEEP_ALIVES":       "sometimes",
+				"WORKER_MAX_IDLE_CONNS_PER_HOST": "0",
+				"WORKER_IDLE_CONN_TIMEOUT":       "-1",
+				"WORKER_ALLOWED_HOSTS":           "example.com,http://other.example",
+				"TRACING_OTLP_ENDPOINT":          "otel-collector:4318",
+				"TRACING_SAMPLE_RATIO":           "2",
+			},
+			wantErr: []string{
+				"REQUEST_TIMEOUT", "WORKER_HIT_HISTORY_SIZE", `WORKER_MAX_IN_FLIGHT="lots"`,
+				"WORKER_QUEUE_TIMEOUT", "WORKER_COLLECT_RESULTS_SIZE", `WORKER_PROXY_KEEP_ALIVES="sometimes"`,
+				"WORKER_MAX_IDLE_CONNS_PER_HOST", "WORKER_IDLE_CONN_TIMEOUT", "WORKER_ALLOWED_HOSTS",
+				"TRACING_OTLP_ENDPOINT", "TRACING_SAMPLE_RATIO",
+			},
+		},
+		{
+			name: "worker limits that do not parse",
+			load: func() (interface{ Validate() error }, error) { return LoadWorkerConfig() },
+			env: map[string]string{
+				"WORKER_MAX_IN_FLIGHT": "2.5",
+				"WORKER_QUEUE_TIMEOUT": "5s",
+			},
+			wantErr: []string{`WORKER_MAX_IN_FLIGHT="2.5"`, `WORKER_QUEUE_TIMEOUT="5s"`},
+		},
+		{
+			name: "agent",
+			load: func() (interface{ Validate() error }, error) { return LoadAgentConfig() },
+			env: map[string]string{
+				"CONTROLLER_URL":                  "controller:8080",
+				"WORKER_URL":                      "ftp://worker",
+				"POLL_INTERVAL":                   "-1",
+				"REQUEST_TIMEOUT":                 "1s",
+				"REGISTRATION_MAX_RETRIES":        "-2",
+				"REGISTRATION_INITIAL_BACKOFF":    "10",
+				"REGISTRATION_MAX_BACKOFF":        "5",
+				"REGISTRATION_BACKOFF_MULTIPLIER": "0.5",
+				"REGISTRATION_TIMEOUT":            "-1",
+				"REGISTRATION_FAILED_EXIT_AFTER":  "-1",
+				"HEALTH_PROBE_CACHE_TTL":          "-1",
+				"AGENT_HEARTBEAT_INTERVAL":        "often",
+				"AGENT_WORKER_PREFLIGHT":          "strict",
+				"AGENT_RETRYABLE_STATUS_CODES":    "503,bad",
+				"REDIS_HOST":                      " ",
+			},
+			wantErr: []string{
+				"CONTROLLER_URL", "WORKER_URL", "POLL_INTERVAL must be positive", `REQUEST_TIMEOUT="1s"`,
+				"REGISTRATION_MAX_RETRIES", "REGISTRATION_MAX_BACKOFF", "REGISTRATION_BACKOFF_MULTIPLIER",
+				"REGISTRATION_TIMEOUT", "REGISTRATION_FAILED_EXIT_AFTER", "HEALTH_PROBE_CACHE_TTL", `AGENT_HEARTBEAT_INTERVAL="often"`,
+				"AGENT_WORKER_PREFLIGHT", "REDIS_HOST",
+				`AGENT_RETRYABLE_STATUS_CODES="503,bad"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			cfg, err := tt.load()
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+
+			err = cfg.Validate()
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected a ValidationError, got %v", err)
+			}
+			if len(verr.Problems) != len(tt.wantErr) {
+				t.Errorf("got %d problems, want %d: %v", len(verr.Problems), len(tt.wantErr), verr.Problems)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error does not mention %s: %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidate_PollIntervalJitter(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr string
+	}{
+		{value: "0"},
+		{value: "0.25"},
+		{value: "0.99"},
+		{value: "-0.1", wantErr: "POLL_INTERVAL_JITTER must be at least 0 and below 1"},
+		{value: "1", wantErr: "POLL_INTERVAL_JITTER must be at least 0 and below 1"},
+		{value: "NaN", wantErr: "POLL_INTERVAL_JITTER must be at least 0 and below 1"},
+		{value: "10%", wantErr: `POLL_INTERVAL_JITTER="10%" is not a number`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("POLL_INTERVAL_JITTER", tt.value)
+			cfg, err := LoadControllerConfig()
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+
+			err = cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected an error mentioning %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestReloaded_KeepsStartupOnlySettings(t *testing.T) {
+	running := &ControllerConfig{
+		ServerAddr:   ":8080",
+		DatabasePath: "./data/data.db",
+		PollInterval: 30 * time.Second,
+		Redis:        &RedisConfig{Host: "cache", Port: 6379},
+	}
+	next := &ControllerConfig{
+		ServerAddr:    ":9090",
+		DatabasePath:  "./data/data.db",
+		PollInterval:  time.Minute,
+		AdminPassword: "rotated",
+		Redis:         &RedisConfig{Host: "other", Port: 6379},
+	}
+
+	merged, restart := running.Reloaded(next)
+	if merged.ServerAddr != ":8080" || merged.Redis.Host != "cache" {
+		t.Fatalf("expected startup-only settings to keep running values, got %+v", merged)
+	}
+	if merged.PollInterval != time.Minute || merged.AdminPassword != "rotated" {
+		t.Fatalf("expected reloadable settings to change, got %+v", merged)
+	}
+	if strings.Join(restart, ",") != "CONTROLLER_ADDR,REDIS_*" {
+		t.Fatalf("unexpected restart-required keys %v", restart)
+	}
+
+	if _, restart := running.Reloaded(running); len(restart) != 0 {
+		t.Fatalf("expected no restart-required keys for an unchanged config, got %v", restart)
+	}
+}
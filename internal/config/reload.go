@@ -0,0 +1,44 @@
+package config
+
+// Reloaded merges a freshly loaded config into the running one. Listeners,
+// the database, Redis, tracing and the seeded default config are set up once
+// at startup, so those settings keep their running values; the returned keys
+// name the ones that changed and need a restart to take effect.
+func (cfg *ControllerConfig) Reloaded(next *ControllerConfig) (*ControllerConfig, []string) {
+	merged := *next
+	var restart []string
+	keep := func(key string, changed bool) {
+		if changed {
+			restart = append(restart, key)
+		}
+	}
+
+	keep("CONTROLLER_ADDR", cfg.ServerAddr != next.ServerAddr)
+	keep("DATABASE_PATH", cfg.DatabasePath != next.DatabasePath)
+	keep("CONTROLLER_MTLS_ADDR", cfg.MTLSAddr != next.MTLSAddr)
+	keep("CONTROLLER_TLS_CERT", cfg.TLSCertFile != next.TLSCertFile)
+	keep("CONTROLLER_TLS_KEY", cfg.TLSKeyFile != next.TLSKeyFile)
+	keep("CONTROLLER_TLS_CLIENT_CA", cfg.TLSClientCAFile != next.TLSClientCAFile)
+	keep("REDIS_*", !sameRedis(cfg.Redis, next.Redis))
+	keep("DEFAULT_CONFIG", cfg.DefaultConfig != next.DefaultConfig)
+	keep("TRACING_*", cfg.Tracing != next.Tracing)
+
+	merged.ServerAddr = cfg.ServerAddr
+	merged.DatabasePath = cfg.DatabasePath
+	merged.MTLSAddr = cfg.MTLSAddr
+	merged.TLSCertFile = cfg.TLSCertFile
+	merged.TLSKeyFile = cfg.TLSKeyFile
+	merged.TLSClientCAFile = cfg.TLSClientCAFile
+	merged.TLS = cfg.TLS
+	merged.Redis = cfg.Redis
+	merged.DefaultConfig = cfg.DefaultConfig
+	merged.Tracing = cfg.Tracing
+	return &merged, restart
+}
+
+func sameRedis(a, b *RedisConfig) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
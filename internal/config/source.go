@@ -0,0 +1,199 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// source resolves settings in layers: an environment variable wins over the
+// same key in CONFIG_FILE, and the loaders fall back to their defaults when
+// neither sets it.
+//
+// CONFIG_FILE is YAML or JSON. Keys are the environment variable names,
+// case-insensitive; nested maps are joined with "_", so
+//
+//	redis:
+//	  host: cache
+//
+// sets REDIS_HOST. Lists become comma-separated values, and keys that take
+// "k=v" pairs (e.g. AGENT_METADATA) may be written as maps.
+type source struct {
+	file map[string]string
+	// problems are values that could not be parsed; Validate reports them
+	problems []string
+}
+
+// loadSource reads CONFIG_FILE when it is set
+func loadSource() (*source, error) {
+	src := &source{file: map[string]string{}}
+
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return src, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read CONFIG_FILE: %w", err)
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("parse CONFIG_FILE %s: %w", path, err)
+	}
+	flatten(src.file, "", raw)
+	return src, nil
+}
+
+func flatten(out map[string]string, prefix string, values map[string]interface{}) {
+	for key, value := range values {
+		name := strings.ToUpper(key)
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+
+		switch v := value.(type) {
+		case nil:
+		case map[string]interface{}:
+			// Also render the map as k=v pairs for keys such as
+			// AGENT_METADATA; unused keys are harmless
+			flatten(out, name, v)
+			out[name] = keyValues(v)
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			out[name] = strings.Join(items, ",")
+		default:
+			out[name] = fmt.Sprint(v)
+		}
+	}
+}
+
+// keyValues renders a map as sorted "k=v" pairs for parseKeyValues
+func keyValues(values map[string]interface{}) string {
+	pairs := make([]string, 0, len(values))
+	for key, value := range values {
+		if _, nested := value.(map[string]interface{}); nested {
+			continue
+		}
+		pairs = append(pairs, key+"="+fmt.Sprint(value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// get returns the environment variable, or the CONFIG_FILE value when it is unset
+func (s *source) get(key string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return s.file[key]
+}
+
+// getOr is get with a default for when neither layer sets key
+func (s *source) getOr(key, def string) string {
+	if v := s.get(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// int returns key as an integer, or def when unset. Unparseable values are
+// recorded as problems and leave def in place.
+func (s *source) int(key string, def int) int {
+	v := s.get(key)
+	if v == "" {
+		return def
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		s.invalid(key, v, "a whole number")
+		return def
+	}
+	return i
+}
+
+// ints reads a comma-separated list of whole numbers, e.g. "502,503"
+func (s *source) ints(key string, def []int) []int {
+	v := s.get(key)
+	if v == "" {
+		return def
+	}
+	var out []int
+	for _, item := range parseList(v) {
+		i, err := strconv.Atoi(item)
+		if err != nil {
+			s.invalid(key, v, "a comma-separated list of whole numbers")
+			return def
+		}
+		out = append(out, i)
+	}
+	return out
+}
+
+func (s *source) float(key string, def float64) float64 {
+	v := s.get(key)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		s.invalid(key, v, "a number")
+		return def
+	}
+	return f
+}
+
+func (s *source) bool(key string, def bool) bool {
+	v := s.get(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		s.invalid(key, v, "true or false")
+		return def
+	}
+	return b
+}
+
+// seconds reads a whole number of seconds
+func (s *source) seconds(key string, def time.Duration) time.Duration {
+	v := s.get(key)
+	if v == "" {
+		return def
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		s.invalid(key, v, "a whole number of seconds")
+		return def
+	}
+	return time.Duration(i) * time.Second
+}
+
+// duration reads a Go duration ("30s", "1m") or a whole number of seconds
+func (s *source) duration(key string, def time.Duration) time.Duration {
+	v := s.get(key)
+	if v == "" {
+		return def
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return d
+	}
+	if i, err := strconv.Atoi(v); err == nil {
+		return time.Duration(i) * time.Second
+	}
+	s.invalid(key, v, `a duration such as "30s" or a number of seconds`)
+	return def
+}
+
+func (s *source) invalid(key, value, want string) {
+	s.problems = append(s.problems, fmt.Sprintf("%s=%q is not %s", key, value, want))
+}
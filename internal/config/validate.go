@@ -0,0 +1,196 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/pkg/hostallow"
+)
+
+// ValidationError lists every problem found in a loaded config so all of
+// them can be fixed in one go
+type ValidationError struct {
+	Service  string
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s configuration: %s", e.Service, strings.Join(e.Problems, "; "))
+}
+
+// checks accumulates validation problems
+type checks struct {
+	problems []string
+}
+
+func (c *checks) add(format string, args ...interface{}) {
+	c.problems = append(c.problems, fmt.Sprintf(format, args...))
+}
+
+func (c *checks) positive(key string, d time.Duration) {
+	if d <= 0 {
+		c.add("%s must be positive, got %s", key, d)
+	}
+}
+
+func (c *checks) notNegative(key string, n int) {
+	if n < 0 {
+		c.add("%s must not be negative, got %d", key, n)
+	}
+}
+
+func (c *checks) notEmpty(key, value string) {
+	if strings.TrimSpace(value) == "" {
+		c.add("%s must not be empty", key)
+	}
+}
+
+func (c *checks) redis(r *RedisConfig) {
+	if r == nil {
+		return
+	}
+	c.notEmpty("REDIS_HOST", r.Host)
+	if r.Port < 1 || r.Port > 65535 {
+		c.add("REDIS_PORT must be between 1 and 65535, got %d", r.Port)
+	}
+	c.notNegative("REDIS_DB", r.DB)
+	if r.MessageBuffer <= 0 {
+		c.add("REDIS_MESSAGE_BUFFER must be positive, got %d", r.MessageBuffer)
+	}
+}
+
+func (c *checks) tracing(t TracingConfig) {
+	if t.Endpoint != "" {
+		if err := validateHTTPURL("TRACING_OTLP_ENDPOINT", t.Endpoint); err != nil {
+			c.add("%v", err)
+		}
+	}
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		c.add("TRACING_SAMPLE_RATIO must be between 0 and 1, got %g", t.SampleRatio)
+	}
+}
+
+func (c *checks) err(service string) error {
+	if len(c.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Service: service, Problems: c.problems}
+}
+
+// Validate reports every unparseable or out-of-range controller setting
+func (cfg *ControllerConfig) Validate() error {
+	c := &checks{problems: append([]string(nil), cfg.problems...)}
+
+	c.notEmpty("CONTROLLER_ADDR", cfg.ServerAddr)
+	c.notEmpty("DATABASE_PATH", cfg.DatabasePath)
+	c.positive("POLL_INTERVAL", cfg.PollInterval)
+	// Written to also reject NaN, which ParseFloat accepts
+	if !(cfg.PollIntervalJitter >= 0 && cfg.PollIntervalJitter < 1) {
+		c.add("POLL_INTERVAL_JITTER must be at least 0 and below 1, got %g", cfg.PollIntervalJitter)
+	}
+	c.notNegative("FETCH_QUOTA_PER_INTERVAL", cfg.FetchQuotaPerInterval)
+	c.positive("HEARTBEAT_LATE_AFTER", cfg.HeartbeatLateAfter)
+	c.positive("AGENT_OFFLINE_AFTER", cfg.AgentOfflineAfter)
+	if cfg.AgentOfflineAfter > 0 && cfg.AgentOfflineAfter < cfg.HeartbeatLateAfter {
+		c.add("AGENT_OFFLINE_AFTER (%s) must not be shorter than HEARTBEAT_LATE_AFTER (%s)", cfg.AgentOfflineAfter, cfg.HeartbeatLateAfter)
+	}
+	c.positive("HEARTBEAT_HISTORY_RETENTION", cfg.HeartbeatHistoryRetention)
+	c.notNegative("CONFIG_MAX_BYTES", cfg.MaxConfigBytes)
+	c.notNegative("CONFIG_RETENTION_KEEP", cfg.ConfigRetentionKeep)
+	if cfg.ConfigRetentionMaxAge < 0 {
+		c.add("CONFIG_RETENTION_MAX_AGE must not be negative, got %s", cfg.ConfigRetentionMaxAge)
+	}
+	if cfg.ConfigPruneInterval < 0 {
+		c.add("CONFIG_PRUNE_INTERVAL must not be negative, got %s", cfg.ConfigPruneInterval)
+	}
+	if cfg.ConfigPruneInterval > 0 && cfg.ConfigRetentionKeep <= 0 && cfg.ConfigRetentionMaxAge <= 0 {
+		c.add("CONFIG_PRUNE_INTERVAL needs CONFIG_RETENTION_KEEP or CONFIG_RETENTION_MAX_AGE")
+	}
+	if cfg.IdempotencyKeyTTL < 0 {
+		c.add("IDEMPOTENCY_KEY_TTL must not be negative, got %s", cfg.IdempotencyKeyTTL)
+	}
+	c.redis(cfg.Redis)
+	c.tracing(cfg.Tracing)
+	return c.err("controller")
+}
+
+// Validate reports every unparseable or out-of-range worker setting
+func (cfg *WorkerConfig) Validate() error {
+	c := &checks{problems: append([]string(nil), cfg.problems...)}
+
+	c.notEmpty("WORKER_ADDR", cfg.ServerAddr)
+	c.positive("REQUEST_TIMEOUT", cfg.RequestTimeout)
+	c.notNegative("WORKER_HIT_HISTORY_SIZE", cfg.HitHistorySize)
+	c.notNegative("WORKER_MAX_IN_FLIGHT", cfg.MaxInFlight)
+	if cfg.QueueTimeout < 0 {
+		c.add("WORKER_QUEUE_TIMEOUT must not be negative, got %s", cfg.QueueTimeout)
+	}
+	if cfg.CollectResultsSize <= 0 {
+		c.add("WORKER_COLLECT_RESULTS_SIZE must be positive, got %d", cfg.CollectResultsSize)
+	}
+	if cfg.MaxIdleConnsPerHost <= 0 {
+		c.add("WORKER_MAX_IDLE_CONNS_PER_HOST must be positive, got %d", cfg.MaxIdleConnsPerHost)
+	}
+	c.positive("WORKER_IDLE_CONN_TIMEOUT", cfg.IdleConnTimeout)
+	if _, err := hostallow.New(cfg.AllowedHosts); err != nil {
+		c.add("invalid WORKER_ALLOWED_HOSTS: %v", err)
+	}
+	c.tracing(cfg.Tracing)
+	return c.err("worker")
+}
+
+// Validate reports every unparseable or out-of-range agent setting
+func (cfg *AgentConfig) Validate() error {
+	c := &checks{problems: append([]string(nil), cfg.problems...)}
+
+	c.notEmpty("AGENT_ADDR", cfg.AgentAddr)
+	if err := validateHTTPURL("CONTROLLER_URL", cfg.ControllerURL); err != nil {
+		c.add("%v", err)
+	}
+	if !cfg.WorkerForwardingDisabled {
+		if err := ValidateWorkerURL(cfg.WorkerURL); err != nil {
+			c.add("%v", err)
+		}
+	}
+	c.positive("POLL_INTERVAL", cfg.PollInterval)
+	c.positive("REQUEST_TIMEOUT", cfg.RequestTimeout)
+	switch cfg.WorkerPreflight {
+	case WorkerPreflightWarn, WorkerPreflightFail, WorkerPreflightOff:
+	default:
+		c.add("AGENT_WORKER_PREFLIGHT must be %s, %s or %s, got %q", WorkerPreflightWarn, WorkerPreflightFail, WorkerPreflightOff, cfg.WorkerPreflight)
+	}
+
+	c.notNegative("REGISTRATION_MAX_RETRIES", cfg.RegistrationMaxRetries)
+	c.positive("REGISTRATION_INITIAL_BACKOFF", cfg.RegistrationInitialBackoff)
+	if cfg.RegistrationMaxBackoff < cfg.RegistrationInitialBackoff {
+		c.add("REGISTRATION_MAX_BACKOFF (%s) must not be shorter than REGISTRATION_INITIAL_BACKOFF (%s)",
+			cfg.RegistrationMaxBackoff, cfg.RegistrationInitialBackoff)
+	}
+	if cfg.RegistrationBackoffMultiplier < 1 {
+		c.add("REGISTRATION_BACKOFF_MULTIPLIER must be at least 1, got %g", cfg.RegistrationBackoffMultiplier)
+	}
+	if cfg.RegistrationTimeout < 0 {
+		c.add("REGISTRATION_TIMEOUT must not be negative, got %s", cfg.RegistrationTimeout)
+	}
+	if cfg.RegistrationFailedExitAfter < 0 {
+		c.add("REGISTRATION_FAILED_EXIT_AFTER must not be negative, got %s", cfg.RegistrationFailedExitAfter)
+	}
+	if cfg.HealthProbeCacheTTL < 0 {
+		c.add("HEALTH_PROBE_CACHE_TTL must not be negative, got %s", cfg.HealthProbeCacheTTL)
+	}
+	for _, code := range cfg.RetryableStatusCodes {
+		if code < 100 || code > 599 {
+			c.add("AGENT_RETRYABLE_STATUS_CODES must be HTTP status codes, got %d", code)
+		}
+	}
+
+	if cfg.Heartbeat.Enabled {
+		c.positive("AGENT_HEARTBEAT_INTERVAL", cfg.Heartbeat.Interval)
+		c.notNegative("AGENT_HEARTBEAT_MAX_RETRIES", cfg.Heartbeat.MaxRetries)
+		c.positive("AGENT_HEARTBEAT_RETRY_BACKOFF", cfg.Heartbeat.RetryBackoff)
+	}
+	c.redis(cfg.Redis)
+	c.tracing(cfg.Tracing)
+	return c.err("agent")
+}
@@ -24,12 +24,19 @@ type RegistrationResponse struct {
 }
 
 type AgentConfig struct {
-	ID                  string    `gorm:"column:id;primaryKey" json:"id"`
-	AgentName           string    `gorm:"column:agent_name;not null" json:"agent_name"`
-	APIToken            string    `gorm:"column:api_token;not null;uniqueIndex" json:"-"` // Never expose in JSON
-	PollIntervalSeconds *int      `gorm:"column:poll_interval_seconds" json:"poll_interval_seconds,omitempty"`
-	CreatedAt           time.Time `gorm:"column:created_at;not null;autoCreateTime" json:"created_at"`
-	UpdatedAt           time.Time `gorm:"column:updated_at;not null;autoUpdateTime" json:"updated_at"`
+	ID                  string            `gorm:"column:id;primaryKey" json:"id"`
+	AgentName           string            `gorm:"column:agent_name;not null" json:"agent_name"`
+	APIToken            string            `gorm:"column:api_token;not null;uniqueIndex" json:"-"` // Never expose in JSON
+	PollIntervalSeconds *int              `gorm:"column:poll_interval_seconds" json:"poll_interval_seconds,omitempty"`
+	Profile             string            `gorm:"column:profile;not null;default:''" json:"profile,omitempty"` // Named config profile; empty uses the default config
+	Revoked             bool              `gorm:"column:revoked;not null;default:false" json:"revoked"`        // Token suspended; cleared by rotation
+	Metadata            map[string]string `gorm:"column:metadata;serializer:json" json:"metadata,omitempty"`   // Facts reported at registration (os, region, ...)
+	RevokedAt           *time.Time        `gorm:"column:revoked_at" json:"revoked_at,omitempty"`
+	LastError           string            `gorm:"column:last_error;not null;default:''" json:"last_error,omitempty"` // Most recent error reported by heartbeat
+	LastErrorAt         *time.Time        `gorm:"column:last_error_at" json:"last_error_at,omitempty"`
+	WorkerSchemaVersion int               `gorm:"column:worker_schema_version;not null;default:0" json:"worker_schema_version,omitempty"` // Newest config schema the agent's worker reported; 0 until it reports one
+	CreatedAt           time.Time         `gorm:"column:created_at;not null;autoCreateTime" json:"created_at"`
+	UpdatedAt           time.Time         `gorm:"column:updated_at;not null;autoUpdateTime" json:"updated_at"`
 }
 
 func (AgentConfig) TableName() string {
@@ -37,11 +44,17 @@ func (AgentConfig) TableName() string {
 }
 
 type AgentPublic struct {
-	ID                  string    `json:"id"`
-	AgentName           string    `json:"agent_name"`
-	PollIntervalSeconds *int      `json:"poll_interval_seconds,omitempty"`
-	CreatedAt           time.Time `json:"created_at"`
-	UpdatedAt           time.Time `json:"updated_at"`
+	ID                  string            `json:"id"`
+	AgentName           string            `json:"agent_name"`
+	PollIntervalSeconds *int              `json:"poll_interval_seconds,omitempty"`
+	Profile             string            `json:"profile,omitempty"`
+	Revoked             bool              `json:"revoked"`
+	Metadata            map[string]string `json:"metadata,omitempty"`
+	RevokedAt           *time.Time        `json:"revoked_at,omitempty"`
+	LastError           string            `json:"last_error,omitempty"`
+	LastErrorAt         *time.Time        `json:"last_error_at,omitempty"`
+	CreatedAt           time.Time         `json:"created_at"`
+	UpdatedAt           time.Time         `json:"updated_at"`
 }
 
 func (a *AgentConfig) ToPublic() AgentPublic {
@@ -49,6 +62,12 @@ func (a *AgentConfig) ToPublic() AgentPublic {
 		ID:                  a.ID,
 		AgentName:           a.AgentName,
 		PollIntervalSeconds: a.PollIntervalSeconds,
+		Profile:             a.Profile,
+		Revoked:             a.Revoked,
+		Metadata:            a.Metadata,
+		RevokedAt:           a.RevokedAt,
+		LastError:           a.LastError,
+		LastErrorAt:         a.LastErrorAt,
 		CreatedAt:           a.CreatedAt,
 		UpdatedAt:           a.UpdatedAt,
 	}
@@ -0,0 +1,65 @@
+package models
+
+import "fmt"
+
+// Assertion types the worker can check a target response against
+const (
+	// AssertionStatus requires the upstream status code to equal Status
+	AssertionStatus = "status"
+	// AssertionContains requires the response body to contain Value
+	AssertionContains = "contains"
+	// AssertionJSON requires the response body to be valid JSON
+	AssertionJSON = "json"
+)
+
+// maxAssertions bounds the assertions of a single config
+const maxAssertions = 16
+
+// Assertion is an expectation about the target response. The worker checks
+// every assertion on each hit and reports which failed alongside the data.
+type Assertion struct {
+	Type string `json:"type"`
+	// Status is the expected status code for status
+	Status int `json:"status,omitempty"`
+	// Value is the substring contains looks for
+	Value string `json:"value,omitempty"`
+}
+
+// Validate reports whether the assertion is well formed
+func (a Assertion) Validate() error {
+	switch a.Type {
+	case AssertionStatus:
+		if a.Status < 100 || a.Status > 599 {
+			return fmt.Errorf("status requires a status between 100 and 599")
+		}
+		return nil
+	case AssertionContains:
+		if a.Value == "" {
+			return fmt.Errorf("contains requires a value")
+		}
+		return nil
+	case AssertionJSON:
+		return nil
+	default:
+		return fmt.Errorf("unknown assertion type %q", a.Type)
+	}
+}
+
+func validateAssertions(assertions []Assertion, encoding string) error {
+	if len(assertions) == 0 {
+		return nil
+	}
+	if len(assertions) > maxAssertions {
+		return fmt.Errorf("at most %d assertions are allowed", maxAssertions)
+	}
+	// A streamed body is never read by the worker, so there is nothing to check
+	if encoding == ResponseEncodingStream {
+		return fmt.Errorf("assertions are not supported with the stream response_encoding")
+	}
+	for i, a := range assertions {
+		if err := a.Validate(); err != nil {
+			return fmt.Errorf("assertions[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// BootstrapToken is a short-lived registration credential issued by an admin.
+// Only the SHA-256 hash of the token is stored.
+type BootstrapToken struct {
+	ID        string    `gorm:"column:id;primaryKey" json:"id"`
+	TokenHash string    `gorm:"column:token_hash;not null;uniqueIndex" json:"-"`
+	MaxUses   int       `gorm:"column:max_uses;not null" json:"max_uses"`
+	Uses      int       `gorm:"column:uses;not null;default:0" json:"uses"`
+	ExpiresAt time.Time `gorm:"column:expires_at;not null;index" json:"expires_at"`
+	CreatedAt time.Time `gorm:"column:created_at;not null;autoCreateTime" json:"created_at"`
+}
+
+func (BootstrapToken) TableName() string {
+	return "bootstrap_tokens"
+}
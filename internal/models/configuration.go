@@ -1,9 +1,18 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/pkg/httpurl"
+	"github.com/Alwanly/service-distribute-management/pkg/proxyurl"
+)
 
 type Configuration struct {
 	ID         int64     `gorm:"primaryKey;autoIncrement;column:id"`
+	Name       string    `gorm:"column:name;not null;default:'';index"` // Profile name; empty for the default config
 	ETag       string    `gorm:"column:etag"`
 	ConfigData string    `gorm:"column:config_data"`
 	CreatedAt  time.Time `gorm:"column:created_at;autoCreateTime"`
@@ -17,4 +26,248 @@ func (Configuration) TableName() string {
 type ConfigData struct {
 	URL   string `json:"url"`
 	Proxy string `json:"proxy"`
+	// ResponseEncoding controls how the worker returns the target response:
+	// text (default), base64, raw or stream
+	ResponseEncoding string `json:"response_encoding,omitempty"`
+	// Match restricts the config to agents whose registration metadata has
+	// every listed key with the given value. Empty matches all agents.
+	Match map[string]string `json:"match,omitempty"`
+	// InsecureSkipVerify disables TLS certificate verification for this
+	// target only. Meant for self-signed targets; never a global default.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+	// Transforms post-process the response body in order before it is returned
+	Transforms []Transform `json:"transforms,omitempty"`
+	// CollectEnabled makes the worker hit the target on its own every
+	// CollectInterval seconds and keep the results for GET /results
+	CollectEnabled  bool `json:"collect_enabled,omitempty"`
+	CollectInterval int  `json:"collect_interval,omitempty"`
+	// Assertions are checked against every target response; the outcome is
+	// reported alongside the data
+	Assertions []Assertion `json:"assertions,omitempty"`
+	// Flags are feature flags for the agent and worker
+	Flags Flags `json:"flags,omitempty"`
+	// SchemaVersion is stamped by the controller when serving the config;
+	// zero means an unversioned (schema 1) config
+	SchemaVersion int `json:"schema_version,omitempty"`
+}
+
+// ConfigSchemaVersion is the newest config schema this build understands.
+//
+//	1: url, proxy, response_encoding, match
+//	2: insecure_skip_verify
+//	3: transforms
+//	4: collect_enabled, collect_interval
+//	5: response_encoding stream
+//	6: assertions
+//	7: flags
+const ConfigSchemaVersion = 7
+
+// MaxCollectInterval bounds collect_interval (one day)
+const MaxCollectInterval = 86400
+
+// HeaderConfigSchemaVersion tells the controller the newest schema the
+// agent's worker supports
+const HeaderConfigSchemaVersion = "X-Config-Schema-Version"
+
+// ErrSchemaUnsupported is returned when a config needs a newer schema than
+// its consumer supports
+var ErrSchemaUnsupported = errors.New("config requires a newer schema version")
+
+// MinSchemaVersion returns the oldest schema version able to express c
+func (c ConfigData) MinSchemaVersion() int {
+	if len(c.Flags) > 0 {
+		return 7
+	}
+	if len(c.Assertions) > 0 {
+		return 6
+	}
+	if c.ResponseEncoding == ResponseEncodingStream {
+		return 5
+	}
+	if c.CollectEnabled || c.CollectInterval != 0 {
+		return 4
+	}
+	if len(c.Transforms) > 0 {
+		return 3
+	}
+	if c.InsecureSkipVerify {
+		return 2
+	}
+	return 1
+}
+
+// ForSchema returns c stamped with the oldest schema version that expresses
+// it, so older workers keep receiving configs they understand. A supported
+// version of zero means the consumer did not negotiate.
+func (c ConfigData) ForSchema(supported int) (ConfigData, error) {
+	need := c.MinSchemaVersion()
+	if supported > 0 && need > supported {
+		return c, fmt.Errorf("%w: needs %d, consumer supports %d", ErrSchemaUnsupported, need, supported)
+	}
+	c.SchemaVersion = need
+	return c, nil
+}
+
+// Matches reports whether an agent with the given metadata should receive
+// this config
+func (c ConfigData) Matches(metadata map[string]string) bool {
+	for key, want := range c.Match {
+		if got, ok := metadata[key]; !ok || got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// Response encodings supported by the worker
+const (
+	ResponseEncodingText   = "text"
+	ResponseEncodingBase64 = "base64"
+	ResponseEncodingRaw    = "raw"
+	// ResponseEncodingStream is raw without buffering: the upstream body is
+	// copied to the client as it arrives
+	ResponseEncodingStream = "stream"
+)
+
+// FieldError is a config validation failure tied to the top-level field
+// that caused it. Its message is the underlying error's, so wrapping does
+// not change what callers show.
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorField returns the config field err was reported for, or "" when err
+// is not a *FieldError
+func ErrorField(err error) string {
+	var fieldErr *FieldError
+	if errors.As(err, &fieldErr) {
+		return fieldErr.Field
+	}
+	return ""
+}
+
+func fieldError(field string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &FieldError{Field: field, Err: err}
+}
+
+// Validate reports whether the worker can run this config. The controller
+// calls it before storing a config and the worker before applying one, so
+// anything the controller accepts the worker accepts too. Errors are
+// *FieldError naming the offending field.
+func (c ConfigData) Validate() error {
+	if c.URL == "" {
+		return fieldError("url", fmt.Errorf("url is required"))
+	}
+	if _, err := httpurl.Parse(c.URL); err != nil {
+		return fieldError("url", fmt.Errorf("invalid url: %w", err))
+	}
+
+	if c.Proxy != "" {
+		if _, err := proxyurl.Parse(c.Proxy); err != nil {
+			return fieldError("proxy", fmt.Errorf("invalid proxy: %w", err))
+		}
+	}
+
+	for key := range c.Match {
+		if key == "" {
+			return fieldError("match", fmt.Errorf("match keys must not be empty"))
+		}
+	}
+
+	switch c.ResponseEncoding {
+	case "", ResponseEncodingText, ResponseEncodingBase64, ResponseEncodingRaw, ResponseEncodingStream:
+	default:
+		return fieldError("response_encoding", fmt.Errorf("unsupported response_encoding %q", c.ResponseEncoding))
+	}
+
+	if err := validateTransforms(c.Transforms, c.ResponseEncoding); err != nil {
+		return fieldError("transforms", err)
+	}
+
+	if err := validateAssertions(c.Assertions, c.ResponseEncoding); err != nil {
+		return fieldError("assertions", err)
+	}
+
+	if err := validateFlags(c.Flags); err != nil {
+		return fieldError("flags", err)
+	}
+
+	if c.CollectInterval < 0 || c.CollectInterval > MaxCollectInterval {
+		return fieldError("collect_interval", fmt.Errorf("collect_interval must be 0 (disabled) or between 1 and %d seconds", MaxCollectInterval))
+	}
+	if c.CollectEnabled && c.CollectInterval == 0 {
+		return fieldError("collect_interval", fmt.Errorf("collect_interval is required when collect_enabled is set"))
+	}
+
+	// Refuse configs from a newer schema rather than silently dropping fields
+	if c.SchemaVersion > ConfigSchemaVersion {
+		return fieldError("schema_version", fmt.Errorf("unsupported schema_version %d (supports up to %d)", c.SchemaVersion, ConfigSchemaVersion))
+	}
+	return nil
+}
+
+// RedactedConfig is the loggable shape of a ConfigData: credentials in the
+// target URL are masked and the proxy is reduced to its host
+type RedactedConfig struct {
+	URL                string            `json:"url"`
+	ProxyHost          string            `json:"proxy_host,omitempty"`
+	ProxyAuth          bool              `json:"proxy_auth,omitempty"`
+	ResponseEncoding   string            `json:"response_encoding,omitempty"`
+	Match              map[string]string `json:"match,omitempty"`
+	InsecureSkipVerify bool              `json:"insecure_skip_verify,omitempty"`
+	Transforms         []string          `json:"transforms,omitempty"`
+	CollectEnabled     bool              `json:"collect_enabled,omitempty"`
+	CollectInterval    int               `json:"collect_interval,omitempty"`
+	Assertions         []string          `json:"assertions,omitempty"`
+	Flags              Flags             `json:"flags,omitempty"`
+	SchemaVersion      int               `json:"schema_version,omitempty"`
+}
+
+// Redacted returns c with every secret removed, safe to log
+func (c ConfigData) Redacted() RedactedConfig {
+	r := RedactedConfig{
+		ResponseEncoding:   c.ResponseEncoding,
+		Match:              c.Match,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		CollectEnabled:     c.CollectEnabled,
+		CollectInterval:    c.CollectInterval,
+		Flags:              c.Flags,
+		SchemaVersion:      c.SchemaVersion,
+	}
+	r.URL = httpurl.Redact(c.URL)
+	for _, t := range c.Transforms {
+		r.Transforms = append(r.Transforms, t.Op)
+	}
+	for _, a := range c.Assertions {
+		r.Assertions = append(r.Assertions, a.Type)
+	}
+	if c.Proxy != "" {
+		r.ProxyHost = "[invalid]"
+		if u, err := proxyurl.Parse(c.Proxy); err == nil {
+			r.ProxyHost = u.Host
+			r.ProxyAuth = u.User != nil
+		}
+	}
+	return r
+}
+
+// RedactedData parses the stored config data and returns its redacted shape
+func (c *Configuration) RedactedData() RedactedConfig {
+	var data ConfigData
+	if err := json.Unmarshal([]byte(c.ConfigData), &data); err != nil {
+		return RedactedConfig{URL: "[invalid]"}
+	}
+	return data.Redacted()
 }
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// DebugEventsChannel carries controller diagnostics for agents. It is kept
+// apart from config-updates so agents without debug events enabled never
+// mistake one for a config notification.
+const DebugEventsChannel = "agent-debug"
+
+// DebugEventType is the type field every debug event carries
+const DebugEventType = "debug"
+
+// Debug events published to agents
+const (
+	DebugEventConfigTargeted = "config_targeted"
+	DebugEventHeartbeatLate  = "heartbeat_late"
+)
+
+// DebugEvent is a diagnostic message for one agent, or for every agent when
+// AgentID is empty
+type DebugEvent struct {
+	Type    string    `json:"type"`
+	AgentID string    `json:"agent_id,omitempty"`
+	Event   string    `json:"event"`
+	Message string    `json:"message"`
+	At      time.Time `json:"at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Event types recorded in the activity feed. EventHeartbeatReceived is
+// recorded only for a heartbeat reporting a different config version than
+// the agent's previous one, so steady heartbeats do not grow the feed.
+const (
+	EventAgentRegistered   = "agent_registered"
+	EventHeartbeatReceived = "heartbeat_received"
+	EventConfigChanged     = "config_changed"
+	EventTokenRotated      = "token_rotated"
+	EventTokenRevoked      = "token_revoked"
+	EventTokenRefreshed    = "token_refreshed"
+	EventAgentDeleted      = "agent_deleted"
+	EventConfigPruned      = "config_pruned"
+)
+
+// Event is one entry in the fleet activity feed. AgentID is empty for
+// fleet-wide events such as config changes.
+type Event struct {
+	ID        int64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Type      string    `gorm:"column:type;not null;index" json:"type"`
+	AgentID   string    `gorm:"column:agent_id;index" json:"agent_id,omitempty"`
+	Detail    string    `gorm:"column:detail" json:"detail,omitempty"`
+	CreatedAt time.Time `gorm:"column:created_at;not null;autoCreateTime;index" json:"created_at"`
+}
+
+func (Event) TableName() string {
+	return "events"
+}
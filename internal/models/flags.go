@@ -0,0 +1,80 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// maxFlags bounds the feature flags of a single config
+const maxFlags = 64
+
+// maxFlagValueLength bounds a string flag value
+const maxFlagValueLength = 256
+
+// flagNamePattern keeps flag names short identifiers, e.g. strict_validation
+var flagNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// Flags are feature flags distributed with a config so operators can toggle
+// agent and worker behavior without redeploying. Values are booleans or
+// strings. Read them through Bool and String, which fall back to the
+// caller's default when a flag is missing or has an unusable value.
+type Flags map[string]interface{}
+
+// Bool returns flag name as a boolean. String values are parsed with
+// strconv.ParseBool, so "true" and "1" enable a flag too.
+func (f Flags) Bool(name string, def bool) bool {
+	switch v := f[name].(type) {
+	case bool:
+		return v
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return def
+}
+
+// String returns flag name as a string; boolean values become "true" or
+// "false"
+func (f Flags) String(name string, def string) string {
+	switch v := f[name].(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return def
+}
+
+// Names returns the flag names in sorted order
+func (f Flags) Names() []string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func validateFlags(flags Flags) error {
+	if len(flags) > maxFlags {
+		return fmt.Errorf("at most %d flags are allowed", maxFlags)
+	}
+	for _, name := range flags.Names() {
+		if !flagNamePattern.MatchString(name) {
+			return fmt.Errorf("flag %q: names must be lowercase letters, digits, '_', '.' or '-' and at most 64 characters", name)
+		}
+		switch v := flags[name].(type) {
+		case bool:
+		case string:
+			if len(v) > maxFlagValueLength {
+				return fmt.Errorf("flag %q: value must be at most %d characters", name, maxFlagValueLength)
+			}
+		default:
+			return fmt.Errorf("flag %q: value must be a boolean or a string", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// AgentHeartbeat is one heartbeat in an agent's history. Rows are appended
+// on every heartbeat and pruned after the controller's retention period, so
+// the history covers uptime over that window.
+type AgentHeartbeat struct {
+	ID            int64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	AgentID       string    `gorm:"column:agent_id;not null;index:idx_agent_heartbeats_agent_time" json:"agent_id"`
+	ConfigVersion string    `gorm:"column:config_version" json:"config_version"`
+	CreatedAt     time.Time `gorm:"column:created_at;not null;index:idx_agent_heartbeats_agent_time;index" json:"created_at"`
+}
+
+func (AgentHeartbeat) TableName() string {
+	return "agent_heartbeats"
+}
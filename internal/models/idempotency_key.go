@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// IdempotencyKey is the stored result of an admin mutation sent with an
+// Idempotency-Key header, replayed when a client retries the same request.
+// Scope names the endpoint so the same key may be used on different ones.
+type IdempotencyKey struct {
+	Scope string `gorm:"column:scope;primaryKey" json:"scope"`
+	Key   string `gorm:"column:key;primaryKey" json:"key"`
+	// RequestHash is the SHA-256 of the request body; a repeat with a
+	// different body is refused rather than replayed
+	RequestHash string    `gorm:"column:request_hash;not null" json:"-"`
+	StatusCode  int       `gorm:"column:status_code;not null" json:"status_code"`
+	Response    string    `gorm:"column:response;type:text;not null" json:"-"`
+	ExpiresAt   time.Time `gorm:"column:expires_at;not null;index" json:"expires_at"`
+	CreatedAt   time.Time `gorm:"column:created_at;not null;autoCreateTime" json:"created_at"`
+}
+
+func (IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
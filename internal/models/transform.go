@@ -0,0 +1,82 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/andybalholm/cascadia"
+)
+
+// Transform operations the worker can apply to a proxied response
+const (
+	TransformTrim         = "trim"
+	TransformLowercase    = "lowercase"
+	TransformRegexMatch   = "regex_match"
+	TransformJSONPrettify = "json_prettify"
+	TransformSelector     = "selector"
+)
+
+// maxTransforms bounds the pipeline length of a single config
+const maxTransforms = 16
+
+// Transform is one step of the worker's response pipeline. Steps run in
+// order, each on the previous step's output.
+type Transform struct {
+	Op string `json:"op"`
+	// Pattern is the regular expression for regex_match
+	Pattern string `json:"pattern,omitempty"`
+	// Group selects a capture group for regex_match; 0 is the whole match
+	Group int `json:"group,omitempty"`
+	// Selector is the CSS selector for selector
+	Selector string `json:"selector,omitempty"`
+	// Attr makes selector return this attribute instead of the element text
+	Attr string `json:"attr,omitempty"`
+}
+
+// Validate reports whether the transform is well formed
+func (t Transform) Validate() error {
+	switch t.Op {
+	case TransformTrim, TransformLowercase, TransformJSONPrettify:
+		return nil
+	case TransformRegexMatch:
+		if t.Pattern == "" {
+			return fmt.Errorf("regex_match requires a pattern")
+		}
+		re, err := regexp.Compile(t.Pattern)
+		if err != nil {
+			return fmt.Errorf("regex_match pattern: %w", err)
+		}
+		if t.Group < 0 || t.Group > re.NumSubexp() {
+			return fmt.Errorf("regex_match group %d out of range (pattern has %d)", t.Group, re.NumSubexp())
+		}
+		return nil
+	case TransformSelector:
+		if t.Selector == "" {
+			return fmt.Errorf("selector requires a selector")
+		}
+		if _, err := cascadia.Compile(t.Selector); err != nil {
+			return fmt.Errorf("selector: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown transform op %q", t.Op)
+	}
+}
+
+func validateTransforms(transforms []Transform, encoding string) error {
+	if len(transforms) == 0 {
+		return nil
+	}
+	if len(transforms) > maxTransforms {
+		return fmt.Errorf("at most %d transforms are allowed", maxTransforms)
+	}
+	if encoding == ResponseEncodingBase64 || encoding == ResponseEncodingRaw || encoding == ResponseEncodingStream {
+		return fmt.Errorf("transforms require the text response_encoding")
+	}
+	for i, t := range transforms {
+		if err := t.Validate(); err != nil {
+			return fmt.Errorf("transforms[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
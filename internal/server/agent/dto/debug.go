@@ -0,0 +1,128 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/internal/models"
+)
+
+// WorkerSyncState describes whether recent config forwards to the worker succeeded
+type WorkerSyncState struct {
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OutOfSync           bool       `json:"out_of_sync"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastFailureAt       *time.Time `json:"last_failure_at,omitempty"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+}
+
+// DebugStateResponse is the agent's runtime state exposed on /debug/state
+type DebugStateResponse struct {
+	AgentID             string          `json:"agent_id"`
+	ConfigETag          string          `json:"config_etag"`
+	PollURL             string          `json:"poll_url"`
+	PollIntervalSeconds int             `json:"poll_interval_seconds"`
+	Worker              WorkerSyncState `json:"worker"`
+	// Pinned is set while a local override config is pinned on the agent
+	Pinned *PinnedConfigState `json:"pinned,omitempty"`
+	// Redis is set when push notifications are configured
+	Redis     *RedisListenerStats `json:"redis,omitempty"`
+	Delivery  DeliveryModeState   `json:"delivery"`
+	Heartbeat HeartbeatStats      `json:"heartbeat"`
+	// Flags are the feature flags of the stored controller config
+	Flags models.Flags `json:"flags,omitempty"`
+}
+
+// HeartbeatStats counts heartbeat outcomes. A heartbeat is missed when it
+// still fails after its retries.
+type HeartbeatStats struct {
+	// ConsecutiveFailures counts missed heartbeats since the last success
+	ConsecutiveFailures int64      `json:"consecutive_failures"`
+	Missed              int64      `json:"missed"`
+	Retries             int64      `json:"retries"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+}
+
+// DeliveryMode says whether the agent currently relies on Redis push
+// notifications or only on polling for config updates
+type DeliveryMode string
+
+const (
+	DeliveryModePushEnabled DeliveryMode = "PUSH_ENABLED"
+	DeliveryModePollOnly    DeliveryMode = "POLL_ONLY"
+)
+
+// DeliveryModeState is the current delivery mode and when it was entered
+type DeliveryModeState struct {
+	Mode        DeliveryMode `json:"mode"`
+	Since       time.Time    `json:"since"`
+	Transitions int64        `json:"transitions"`
+}
+
+// RedisListenerStats counts activity of the Redis push notification listener
+type RedisListenerStats struct {
+	MessagesReceived int64 `json:"messages_received"`
+	// MessagesDropped counts notifications dropped because the buffer
+	// between the Redis listener and the agent was full
+	MessagesDropped   int64      `json:"messages_dropped"`
+	ReconnectAttempts int64      `json:"reconnect_attempts"`
+	CircuitOpens      int64      `json:"circuit_opens"`
+	CircuitOpen       bool       `json:"circuit_open"`
+	CircuitOpenFor    string     `json:"circuit_open_for,omitempty"`
+	LastMessageAt     *time.Time `json:"last_message_at,omitempty"`
+}
+
+// EffectiveConfigResponse is the agent's resolved operational configuration
+// exposed on /debug/config. Secrets are replaced with "[redacted]" when set
+// and left empty when not, and URLs have their credentials masked.
+type EffectiveConfigResponse struct {
+	ControllerURL            string            `json:"controller_url"`
+	WorkerURL                string            `json:"worker_url"`
+	WorkerForwardingDisabled bool              `json:"worker_forwarding_disabled"`
+	WorkerPreflight          string            `json:"worker_preflight"`
+	AgentAddr                string            `json:"agent_addr"`
+	Hostname                 string            `json:"hostname,omitempty"`
+	Metadata                 map[string]string `json:"metadata,omitempty"`
+	PollInterval             string            `json:"poll_interval"`
+	RequestTimeout           string            `json:"request_timeout"`
+	AgentUsername            string            `json:"agent_username"`
+	AgentPassword            string            `json:"agent_password,omitempty"`
+	BootstrapToken           string            `json:"bootstrap_token,omitempty"`
+	Registration             RegistrationRetry `json:"registration"`
+	Heartbeat                HeartbeatSettings `json:"heartbeat"`
+	HealthProbeCacheTTL      string            `json:"health_probe_cache_ttl"`
+	RetryableStatusCodes     []int             `json:"retryable_status_codes"`
+	Redis                    *RedisSettings    `json:"redis,omitempty"`
+	TLS                      *TLSSettings      `json:"tls,omitempty"`
+	ConfigCachePath          string            `json:"config_cache_path,omitempty"`
+	DebugEvents              bool              `json:"debug_events"`
+	TracingEndpoint          string            `json:"tracing_endpoint,omitempty"`
+	TracingSampleRatio       float64           `json:"tracing_sample_ratio"`
+}
+
+type RegistrationRetry struct {
+	MaxRetries        int     `json:"max_retries"`
+	InitialBackoff    string  `json:"initial_backoff"`
+	MaxBackoff        string  `json:"max_backoff"`
+	BackoffMultiplier float64 `json:"backoff_multiplier"`
+	Timeout           string  `json:"timeout"`
+}
+
+type HeartbeatSettings struct {
+	Enabled      bool   `json:"enabled"`
+	Interval     string `json:"interval"`
+	MaxRetries   int    `json:"max_retries"`
+	RetryBackoff string `json:"retry_backoff"`
+}
+
+type RedisSettings struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	DB       int    `json:"db"`
+	Password string `json:"password,omitempty"`
+}
+
+type TLSSettings struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	CAFile   string `json:"ca_file,omitempty"`
+}
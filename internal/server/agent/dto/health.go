@@ -1,7 +1,43 @@
 package dto
 
+import "time"
+
 type HealthResponse struct {
-	Status    string `json:"status"`
-	AgentID   string `json:"agent_id,omitempty"`
-	Timestamp string `json:"timestamp"`
+	Status     string `json:"status"`
+	AgentID    string `json:"agent_id,omitempty"`
+	Registered bool   `json:"registered"`
+	Timestamp  string `json:"timestamp"`
+	// Registration shows how startup registration with the controller is going
+	Registration RegistrationStatus `json:"registration"`
+	// Dependencies is only present for ?deep=true checks
+	Dependencies map[string]DependencyHealth `json:"dependencies,omitempty"`
+}
+
+// DependencyHealth is the result of probing a dependency's /health endpoint
+type DependencyHealth struct {
+	Reachable bool      `json:"reachable"`
+	LatencyMs float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// RegistrationState is the stage of startup registration with the controller
+type RegistrationState string
+
+const (
+	RegistrationPending     RegistrationState = "pending"
+	RegistrationRegistering RegistrationState = "registering"
+	RegistrationRegistered  RegistrationState = "registered"
+	RegistrationFailed      RegistrationState = "failed"
+)
+
+// RegistrationStatus describes registration progress; LastError is the most
+// recent attempt's failure and is cleared once registration succeeds
+type RegistrationStatus struct {
+	State         RegistrationState `json:"state" example:"registering"`
+	Attempts      int               `json:"attempts" example:"3"`
+	LastError     string            `json:"last_error,omitempty" example:"registration failed with status 503: unavailable"`
+	StartedAt     *time.Time        `json:"started_at,omitempty"`
+	LastAttemptAt *time.Time        `json:"last_attempt_at,omitempty"`
+	CompletedAt   *time.Time        `json:"completed_at,omitempty"`
 }
@@ -0,0 +1,16 @@
+package dto
+
+import "time"
+
+// HeartbeatRequest is the payload the agent sends to the controller heartbeat endpoint
+type HeartbeatRequest struct {
+	ConfigVersion         string `json:"config_version"`
+	Status                string `json:"status"`
+	WorkerOutOfSync       bool   `json:"worker_out_of_sync,omitempty"`
+	WorkerForwardFailures int    `json:"worker_forward_failures,omitempty"`
+	ConfigPinned          bool   `json:"config_pinned,omitempty"`
+	DeliveryMode          string `json:"delivery_mode,omitempty"`
+	// LastError is the agent's most recent operational error, if any
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
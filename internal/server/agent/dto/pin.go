@@ -0,0 +1,19 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/internal/models"
+)
+
+// PinConfigRequest is the body of POST /debug/pin-config
+type PinConfigRequest struct {
+	ETag   string            `json:"etag,omitempty" example:"pinned-debug"`
+	Config models.ConfigData `json:"config"`
+}
+
+// PinnedConfigState describes a locally pinned configuration
+type PinnedConfigState struct {
+	ETag     string    `json:"etag"`
+	PinnedAt time.Time `json:"pinned_at"`
+}
@@ -6,4 +6,19 @@ type SendConfigRequest struct {
 	ID         int64             `json:"id" example:"1"`
 	ETag       string            `json:"etag" example:"v1.0.0"`
 	ConfigData models.ConfigData `json:"config_data"`
+	// DeliveryMethod is the agent path that delivered the config: push,
+	// poll, pin or cache. The worker logs it and uses it to report duplicates.
+	DeliveryMethod string `json:"delivery_method,omitempty" example:"push"`
+}
+
+// ConfigRejectedCode is the Code of a ConfigRejection
+const ConfigRejectedCode = "config_rejected"
+
+// ConfigRejection is the worker's explanation for refusing a config, sent
+// as the data of its 400 response
+type ConfigRejection struct {
+	Code   string `json:"code"`
+	ETag   string `json:"etag"`
+	Field  string `json:"field,omitempty"`
+	Reason string `json:"reason"`
 }
@@ -2,20 +2,27 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/Alwanly/service-distribute-management/internal/config"
 	"github.com/Alwanly/service-distribute-management/internal/models"
+	"github.com/Alwanly/service-distribute-management/internal/server/agent/dto"
 	"github.com/Alwanly/service-distribute-management/internal/server/agent/repository"
 	"github.com/Alwanly/service-distribute-management/internal/server/agent/usecase"
 	"github.com/Alwanly/service-distribute-management/pkg/deps"
 	"github.com/Alwanly/service-distribute-management/pkg/logger"
 	"github.com/Alwanly/service-distribute-management/pkg/poll"
+	"github.com/Alwanly/service-distribute-management/pkg/validator"
+	"github.com/Alwanly/service-distribute-management/pkg/wrapper"
 	"github.com/gofiber/fiber/v2"
 
 	"go.uber.org/zap"
 )
 
+// ConfigPollName is the name GetConfigure is registered under with the poller
+const ConfigPollName = "get-configure"
+
 type Handler struct {
 	useCase *usecase.UseCase
 	logger  *logger.CanonicalLogger
@@ -26,6 +33,10 @@ type Handler struct {
 func NewHandler(d deps.App, config *config.AgentConfig) *Handler {
 	// Pass in the pubsub subscriber (may be nil) so repository can start Redis listener if available.
 	repo := repository.NewRepository(config.ControllerURL, config.WorkerURL, "", "", d.Pub)
+	repo.SetDebugEvents(config.DebugEvents)
+	repo.SetConfigCachePath(config.ConfigCachePath)
+	repo.SetHeartbeatRetry(config.Heartbeat.MaxRetries, config.Heartbeat.RetryBackoff)
+	repo.SetRetryableStatusCodes(config.RetryableStatusCodes)
 	controllerRepo := repository.NewControllerClient(config, d.Logger)
 	workerClient := repository.NewWorkerClient(config, d.Logger)
 
@@ -37,10 +48,26 @@ func NewHandler(d deps.App, config *config.AgentConfig) *Handler {
 		poller:  d.Poller,
 	}
 
+	// Interval updates pushed by the controller move the poller immediately
+	uc.OnPollIntervalUpdate(h.applyPollInterval)
+
 	// registration is performed at startup; do not register periodic register task here
 	// Health check endpoint (no auth required)
 	d.Fiber.Get("/health", h.health)
 
+	// Runtime state for troubleshooting config distribution
+	d.Fiber.Get("/debug/state", h.debugState)
+
+	// Resolved agent settings with secrets redacted
+	d.Fiber.Get("/debug/config", h.debugConfig)
+
+	// Local config pinning is only exposed when agent credentials are configured
+	if d.Middleware != nil {
+		d.Fiber.Post("/debug/pin-config", d.Middleware.BasicAuth(), h.pinConfig)
+		d.Fiber.Post("/debug/unpin-config", d.Middleware.BasicAuth(), h.unpinConfig)
+		d.Fiber.Post("/debug/reauthenticate", d.Middleware.BasicAuth(), h.reauthenticate)
+	}
+
 	return h
 }
 
@@ -49,11 +76,41 @@ func (h *Handler) RegisterAgent(ctx context.Context) (*models.RegistrationRespon
 	return h.useCase.RegisterWithController(ctx, h.cfg.Hostname, startTime)
 }
 
-// StartBackgroundServices starts background listeners and pollers for the agent
+// PreflightWorker checks the worker is reachable before registration
+func (h *Handler) PreflightWorker(ctx context.Context) error {
+	return h.useCase.PreflightWorker(ctx)
+}
+
+// ValidateConnectivity checks the controller and worker are reachable and
+// that registration works, without starting the agent
+func (h *Handler) ValidateConnectivity(ctx context.Context) error {
+	startTime := time.Now().UTC().Format(time.RFC3339)
+	return h.useCase.ValidateConnectivity(ctx, h.cfg.Hostname, startTime)
+}
+
+// ServeCachedConfig forwards the config cached by a previous run to the
+// worker; it returns nil when nothing is cached
+func (h *Handler) ServeCachedConfig(ctx context.Context) (*models.Configuration, error) {
+	return h.useCase.ServeCachedConfig(ctx)
+}
+
+// RetryRegistration registers with the controller, retrying until it
+// succeeds or ctx is done
+func (h *Handler) RetryRegistration(ctx context.Context) (*models.RegistrationResponse, error) {
+	startTime := time.Now().UTC().Format(time.RFC3339)
+	return h.useCase.RetryRegistration(ctx, h.cfg.Hostname, startTime)
+}
+
+// StartBackgroundServices starts the Redis listener and heartbeats; config
+// polling runs on the poller GetConfigure is registered with
 func (h *Handler) StartBackgroundServices(ctx context.Context) error {
-	hbInterval := h.cfg.Heartbeat.Interval
-	fbInterval := h.cfg.FallbackPoll.Interval
-	return h.useCase.StartBackgroundServices(ctx, hbInterval, fbInterval)
+	return h.useCase.StartBackgroundServices(ctx, h.cfg.Heartbeat.Interval)
+}
+
+// StopWorkerForwards ends the worker forward goroutine; call it on shutdown
+// once nothing queues forwards any more
+func (h *Handler) StopWorkerForwards() {
+	h.useCase.StopWorkerForwards()
 }
 
 // GetConfigure is a poller fetch function that fetches configuration from the controller
@@ -66,33 +123,7 @@ func (h *Handler) GetConfigure(ctx context.Context, log *logger.CanonicalLogger)
 
 	// If controller provided a new poll interval, and it's different, update poller
 	if pollInterval != nil {
-		_, currentInterval, _ := h.useCase.GetPollInfo()
-		if *pollInterval > 0 && *pollInterval != currentInterval {
-			agentID, _ := h.useCase.GetAgentID()
-
-			// log intent to update with both old and new values
-			h.logger.Info("updating poller interval",
-				logger.Int("old_interval", currentInterval),
-				logger.Int("new_interval", *pollInterval),
-				logger.String("agent_id", agentID),
-			)
-
-			// update repository stored interval
-			h.useCase.SetStoredPollInterval(*pollInterval)
-			// update poller runtime interval
-			if err := h.poller.UpdateInterval("get-configure", *pollInterval); err != nil {
-				h.logger.WithError(err).Error("failed to update poller interval",
-					logger.Int("new_interval", *pollInterval),
-					logger.String("agent_id", agentID),
-				)
-			} else {
-				h.logger.Info("updated poller interval",
-					logger.Int("new_interval", *pollInterval),
-					logger.Int("old_interval", currentInterval),
-					logger.String("agent_id", agentID),
-				)
-			}
-		}
+		h.applyPollInterval(*pollInterval)
 	}
 
 	if notModified {
@@ -108,5 +139,106 @@ func (h *Handler) GetConfigure(ctx context.Context, log *logger.CanonicalLogger)
 func (h *Handler) health(c *fiber.Ctx) error {
 	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "health_check"))
 
-	return c.JSON(fiber.Map{"status": "healthy"})
+	// ?deep=true also probes the controller and worker
+	res := h.useCase.Health(c.UserContext(), c.QueryBool("deep"))
+	if res.Status != "healthy" {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(res)
+	}
+	return c.JSON(res)
+}
+
+func (h *Handler) debugState(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "debug_state"))
+
+	return c.JSON(h.useCase.GetDebugState())
+}
+
+func (h *Handler) debugConfig(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "debug_config"))
+
+	return c.JSON(h.useCase.GetEffectiveConfig())
+}
+
+func (h *Handler) pinConfig(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "pin_config"))
+
+	req := new(dto.PinConfigRequest)
+	if err := validator.BindJSON(c, req); err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err))
+		res := validator.BodyErrorResponse(err)
+		return c.Status(res.Code).JSON(res)
+	}
+	if req.Config.URL == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(wrapper.ResponseBadRequest("config.url is required"))
+	}
+
+	state, err := h.useCase.PinConfig(c.UserContext(), req)
+	if err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return c.Status(fiber.StatusBadGateway).JSON(wrapper.ResponseFailed(fiber.StatusBadGateway, err.Error(), nil))
+	}
+
+	logger.AddToContext(c.UserContext(), zap.Bool(logger.FieldSuccess, true), zap.String(logger.FieldETag, state.ETag))
+	return c.JSON(state)
+}
+
+func (h *Handler) unpinConfig(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "unpin_config"))
+
+	if err := h.useCase.UnpinConfig(c.UserContext()); err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return c.Status(fiber.StatusBadGateway).JSON(wrapper.ResponseFailed(fiber.StatusBadGateway, err.Error(), nil))
+	}
+
+	logger.AddToContext(c.UserContext(), zap.Bool(logger.FieldSuccess, true))
+	return c.JSON(fiber.Map{"pinned": false})
+}
+
+func (h *Handler) reauthenticate(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "reauthenticate"))
+
+	agentID, err := h.useCase.ForceReauthenticate(c.UserContext())
+	if err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return c.Status(fiber.StatusBadGateway).JSON(wrapper.ResponseFailed(fiber.StatusBadGateway, err.Error(), nil))
+	}
+
+	logger.AddToContext(c.UserContext(), zap.Bool(logger.FieldSuccess, true), zap.String(logger.FieldAgentID, agentID))
+	return c.JSON(fiber.Map{"agent_id": agentID})
+}
+
+// applyPollInterval moves the config poller to newInterval seconds when it
+// differs from the current interval. It is used for intervals returned with
+// a config and for interval updates pushed by the controller.
+func (h *Handler) applyPollInterval(newInterval int) {
+	_, currentInterval, _ := h.useCase.GetPollInfo()
+	if newInterval <= 0 || newInterval == currentInterval {
+		return
+	}
+	agentID, _ := h.useCase.GetAgentID()
+
+	// log intent to update with both old and new values
+	h.logger.Info("updating poller interval",
+		logger.Int("old_interval", currentInterval),
+		logger.Int("new_interval", newInterval),
+		logger.String("agent_id", agentID),
+	)
+
+	// Apply to the poller first so the stored interval never
+	// reports a value the poll loop is not running at
+	if err := h.poller.UpdateInterval(ConfigPollName, newInterval); err != nil {
+		h.logger.WithError(err).Error("failed to update poller interval",
+			logger.String("poll_name", ConfigPollName),
+			logger.Bool("not_registered", errors.Is(err, poll.ErrNotRegistered)),
+			logger.Int("new_interval", newInterval),
+			logger.String("agent_id", agentID),
+		)
+		return
+	}
+	h.useCase.SetStoredPollInterval(newInterval)
+	h.logger.Info("updated poller interval",
+		logger.Int("new_interval", newInterval),
+		logger.Int("old_interval", currentInterval),
+		logger.String("agent_id", agentID),
+	)
 }
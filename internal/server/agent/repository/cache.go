@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/internal/models"
+)
+
+// cachedConfig is the on-disk form of the last config received from the
+// controller
+type cachedConfig struct {
+	ID         int64     `json:"id"`
+	ETag       string    `json:"etag"`
+	ConfigData string    `json:"config_data"`
+	SavedAt    time.Time `json:"saved_at"`
+}
+
+// SetConfigCachePath enables persisting every config received from the
+// controller to path. An empty path disables the cache.
+func (r *Repository) SetConfigCachePath(path string) {
+	r.cacheMutex.Lock()
+	defer r.cacheMutex.Unlock()
+	r.cachePath = path
+}
+
+// LoadCachedConfig returns the config last saved to the cache, or nil when
+// the cache is disabled or has not been written yet
+func (r *Repository) LoadCachedConfig() (*models.Configuration, error) {
+	r.cacheMutex.Lock()
+	path := r.cachePath
+	r.cacheMutex.Unlock()
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read config cache: %w", err)
+	}
+	var cached cachedConfig
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, fmt.Errorf("parse config cache %s: %w", path, err)
+	}
+	if cached.ETag == "" || cached.ConfigData == "" {
+		return nil, fmt.Errorf("config cache %s has no config", path)
+	}
+	return &models.Configuration{ID: cached.ID, ETag: cached.ETag, ConfigData: cached.ConfigData}, nil
+}
+
+// saveCachedConfig writes cfg to the cache through a temporary file so a
+// crash mid-write never leaves a truncated cache behind. A failed write is
+// reported in heartbeats but does not fail the config update.
+func (r *Repository) saveCachedConfig(cfg *models.Configuration) {
+	r.cacheMutex.Lock()
+	defer r.cacheMutex.Unlock()
+	if r.cachePath == "" || cfg == nil {
+		return
+	}
+	if err := writeConfigCache(r.cachePath, cfg); err != nil {
+		r.recordError(err)
+	}
+}
+
+func writeConfigCache(path string, cfg *models.Configuration) error {
+	data, err := json.Marshal(cachedConfig{
+		ID:         cfg.ID,
+		ETag:       cfg.ETag,
+		ConfigData: cfg.ConfigData,
+		SavedAt:    time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("encode config cache: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("write config cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write config cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write config cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write config cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/internal/models"
+)
+
+func TestConfigCache_WrittenOnConfigReceipt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	repo := NewRepository("http://controller", "", "agent-1", "token", nil).(*Repository)
+	repo.SetConfigCachePath(path)
+
+	if cfg, err := repo.LoadCachedConfig(); err != nil || cfg != nil {
+		t.Fatalf("expected no cached config before the first receipt, got %+v: %v", cfg, err)
+	}
+
+	// Poll path
+	if err := repo.UpdateConfig(&models.Configuration{ID: 1, ETag: "etag-1", ConfigData: `{"url":"http://one"}`}); err != nil {
+		t.Fatalf("UpdateConfig: %v", err)
+	}
+	assertCachedETag(t, path, "etag-1")
+
+	// Push path
+	log, _ := newTestLogger()
+	repo.applyConfig(context.Background(), log, &models.Configuration{ID: 2, ETag: "etag-2", ConfigData: `{"url":"http://two"}`}, repo.NextConfigSeq(), "", "push", time.Millisecond)
+	assertCachedETag(t, path, "etag-2")
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Fatalf("expected only the cache file to remain, got %d entries", len(entries))
+	}
+}
+
+func TestConfigCache_FailedWriteIsReported(t *testing.T) {
+	repo := NewRepository("http://controller", "", "agent-1", "token", nil).(*Repository)
+	repo.SetConfigCachePath(filepath.Join(t.TempDir(), "missing", "config.json"))
+
+	if err := repo.UpdateConfig(&models.Configuration{ETag: "etag-1", ConfigData: `{}`}); err != nil {
+		t.Fatalf("expected a cache failure not to fail the update, got %v", err)
+	}
+	if _, etag := repo.GetConfig(); etag != "etag-1" {
+		t.Fatalf("expected the config to be stored, got %q", etag)
+	}
+	if payload := repo.heartbeatPayload("etag-1"); payload.LastError == "" {
+		t.Fatal("expected the cache failure to be reported in heartbeats")
+	}
+}
+
+func TestConfigCache_CorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	repo := NewRepository("http://controller", "", "agent-1", "token", nil)
+	repo.SetConfigCachePath(path)
+
+	if _, err := repo.LoadCachedConfig(); err == nil {
+		t.Fatal("expected an error for a corrupt cache file")
+	}
+}
+
+// assertCachedETag loads the cache at path from a fresh repository, as a
+// restarted agent would
+func assertCachedETag(t *testing.T, path, etag string) {
+	t.Helper()
+	repo := NewRepository("http://controller", "", "", "", nil)
+	repo.SetConfigCachePath(path)
+	cfg, err := repo.LoadCachedConfig()
+	if err != nil || cfg == nil {
+		t.Fatalf("load cached config: %+v, %v", cfg, err)
+	}
+	if cfg.ETag != etag || cfg.ConfigData == "" {
+		t.Fatalf("expected cached config %s, got %+v", etag, cfg)
+	}
+}
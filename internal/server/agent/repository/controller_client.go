@@ -1,81 +1,67 @@
 package repository
 
 import (
-	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"strconv"
 	"sync"
 
 	"github.com/Alwanly/service-distribute-management/internal/config"
 	"github.com/Alwanly/service-distribute-management/internal/models"
 	"github.com/Alwanly/service-distribute-management/internal/server/agent/dto"
+	"github.com/Alwanly/service-distribute-management/pkg/httpclient"
+	"github.com/Alwanly/service-distribute-management/pkg/httpurl"
 	"github.com/Alwanly/service-distribute-management/pkg/logger"
 	"go.uber.org/zap"
 )
 
+// defaultPollPath is the controller config endpoint used before registration
+// has supplied a poll URL
+const defaultPollPath = "/config"
+
+var _ IControllerClient = (*controllerClient)(nil)
+
 type controllerClient struct {
 	httpClient    *http.Client
 	baseURL       string
 	username      string
 	password      string
+	bootstrap     string
+	metadata      map[string]string
 	logger        *logger.CanonicalLogger
 	currentConfig *StoreData
 	mutex         sync.Mutex
 }
 
 func NewControllerClient(cfg *config.AgentConfig, log *logger.CanonicalLogger) IControllerClient {
+	httpClient := &http.Client{Timeout: cfg.RequestTimeout}
+	if cfg.TLS != nil {
+		httpClient.Transport = &http.Transport{TLSClientConfig: cfg.TLS}
+	}
+
 	return &controllerClient{
-		httpClient: &http.Client{Timeout: cfg.RequestTimeout},
+		httpClient: httpClient,
 		baseURL:    cfg.ControllerURL,
 		username:   cfg.AgentUsername,
 		password:   cfg.AgentPassword,
+		bootstrap:  cfg.BootstrapToken,
+		metadata:   cfg.Metadata,
 		logger:     log,
 	}
 }
 
 func (c *controllerClient) Register(ctx context.Context, hostname, version, startTime string) (*models.RegistrationResponse, error) {
-	reqBody := map[string]string{
-		"hostname":   hostname,
-		"version":    version,
-		"start_time": startTime,
-	}
-
-	body, err := json.Marshal(reqBody)
+	reqBody, headers := c.registrationRequest(hostname, version, startTime)
+	target, err := httpurl.Join(c.baseURL, "/register")
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal registration request: %w", err)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/register", c.baseURL), bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.SetBasicAuth(c.username, c.password)
-
-	// Set GetBody for potential retries
-	buf := body
-	req.GetBody = func() (io.ReadCloser, error) {
-		return io.NopCloser(bytes.NewReader(buf)), nil
-	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		b, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("registration failed with status %d: %s", resp.StatusCode, string(b))
+		return nil, fmt.Errorf("registration failed: %w", err)
 	}
-
 	var regResp models.RegistrationResponse
-	if err := json.NewDecoder(resp.Body).Decode(&regResp); err != nil {
-		return nil, fmt.Errorf("failed to decode registration response: %w", err)
+	if _, err := httpclient.DoJSON(ctx, c.httpClient, http.MethodPost, target, reqBody, headers, &regResp); err != nil {
+		return nil, fmt.Errorf("registration failed: %w", err)
 	}
 
 	c.mutex.Lock()
@@ -91,60 +77,133 @@ func (c *controllerClient) Register(ctx context.Context, hostname, version, star
 	return &regResp, nil
 }
 
-func (c *controllerClient) GetConfiguration(ctx context.Context, agentID, pollURL, ifNoneMatch string) (*models.Configuration, string, *int, bool, error) {
-	target := fmt.Sprintf("%s%s", c.baseURL, c.currentConfig.PollURL)
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+// CheckRegistration sends the registration request to the controller's
+// dry-run endpoint, which authenticates and validates it like a real one
+// but creates no agent and leaves a bootstrap token's uses alone
+func (c *controllerClient) CheckRegistration(ctx context.Context, hostname, version, startTime string) error {
+	reqBody, headers := c.registrationRequest(hostname, version, startTime)
+	target, err := httpurl.Join(c.baseURL, "/register/check")
 	if err != nil {
-		return nil, "", nil, false, fmt.Errorf("failed to create get configuration request: %w", err)
+		return fmt.Errorf("registration check failed: %w", err)
+	}
+	if _, err := httpclient.DoJSON(ctx, c.httpClient, http.MethodPost, target, reqBody, headers, nil); err != nil {
+		return fmt.Errorf("registration check failed: %w", err)
 	}
+	return nil
+}
 
-	if agentID != "" {
-		req.Header.Set("X-Agent-ID", agentID)
+// RefreshToken asks the controller for a new API token for agentID, keeping
+// the agent ID. It always authenticates with the shared agent credentials: a
+// bootstrap token is spent by the first registration.
+func (c *controllerClient) RefreshToken(ctx context.Context, agentID string) (string, error) {
+	target, err := httpurl.Join(c.baseURL, "/register/refresh")
+	if err != nil {
+		return "", fmt.Errorf("token refresh failed: %w", err)
+	}
+	headers := map[string]string{
+		"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(c.username+":"+c.password)),
 	}
-	if ifNoneMatch != "" {
-		req.Header.Set("If-None-Match", ifNoneMatch)
+	var resp struct {
+		AgentID  string `json:"agent_id"`
+		APIToken string `json:"api_token"`
+	}
+	if _, err := httpclient.DoJSON(ctx, c.httpClient, http.MethodPost, target, map[string]string{"agent_id": agentID}, headers, &resp); err != nil {
+		return "", fmt.Errorf("token refresh failed: %w", err)
+	}
+	if resp.APIToken == "" || resp.AgentID != agentID {
+		return "", fmt.Errorf("token refresh failed: invalid response")
 	}
 
 	c.mutex.Lock()
-	token := ""
-	if c.currentConfig != nil {
-		token = c.currentConfig.APIToken
+	defer c.mutex.Unlock()
+	if c.currentConfig == nil {
+		c.currentConfig = &StoreData{}
 	}
-	c.mutex.Unlock()
-	if token != "" {
-		req.Header.Set("Authorization", "Bearer "+token)
+	c.currentConfig.AgentID = agentID
+	c.currentConfig.APIToken = resp.APIToken
+	return resp.APIToken, nil
+}
+
+// registrationRequest builds the body and credentials of a registration
+func (c *controllerClient) registrationRequest(hostname, version, startTime string) (map[string]interface{}, map[string]string) {
+	reqBody := map[string]interface{}{
+		"hostname":   hostname,
+		"version":    version,
+		"start_time": startTime,
+	}
+	if len(c.metadata) > 0 {
+		reqBody["metadata"] = c.metadata
 	}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, "", nil, false, fmt.Errorf("get configuration request failed: %w", err)
+	headers := map[string]string{}
+	if c.bootstrap != "" {
+		headers["Authorization"] = "Bearer " + c.bootstrap
+	} else {
+		headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(c.username+":"+c.password))
 	}
-	defer resp.Body.Close()
+	return reqBody, headers
+}
 
-	var pollIntervalSeconds *int
-	respHeader := resp.Header
-	if val := respHeader.Get("x-poll-interval-seconds"); val != "" {
-		var interval int
-		_, err := fmt.Sscanf(val, "%d", &interval)
-		if err == nil {
-			pollIntervalSeconds = &interval
-		}
+// snapshot returns a copy of the registration state so callers never read
+// currentConfig fields outside the mutex. ok is false before the first
+// Register or GetConfiguration.
+func (c *controllerClient) snapshot() (data StoreData, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.currentConfig == nil {
+		return StoreData{}, false
 	}
+	return *c.currentConfig, true
+}
 
-	if resp.StatusCode == http.StatusNotModified {
-		return nil, "", pollIntervalSeconds, true, nil
+// GetConfiguration fetches the config from the poll URL of the last
+// registration, falling back to pollURL and then /config. A relative poll
+// URL is resolved against the controller URL; an absolute one, e.g. a
+// shard's config endpoint on another host, is used as is.
+func (c *controllerClient) GetConfiguration(ctx context.Context, agentID, pollURL, ifNoneMatch string) (*models.Configuration, string, *int, bool, error) {
+	current, _ := c.snapshot()
+	path := current.PollURL
+	if path == "" {
+		path = pollURL
+	}
+	if path == "" {
+		path = defaultPollPath
+	}
+	target, err := httpurl.Join(c.baseURL, path)
+	if err != nil {
+		return nil, "", nil, false, fmt.Errorf("invalid poll URL: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		b, _ := io.ReadAll(resp.Body)
-		return nil, "", pollIntervalSeconds, false, fmt.Errorf("get configuration returned status %d: %s", resp.StatusCode, string(b))
+	headers := map[string]string{
+		"X-Agent-ID":    agentID,
+		"If-None-Match": ifNoneMatch,
+	}
+	if v := WorkerSchemaVersion(ctx); v > 0 {
+		headers[models.HeaderConfigSchemaVersion] = strconv.Itoa(v)
+	}
+	if current.APIToken != "" {
+		headers["Authorization"] = "Bearer " + current.APIToken
 	}
 
 	var respBody dto.ConfigurationResponse
-	if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
-		return nil, "", nil, false, fmt.Errorf("failed to decode configuration: %w", err)
+	resp, err := httpclient.Do(ctx, c.httpClient, http.MethodGet, target, nil, headers, &respBody)
+
+	var pollIntervalSeconds *int
+	if resp != nil {
+		if val := resp.Header.Get("x-poll-interval-seconds"); val != "" {
+			var interval int
+			if _, err := fmt.Sscanf(val, "%d", &interval); err == nil {
+				pollIntervalSeconds = &interval
+			}
+		}
+		if resp.StatusCode == http.StatusNotModified {
+			return nil, "", pollIntervalSeconds, true, nil
+		}
+	}
+	if err != nil {
+		return nil, "", pollIntervalSeconds, false, fmt.Errorf("get configuration failed: %w", err)
 	}
+
 	cfg := models.Configuration{
 		ID:         respBody.ID,
 		ETag:       respBody.ETag,
@@ -169,48 +228,45 @@ func (c *controllerClient) GetConfiguration(ctx context.Context, agentID, pollUR
 }
 
 func (c *controllerClient) SendHeartbeat(ctx context.Context, logger *logger.CanonicalLogger) error {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-
-	if c.currentConfig == nil {
+	current, ok := c.snapshot()
+	if !ok {
 		// nothing to send
 		return nil
 	}
 
 	payload := map[string]string{
-		"config_version": c.currentConfig.ETag,
+		"config_version": current.ETag,
 		"status":         "healthy",
 	}
 
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal heartbeat payload: %w", err)
+	headers := map[string]string{"X-Agent-ID": current.AgentID}
+	if current.APIToken != "" {
+		headers["Authorization"] = "Bearer " + current.APIToken
 	}
-
-	target := fmt.Sprintf("%s/heartbeat", c.baseURL)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	target, err := httpurl.Join(c.baseURL, "/heartbeat")
 	if err != nil {
-		return fmt.Errorf("failed to create heartbeat request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	if c.currentConfig.AgentID != "" {
-		req.Header.Set("X-Agent-ID", c.currentConfig.AgentID)
+		return fmt.Errorf("heartbeat failed: %w", err)
 	}
-	if c.currentConfig.APIToken != "" {
-		req.Header.Set("Authorization", "Bearer "+c.currentConfig.APIToken)
+	if _, err := httpclient.DoJSON(ctx, c.httpClient, http.MethodPost, target, payload, headers, nil); err != nil {
+		return fmt.Errorf("heartbeat failed: %w", err)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	logger.Debug("heartbeat sent successfully", zap.String("agent_id", current.AgentID), zap.String("config_version", current.ETag))
+	return nil
+}
+
+func (c *controllerClient) CheckHealth(ctx context.Context) error {
+	return checkHealth(ctx, c.httpClient, c.baseURL)
+}
+
+// checkHealth calls baseURL/health and fails on transport errors or a non-2xx status
+func checkHealth(ctx context.Context, client *http.Client, baseURL string) error {
+	target, err := httpurl.Join(baseURL, "/health")
 	if err != nil {
-		return fmt.Errorf("heartbeat request failed: %w", err)
+		return fmt.Errorf("health check failed: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		b, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("heartbeat returned status %d: %s", resp.StatusCode, string(b))
+	if _, err := httpclient.DoJSON(ctx, client, http.MethodGet, target, nil, nil, nil); err != nil {
+		return fmt.Errorf("health check failed: %w", err)
 	}
-
-	logger.Debug("heartbeat sent successfully", zap.String("agent_id", c.currentConfig.AgentID), zap.String("config_version", c.currentConfig.ETag))
 	return nil
 }
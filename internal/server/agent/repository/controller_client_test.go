@@ -0,0 +1,274 @@
+package repository
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/internal/config"
+	"github.com/Alwanly/service-distribute-management/internal/models"
+)
+
+// newFakeController serves /register and a config endpoint at /config
+func newFakeController(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(fakeControllerMux())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func fakeControllerMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(models.RegistrationResponse{
+			AgentID:             "agent-1",
+			PollURL:             "/config",
+			PollIntervalSeconds: 30,
+			APIToken:            "token-1",
+		})
+	})
+	mux.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":1,"etag":"etag-1","config":{"url":"http://example.com"}}`))
+	})
+	return mux
+}
+
+// issueCert creates a certificate signed by parent (self-signed when parent
+// is nil) and writes it and its key to dir as PEM files
+func issueCert(t *testing.T, dir, name string, tmpl, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	for path, block := range map[string]*pem.Block{
+		filepath.Join(dir, name+".crt"): {Type: "CERTIFICATE", Bytes: der},
+		filepath.Join(dir, name+".key"): {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+	return cert, key
+}
+
+// TestControllerClient_MutualTLS runs the agent's controller client against a
+// server on the controller's mTLS settings, both loaded from the environment
+// the way the services load them
+func TestControllerClient_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	caCert, caKey := issueCert(t, dir, "ca", &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil, nil)
+	issueCert(t, dir, "controller", &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "controller"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, caCert, caKey)
+	issueCert(t, dir, "agent", &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "agent"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, caCert, caKey)
+
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("CONTROLLER_MTLS_ADDR", "127.0.0.1:0")
+	t.Setenv("CONTROLLER_TLS_CERT", filepath.Join(dir, "controller.crt"))
+	t.Setenv("CONTROLLER_TLS_KEY", filepath.Join(dir, "controller.key"))
+	t.Setenv("CONTROLLER_TLS_CLIENT_CA", filepath.Join(dir, "ca.crt"))
+	controllerCfg, err := config.LoadControllerConfig()
+	if err != nil {
+		t.Fatalf("load controller config: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(fakeControllerMux())
+	srv.TLS = controllerCfg.TLS
+	srv.StartTLS()
+	defer srv.Close()
+
+	t.Setenv("CONTROLLER_URL", srv.URL)
+	t.Setenv("AGENT_TLS_CERT", filepath.Join(dir, "agent.crt"))
+	t.Setenv("AGENT_TLS_KEY", filepath.Join(dir, "agent.key"))
+	t.Setenv("AGENT_TLS_CA", filepath.Join(dir, "ca.crt"))
+	agentCfg, err := config.LoadAgentConfig()
+	if err != nil {
+		t.Fatalf("load agent config: %v", err)
+	}
+	log, _ := newTestLogger()
+
+	resp, err := NewControllerClient(agentCfg, log).Register(context.Background(), "host", "v1", "now")
+	if err != nil {
+		t.Fatalf("register over mTLS: %v", err)
+	}
+	if resp.AgentID != "agent-1" {
+		t.Errorf("got agent ID %q, want agent-1", resp.AgentID)
+	}
+
+	// Trusting the controller is not enough; the agent must present its cert
+	noCert := *agentCfg
+	noCert.TLS = &tls.Config{RootCAs: agentCfg.TLS.RootCAs}
+	if _, err := NewControllerClient(&noCert, log).Register(context.Background(), "host", "v1", "now"); err == nil {
+		t.Error("register without a client certificate succeeded")
+	}
+}
+
+func TestControllerClient_ConcurrentRegisterAndGetConfiguration(t *testing.T) {
+	srv := newFakeController(t)
+	log, _ := newTestLogger()
+	client := NewControllerClient(&config.AgentConfig{ControllerURL: srv.URL, RequestTimeout: 5 * time.Second}, log)
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, _ = client.Register(ctx, "host", "v1", "now")
+		}()
+		go func() {
+			defer wg.Done()
+			_, _, _, _, _ = client.GetConfiguration(ctx, "agent-1", "/config", "")
+		}()
+	}
+	wg.Wait()
+}
+
+func TestControllerClient_GetConfigurationBeforeRegister(t *testing.T) {
+	srv := newFakeController(t)
+	log, _ := newTestLogger()
+	client := NewControllerClient(&config.AgentConfig{ControllerURL: srv.URL, RequestTimeout: 5 * time.Second}, log)
+
+	cfg, etag, _, _, err := client.GetConfiguration(context.Background(), "", "", "")
+	if err != nil {
+		t.Fatalf("get configuration: %v", err)
+	}
+	if etag != "etag-1" || cfg == nil {
+		t.Fatalf("got etag %q cfg %v, want config served from the default path", etag, cfg)
+	}
+}
+
+func TestControllerClient_GetConfigurationJoinsPollURL(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	controller := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.RequestURI())
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"id":1,"etag":"etag-1","config":{"url":"http://example.com"}}`))
+	}))
+	defer controller.Close()
+
+	tests := []struct {
+		name          string
+		controllerURL string
+		pollURL       string
+		wantPath      string
+	}{
+		{name: "default", controllerURL: controller.URL, wantPath: "/config"},
+		{name: "relative", controllerURL: controller.URL + "/", pollURL: "/config?profile=eu", wantPath: "/config?profile=eu"},
+		{name: "relative under base path", controllerURL: controller.URL + "/api", pollURL: "/config", wantPath: "/api/config"},
+		// An absolute poll URL is used as is, not appended to the controller URL
+		{name: "absolute", controllerURL: "http://unreachable.invalid", pollURL: controller.URL + "/v2/config", wantPath: "/v2/config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			paths = nil
+			mu.Unlock()
+			log, _ := newTestLogger()
+			client := NewControllerClient(&config.AgentConfig{ControllerURL: tt.controllerURL, RequestTimeout: 5 * time.Second}, log)
+
+			_, etag, _, _, err := client.GetConfiguration(context.Background(), "agent-1", tt.pollURL, "")
+			if err != nil || etag != "etag-1" {
+				t.Fatalf("got etag %q, err %v; want etag-1", etag, err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if len(paths) != 1 || paths[0] != tt.wantPath {
+				t.Fatalf("expected one poll of %s, got %v", tt.wantPath, paths)
+			}
+		})
+	}
+}
+
+func TestControllerClient_PollsAbsolutePollURLFromRegistration(t *testing.T) {
+	// A sharded controller directs the agent to another host's config
+	// endpoint at registration
+	var shardHits atomic.Int32
+	shard := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/shards/2/config" || r.Header.Get("Authorization") != "Bearer token-1" {
+			t.Errorf("unexpected shard request %s with Authorization %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		shardHits.Add(1)
+		_, _ = w.Write([]byte(`{"id":1,"etag":"etag-shard","config":{"url":"http://example.com"}}`))
+	}))
+	defer shard.Close()
+	controller := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/register" {
+			t.Errorf("config fetched from the registering controller: %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(models.RegistrationResponse{
+			AgentID:             "agent-1",
+			PollURL:             shard.URL + "/shards/2/config",
+			PollIntervalSeconds: 30,
+			APIToken:            "token-1",
+		})
+	}))
+	defer controller.Close()
+
+	log, _ := newTestLogger()
+	client := NewControllerClient(&config.AgentConfig{ControllerURL: controller.URL, RequestTimeout: 5 * time.Second}, log)
+	if _, err := client.Register(context.Background(), "host", "v1", "now"); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	_, etag, _, _, err := client.GetConfiguration(context.Background(), "agent-1", "", "")
+	if err != nil || etag != "etag-shard" {
+		t.Fatalf("got etag %q, err %v; want the shard's config", etag, err)
+	}
+	if shardHits.Load() != 1 {
+		t.Fatalf("shard served %d requests, want 1", shardHits.Load())
+	}
+}
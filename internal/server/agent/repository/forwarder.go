@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrForwardSuperseded is returned for a worker forward that was skipped
+// because a newer config was queued before it was sent
+var ErrForwardSuperseded = errors.New("worker forward superseded by a newer config")
+
+// ErrForwarderStopped is returned for a worker forward queued or still
+// waiting when the agent shuts down
+var ErrForwarderStopped = errors.New("worker forwarder stopped")
+
+// forwardJob is one queued worker forward; done receives its outcome
+type forwardJob struct {
+	ctx  context.Context
+	etag string
+	seq  uint64
+	send func(ctx context.Context) error
+	done chan error
+}
+
+// workerForwarder sends worker forwards one at a time, in the order of
+// their sequence numbers (see NextConfigSeq). Its queue holds only the
+// newest pending forward: queueing a config while another is waiting skips
+// the waiting one, so rapid updates coalesce into a forward of the newest
+// version, and a forward older than one already queued is skipped.
+type workerForwarder struct {
+	start sync.Once
+	// mu serialises queueing so replacing the pending job is atomic
+	mu    sync.Mutex
+	queue chan *forwardJob
+	// latest is the highest sequence number queued, guarded by mu
+	latest uint64
+	// stopped is closed by stop; stopping is set under mu first
+	stopped  chan struct{}
+	stopping bool
+	// superseded counts forwards skipped for a newer config
+	superseded atomic.Int64
+}
+
+func newWorkerForwarder() *workerForwarder {
+	return &workerForwarder{queue: make(chan *forwardJob, 1), stopped: make(chan struct{})}
+}
+
+// forward queues send and waits until it has run, returning its error, or
+// until it is superseded (ErrForwardSuperseded), the forwarder stops or ctx
+// is done
+func (f *workerForwarder) forward(ctx context.Context, etag string, seq uint64, send func(ctx context.Context) error) error {
+	f.start.Do(func() { go f.run() })
+
+	job := &forwardJob{ctx: ctx, etag: etag, seq: seq, send: send, done: make(chan error, 1)}
+	f.mu.Lock()
+	switch {
+	case f.stopping:
+		f.mu.Unlock()
+		return ErrForwarderStopped
+	case seq < f.latest:
+		// A newer version is queued or already sent
+		f.mu.Unlock()
+		f.superseded.Add(1)
+		return ErrForwardSuperseded
+	}
+	f.latest = seq
+	select {
+	case pending := <-f.queue:
+		f.superseded.Add(1)
+		pending.done <- ErrForwardSuperseded
+	default:
+	}
+	f.queue <- job
+	f.mu.Unlock()
+
+	select {
+	case err := <-job.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stop ends the forward goroutine once the forward in flight, if any, has
+// run; the pending forward and later ones fail with ErrForwarderStopped
+func (f *workerForwarder) stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stopping {
+		return
+	}
+	f.stopping = true
+	close(f.stopped)
+	select {
+	case pending := <-f.queue:
+		pending.done <- ErrForwarderStopped
+	default:
+	}
+}
+
+// run is the single goroutine sending forwards to the worker
+func (f *workerForwarder) run() {
+	for {
+		select {
+		case <-f.stopped:
+			return
+		case job := <-f.queue:
+			select {
+			case <-f.stopped:
+				job.done <- ErrForwarderStopped
+				return
+			default:
+			}
+			if err := job.ctx.Err(); err != nil {
+				job.done <- err
+				continue
+			}
+			job.done <- job.send(job.ctx)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/internal/server/agent/dto"
+	"github.com/Alwanly/service-distribute-management/pkg/httpclient"
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+	"github.com/Alwanly/service-distribute-management/pkg/retry"
+	"go.uber.org/zap"
+)
+
+// defaultHeartbeatRetries is how often a failed heartbeat is retried unless
+// SetHeartbeatRetry says otherwise
+const defaultHeartbeatRetries = 2
+
+// heartbeatStats tracks heartbeat outcomes for /debug/state
+type heartbeatStats struct {
+	mu                  sync.Mutex
+	consecutiveFailures int64
+	missed              int64
+	retries             int64
+	lastSuccess         time.Time
+}
+
+func newHeartbeatRetry(maxRetries int, backoff time.Duration) retry.Config {
+	return retry.Config{
+		MaxRetries:     maxRetries,
+		InitialBackoff: backoff,
+		MaxBackoff:     backoff * 4,
+		Multiplier:     2,
+		RetryIf:        httpclient.RetryableStatus(nil),
+	}
+}
+
+// SetHeartbeatRetry sets how many times a failed heartbeat is retried and
+// the backoff before the first retry, doubling for each further one.
+// Retries stop when the next heartbeat is due.
+func (r *Repository) SetHeartbeatRetry(maxRetries int, backoff time.Duration) {
+	retryIf := r.heartbeatRetry.RetryIf
+	r.heartbeatRetry = newHeartbeatRetry(maxRetries, backoff)
+	r.heartbeatRetry.RetryIf = retryIf
+}
+
+// SetRetryableStatusCodes sets the controller statuses a failed heartbeat
+// is retried on; see httpclient.RetryableStatus
+func (r *Repository) SetRetryableStatusCodes(codes []int) {
+	r.heartbeatRetry.RetryIf = httpclient.RetryableStatus(codes)
+}
+
+// heartbeatWithRetry sends one heartbeat, retrying failures within interval
+// so a brief controller outage does not cost a heartbeat. Only a heartbeat
+// that still fails after its retries is logged and counted as missed.
+func (r *Repository) heartbeatWithRetry(ctx context.Context, log *logger.CanonicalLogger, client *http.Client, interval time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, interval)
+	defer cancel()
+
+	attempts := 0
+	err := retry.WithExponentialBackoff(ctx, r.heartbeatRetry, func(ctx context.Context) error {
+		attempts++
+		if attempts > 1 {
+			r.heartbeat.mu.Lock()
+			r.heartbeat.retries++
+			r.heartbeat.mu.Unlock()
+		}
+		return r.permanentIfRejected(r.sendHeartbeat(ctx, log, client))
+	})
+
+	r.heartbeat.mu.Lock()
+	defer r.heartbeat.mu.Unlock()
+	if err == nil {
+		r.heartbeat.consecutiveFailures = 0
+		r.heartbeat.lastSuccess = time.Now().UTC()
+		return
+	}
+	r.heartbeat.missed++
+	r.heartbeat.consecutiveFailures++
+	log.WithError(err).Error("heartbeat missed",
+		zap.Int("attempts", attempts),
+		zap.Int64("consecutive_failures", r.heartbeat.consecutiveFailures),
+	)
+}
+
+// permanentIfRejected marks a 4xx the heartbeat retry config does not retry
+// as permanent: the controller rejected the heartbeat itself and sending it
+// again before the next interval would be rejected the same way. A 401 the
+// token refresh could not fix ends up here too.
+func (r *Repository) permanentIfRejected(err error) error {
+	var statusErr *httpclient.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode < 400 || statusErr.StatusCode >= 500 {
+		return err
+	}
+	if r.heartbeatRetry.RetryIf != nil && r.heartbeatRetry.RetryIf(err) {
+		return err
+	}
+	return retry.Permanent(err)
+}
+
+// GetHeartbeatStats returns a snapshot of the heartbeat counters
+func (r *Repository) GetHeartbeatStats() dto.HeartbeatStats {
+	r.heartbeat.mu.Lock()
+	defer r.heartbeat.mu.Unlock()
+
+	stats := dto.HeartbeatStats{
+		ConsecutiveFailures: r.heartbeat.consecutiveFailures,
+		Missed:              r.heartbeat.missed,
+		Retries:             r.heartbeat.retries,
+	}
+	if !r.heartbeat.lastSuccess.IsZero() {
+		last := r.heartbeat.lastSuccess
+		stats.LastSuccessAt = &last
+	}
+	return stats
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/pkg/httpclient"
+	"github.com/Alwanly/service-distribute-management/pkg/retry"
+)
+
+// newFlakyController fails the first failures heartbeats with 503
+func newFlakyController(t *testing.T, failures int32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestHeartbeatWithRetry_RecoversFromTransientFailures(t *testing.T) {
+	controller, calls := newFlakyController(t, 2)
+	log, logs := newTestLogger()
+	repo := NewRepository(controller.URL, "", "agent-1", "token", nil).(*Repository)
+	repo.SetHeartbeatRetry(2, time.Millisecond)
+
+	repo.heartbeatWithRetry(context.Background(), log, &http.Client{Timeout: time.Second}, time.Second)
+
+	if got := calls.Load(); got != 3 {
+		t.Fatalf("expected two retries, got %d requests", got)
+	}
+	stats := repo.GetHeartbeatStats()
+	if stats.Missed != 0 || stats.ConsecutiveFailures != 0 || stats.Retries != 2 || stats.LastSuccessAt == nil {
+		t.Fatalf("expected a recovered heartbeat, got %+v", stats)
+	}
+	if logs.FilterMessage("heartbeat missed").Len() != 0 {
+		t.Fatal("a recovered heartbeat was logged as missed")
+	}
+}
+
+func TestHeartbeatWithRetry_CountsMisses(t *testing.T) {
+	controller, calls := newFlakyController(t, 4)
+	log, logs := newTestLogger()
+	repo := NewRepository(controller.URL, "", "agent-1", "token", nil).(*Repository)
+	repo.SetHeartbeatRetry(1, time.Millisecond)
+	client := &http.Client{Timeout: time.Second}
+
+	// Both attempts of each of the first two heartbeats fail
+	for i := 0; i < 2; i++ {
+		repo.heartbeatWithRetry(context.Background(), log, client, time.Second)
+	}
+	stats := repo.GetHeartbeatStats()
+	if calls.Load() != 4 || stats.Missed != 2 || stats.ConsecutiveFailures != 2 || stats.LastSuccessAt != nil {
+		t.Fatalf("expected two missed heartbeats after 4 requests, got %d requests and %+v", calls.Load(), stats)
+	}
+	if logs.FilterMessage("heartbeat missed").Len() != 2 {
+		t.Fatal("expected each miss to be logged once")
+	}
+
+	repo.heartbeatWithRetry(context.Background(), log, client, time.Second)
+	if stats := repo.GetHeartbeatStats(); stats.ConsecutiveFailures != 0 || stats.Missed != 2 || stats.LastSuccessAt == nil {
+		t.Fatalf("expected a success to reset the consecutive failures, got %+v", stats)
+	}
+}
+
+func TestHeartbeatWithRetry_StopsAtInterval(t *testing.T) {
+	controller, calls := newFlakyController(t, 100)
+	log, _ := newTestLogger()
+	repo := NewRepository(controller.URL, "", "agent-1", "token", nil).(*Repository)
+	repo.SetHeartbeatRetry(100, 20*time.Millisecond)
+
+	start := time.Now()
+	repo.heartbeatWithRetry(context.Background(), log, &http.Client{Timeout: time.Second}, 50*time.Millisecond)
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("retries ran past the interval: %s", elapsed)
+	}
+	if calls.Load() >= 100 {
+		t.Fatalf("expected retries to stop at the interval, got %d requests", calls.Load())
+	}
+	if stats := repo.GetHeartbeatStats(); stats.Missed != 1 {
+		t.Fatalf("expected one missed heartbeat, got %+v", stats)
+	}
+}
+
+func TestHeartbeatWithRetry_RetriesOnlyConfiguredStatuses(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		wantCalls int32
+	}{
+		{name: "configured status is retried", status: http.StatusInternalServerError, wantCalls: 2},
+		{name: "other status fails at once", status: http.StatusServiceUnavailable, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			controller := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) == 1 {
+					w.WriteHeader(tt.status)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer controller.Close()
+
+			log, _ := newTestLogger()
+			repo := NewRepository(controller.URL, "", "agent-1", "token", nil).(*Repository)
+			repo.SetRetryableStatusCodes([]int{http.StatusInternalServerError})
+			repo.SetHeartbeatRetry(2, time.Millisecond)
+
+			repo.heartbeatWithRetry(context.Background(), log, &http.Client{Timeout: time.Second}, time.Second)
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Fatalf("got %d requests, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestPermanentIfRejected(t *testing.T) {
+	repo := NewRepository("http://controller", "", "agent-1", "token", nil).(*Repository)
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int
+	}{
+		{name: "bad request", err: &httpclient.StatusError{StatusCode: http.StatusBadRequest}, wantCalls: 1},
+		{name: "unauthorized after refresh", err: &httpclient.StatusError{StatusCode: http.StatusUnauthorized}, wantCalls: 1},
+		{name: "retryable 4xx", err: &httpclient.StatusError{StatusCode: http.StatusTooManyRequests}, wantCalls: 3},
+		{name: "server error", err: &httpclient.StatusError{StatusCode: http.StatusInternalServerError}, wantCalls: 3},
+		{name: "no response", err: errors.New("connection refused"), wantCalls: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// No RetryIf, so only a permanent error stops the retries
+			calls := 0
+			err := retry.WithExponentialBackoff(context.Background(), retry.Config{MaxRetries: 2, Multiplier: 1}, func(context.Context) error {
+				calls++
+				return repo.permanentIfRejected(tt.err)
+			})
+			if calls != tt.wantCalls || !errors.Is(err, tt.err) {
+				t.Fatalf("got %d calls and %v, want %d calls returning the status error", calls, err, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/Alwanly/service-distribute-management/internal/models"
+	"github.com/Alwanly/service-distribute-management/internal/server/agent/dto"
 	"github.com/Alwanly/service-distribute-management/pkg/logger"
 )
 
@@ -12,9 +13,17 @@ import (
 type IControllerClient interface {
 	// Register registers the agent with the controller
 	Register(ctx context.Context, hostname, version, startTime string) (*models.RegistrationResponse, error)
+	// CheckRegistration asks the controller whether a registration would be
+	// accepted, without registering
+	CheckRegistration(ctx context.Context, hostname, version, startTime string) error
+	// RefreshToken gets a new API token for an already registered agent
+	// without changing its agent ID
+	RefreshToken(ctx context.Context, agentID string) (string, error)
 	// GetConfiguration fetches the configuration from the controller using the provided poll URL.
 	// Returns: configuration, new ETag, optional poll interval (nil if not provided), notModified flag, error
 	GetConfiguration(ctx context.Context, agentID, pollURL, ifNoneMatch string) (*models.Configuration, string, *int, bool, error)
+	// CheckHealth calls the controller's /health endpoint
+	CheckHealth(ctx context.Context) error
 }
 
 // IWorkerClient defines the interface for communicating with the worker service
@@ -23,6 +32,10 @@ type IWorkerClient interface {
 	SendConfiguration(ctx context.Context, config *models.Configuration) error
 	// SendConfigurationWithRetry sends the configuration to the worker with retry/backoff
 	SendConfigurationWithRetry(ctx context.Context, config *models.Configuration, maxRetries int) error
+	// CheckHealth calls the worker's /health endpoint
+	CheckHealth(ctx context.Context) error
+	// SchemaVersion returns the newest config schema the worker supports
+	SchemaVersion(ctx context.Context) (int, error)
 }
 
 type IRepository interface {
@@ -34,6 +47,15 @@ type IRepository interface {
 	GetCurrentConfig() (*models.Configuration, error)
 	// UpdateConfig updates the worker configuration
 	UpdateConfig(config *models.Configuration) error
+	// StoreConfigIfNew stores config, fetched under seq (see NextConfigSeq),
+	// unless the store already holds its ETag or a config fetched later, and
+	// reports whether it stored it. Only the caller that stored a version
+	// forwards it, so a push and a poll racing for the same ETag forward it
+	// once, and a slow fetch never replaces a newer config.
+	StoreConfigIfNew(config *models.Configuration, seq uint64) bool
+	// NextConfigSeq returns a number ordering config fetches and worker
+	// forwards; take it before fetching
+	NextConfigSeq() uint64
 	// SetPollInfo sets the poll URL and interval
 	SetPollInfo(pollURL string, pollInterval int) error
 	// GetPollInfo retrieves the poll URL and interval
@@ -50,8 +72,58 @@ type IRepository interface {
 	GetConfig() (*models.Configuration, string)
 	// StartRedisListener starts a background Redis subscription listener
 	StartRedisListener(ctx context.Context, logger *logger.CanonicalLogger) error
-	// RegisterConfigPolling registers fallback polling mechanism for configuration
-	RegisterConfigPolling(ctx context.Context, logger *logger.CanonicalLogger)
 	// RegisterHeartbeatPolling starts periodic heartbeat to controller
 	RegisterHeartbeatPolling(ctx context.Context, logger *logger.CanonicalLogger, interval time.Duration)
+	// RecordWorkerForward records the outcome of forwarding a config to the worker
+	RecordWorkerForward(logger *logger.CanonicalLogger, etag string, err error)
+	// UnforwardedConfig returns the stored config and its seq while the
+	// worker has not accepted or rejected it, nil otherwise
+	UnforwardedConfig() (*models.Configuration, uint64)
+	// ClearErrorsBefore clears the error reported in heartbeats when it was
+	// recorded before since
+	ClearErrorsBefore(since time.Time)
+	// GetWorkerSyncState returns the current worker forward tracking state
+	GetWorkerSyncState() dto.WorkerSyncState
+	// PinConfig pins a local override config and forwards it to the worker
+	PinConfig(ctx context.Context, logger *logger.CanonicalLogger, config *models.Configuration) error
+	// UnpinConfig removes the local override and restores the controller config on the worker
+	UnpinConfig(ctx context.Context, logger *logger.CanonicalLogger) error
+	// IsConfigPinned reports whether a local override config is pinned
+	IsConfigPinned() bool
+	// GetPinnedState returns the pinned config state, or nil when not pinned
+	GetPinnedState() *dto.PinnedConfigState
+	// GetRedisListenerStats returns Redis listener counters, or nil without a subscriber
+	GetRedisListenerStats() *dto.RedisListenerStats
+	// GetDeliveryMode returns whether config updates currently arrive by push or poll only
+	GetDeliveryMode() dto.DeliveryModeState
+	// SetWorkerSchemaVersion stores the config schema version the worker supports
+	SetWorkerSchemaVersion(version int)
+	// GetWorkerSchemaVersion returns the stored worker schema version, 0 when unknown
+	GetWorkerSchemaVersion() int
+	// SetDebugEvents enables logging controller debug events for this agent
+	SetDebugEvents(enabled bool)
+	// SetIntervalUpdater sets how poll intervals pushed by the controller are applied
+	SetIntervalUpdater(update func(intervalSeconds int))
+	// SetReauthenticator sets how heartbeats and pushed config fetches recover from a 401
+	SetReauthenticator(reauth func(ctx context.Context, staleToken string) error, authenticated func())
+	// QueueWorkerForward runs send on the single worker forward goroutine;
+	// it returns ErrForwardSuperseded when a forward with a higher seq
+	// replaced it or was queued before it
+	QueueWorkerForward(ctx context.Context, etag string, seq uint64, send func(ctx context.Context) error) error
+	// StopWorkerForwards ends the worker forward goroutine on shutdown
+	StopWorkerForwards()
+	// SetConfigCachePath persists received configs to path; empty disables it
+	SetConfigCachePath(path string)
+	// LoadCachedConfig returns the last cached config, nil when there is none
+	LoadCachedConfig() (*models.Configuration, error)
+	// SetHeartbeatRetry bounds the retries of a failed heartbeat
+	SetHeartbeatRetry(maxRetries int, backoff time.Duration)
+	// SetRetryableStatusCodes sets the controller statuses a failed
+	// heartbeat is retried on
+	SetRetryableStatusCodes(codes []int)
+	// GetHeartbeatStats returns the heartbeat success and miss counters
+	GetHeartbeatStats() dto.HeartbeatStats
+	// Flags returns the feature flags of the stored controller config, nil
+	// before one is received
+	Flags() models.Flags
 }
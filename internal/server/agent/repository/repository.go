@@ -1,21 +1,29 @@
 package repository
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/Alwanly/service-distribute-management/internal/models"
 	"github.com/Alwanly/service-distribute-management/internal/server/agent/dto"
+	"github.com/Alwanly/service-distribute-management/pkg/httpclient"
+	"github.com/Alwanly/service-distribute-management/pkg/httpurl"
 	"github.com/Alwanly/service-distribute-management/pkg/logger"
-	"github.com/Alwanly/service-distribute-management/pkg/poll"
 	"github.com/Alwanly/service-distribute-management/pkg/pubsub"
+	"github.com/Alwanly/service-distribute-management/pkg/retry"
+	"github.com/Alwanly/service-distribute-management/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -32,7 +40,6 @@ type Repository struct {
 	store         *StoreData
 	storeMutex    sync.RWMutex
 	pubsub        pubsub.Subscriber
-	configPoller  poll.Poller
 	agentID       string
 	controllerURL string
 	workerURL     string
@@ -42,18 +49,81 @@ type Repository struct {
 	redisCircuitOpen bool
 	lastRedisFailure time.Time
 	circuitMutex     sync.Mutex
+	// Redis listener counters, guarded by circuitMutex
+	redisMessages      int64
+	redisReconnects    int64
+	redisCircuitOpens  int64
+	redisCircuitOpenAt time.Time
+	lastRedisMessage   time.Time
+	// Delivery mode state machine, guarded by circuitMutex
+	delivery dto.DeliveryModeState
+	// Redis listener wait durations; fields so tests can shorten them
+	redisCircuitPoll      time.Duration
+	redisSubscribeBackoff time.Duration
+	redisReconnectDelay   time.Duration
+	redisCircuitCooldown  time.Duration
+	// Worker forward tracking
+	workerSync  dto.WorkerSyncState
+	workerMutex sync.Mutex
+	// deliveredETag is the last config the worker accepted or rejected,
+	// guarded by workerMutex; see UnforwardedConfig
+	deliveredETag string
+	// Most recent operational error, reported in heartbeats
+	lastError      string
+	lastErrorAt    *time.Time
+	lastErrorMutex sync.Mutex
+	// Local config override; while set, controller configs are stored but not forwarded
+	pinned      *models.Configuration
+	pinnedAt    time.Time
+	pinnedMutex sync.RWMutex
+	// fetchGroup coalesces concurrent push and poll fetches of the same ETag
+	fetchGroup singleflight.Group
+	// configSeq hands out NextConfigSeq numbers; storedSeq is the one the
+	// stored config was fetched under, guarded by storeMutex
+	configSeq atomic.Uint64
+	storedSeq uint64
+	// workerSchema is the newest config schema the worker supports, 0 when unknown
+	workerSchema atomic.Int32
+	// debugEvents subscribes to controller diagnostics as well as config updates
+	debugEvents atomic.Bool
+	// reauth and authenticated are set by the usecase so background requests
+	// recover from a rotated token; see SetReauthenticator
+	reauth        func(ctx context.Context, staleToken string) error
+	authenticated func()
+	// cachePath is where received configs are persisted for offline
+	// startup; empty disables the cache. See SetConfigCachePath.
+	cachePath  string
+	cacheMutex sync.Mutex
+	// forwarder runs worker forwards one at a time, newest pending first
+	forwarder *workerForwarder
+	// intervalUpdate applies a poll interval pushed by the controller; see
+	// SetIntervalUpdater
+	intervalUpdate func(intervalSeconds int)
+	// heartbeatRetry bounds the retries of a failed heartbeat; see
+	// SetHeartbeatRetry
+	heartbeatRetry retry.Config
+	heartbeat      heartbeatStats
 }
 
 func NewRepository(controllerURL string, workerURL string, agentID string, apiToken string, subscriber pubsub.Subscriber) IRepository {
 	return &Repository{
-		store:         &StoreData{},
+		store:         &StoreData{AgentID: agentID},
 		storeMutex:    sync.RWMutex{},
 		pubsub:        subscriber,
-		configPoller:  nil,
 		agentID:       agentID,
 		controllerURL: controllerURL,
 		workerURL:     workerURL,
 		apiToken:      apiToken,
+
+		redisCircuitPoll:      10 * time.Second,
+		redisSubscribeBackoff: 5 * time.Second,
+		redisReconnectDelay:   2 * time.Second,
+		redisCircuitCooldown:  circuitBreakerCooldown,
+
+		delivery:  dto.DeliveryModeState{Mode: dto.DeliveryModePollOnly, Since: time.Now().UTC()},
+		forwarder: newWorkerForwarder(),
+
+		heartbeatRetry: newHeartbeatRetry(defaultHeartbeatRetries, time.Second),
 	}
 }
 
@@ -70,13 +140,46 @@ func (r *Repository) SetAPIToken(token string) {
 func (r *Repository) GetAPIToken() string {
 	r.storeMutex.RLock()
 	defer r.storeMutex.RUnlock()
-	if r.store == nil {
-		return ""
+	return r.apiToken
+}
+
+// SetReauthenticator sets how background requests recover from a 401:
+// reauth refreshes the token after a request made with staleToken was rejected and
+// authenticated is called after a request was accepted. It must be called
+// before the background services start.
+func (r *Repository) SetReauthenticator(reauth func(ctx context.Context, staleToken string) error, authenticated func()) {
+	r.reauth = reauth
+	r.authenticated = authenticated
+}
+
+// credentials returns the agent ID and token to send to the controller
+func (r *Repository) credentials() (agentID, token string) {
+	r.storeMutex.RLock()
+	defer r.storeMutex.RUnlock()
+	return r.agentID, r.apiToken
+}
+
+// withReauth calls do with the current credentials. A 401 refreshes the
+// token through the reauthenticator and retries do once with the new one.
+func (r *Repository) withReauth(ctx context.Context, log *logger.CanonicalLogger, do func(agentID, token string) (int, error)) (int, error) {
+	agentID, token := r.credentials()
+	status, err := do(agentID, token)
+	if status == http.StatusUnauthorized && r.reauth != nil {
+		if reauthErr := r.reauth(ctx, token); reauthErr != nil {
+			return status, fmt.Errorf("%w (%w)", err, reauthErr)
+		}
+		log.Info("retrying controller request with the new token")
+		status, err = do(r.credentials())
+	}
+	// A 304 answers a conditional request, so the credentials were accepted
+	if (err == nil || status == http.StatusNotModified) && r.authenticated != nil {
+		r.authenticated()
 	}
-	return r.store.APIToken
+	return status, err
 }
 
 func (r *Repository) SetConfig(config *models.Configuration, etag string) {
+	seq := r.NextConfigSeq()
 	r.storeMutex.Lock()
 	defer r.storeMutex.Unlock()
 	if r.store == nil {
@@ -84,6 +187,7 @@ func (r *Repository) SetConfig(config *models.Configuration, etag string) {
 	}
 	r.store.Config = config
 	r.store.ETag = etag
+	r.storedSeq = seq
 }
 
 func (r *Repository) GetConfig() (*models.Configuration, string) {
@@ -95,6 +199,20 @@ func (r *Repository) GetConfig() (*models.Configuration, string) {
 	return r.store.Config, r.store.ETag
 }
 
+func (r *Repository) Flags() models.Flags {
+	cfg, _ := r.GetConfig()
+	if cfg == nil || cfg.ConfigData == "" {
+		return nil
+	}
+	var data struct {
+		Flags models.Flags `json:"flags"`
+	}
+	if err := json.Unmarshal([]byte(cfg.ConfigData), &data); err != nil {
+		return nil
+	}
+	return data.Flags
+}
+
 func (r *Repository) GetPollInfo() (string, int, error) {
 	r.storeMutex.RLock()
 	defer r.storeMutex.RUnlock()
@@ -124,280 +242,389 @@ func (r *Repository) UpdatePollInterval(newInterval int) {
 	r.store.PollInterval = newInterval
 }
 
-func (r *Repository) handleConfigUpdate(ctx context.Context, log *logger.CanonicalLogger, etag string, correlationID string) error {
-	updateStart := time.Now()
+// handleConfigNotification applies a pushed config update as part of the
+// publisher's trace, so the controller's fetch and the worker's apply show up
+// under the admin request that changed the config
+func (r *Repository) handleConfigNotification(ctx context.Context, log *logger.CanonicalLogger, n pubsub.ConfigUpdateNotification) error {
+	ctx, span := tracing.Start(tracing.WithTraceParent(ctx, n.TraceParent), "config.update",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String(logger.FieldETag, n.ETag), attribute.String(logger.FieldCorrelationID, n.CorrelationID)))
+	defer span.End()
 
-	r.storeMutex.RLock()
-	if r.store != nil && r.store.ETag == etag {
-		r.storeMutex.RUnlock()
+	err := r.handleConfigUpdate(ctx, log, n.ETag, n.CorrelationID)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+func (r *Repository) handleConfigUpdate(ctx context.Context, log *logger.CanonicalLogger, etag string, correlationID string) error {
+	if r.hasETag(etag) {
 		log.Debug("Configuration already up to date", zap.String("etag", etag))
 		return nil
 	}
-	r.storeMutex.RUnlock()
 
-	// Fetch configuration from controller
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/config", r.controllerURL), nil)
+	// Coalesce with any poll or push already fetching this version
+	_, err, _ := r.fetchGroup.Do(etag, func() (interface{}, error) {
+		return nil, r.fetchAndApply(ctx, log, etag, correlationID)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		r.recordError(err)
 	}
-	if r.agentID != "" {
-		req.Header.Set("X-Agent-ID", r.agentID)
+	return err
+}
+
+// fetchAndApply fetches the latest configuration from the controller after a
+// push notification for etag and applies it
+func (r *Repository) fetchAndApply(ctx context.Context, log *logger.CanonicalLogger, etag string, correlationID string) error {
+	updateStart := time.Now()
+	seq := r.NextConfigSeq()
+
+	// Fetch configuration from controller
+	headers := map[string]string{logger.HeaderCorrelationID: correlationID}
+	if v := r.GetWorkerSchemaVersion(); v > 0 {
+		headers[models.HeaderConfigSchemaVersion] = strconv.Itoa(v)
 	}
-	if r.apiToken != "" {
-		req.Header.Set("Authorization", "Bearer "+r.apiToken)
+
+	// Fetch from the same target as polls: the poll URL of the last
+	// registration, which may be absolute, e.g. a shard on another host
+	pollURL, _, _ := r.GetPollInfo()
+	if pollURL == "" {
+		pollURL = defaultPollPath
 	}
-	if correlationID != "" {
-		req.Header.Set("X-Correlation-ID", correlationID)
+	target, err := httpurl.Join(r.controllerURL, pollURL)
+	if err != nil {
+		return fmt.Errorf("invalid poll URL: %w", err)
 	}
 
+	// A push for a version the agent already has is answered with a 304,
+	// which the controller does not count against the fetch quota
+	_, current := r.GetConfig()
+	headers["If-None-Match"] = current
+
+	var cr dto.ConfigurationResponse
 	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to fetch config from controller: %w", err)
+	var status int
+	for attempt := 0; ; attempt++ {
+		var resp *httpclient.Response
+		status, err = r.withReauth(ctx, log, func(agentID, token string) (int, error) {
+			headers["X-Agent-ID"] = agentID
+			headers["Authorization"] = bearer(token)
+			var err error
+			resp, err = httpclient.Do(ctx, client, http.MethodGet, target, nil, headers, &cr)
+			if resp == nil {
+				return 0, err
+			}
+			return resp.StatusCode, err
+		})
+		// A burst of pushes can exhaust the fetch quota; wait as told and
+		// fetch once more rather than miss the newest config until the next
+		// poll
+		if status != http.StatusTooManyRequests || attempt > 0 {
+			break
+		}
+		wait, ok := retryAfter(resp.Header)
+		if !ok {
+			break
+		}
+		log.Info("config fetch rate limited; retrying", zap.String("etag", etag), zap.Duration("retry_after", wait))
+		sleepContext(ctx, wait)
+		if ctx.Err() != nil {
+			break
+		}
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == http.StatusNotModified {
+	if status == http.StatusNotModified {
 		return nil
 	}
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("controller returned status %d", resp.StatusCode)
+	if err != nil {
+		return fmt.Errorf("failed to fetch config from controller: %w", err)
 	}
 
-	var cr dto.ConfigurationResponse
-	if err := json.NewDecoder(resp.Body).Decode(&cr); err != nil {
-		return fmt.Errorf("failed to decode controller config response: %w", err)
-	}
+	r.applyConfig(ctx, log, configFromResponse(&cr), seq, correlationID, "push", time.Since(updateStart))
+	return nil
+}
+
+// maxPushRetryAfter bounds how long a push-triggered fetch waits on a 429;
+// a longer Retry-After is left to the next poll
+const maxPushRetryAfter = time.Minute
 
-	// Convert to models.Configuration
-	cfg := &models.Configuration{
-		ID:   cr.ID,
-		ETag: cr.ETag,
+// retryAfter parses a Retry-After header given in seconds
+func retryAfter(h http.Header) (time.Duration, bool) {
+	seconds, err := strconv.Atoi(h.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
 	}
+	wait := time.Duration(seconds) * time.Second
+	return wait, wait <= maxPushRetryAfter
+}
+
+// hasETag reports whether the stored configuration is already at etag
+func (r *Repository) hasETag(etag string) bool {
+	r.storeMutex.RLock()
+	defer r.storeMutex.RUnlock()
+	return r.store != nil && r.store.ETag == etag
+}
+
+// configFromResponse converts a controller config response to a stored configuration
+func configFromResponse(cr *dto.ConfigurationResponse) *models.Configuration {
+	cfg := &models.Configuration{ID: cr.ID, ETag: cr.ETag}
 	if data, err := json.Marshal(cr.Config); err == nil {
 		cfg.ConfigData = string(data)
 	}
+	return cfg
+}
 
-	oldETag := ""
-	r.storeMutex.Lock()
-	if r.store != nil {
-		oldETag = r.store.ETag
-	}
-	if r.store == nil {
-		r.store = &StoreData{}
+// applyConfig stores cfg, fetched under seq, and forwards it to the worker
+// unless the store is already at that version or at one fetched later, so a
+// push and a poll racing for the same ETag forward it once and a slow fetch
+// never replaces a newer config. Concurrent pushes coalesce through
+// fetchGroup; a poll meets them in StoreConfigIfNew.
+func (r *Repository) applyConfig(ctx context.Context, log *logger.CanonicalLogger, cfg *models.Configuration, seq uint64, correlationID string, deliveryMethod string, elapsed time.Duration) {
+	start := time.Now().UTC()
+	_, oldETag := r.GetConfig()
+	if !r.StoreConfigIfNew(cfg, seq) {
+		log.Debug("Configuration already applied", zap.String("etag", cfg.ETag), zap.String("delivery_method", deliveryMethod))
+		return
 	}
-	r.store.Config = cfg
-	r.store.ETag = cr.ETag
-	r.storeMutex.Unlock()
 
-	elapsed := time.Since(updateStart)
-	log.Info("Configuration updated via notification",
+	log.Info("Configuration updated",
 		zap.String("old_etag", oldETag),
-		zap.String("new_etag", cr.ETag),
-		zap.String("delivery_method", "push"),
+		zap.String("new_etag", cfg.ETag),
+		zap.String("delivery_method", deliveryMethod),
 		zap.Duration("duration_ms", elapsed),
 		zap.String("correlation_id", correlationID),
 	)
 
 	// Forward updated config to worker and include correlation id
-	if r.workerURL != "" {
-		configData := new(models.ConfigData)
-		if cfg.ConfigData != "" {
-			_ = json.Unmarshal([]byte(cfg.ConfigData), configData)
-		}
-		payload := dto.SendConfigRequest{ID: cfg.ID, ETag: cfg.ETag, ConfigData: *configData}
-		bodyBytes, err := json.Marshal(payload)
-		if err != nil {
-			log.WithError(err).Error("failed to marshal config for worker")
-			return nil
-		}
-		workerReq, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/config", r.workerURL), bytes.NewReader(bodyBytes))
-		if err != nil {
-			log.WithError(err).Error("failed to create worker request")
-			return nil
-		}
-		workerReq.Header.Set("Content-Type", "application/json")
-		corr := correlationID
-		if corr == "" {
-			corr = uuid.Must(uuid.NewV7()).String()
+	err := r.forwardToWorker(ctx, log, cfg, seq, correlationID, deliveryMethod)
+	switch {
+	case err == nil:
+		r.ClearErrorsBefore(start)
+	case !errors.Is(err, ErrForwardSuperseded):
+		log.WithError(err).Error("failed to forward config to worker")
+	}
+}
+
+// forwardToWorker sends the configuration, ordered by seq, to the worker and
+// records the outcome in the worker sync state. It is a no-op when no worker
+// URL is configured.
+func (r *Repository) forwardToWorker(ctx context.Context, log *logger.CanonicalLogger, cfg *models.Configuration, seq uint64, correlationID string, deliveryMethod string) error {
+	if r.workerURL == "" {
+		return nil
+	}
+	if deliveryMethod != deliveryPin && r.IsConfigPinned() {
+		log.Info("config pinned; skipping worker forward",
+			zap.String("etag", cfg.ETag),
+			zap.String("delivery_method", deliveryMethod),
+		)
+		return nil
+	}
+
+	configData := new(models.ConfigData)
+	if cfg.ConfigData != "" {
+		_ = json.Unmarshal([]byte(cfg.ConfigData), configData)
+	}
+	payload := dto.SendConfigRequest{ID: cfg.ID, ETag: cfg.ETag, ConfigData: *configData, DeliveryMethod: deliveryMethod}
+	corr := correlationID
+	if corr == "" {
+		corr = logger.NewCorrelationID()
+	}
+	headers := map[string]string{logger.HeaderCorrelationID: corr}
+	if r.apiToken != "" {
+		headers["Authorization"] = "Bearer " + r.apiToken
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	err := r.QueueWorkerForward(ctx, cfg.ETag, seq, func(ctx context.Context) error {
+		target, err := httpurl.Join(r.workerURL, "/config")
+		if err == nil {
+			_, err = httpclient.DoJSON(ctx, client, http.MethodPost, target, payload, headers, nil)
 		}
-		workerReq.Header.Set("X-Correlation-ID", corr)
-		if r.apiToken != "" {
-			workerReq.Header.Set("Authorization", "Bearer "+r.apiToken)
+		if rejected := configRejection(cfg.ETag, err); rejected != nil {
+			err = rejected
+		} else if err != nil {
+			err = fmt.Errorf("failed to send config to worker: %w", err)
 		}
-		client := &http.Client{Timeout: 10 * time.Second}
-		wresp, err := client.Do(workerReq)
 		if err != nil {
-			log.WithError(err).Error("failed to send config to worker")
-			return nil
-		}
-		wresp.Body.Close()
-		if wresp.StatusCode != http.StatusOK {
-			log.Error("worker rejected config", zap.Int("status", wresp.StatusCode))
-			return nil
+			r.RecordWorkerForward(log, cfg.ETag, err)
+			return err
 		}
-		log.Info("configuration forwarded to worker via push", zap.String("etag", cfg.ETag), zap.String("correlation_id", corr))
+		r.RecordWorkerForward(log, cfg.ETag, nil)
+		return nil
+	})
+	if errors.Is(err, ErrForwardSuperseded) {
+		log.Info("worker forward skipped for a newer config",
+			zap.String("etag", cfg.ETag),
+			zap.String("delivery_method", deliveryMethod),
+			zap.String("correlation_id", corr),
+		)
+		return err
+	}
+	if err != nil {
+		return err
 	}
 
+	log.Info("configuration forwarded to worker",
+		zap.String("etag", cfg.ETag),
+		zap.String("delivery_method", deliveryMethod),
+		zap.String("correlation_id", corr),
+		zap.Any("config", configData.Redacted()),
+	)
 	return nil
 }
 
-// RegisterConfigPolling starts periodic fallback configuration polling
-func (r *Repository) RegisterConfigPolling(ctx context.Context, log *logger.CanonicalLogger) {
-	if r == nil {
-		return
+// QueueWorkerForward runs send, which delivers the config at etag to the
+// worker, on the agent's single forward goroutine so forwards never overlap.
+// seq orders it against the other forwards: one still waiting when a newer
+// one is queued, or queued after a newer one, is skipped with
+// ErrForwardSuperseded.
+func (r *Repository) QueueWorkerForward(ctx context.Context, etag string, seq uint64, send func(ctx context.Context) error) error {
+	return r.forwarder.forward(ctx, etag, seq, send)
+}
+
+// StopWorkerForwards ends the worker forward goroutine; forwards queued
+// afterwards fail with ErrForwarderStopped
+func (r *Repository) StopWorkerForwards() {
+	r.forwarder.stop()
+}
+
+// NextConfigSeq returns a number ordering config fetches and worker
+// forwards; take it before fetching so a slower fetch of an older version
+// never overrides a newer one
+func (r *Repository) NextConfigSeq() uint64 {
+	return r.configSeq.Add(1)
+}
+
+// deliveryPin marks worker forwards that apply or release a pinned config
+const deliveryPin = "pin"
+
+// PinConfig stores a local override config and forwards it to the worker.
+// Controller updates keep being stored but are not forwarded until unpinned.
+func (r *Repository) PinConfig(ctx context.Context, log *logger.CanonicalLogger, cfg *models.Configuration) error {
+	if err := r.forwardToWorker(ctx, log, cfg, r.NextConfigSeq(), "", deliveryPin); err != nil {
+		return err
 	}
 
-	// Start a fallback poller that performs conditional GETs against the controller
-	go func() {
-		interval := 60 * time.Second
-		r.storeMutex.RLock()
-		if r.store != nil && r.store.PollInterval > 0 {
-			interval = time.Duration(r.store.PollInterval) * time.Second
-		}
-		r.storeMutex.RUnlock()
+	r.pinnedMutex.Lock()
+	r.pinned = cfg
+	r.pinnedAt = time.Now().UTC()
+	r.pinnedMutex.Unlock()
 
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
+	log.Info("config pinned", zap.String("etag", cfg.ETag))
+	return nil
+}
 
-		log.Info("config fallback polling started", zap.Duration("interval", interval))
+// UnpinConfig clears the local override and restores the latest controller
+// config on the worker.
+func (r *Repository) UnpinConfig(ctx context.Context, log *logger.CanonicalLogger) error {
+	r.pinnedMutex.Lock()
+	wasPinned := r.pinned != nil
+	r.pinned = nil
+	r.pinnedAt = time.Time{}
+	r.pinnedMutex.Unlock()
 
-		// Purpose tag for observability
-		log.Info("config fallback polling started",
-			zap.Duration("interval", interval),
-			zap.String("purpose", "safety_net_for_missed_push_notifications"))
+	if !wasPinned {
+		return nil
+	}
+	log.Info("config unpinned")
+
+	cfg, _ := r.GetConfig()
+	if cfg == nil {
+		return nil
+	}
+	return r.forwardToWorker(ctx, log, cfg, r.NextConfigSeq(), "", deliveryPin)
+}
 
-		client := &http.Client{Timeout: 15 * time.Second}
+// IsConfigPinned reports whether a local override config is pinned
+func (r *Repository) IsConfigPinned() bool {
+	r.pinnedMutex.RLock()
+	defer r.pinnedMutex.RUnlock()
+	return r.pinned != nil
+}
 
-		for {
-			select {
-			case <-ctx.Done():
-				log.Info("config fallback polling stopped")
-				return
-			case <-ticker.C:
-				// read current ETag and poll URL
-				r.storeMutex.RLock()
-				curETag := ""
-				pollURL := r.store.PollURL
-				agentID := r.agentID
-				token := r.apiToken
-				if r.store != nil {
-					curETag = r.store.ETag
-				}
-				r.storeMutex.RUnlock()
-
-				target := fmt.Sprintf("%s/config", r.controllerURL)
-				if pollURL != "" {
-					// if controller provided an explicit poll URL, use it
-					target = fmt.Sprintf("%s%s", r.controllerURL, pollURL)
-				}
-
-				req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
-				if err != nil {
-					log.WithError(err).Error("failed to create poll request")
-					continue
-				}
-				if curETag != "" {
-					req.Header.Set("If-None-Match", curETag)
-				}
-				if agentID != "" {
-					req.Header.Set("X-Agent-ID", agentID)
-				}
-				if token != "" {
-					req.Header.Set("Authorization", "Bearer "+token)
-				}
-
-				resp, err := client.Do(req)
-				if err != nil {
-					log.WithError(err).Error("poll request failed")
-					continue
-				}
-
-				if resp.StatusCode == http.StatusNotModified {
-					resp.Body.Close()
-					// nothing to do
-					continue
-				}
-				if resp.StatusCode != http.StatusOK {
-					log.Error("poll returned non-OK status", zap.Int("status", resp.StatusCode))
-					resp.Body.Close()
-					continue
-				}
-
-				// decode body separately to avoid holding locks while reading
-				var cr dto.ConfigurationResponse
-				if err := json.NewDecoder(resp.Body).Decode(&cr); err != nil {
-					resp.Body.Close()
-					log.WithError(err).Error("failed to decode config response from poll")
-					continue
-				}
-				resp.Body.Close()
-
-				// update store with new config and forward to worker
-				cfg := &models.Configuration{ID: cr.ID, ETag: cr.ETag}
-				if data, err := json.Marshal(cr.Config); err == nil {
-					cfg.ConfigData = string(data)
-				}
-
-				// store update
-				r.storeMutex.Lock()
-				oldETag := ""
-				if r.store != nil {
-					oldETag = r.store.ETag
-				}
-				if r.store == nil {
-					r.store = &StoreData{}
-				}
-				r.store.Config = cfg
-				r.store.ETag = cr.ETag
-				r.storeMutex.Unlock()
-
-				log.Info("Configuration updated via poll",
-					zap.String("old_etag", oldETag),
-					zap.String("new_etag", cr.ETag),
-					zap.String("delivery_method", "poll"),
-				)
+// GetPinnedState returns the pinned config state, or nil when not pinned
+func (r *Repository) GetPinnedState() *dto.PinnedConfigState {
+	r.pinnedMutex.RLock()
+	defer r.pinnedMutex.RUnlock()
+	if r.pinned == nil {
+		return nil
+	}
+	return &dto.PinnedConfigState{ETag: r.pinned.ETag, PinnedAt: r.pinnedAt}
+}
 
-				// forward to worker
-				if r.workerURL != "" {
-					// prepare payload
-					configData := new(models.ConfigData)
-					if cfg.ConfigData != "" {
-						_ = json.Unmarshal([]byte(cfg.ConfigData), configData)
-					}
-					payload := dto.SendConfigRequest{ID: cfg.ID, ETag: cfg.ETag, ConfigData: *configData}
-					bodyBytes, err := json.Marshal(payload)
-					if err != nil {
-						log.WithError(err).Error("failed to marshal config for worker")
-						continue
-					}
-					workerReq, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/config", r.workerURL), bytes.NewReader(bodyBytes))
-					if err != nil {
-						log.WithError(err).Error("failed to create worker request")
-						continue
-					}
-					workerReq.Header.Set("Content-Type", "application/json")
-					// generate correlation id for this forward
-					corr := uuid.Must(uuid.NewV7()).String()
-					workerReq.Header.Set("X-Correlation-ID", corr)
-					if r.apiToken != "" {
-						workerReq.Header.Set("Authorization", "Bearer "+r.apiToken)
-					}
-					wresp, err := client.Do(workerReq)
-					if err != nil {
-						log.WithError(err).Error("failed to send config to worker")
-						continue
-					}
-					wresp.Body.Close()
-					if wresp.StatusCode != http.StatusOK {
-						log.Error("worker rejected config", zap.Int("status", wresp.StatusCode))
-						continue
-					}
-					log.Info("configuration forwarded to worker via poll", zap.String("etag", cfg.ETag))
-				}
-			}
+// workerOutOfSyncThreshold is the number of consecutive failed forwards after
+// which the worker is considered out of sync with the agent
+const workerOutOfSyncThreshold = 3
+
+// RecordWorkerForward updates the consecutive worker forward failure counter.
+// Crossing workerOutOfSyncThreshold emits a single "worker-out-of-sync" event;
+// the next successful forward resets the counter and logs the recovery.
+func (r *Repository) RecordWorkerForward(log *logger.CanonicalLogger, etag string, err error) {
+	r.workerMutex.Lock()
+	defer r.workerMutex.Unlock()
+
+	now := time.Now().UTC()
+	// A rejected config cannot succeed on a resend, so it counts as settled
+	var rejected *ConfigRejectedError
+	if err == nil || errors.As(err, &rejected) {
+		r.deliveredETag = etag
+	}
+	if err == nil {
+		if r.workerSync.OutOfSync {
+			log.Info("worker-back-in-sync",
+				zap.String("event", "worker_back_in_sync"),
+				zap.String("etag", etag),
+				zap.Int("failed_forwards", r.workerSync.ConsecutiveFailures),
+			)
 		}
-	}()
+		r.workerSync.ConsecutiveFailures = 0
+		r.workerSync.OutOfSync = false
+		r.workerSync.LastError = ""
+		r.workerSync.LastSuccessAt = &now
+		return
+	}
+
+	r.recordError(err)
+	r.workerSync.ConsecutiveFailures++
+	r.workerSync.LastError = err.Error()
+	r.workerSync.LastFailureAt = &now
+	if r.workerSync.ConsecutiveFailures == workerOutOfSyncThreshold {
+		r.workerSync.OutOfSync = true
+		log.Error("worker-out-of-sync",
+			zap.String("event", "worker_out_of_sync"),
+			zap.String("etag", etag),
+			zap.Int("consecutive_failures", r.workerSync.ConsecutiveFailures),
+			zap.String("last_error", r.workerSync.LastError),
+		)
+	}
+}
+
+// UnforwardedConfig returns the stored config and the seq it was fetched
+// under while the worker has neither accepted nor rejected it, e.g. after a
+// failed forward; it returns nil once the worker answered for it
+func (r *Repository) UnforwardedConfig() (*models.Configuration, uint64) {
+	r.storeMutex.RLock()
+	var cfg *models.Configuration
+	var etag string
+	if r.store != nil {
+		cfg, etag = r.store.Config, r.store.ETag
+	}
+	seq := r.storedSeq
+	r.storeMutex.RUnlock()
+
+	r.workerMutex.Lock()
+	defer r.workerMutex.Unlock()
+	if cfg == nil || etag == r.deliveredETag {
+		return nil, 0
+	}
+	return cfg, seq
+}
+
+// GetWorkerSyncState returns a snapshot of the worker forward tracking state
+func (r *Repository) GetWorkerSyncState() dto.WorkerSyncState {
+	r.workerMutex.Lock()
+	defer r.workerMutex.Unlock()
+	return r.workerSync
 }
 
 func (r *Repository) RegisterHeartbeatPolling(ctx context.Context, log *logger.CanonicalLogger, interval time.Duration) {
@@ -423,53 +650,183 @@ func (r *Repository) RegisterHeartbeatPolling(ctx context.Context, log *logger.C
 				log.Info("Heartbeat polling stopped")
 				return
 			case <-ticker.C:
-				// read current stored etag
-				r.storeMutex.RLock()
-				etag := ""
-				agentID := r.agentID
-				token := r.apiToken
-				if r.store != nil {
-					etag = r.store.ETag
-				}
-				r.storeMutex.RUnlock()
-
-				payload := map[string]string{"config_version": etag, "status": "healthy"}
-				body, err := json.Marshal(payload)
-				if err != nil {
-					log.WithError(err).Error("failed to marshal heartbeat payload")
-					continue
-				}
-
-				target := fmt.Sprintf("%s/heartbeat", r.controllerURL)
-				req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
-				if err != nil {
-					log.WithError(err).Error("failed to create heartbeat request")
-					continue
-				}
-				req.Header.Set("Content-Type", "application/json")
-				if agentID != "" {
-					req.Header.Set("X-Agent-ID", agentID)
-				}
-				if token != "" {
-					req.Header.Set("Authorization", "Bearer "+token)
-				}
-
-				resp, err := client.Do(req)
-				if err != nil {
-					log.WithError(err).Error("heartbeat request failed")
-					continue
-				}
-				resp.Body.Close()
-				if resp.StatusCode != http.StatusOK {
-					log.Error("heartbeat not accepted by controller", zap.Int("status", resp.StatusCode), zap.String("agent_id", agentID))
-					continue
-				}
-				log.Info("Heartbeat sent successfully", zap.String("agent_id", agentID), zap.String("config_version", etag))
+				r.heartbeatWithRetry(ctx, log, client, interval)
 			}
 		}
 	}()
 }
 
+// sendHeartbeat posts one heartbeat with the stored config version
+func (r *Repository) sendHeartbeat(ctx context.Context, log *logger.CanonicalLogger, client *http.Client) error {
+	r.storeMutex.RLock()
+	etag := ""
+	if r.store != nil {
+		etag = r.store.ETag
+	}
+	r.storeMutex.RUnlock()
+
+	var sentAs string
+	target, err := httpurl.Join(r.controllerURL, "/heartbeat")
+	if err != nil {
+		return err
+	}
+	status, err := r.withReauth(ctx, log, func(agentID, token string) (int, error) {
+		sentAs = agentID
+		headers := map[string]string{"X-Agent-ID": agentID, "Authorization": bearer(token)}
+		return httpclient.DoJSON(ctx, client, http.MethodPost, target, r.heartbeatPayload(etag), headers, nil)
+	})
+	if err != nil {
+		log.WithError(err).Debug("heartbeat attempt failed", zap.Int("status", status), zap.String("agent_id", sentAs))
+		return err
+	}
+	log.Info("Heartbeat sent successfully", zap.String("agent_id", sentAs), zap.String("config_version", etag))
+	return nil
+}
+
+// bearer returns the Authorization value for token; empty tokens send none
+func bearer(token string) string {
+	if token == "" {
+		return ""
+	}
+	return "Bearer " + token
+}
+
+// heartbeatPayload builds the heartbeat body including the worker sync state
+func (r *Repository) heartbeatPayload(etag string) dto.HeartbeatRequest {
+	sync := r.GetWorkerSyncState()
+	payload := dto.HeartbeatRequest{
+		ConfigVersion:         etag,
+		Status:                "healthy",
+		WorkerOutOfSync:       sync.OutOfSync,
+		WorkerForwardFailures: sync.ConsecutiveFailures,
+		ConfigPinned:          r.IsConfigPinned(),
+		DeliveryMode:          string(r.GetDeliveryMode().Mode),
+	}
+	if sync.OutOfSync {
+		payload.Status = "degraded"
+	}
+	r.lastErrorMutex.Lock()
+	payload.LastError = r.lastError
+	payload.LastErrorAt = r.lastErrorAt
+	r.lastErrorMutex.Unlock()
+	return payload
+}
+
+// recordError remembers err as the most recent operational error so the next
+// heartbeat reports it to the controller
+func (r *Repository) recordError(err error) {
+	now := time.Now().UTC()
+	r.lastErrorMutex.Lock()
+	defer r.lastErrorMutex.Unlock()
+	r.lastError = err.Error()
+	r.lastErrorAt = &now
+}
+
+// ClearErrorsBefore forgets the reported error when it was recorded before
+// since, so a config fetched and applied after a failure clears it while an
+// error recorded during that apply is kept
+func (r *Repository) ClearErrorsBefore(since time.Time) {
+	r.lastErrorMutex.Lock()
+	defer r.lastErrorMutex.Unlock()
+	if r.lastErrorAt != nil && r.lastErrorAt.Before(since) {
+		r.lastError = ""
+		r.lastErrorAt = nil
+	}
+}
+
+// SetIntervalUpdater sets how a poll interval pushed by the controller is
+// applied. Without one only the stored interval is updated. It must be
+// called before StartRedisListener.
+func (r *Repository) SetIntervalUpdater(update func(intervalSeconds int)) {
+	r.intervalUpdate = update
+}
+
+// handleIntervalUpdate applies a poll interval the controller pushed for
+// this agent
+func (r *Repository) handleIntervalUpdate(log *logger.CanonicalLogger, n pubsub.ConfigUpdateNotification) {
+	if n.PollIntervalSeconds <= 0 {
+		log.Warn("ignoring interval update without a positive interval",
+			zap.Int("poll_interval_seconds", n.PollIntervalSeconds),
+			zap.String("correlation_id", n.CorrelationID),
+		)
+		return
+	}
+	log.Info("received poll interval update",
+		zap.Int("poll_interval_seconds", n.PollIntervalSeconds),
+		zap.String("correlation_id", n.CorrelationID),
+	)
+	if r.intervalUpdate != nil {
+		r.intervalUpdate(n.PollIntervalSeconds)
+		return
+	}
+	r.UpdatePollInterval(n.PollIntervalSeconds)
+}
+
+// SetDebugEvents enables logging controller debug events addressed to this
+// agent. It must be called before StartRedisListener.
+func (r *Repository) SetDebugEvents(enabled bool) {
+	r.debugEvents.Store(enabled)
+}
+
+// handleDebugEvent logs a controller debug event meant for this agent
+func (r *Repository) handleDebugEvent(log *logger.CanonicalLogger, raw string) {
+	var event models.DebugEvent
+	if err := json.Unmarshal([]byte(raw), &event); err != nil {
+		log.WithError(err).Debug("failed to unmarshal debug event")
+		return
+	}
+	if event.Type != models.DebugEventType {
+		return
+	}
+	if event.AgentID != "" && r.agentID != "" && event.AgentID != r.agentID {
+		return
+	}
+	log.Info("controller debug event",
+		zap.String("event", event.Event),
+		zap.String("message", event.Message),
+		zap.Time("at", event.At),
+	)
+}
+
+// SetWorkerSchemaVersion stores the config schema version the worker supports
+func (r *Repository) SetWorkerSchemaVersion(version int) {
+	r.workerSchema.Store(int32(version))
+}
+
+// GetWorkerSchemaVersion returns the stored worker schema version, 0 when unknown
+func (r *Repository) GetWorkerSchemaVersion() int {
+	return int(r.workerSchema.Load())
+}
+
+// workerSchemaKey carries the worker schema version into controller requests
+type workerSchemaKey struct{}
+
+// WithWorkerSchemaVersion attaches the worker's supported config schema to
+// ctx so config fetches can negotiate it with the controller
+func WithWorkerSchemaVersion(ctx context.Context, version int) context.Context {
+	return context.WithValue(ctx, workerSchemaKey{}, version)
+}
+
+type deliveryMethodKey struct{}
+
+// WithDeliveryMethod attaches the path delivering a config (push, poll, pin
+// or cache) for worker forwards made with ctx
+func WithDeliveryMethod(ctx context.Context, method string) context.Context {
+	return context.WithValue(ctx, deliveryMethodKey{}, method)
+}
+
+// DeliveryMethod returns the delivery method attached to ctx, "" when none
+func DeliveryMethod(ctx context.Context) string {
+	v, _ := ctx.Value(deliveryMethodKey{}).(string)
+	return v
+}
+
+// WorkerSchemaVersion returns the schema version attached to ctx, 0 when none
+func WorkerSchemaVersion(ctx context.Context) int {
+	v, _ := ctx.Value(workerSchemaKey{}).(int)
+	return v
+}
+
 func (r *Repository) SetAgentID(agentID string) error {
 	r.storeMutex.Lock()
 	defer r.storeMutex.Unlock()
@@ -503,16 +860,36 @@ func (r *Repository) UpdateConfig(config *models.Configuration) error {
 	if r == nil {
 		return nil
 	}
+	seq := r.NextConfigSeq()
 	r.storeMutex.Lock()
-	defer r.storeMutex.Unlock()
 	if r.store == nil {
 		r.store = &StoreData{}
 	}
 	r.store.Config = config
 	r.store.ETag = config.ETag
+	r.storedSeq = seq
+	r.storeMutex.Unlock()
+	r.saveCachedConfig(config)
 	return nil
 }
 
+func (r *Repository) StoreConfigIfNew(config *models.Configuration, seq uint64) bool {
+	r.storeMutex.Lock()
+	if r.store == nil {
+		r.store = &StoreData{}
+	}
+	if r.store.ETag == config.ETag || seq < r.storedSeq {
+		r.storeMutex.Unlock()
+		return false
+	}
+	r.store.Config = config
+	r.store.ETag = config.ETag
+	r.storedSeq = seq
+	r.storeMutex.Unlock()
+	r.saveCachedConfig(config)
+	return true
+}
+
 func (r *Repository) StartRedisListener(ctx context.Context, log *logger.CanonicalLogger) error {
 	if r.pubsub == nil {
 		log.Info("Redis subscriber not configured, skipping push notifications")
@@ -536,34 +913,124 @@ func (r *Repository) shouldAttemptRedisReconnect() bool {
 		return true
 	}
 	// If circuit open, allow reconnect attempt after cooldown
-	if time.Since(r.lastRedisFailure) > circuitBreakerCooldown {
+	if time.Since(r.lastRedisFailure) > r.redisCircuitCooldown {
 		r.redisCircuitOpen = false
+		r.redisCircuitOpenAt = time.Time{}
 		r.redisFailures = 0
 		return true
 	}
 	return false
 }
 
-func (r *Repository) recordRedisFailure() {
+func (r *Repository) recordRedisFailure(log *logger.CanonicalLogger) {
 	r.circuitMutex.Lock()
 	defer r.circuitMutex.Unlock()
 	r.redisFailures++
 	r.lastRedisFailure = time.Now()
-	if r.redisFailures >= maxRedisFailures {
+	if r.redisFailures >= maxRedisFailures && !r.redisCircuitOpen {
 		r.redisCircuitOpen = true
+		r.redisCircuitOpens++
+		r.redisCircuitOpenAt = r.lastRedisFailure
+		r.setDeliveryModeLocked(log, dto.DeliveryModePollOnly, "redis_circuit_open")
 	}
 }
 
-func (r *Repository) recordRedisSuccess() {
+func (r *Repository) recordRedisSuccess(log *logger.CanonicalLogger) {
 	r.circuitMutex.Lock()
 	defer r.circuitMutex.Unlock()
 	r.redisFailures = 0
 	r.redisCircuitOpen = false
+	r.redisCircuitOpenAt = time.Time{}
+	r.setDeliveryModeLocked(log, dto.DeliveryModePushEnabled, "redis_subscribed")
+}
+
+// setDeliveryModeLocked moves the delivery state machine to mode, logging the
+// transition and how long the previous mode lasted. Callers hold circuitMutex.
+func (r *Repository) setDeliveryModeLocked(log *logger.CanonicalLogger, mode dto.DeliveryMode, reason string) {
+	if r.delivery.Mode == mode {
+		return
+	}
+	now := time.Now().UTC()
+	log.Info("delivery mode changed",
+		zap.String("event", "delivery_mode_changed"),
+		zap.String("from", string(r.delivery.Mode)),
+		zap.String("to", string(mode)),
+		zap.String("reason", reason),
+		zap.Duration("previous_mode_duration", now.Sub(r.delivery.Since)),
+	)
+	r.delivery.Mode = mode
+	r.delivery.Since = now
+	r.delivery.Transitions++
+}
+
+// GetDeliveryMode returns whether config updates currently arrive by push or
+// only through polling. Without a subscriber the agent is always poll only.
+func (r *Repository) GetDeliveryMode() dto.DeliveryModeState {
+	r.circuitMutex.Lock()
+	defer r.circuitMutex.Unlock()
+	return r.delivery
+}
+
+func (r *Repository) recordRedisReconnectAttempt() {
+	r.circuitMutex.Lock()
+	defer r.circuitMutex.Unlock()
+	r.redisReconnects++
+}
+
+func (r *Repository) recordRedisMessage() {
+	r.circuitMutex.Lock()
+	defer r.circuitMutex.Unlock()
+	r.redisMessages++
+	r.lastRedisMessage = time.Now().UTC()
+}
+
+// GetRedisListenerStats returns a snapshot of the Redis listener counters,
+// or nil when no subscriber is configured
+func (r *Repository) GetRedisListenerStats() *dto.RedisListenerStats {
+	if r.pubsub == nil {
+		return nil
+	}
+
+	r.circuitMutex.Lock()
+	defer r.circuitMutex.Unlock()
+
+	stats := &dto.RedisListenerStats{
+		MessagesReceived:  r.redisMessages,
+		ReconnectAttempts: r.redisReconnects,
+		CircuitOpens:      r.redisCircuitOpens,
+		CircuitOpen:       r.redisCircuitOpen,
+	}
+	if dc, ok := r.pubsub.(pubsub.DropCounter); ok {
+		stats.MessagesDropped = dc.DroppedMessages()
+	}
+	if r.redisCircuitOpen && !r.redisCircuitOpenAt.IsZero() {
+		stats.CircuitOpenFor = time.Since(r.redisCircuitOpenAt).Round(time.Second).String()
+	}
+	if !r.lastRedisMessage.IsZero() {
+		last := r.lastRedisMessage
+		stats.LastMessageAt = &last
+	}
+	return stats
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first
+func sleepContext(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
 }
 
 // manageRedisConnection handles Redis connection with circuit breaker and reconnection
 func (r *Repository) manageRedisConnection(ctx context.Context, log *logger.CanonicalLogger) {
-	channel := "config-updates"
+	channel := pubsub.ConfigUpdatesChannel
+	channels := []string{channel}
+	if r.debugEvents.Load() {
+		channels = append(channels, models.DebugEventsChannel)
+	}
+	firstAttempt := true
 	for {
 		if ctx.Err() != nil {
 			return
@@ -571,28 +1038,37 @@ func (r *Repository) manageRedisConnection(ctx context.Context, log *logger.Cano
 
 		if !r.shouldAttemptRedisReconnect() {
 			// circuit open; wait a bit before checking again
-			time.Sleep(10 * time.Second)
+			sleepContext(ctx, r.redisCircuitPoll)
 			continue
 		}
 
-		msgCh, err := r.pubsub.Subscribe(ctx, channel)
+		if !firstAttempt {
+			r.recordRedisReconnectAttempt()
+		}
+		firstAttempt = false
+
+		msgCh, err := r.pubsub.Subscribe(ctx, channels...)
+		if err == nil && msgCh == nil {
+			// Reading a nil channel blocks forever; treat it as a failed subscribe
+			err = fmt.Errorf("subscriber returned no message channel")
+		}
 		if err != nil {
 			log.WithError(err).Error("failed to subscribe to redis channel")
-			r.recordRedisFailure()
+			r.recordRedisFailure(log)
 			// backoff before retrying
-			time.Sleep(5 * time.Second)
+			sleepContext(ctx, r.redisSubscribeBackoff)
 			continue
 		}
 
 		log.Info("Subscribed to Redis config updates channel", zap.String("channel", channel), zap.String("agent_id", r.agentID))
-		r.recordRedisSuccess()
+		r.recordRedisSuccess(log)
 
 		// Listen to messages until subscription breaks
 		alive := r.listenToRedis(ctx, log, msgCh)
 		if !alive {
 			// subscription ended unexpectedly; record failure and attempt reconnect
-			r.recordRedisFailure()
-			time.Sleep(2 * time.Second)
+			r.recordRedisFailure(log)
+			sleepContext(ctx, r.redisReconnectDelay)
 			continue
 		}
 	}
@@ -610,12 +1086,21 @@ func (r *Repository) listenToRedis(ctx context.Context, log *logger.CanonicalLog
 				log.Info("redis message channel closed")
 				return false
 			}
-			var payload struct {
-				AgentID       string `json:"agent_id"`
-				ETag          string `json:"etag"`
-				CorrelationID string `json:"correlation_id"`
+			r.recordRedisMessage()
+			if msg.Channel == models.DebugEventsChannel {
+				r.handleDebugEvent(log, msg.Payload)
+				continue
+			}
+			payload, err := pubsub.DecodeConfigUpdateNotification(msg.Payload)
+			if errors.Is(err, pubsub.ErrUnsupportedNotificationSchema) {
+				// Published by a newer controller; polling still picks the config up
+				log.Warn("ignoring config update notification with unknown schema",
+					zap.Int("schema_version", payload.SchemaVersion),
+					zap.Int("supported_schema_version", pubsub.NotificationSchemaVersion),
+				)
+				continue
 			}
-			if err := json.Unmarshal([]byte(msg.Payload), &payload); err != nil {
+			if err != nil {
 				log.WithError(err).Error("failed to unmarshal redis message")
 				continue
 			}
@@ -623,7 +1108,16 @@ func (r *Repository) listenToRedis(ctx context.Context, log *logger.CanonicalLog
 			if payload.AgentID != "" && r.agentID != "" && payload.AgentID != r.agentID {
 				continue
 			}
-			if err := r.handleConfigUpdate(ctx, log, payload.ETag, payload.CorrelationID); err != nil {
+			switch payload.Type {
+			case "":
+			case pubsub.NotificationTypeIntervalUpdate:
+				r.handleIntervalUpdate(log, payload)
+				continue
+			default:
+				log.Warn("ignoring notification of unknown type", zap.String("type", payload.Type))
+				continue
+			}
+			if err := r.handleConfigNotification(ctx, log, payload); err != nil {
 				log.WithError(err).Error("failed to handle config update notification")
 			} else {
 				log.Info("received config update notification", zap.String("etag", payload.ETag), zap.String("correlation_id", payload.CorrelationID))
@@ -1,26 +1,69 @@
 package repository
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"time"
 
 	"github.com/Alwanly/service-distribute-management/internal/config"
 	"github.com/Alwanly/service-distribute-management/internal/models"
 	"github.com/Alwanly/service-distribute-management/internal/server/agent/dto"
+	"github.com/Alwanly/service-distribute-management/pkg/httpclient"
+	"github.com/Alwanly/service-distribute-management/pkg/httpurl"
 	"github.com/Alwanly/service-distribute-management/pkg/logger"
 	"github.com/Alwanly/service-distribute-management/pkg/retry"
 	"go.uber.org/zap"
 )
 
+var _ IWorkerClient = (*workerClient)(nil)
+
+// ConfigRejectedError is returned when the worker refuses a config as
+// invalid. Resending the same config cannot succeed, so it is not retried;
+// its message becomes the agent's last_error and reaches the controller
+// with the next heartbeat.
+type ConfigRejectedError struct {
+	ETag   string
+	Field  string
+	Reason string
+}
+
+func (e *ConfigRejectedError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("worker rejected config ETag %s: %s", e.ETag, e.Reason)
+	}
+	return fmt.Sprintf("worker rejected config ETag %s: field %s: %s", e.ETag, e.Field, e.Reason)
+}
+
+// configRejection reads the worker's 400 for a config; it returns nil for
+// any other error, including a 400 without the rejection code
+func configRejection(etag string, err error) *ConfigRejectedError {
+	var statusErr *httpclient.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		return nil
+	}
+	var body struct {
+		Message string              `json:"message"`
+		Data    dto.ConfigRejection `json:"data"`
+	}
+	if json.Unmarshal([]byte(statusErr.Body), &body) != nil || body.Data.Code != dto.ConfigRejectedCode {
+		return nil
+	}
+	rejected := &ConfigRejectedError{ETag: etag, Field: body.Data.Field, Reason: body.Data.Reason}
+	if rejected.Reason == "" {
+		rejected.Reason = body.Message
+	}
+	return rejected
+}
+
 type workerClient struct {
 	httpClient *http.Client
 	baseURL    string
 	logger     *logger.CanonicalLogger
+	// retryIf picks the worker failures SendConfigurationWithRetry retries
+	retryIf func(error) bool
 }
 
 func NewWorkerClient(cfg *config.AgentConfig, log *logger.CanonicalLogger) IWorkerClient {
@@ -28,11 +71,15 @@ func NewWorkerClient(cfg *config.AgentConfig, log *logger.CanonicalLogger) IWork
 		httpClient: &http.Client{Timeout: cfg.RequestTimeout},
 		baseURL:    cfg.WorkerURL,
 		logger:     log,
+		retryIf:    httpclient.RetryableStatus(cfg.RetryableStatusCodes),
 	}
 }
 
 func (w *workerClient) SendConfiguration(ctx context.Context, config *models.Configuration) error {
-	url := fmt.Sprintf("%s/config", w.baseURL)
+	url, err := httpurl.Join(w.baseURL, "/config")
+	if err != nil {
+		return fmt.Errorf("invalid worker URL: %w", err)
+	}
 
 	configData := new(models.ConfigData)
 	if config.ConfigData == "" {
@@ -44,34 +91,17 @@ func (w *workerClient) SendConfiguration(ctx context.Context, config *models.Con
 	}
 
 	rawRequestBody := dto.SendConfigRequest{
-		ID:         config.ID,
-		ETag:       config.ETag,
-		ConfigData: *configData,
-	}
-	requestBody, err := json.Marshal(rawRequestBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(requestBody))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	if corr := logger.GetCorrelationID(ctx); corr != "" {
-		req.Header.Set("X-Correlation-ID", corr)
+		ID:             config.ID,
+		ETag:           config.ETag,
+		ConfigData:     *configData,
+		DeliveryMethod: DeliveryMethod(ctx),
 	}
-
-	resp, err := w.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		b, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("worker returned status %d: %s", resp.StatusCode, string(b))
+	headers := map[string]string{logger.HeaderCorrelationID: logger.GetCorrelationID(ctx)}
+	if _, err := httpclient.DoJSON(ctx, w.httpClient, http.MethodPost, url, rawRequestBody, headers, nil); err != nil {
+		if rejected := configRejection(config.ETag, err); rejected != nil {
+			return rejected
+		}
+		return fmt.Errorf("worker rejected config: %w", err)
 	}
 
 	return nil
@@ -85,12 +115,22 @@ func (w *workerClient) SendConfigurationWithRetry(ctx context.Context, config *m
 		MaxBackoff:     30 * time.Second,
 		Multiplier:     2.0,
 		Jitter:         true,
+		RetryIf:        w.retryIf,
 	}
 
 	op := func(ctx context.Context) error {
 		attempt++
 		w.logger.Info("attempting to send configuration to worker", zap.Int("attempt", attempt), zap.String("etag", config.ETag))
 		err := w.SendConfiguration(ctx, config)
+		var rejected *ConfigRejectedError
+		if errors.As(err, &rejected) {
+			w.logger.Error("worker rejected configuration",
+				zap.String("etag", config.ETag),
+				zap.String("field", rejected.Field),
+				zap.String("reason", rejected.Reason),
+			)
+			return retry.Permanent(err)
+		}
 		if err != nil {
 			w.logger.WithError(err).Error("failed to send configuration to worker", zap.Int("attempt", attempt), zap.String("etag", config.ETag))
 		} else {
@@ -101,3 +141,26 @@ func (w *workerClient) SendConfigurationWithRetry(ctx context.Context, config *m
 
 	return retry.WithExponentialBackoff(ctx, retryCfg, op)
 }
+
+func (w *workerClient) CheckHealth(ctx context.Context) error {
+	return checkHealth(ctx, w.httpClient, w.baseURL)
+}
+
+// SchemaVersion reads the worker's supported config schema from /health.
+// Workers that predate schema negotiation report none and understand schema 1.
+func (w *workerClient) SchemaVersion(ctx context.Context) (int, error) {
+	var health struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	target, err := httpurl.Join(w.baseURL, "/health")
+	if err != nil {
+		return 0, fmt.Errorf("worker health failed: %w", err)
+	}
+	if _, err := httpclient.DoJSON(ctx, w.httpClient, http.MethodGet, target, nil, nil, &health); err != nil {
+		return 0, fmt.Errorf("worker health failed: %w", err)
+	}
+	if health.SchemaVersion == 0 {
+		return 1, nil
+	}
+	return health.SchemaVersion, nil
+}
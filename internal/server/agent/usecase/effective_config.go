@@ -0,0 +1,81 @@
+package usecase
+
+import (
+	"net/url"
+
+	"github.com/Alwanly/service-distribute-management/internal/server/agent/dto"
+)
+
+// redacted replaces a secret in the effective config
+const redacted = "[redacted]"
+
+// GetEffectiveConfig returns the agent's resolved settings with secrets
+// redacted, so operators can see what is actually in effect
+func (uc *UseCase) GetEffectiveConfig() dto.EffectiveConfigResponse {
+	cfg := uc.cfg
+	if cfg == nil {
+		return dto.EffectiveConfigResponse{}
+	}
+
+	resp := dto.EffectiveConfigResponse{
+		ControllerURL:            redactURL(cfg.ControllerURL),
+		WorkerURL:                redactURL(cfg.WorkerURL),
+		WorkerForwardingDisabled: cfg.WorkerForwardingDisabled,
+		WorkerPreflight:          cfg.WorkerPreflight,
+		AgentAddr:                cfg.AgentAddr,
+		Hostname:                 cfg.Hostname,
+		Metadata:                 cfg.Metadata,
+		PollInterval:             cfg.PollInterval.String(),
+		RequestTimeout:           cfg.RequestTimeout.String(),
+		AgentUsername:            cfg.AgentUsername,
+		AgentPassword:            redactSecret(cfg.AgentPassword),
+		BootstrapToken:           redactSecret(cfg.BootstrapToken),
+		Registration: dto.RegistrationRetry{
+			MaxRetries:        cfg.RegistrationMaxRetries,
+			InitialBackoff:    cfg.RegistrationInitialBackoff.String(),
+			MaxBackoff:        cfg.RegistrationMaxBackoff.String(),
+			BackoffMultiplier: cfg.RegistrationBackoffMultiplier,
+			Timeout:           cfg.RegistrationTimeout.String(),
+		},
+		Heartbeat: dto.HeartbeatSettings{
+			Enabled:      cfg.Heartbeat.Enabled,
+			Interval:     cfg.Heartbeat.Interval.String(),
+			MaxRetries:   cfg.Heartbeat.MaxRetries,
+			RetryBackoff: cfg.Heartbeat.RetryBackoff.String(),
+		},
+		HealthProbeCacheTTL:  cfg.HealthProbeCacheTTL.String(),
+		RetryableStatusCodes: cfg.RetryableStatusCodes,
+		ConfigCachePath:      cfg.ConfigCachePath,
+		DebugEvents:          cfg.DebugEvents,
+		TracingEndpoint:      redactURL(cfg.Tracing.Endpoint),
+		TracingSampleRatio:   cfg.Tracing.SampleRatio,
+	}
+	if cfg.Redis != nil {
+		resp.Redis = &dto.RedisSettings{
+			Host:     cfg.Redis.Host,
+			Port:     cfg.Redis.Port,
+			DB:       cfg.Redis.DB,
+			Password: redactSecret(cfg.Redis.Password),
+		}
+	}
+	if cfg.TLSCertFile != "" {
+		resp.TLS = &dto.TLSSettings{CertFile: cfg.TLSCertFile, KeyFile: cfg.TLSKeyFile, CAFile: cfg.TLSCAFile}
+	}
+	return resp
+}
+
+func redactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
+
+// redactURL masks the password of a URL with credentials
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,131 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/internal/server/agent/dto"
+)
+
+const (
+	defaultHealthProbeTTL     = 5 * time.Second
+	defaultHealthProbeTimeout = 2 * time.Second
+)
+
+// dependencyProbe checks the controller and worker health endpoints and
+// caches the results for ttl so frequent health checks don't hammer them.
+// Probes run outside mutex, so a slow dependency never blocks a reader that
+// can be answered from the cache.
+type dependencyProbe struct {
+	mutex     sync.Mutex
+	ttl       time.Duration
+	timeout   time.Duration
+	checkedAt time.Time
+	results   map[string]dto.DependencyHealth
+	probing   chan struct{} // Closed when the probe in flight finishes; nil when none is
+}
+
+func newDependencyProbe(ttl time.Duration) *dependencyProbe {
+	if ttl <= 0 {
+		ttl = defaultHealthProbeTTL
+	}
+	return &dependencyProbe{ttl: ttl, timeout: defaultHealthProbeTimeout}
+}
+
+// check returns the cached results, probing again when they are older than
+// ttl. While a probe is in flight other callers get the previous results,
+// or wait for it when there are none yet.
+func (p *dependencyProbe) check(ctx context.Context, checks map[string]func(context.Context) error) map[string]dto.DependencyHealth {
+	p.mutex.Lock()
+	if p.results != nil && time.Since(p.checkedAt) < p.ttl {
+		defer p.mutex.Unlock()
+		return p.results
+	}
+	if probing := p.probing; probing != nil {
+		results := p.results
+		p.mutex.Unlock()
+		if results != nil {
+			return results
+		}
+		<-probing
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		return p.results
+	}
+	probing := make(chan struct{})
+	p.probing = probing
+	p.mutex.Unlock()
+
+	results := p.probe(ctx, checks)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.results = results
+	p.checkedAt = time.Now()
+	p.probing = nil
+	close(probing)
+	return results
+}
+
+// probe runs checks concurrently, each bounded by timeout
+func (p *dependencyProbe) probe(ctx context.Context, checks map[string]func(context.Context) error) map[string]dto.DependencyHealth {
+	results := make(map[string]dto.DependencyHealth, len(checks))
+	var wg sync.WaitGroup
+	var resultsMutex sync.Mutex
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(context.Context) error) {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, p.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(probeCtx)
+			health := dto.DependencyHealth{
+				Reachable: err == nil,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+				CheckedAt: start.UTC(),
+			}
+			if err != nil {
+				health.Error = err.Error()
+			}
+
+			resultsMutex.Lock()
+			results[name] = health
+			resultsMutex.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+	return results
+}
+
+// Health reports the agent's registration state. With deep set it also
+// probes the controller and worker and reports degraded if either is down.
+func (uc *UseCase) Health(ctx context.Context, deep bool) dto.HealthResponse {
+	agentID, _ := uc.repo.GetAgentID()
+	resp := dto.HealthResponse{
+		Status:       "healthy",
+		AgentID:      agentID,
+		Registered:   agentID != "",
+		Timestamp:    time.Now().UTC().Format(time.RFC3339),
+		Registration: uc.reg.snapshot(),
+	}
+	if !deep {
+		return resp
+	}
+
+	probes := map[string]func(context.Context) error{
+		"controller": uc.controller.CheckHealth,
+	}
+	if uc.forwardingEnabled() {
+		probes["worker"] = uc.worker.CheckHealth
+	}
+	resp.Dependencies = uc.probe.check(ctx, probes)
+	for _, dep := range resp.Dependencies {
+		if !dep.Reachable {
+			resp.Status = "degraded"
+		}
+	}
+	return resp
+}
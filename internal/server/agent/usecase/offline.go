@@ -0,0 +1,129 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/internal/models"
+	"github.com/Alwanly/service-distribute-management/internal/server/agent/repository"
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// deliveryCache marks worker forwards of the config loaded from the cache
+const deliveryCache = "cache"
+
+// cachedForwardRetry is how long the cached config forward waits between
+// worker readiness checks; a variable so tests can shorten it
+var cachedForwardRetry = 2 * time.Second
+
+// ServeCachedConfig loads the config cached by a previous run and forwards
+// it to the worker, for starting while the controller is unreachable. The
+// cached config is stored as current so polls after registration send its
+// ETag and only fetch a newer version. It returns nil when nothing is cached.
+//
+// The worker often starts alongside the agent, so the forward runs in the
+// background until the worker's /health passes and it accepts the config.
+func (uc *UseCase) ServeCachedConfig(ctx context.Context) (*models.Configuration, error) {
+	cfg, err := uc.repo.LoadCachedConfig()
+	if err != nil || cfg == nil {
+		return nil, err
+	}
+	uc.repo.SetConfig(cfg, cfg.ETag)
+
+	if uc.forwardingEnabled() {
+		go uc.forwardCachedConfig(ctx, cfg)
+	}
+	return cfg, nil
+}
+
+// forwardCachedConfig forwards cfg once the worker is ready, retrying every
+// cachedForwardRetry until it is sent, the worker rejects it, a newer config
+// replaces it or ctx is done
+func (uc *UseCase) forwardCachedConfig(ctx context.Context, cfg *models.Configuration) {
+	ctx, corr := logger.EnsureCorrelationID(ctx)
+	ctx = repository.WithDeliveryMethod(ctx, deliveryCache)
+	fields := []zap.Field{
+		zap.String("correlation_id", corr),
+		zap.String("etag", cfg.ETag),
+		zap.String("delivery_method", deliveryCache),
+	}
+
+	for attempt := 1; ; attempt++ {
+		if _, current := uc.repo.GetConfig(); current != cfg.ETag {
+			// Whatever stored the newer config forwards it
+			uc.logger.Info("cached configuration replaced before the worker was ready", append(fields, zap.String("current_etag", current))...)
+			return
+		}
+
+		err := uc.checkWorkerReady(ctx)
+		if err == nil {
+			uc.logger.Info("forwarding cached configuration to worker", append(fields, zap.Int("attempt", attempt))...)
+			err = uc.repo.QueueWorkerForward(ctx, cfg.ETag, uc.repo.NextConfigSeq(), func(ctx context.Context) error {
+				if err := uc.worker.SendConfiguration(ctx, cfg); err != nil {
+					uc.repo.RecordWorkerForward(uc.logger, cfg.ETag, err)
+					return fmt.Errorf("send cached configuration to worker: %w", err)
+				}
+				uc.repo.RecordWorkerForward(uc.logger, cfg.ETag, nil)
+				return nil
+			})
+			var rejected *repository.ConfigRejectedError
+			if err == nil || errors.Is(err, repository.ErrForwardSuperseded) || errors.As(err, &rejected) {
+				return
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		uc.logger.Warn("worker not ready for the cached configuration; retrying", append(fields,
+			zap.Error(err),
+			zap.Int("attempt", attempt),
+			zap.Duration("retry_in", cachedForwardRetry),
+		)...)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(cachedForwardRetry):
+		}
+	}
+}
+
+// checkWorkerReady runs the worker's /health probe under the probe timeout
+func (uc *UseCase) checkWorkerReady(ctx context.Context) error {
+	checkCtx, cancel := context.WithTimeout(ctx, uc.probe.timeout)
+	defer cancel()
+	return uc.worker.CheckHealth(checkCtx)
+}
+
+// RetryRegistration keeps calling RegisterWithController until it succeeds
+// or ctx is done, waiting RegistrationMaxBackoff between rounds. It is used
+// after startup registration failed and the agent is serving a cached config.
+func (uc *UseCase) RetryRegistration(ctx context.Context, hostname, startTime string) (*models.RegistrationResponse, error) {
+	wait := time.Second
+	if uc.cfg != nil && uc.cfg.RegistrationMaxBackoff > 0 {
+		wait = uc.cfg.RegistrationMaxBackoff
+	}
+
+	for {
+		resp, err := uc.RegisterWithController(ctx, hostname, startTime)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		uc.logger.Warn("controller still unreachable; serving cached configuration",
+			zap.Error(err),
+			zap.Duration("retry_in", wait),
+		)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
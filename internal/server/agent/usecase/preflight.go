@@ -0,0 +1,41 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/Alwanly/service-distribute-management/internal/config"
+)
+
+// PreflightWorker checks the worker's /health at startup so a wrong
+// WORKER_URL shows up before the first config forward fails. An unreachable
+// worker is logged as a warning, or returned as an error when the agent is
+// configured to fail on it.
+func (uc *UseCase) PreflightWorker(ctx context.Context) error {
+	mode := config.WorkerPreflightWarn
+	if uc.cfg != nil && uc.cfg.WorkerPreflight != "" {
+		mode = uc.cfg.WorkerPreflight
+	}
+	if mode == config.WorkerPreflightOff || !uc.forwardingEnabled() {
+		return nil
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, uc.probe.timeout)
+	defer cancel()
+	err := uc.worker.CheckHealth(checkCtx)
+	if err == nil {
+		uc.logger.Info("worker reachable")
+		return nil
+	}
+
+	if mode == config.WorkerPreflightFail {
+		return fmt.Errorf("worker unreachable: %w", err)
+	}
+	uc.logger.Warn("worker unreachable at startup; configs will not be applied until it is",
+		zap.Error(err),
+		zap.String("setting", "AGENT_WORKER_PREFLIGHT"),
+	)
+	return nil
+}
@@ -0,0 +1,62 @@
+package usecase
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/Alwanly/service-distribute-management/internal/config"
+	"github.com/Alwanly/service-distribute-management/internal/server/agent/repository"
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+)
+
+func TestPreflightWorker(t *testing.T) {
+	var hits atomic.Int32
+	reachable := newHealthServer(t, http.StatusOK, &hits)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	tests := []struct {
+		name     string
+		worker   string
+		mode     string
+		wantErr  bool
+		wantWarn bool
+	}{
+		{name: "reachable", worker: reachable.URL, mode: config.WorkerPreflightFail},
+		{name: "unreachable warns", worker: down.URL, mode: config.WorkerPreflightWarn, wantWarn: true},
+		{name: "unreachable fails", worker: down.URL, mode: config.WorkerPreflightFail, wantErr: true},
+		{name: "unreachable ignored when off", worker: down.URL, mode: config.WorkerPreflightOff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.WarnLevel)
+			log := logger.New(zap.New(core))
+			cfg := &config.AgentConfig{WorkerURL: tt.worker, RequestTimeout: time.Second, WorkerPreflight: tt.mode}
+			repo := repository.NewRepository("http://controller", tt.worker, "", "", nil)
+			uc := NewUseCase(&mockControllerClient{}, repo, repository.NewWorkerClient(cfg, log), cfg, log)
+
+			err := uc.PreflightWorker(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "worker unreachable") {
+				t.Errorf("got %q, want a worker unreachable error", err)
+			}
+			if warned := logs.Len() > 0; warned != tt.wantWarn {
+				t.Errorf("got warning %v, want %v", warned, tt.wantWarn)
+			}
+		})
+	}
+	if hits.Load() != 1 {
+		t.Errorf("got %d probes of the reachable worker, want 1", hits.Load())
+	}
+}
@@ -0,0 +1,124 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/Alwanly/service-distribute-management/pkg/httpclient"
+)
+
+// maxReauthAttempts caps back-to-back token refreshes triggered by 401s. The
+// count resets once an authenticated request succeeds, so a controller that
+// rejects every new token does not make the agent refresh forever.
+const maxReauthAttempts = 3
+
+// ErrReauthLimit is returned once maxReauthAttempts token refreshes in a row
+// have not produced a token the controller accepts
+var ErrReauthLimit = errors.New("re-authentication limit reached")
+
+// ErrAgentRevoked is returned once the controller refused a token refresh
+// because the agent was revoked. It is final: the agent does not try again
+// until an operator forces a refresh after restoring access.
+var ErrAgentRevoked = errors.New("agent revoked by the controller")
+
+// reauthGuard serializes token refreshes and counts them between
+// authenticated successes
+type reauthGuard struct {
+	mutex    sync.Mutex
+	attempts int
+	revoked  bool
+}
+
+// isUnauthorized reports whether err is a 401 from the controller
+func isUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// hasStatus reports whether err is a controller response with status code
+func hasStatus(err error, code int) bool {
+	var statusErr *httpclient.StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == code
+}
+
+// refreshToken asks the controller for a new token for the stored agent ID
+// and stores it. The agent keeps its ID, so a rotated token never leaves the
+// old agent behind as a second registration.
+func (uc *UseCase) refreshToken(ctx context.Context) (string, error) {
+	agentID, _ := uc.repo.GetAgentID()
+	if agentID == "" {
+		return "", fmt.Errorf("agent is not registered")
+	}
+
+	token, err := uc.controller.RefreshToken(ctx, agentID)
+	if err != nil {
+		if hasStatus(err, http.StatusForbidden) {
+			return "", fmt.Errorf("%w: %w", ErrAgentRevoked, err)
+		}
+		return "", err
+	}
+	uc.repo.SetAPIToken(token)
+
+	uc.logger.Info("refreshed agent token", zap.String("agent_id", agentID))
+	return agentID, nil
+}
+
+// reauthenticate refreshes the token after a request made with staleToken got
+// a 401. When the stored token already differs, another caller refreshed it
+// and the request can simply be retried.
+func (uc *UseCase) reauthenticate(ctx context.Context, staleToken string) error {
+	uc.reauth.mutex.Lock()
+	defer uc.reauth.mutex.Unlock()
+
+	if uc.repo.GetAPIToken() != staleToken {
+		return nil
+	}
+	if uc.reauth.revoked {
+		return ErrAgentRevoked
+	}
+	if uc.reauth.attempts >= maxReauthAttempts {
+		return fmt.Errorf("%w after %d attempts", ErrReauthLimit, uc.reauth.attempts)
+	}
+	uc.reauth.attempts++
+
+	uc.logger.Warn("controller rejected the agent token, refreshing it",
+		zap.Int("attempt", uc.reauth.attempts),
+		zap.Int("max_attempts", maxReauthAttempts),
+	)
+	if _, err := uc.refreshToken(ctx); err != nil {
+		if errors.Is(err, ErrAgentRevoked) {
+			uc.reauth.revoked = true
+			uc.logger.Error("agent revoked by the controller; no longer refreshing its token", zap.Error(err))
+		}
+		return fmt.Errorf("refresh token: %w", err)
+	}
+	return nil
+}
+
+// ForceReauthenticate refreshes the token on operator request, e.g. after an
+// admin rotated the agent's token or restored a revoked agent. It bypasses
+// the 401 cap and a previous revocation, and resets both when it succeeds.
+func (uc *UseCase) ForceReauthenticate(ctx context.Context) (string, error) {
+	uc.reauth.mutex.Lock()
+	defer uc.reauth.mutex.Unlock()
+
+	agentID, err := uc.refreshToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	uc.reauth.attempts = 0
+	uc.reauth.revoked = false
+	return agentID, nil
+}
+
+// authenticated resets the refresh cap after the controller accepted the
+// agent's token
+func (uc *UseCase) authenticated() {
+	uc.reauth.mutex.Lock()
+	defer uc.reauth.mutex.Unlock()
+	uc.reauth.attempts = 0
+}
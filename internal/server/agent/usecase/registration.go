@@ -0,0 +1,91 @@
+package usecase
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/internal/server/agent/dto"
+)
+
+// registrationTracker records the progress of startup registration so the
+// health endpoint can show where an agent that never came up is stuck
+type registrationTracker struct {
+	mutex         sync.Mutex
+	state         dto.RegistrationState
+	attempts      int
+	lastError     string
+	startedAt     time.Time
+	lastAttemptAt time.Time
+	completedAt   time.Time
+}
+
+func newRegistrationTracker() *registrationTracker {
+	return &registrationTracker{state: dto.RegistrationPending}
+}
+
+// IncrementAttempts records the start of a registration attempt
+func (t *registrationTracker) IncrementAttempts() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now().UTC()
+	if t.startedAt.IsZero() {
+		t.startedAt = now
+	}
+	t.state = dto.RegistrationRegistering
+	t.attempts++
+	t.lastAttemptAt = now
+}
+
+// SetAttemptError records why the latest attempt failed while retries continue
+func (t *registrationTracker) SetAttemptError(err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if err != nil {
+		t.lastError = err.Error()
+	}
+}
+
+// SetRegistered marks registration as complete
+func (t *registrationTracker) SetRegistered() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.state = dto.RegistrationRegistered
+	t.lastError = ""
+	t.completedAt = time.Now().UTC()
+}
+
+// SetRegistrationFailed marks registration as given up after attempts tries
+func (t *registrationTracker) SetRegistrationFailed(err error, attempts int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.state = dto.RegistrationFailed
+	t.attempts = attempts
+	if err != nil {
+		t.lastError = err.Error()
+	}
+	t.completedAt = time.Now().UTC()
+}
+
+func (t *registrationTracker) snapshot() dto.RegistrationStatus {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	status := dto.RegistrationStatus{
+		State:     t.state,
+		Attempts:  t.attempts,
+		LastError: t.lastError,
+	}
+	if !t.startedAt.IsZero() {
+		status.StartedAt = &t.startedAt
+	}
+	if !t.lastAttemptAt.IsZero() {
+		status.LastAttemptAt = &t.lastAttemptAt
+	}
+	if !t.completedAt.IsZero() {
+		status.CompletedAt = &t.completedAt
+	}
+	return status
+}
@@ -0,0 +1,63 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Alwanly/service-distribute-management/internal/server/agent/dto"
+)
+
+func TestRegistrationTracker_Transitions(t *testing.T) {
+	tracker := newRegistrationTracker()
+
+	status := tracker.snapshot()
+	if status.State != dto.RegistrationPending || status.Attempts != 0 || status.StartedAt != nil {
+		t.Fatalf("initial status = %+v, want pending with no attempts", status)
+	}
+
+	tracker.IncrementAttempts()
+	tracker.SetAttemptError(errors.New("connection refused"))
+	tracker.IncrementAttempts()
+	status = tracker.snapshot()
+	if status.State != dto.RegistrationRegistering || status.Attempts != 2 {
+		t.Fatalf("got %s after %d attempts, want registering after 2", status.State, status.Attempts)
+	}
+	if status.LastError != "connection refused" {
+		t.Errorf("last error = %q, want the previous attempt's error", status.LastError)
+	}
+	if status.StartedAt == nil || status.LastAttemptAt == nil || status.LastAttemptAt.Before(*status.StartedAt) {
+		t.Errorf("got started_at=%v last_attempt_at=%v, want both set in order", status.StartedAt, status.LastAttemptAt)
+	}
+	if status.CompletedAt != nil {
+		t.Error("completed_at set while still registering")
+	}
+
+	t.Run("failed", func(t *testing.T) {
+		failed := newRegistrationTracker()
+		failed.IncrementAttempts()
+		failed.SetRegistrationFailed(errors.New("deadline exceeded"), 5)
+
+		status := failed.snapshot()
+		if status.State != dto.RegistrationFailed || status.Attempts != 5 || status.LastError != "deadline exceeded" {
+			t.Fatalf("got %+v, want failed after 5 attempts with the error", status)
+		}
+		if status.CompletedAt == nil {
+			t.Error("completed_at not set on failure")
+		}
+	})
+
+	t.Run("registered", func(t *testing.T) {
+		tracker.SetRegistered()
+
+		status := tracker.snapshot()
+		if status.State != dto.RegistrationRegistered || status.Attempts != 2 {
+			t.Fatalf("got %s after %d attempts, want registered after 2", status.State, status.Attempts)
+		}
+		if status.LastError != "" {
+			t.Errorf("last error = %q, want it cleared on success", status.LastError)
+		}
+		if status.CompletedAt == nil {
+			t.Error("completed_at not set on success")
+		}
+	})
+}
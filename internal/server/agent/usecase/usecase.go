@@ -2,14 +2,17 @@ package usecase
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
-	"github.com/google/uuid"
-
 	"github.com/Alwanly/service-distribute-management/internal/config"
 	"github.com/Alwanly/service-distribute-management/internal/models"
+	"github.com/Alwanly/service-distribute-management/internal/server/agent/dto"
 	"github.com/Alwanly/service-distribute-management/internal/server/agent/repository"
+	"github.com/Alwanly/service-distribute-management/pkg/httpclient"
 	"github.com/Alwanly/service-distribute-management/pkg/logger"
 	"github.com/Alwanly/service-distribute-management/pkg/retry"
 	"go.uber.org/zap"
@@ -21,12 +24,34 @@ type UseCase struct {
 	worker     repository.IWorkerClient
 	cfg        *config.AgentConfig
 	logger     *logger.CanonicalLogger
+	probe      *dependencyProbe
+	reg        *registrationTracker
+	reauth     reauthGuard
+	// schemaCheckedAt is when the worker schema version was last read, in
+	// Unix nanoseconds
+	schemaCheckedAt atomic.Int64
 }
 
+// workerSchemaTTL is how long a worker schema version is trusted before the
+// worker is asked again, so an upgraded worker is picked up without an agent
+// restart
+var workerSchemaTTL = time.Minute
+
 func NewUseCase(ctrl repository.IControllerClient, repo repository.IRepository, worker repository.IWorkerClient, cfg *config.AgentConfig, log *logger.CanonicalLogger) *UseCase {
-	return &UseCase{controller: ctrl, repo: repo, worker: worker, cfg: cfg, logger: log}
+	var probeTTL time.Duration
+	if cfg != nil {
+		probeTTL = cfg.HealthProbeCacheTTL
+	}
+	uc := &UseCase{controller: ctrl, repo: repo, worker: worker, cfg: cfg, logger: log, probe: newDependencyProbe(probeTTL), reg: newRegistrationTracker()}
+	// Heartbeats and pushed config fetches also recover from a rotated token
+	repo.SetReauthenticator(uc.reauthenticate, uc.authenticated)
+	return uc
 }
-func (uc *UseCase) StartBackgroundServices(ctx context.Context, heartbeatInterval, fallbackInterval time.Duration) error {
+
+// StartBackgroundServices starts the Redis listener and heartbeats. Config
+// polling is not started here: the poller in pkg/poll, running the
+// handler's GetConfigure, is the agent's only config poll.
+func (uc *UseCase) StartBackgroundServices(ctx context.Context, heartbeatInterval time.Duration) error {
 	// Start Redis listener for push notifications
 	if err := uc.repo.StartRedisListener(ctx, uc.logger); err != nil {
 		uc.logger.WithError(err).Error("Failed to start Redis listener")
@@ -34,27 +59,29 @@ func (uc *UseCase) StartBackgroundServices(ctx context.Context, heartbeatInterva
 	}
 
 	// Start heartbeat polling if enabled
-	if uc.cfg != nil {
-		if uc.cfg.Heartbeat.Enabled && heartbeatInterval > 0 {
-			uc.repo.RegisterHeartbeatPolling(ctx, uc.logger, heartbeatInterval)
-		}
-		if uc.cfg.FallbackPoll.Enabled && fallbackInterval > 0 {
-			// Register fallback polling (uses same underlying mechanism)
-			uc.repo.RegisterConfigPolling(ctx, uc.logger)
-		}
-	} else {
-		// Fallback: register config polling
-		uc.repo.RegisterConfigPolling(ctx, uc.logger)
+	if uc.cfg != nil && uc.cfg.Heartbeat.Enabled && heartbeatInterval > 0 {
+		uc.repo.RegisterHeartbeatPolling(ctx, uc.logger, heartbeatInterval)
 	}
 
 	return nil
 }
 
+// StopWorkerForwards ends the worker forward goroutine; forwards queued
+// afterwards fail with repository.ErrForwarderStopped
+func (uc *UseCase) StopWorkerForwards() {
+	uc.repo.StopWorkerForwards()
+}
+
 func (uc *UseCase) RegisterWithController(ctx context.Context, hostname, startTime string) (*models.RegistrationResponse, error) {
 	var lastErr error
 	var savedResp *models.RegistrationResponse
-	op := func(ctx context.Context) error {
-		resp, err := uc.controller.Register(ctx, hostname, "", startTime)
+	attempts := 0
+	op := func(ctx context.Context) (err error) {
+		attempts++
+		uc.reg.IncrementAttempts()
+		defer func() { uc.reg.SetAttemptError(err) }()
+
+		resp, err := uc.controller.Register(ctx, hostname, uc.version(), startTime)
 		if err != nil {
 			lastErr = err
 			return err
@@ -85,12 +112,28 @@ func (uc *UseCase) RegisterWithController(ctx context.Context, hostname, startTi
 		MaxBackoff:     uc.cfg.RegistrationMaxBackoff,
 		Multiplier:     uc.cfg.RegistrationBackoffMultiplier,
 		Jitter:         true,
+		RetryIf:        httpclient.RetryableStatus(uc.cfg.RetryableStatusCodes),
 	}
 
-	if err := retry.WithExponentialBackoff(ctx, retryCfg, op); err != nil {
-		return nil, fmt.Errorf("register with controller failed after retries: %w", lastErr)
+	// Bound the whole retry loop so a large retry count cannot block startup indefinitely
+	regCtx := ctx
+	if uc.cfg.RegistrationTimeout > 0 {
+		var cancel context.CancelFunc
+		regCtx, cancel = context.WithTimeout(ctx, uc.cfg.RegistrationTimeout)
+		defer cancel()
 	}
 
+	if err := retry.WithExponentialBackoff(regCtx, retryCfg, op); err != nil {
+		if errors.Is(regCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			err = fmt.Errorf("registration deadline of %s exceeded: %w", uc.cfg.RegistrationTimeout, lastErr)
+		} else {
+			err = fmt.Errorf("register with controller failed after retries: %w", lastErr)
+		}
+		uc.reg.SetRegistrationFailed(err, attempts)
+		return nil, err
+	}
+	uc.reg.SetRegistered()
+
 	agentID, _ := uc.repo.GetAgentID()
 	_, poll, _ := uc.repo.GetPollInfo()
 	token := uc.repo.GetAPIToken()
@@ -145,55 +188,149 @@ func (uc *UseCase) FetchConfiguration(ctx context.Context) (*models.Configuratio
 		curETag = curCfg.ETag
 	}
 
+	// Taken before fetching so a push stored meanwhile is not replaced by
+	// an older version from this poll
+	seq := uc.repo.NextConfigSeq()
+	schemaVersion := uc.workerSchemaVersion(ctx)
+	fetch := func() (*models.Configuration, string, *int, bool, error) {
+		agentID, _ := uc.repo.GetAgentID()
+		pollURL, _, _ := uc.repo.GetPollInfo()
+		return uc.controller.GetConfiguration(repository.WithWorkerSchemaVersion(ctx, schemaVersion), agentID, pollURL, curETag)
+	}
+
+	token := uc.repo.GetAPIToken()
+	cfg, newETag, pollInterval, notModified, err := fetch()
+	if isUnauthorized(err) {
+		// The token was likely rotated; register again and retry once
+		if reauthErr := uc.reauthenticate(ctx, token); reauthErr != nil {
+			err = fmt.Errorf("%w (%w)", err, reauthErr)
+		} else {
+			logger.AddToContext(ctx, zap.Bool("reauthenticated", true))
+			cfg, newETag, pollInterval, notModified, err = fetch()
+		}
+	}
+	if err == nil {
+		uc.authenticated()
+	}
+
 	agentID, _ := uc.repo.GetAgentID()
 	pollURL, _, _ := uc.repo.GetPollInfo()
-
-	cfg, newETag, pollInterval, notModified, err := uc.controller.GetConfiguration(ctx, agentID, pollURL, curETag)
 	logger.AddToContext(ctx,
 		zap.String("agent_id", agentID),
 		zap.String("poll_url", pollURL),
 		zap.String("if_none_match", curETag),
 		zap.String("new_etag", newETag),
 		zap.Intp("poll_interval_seconds", pollInterval),
+		zap.Int("worker_schema_version", schemaVersion),
 	)
 	if err != nil {
 		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
 		return nil, nil, false, err
 	}
-	if notModified {
+	// A controller that ignores If-None-Match answers 200 with the version
+	// already stored and forwarded
+	if notModified || (cfg != nil && curETag != "" && newETag == curETag) {
 		logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, true), zap.String("result", "not_modified"))
-		return nil, pollInterval, true, nil
+		return uc.reforwardStored(ctx, pollInterval)
 	}
 
 	if cfg != nil {
+		applyStart := time.Now().UTC()
 		cfg.ETag = newETag
-		if err := uc.repo.UpdateConfig(cfg); err != nil {
-			return nil, nil, false, fmt.Errorf("update config repository: %w", err)
+		// A push may have applied and forwarded this version, or a newer
+		// one, while the poll was in flight
+		if !uc.repo.StoreConfigIfNew(cfg, seq) {
+			logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, true), zap.String("result", "already_applied"))
+			return nil, pollInterval, true, nil
+		}
+		if !uc.forwardingEnabled() {
+			logger.AddToContext(ctx, zap.Bool("worker_forwarding_disabled", true))
+			uc.repo.ClearErrorsBefore(applyStart)
+			return cfg, pollInterval, false, nil
+		}
+		// A pinned local config takes precedence; keep the controller config stored only
+		if uc.repo.IsConfigPinned() {
+			logger.AddToContext(ctx, zap.Bool("config_pinned", true))
+			uc.logger.Info("config pinned; skipping worker forward", zap.String("etag", cfg.ETag))
+			uc.repo.ClearErrorsBefore(applyStart)
+			return cfg, pollInterval, false, nil
 		}
-		// Send configuration to worker with retry wrapper if supported
 
-		// Ensure correlation ID is present in context for downstream worker calls
-		corr := logger.GetCorrelationID(ctx)
-		if corr == "" {
-			corr = uuid.Must(uuid.NewV7()).String()
-			ctx = logger.WithCorrelationID(ctx, corr)
+		err := uc.forwardPolled(ctx, cfg, seq)
+		if errors.Is(err, repository.ErrForwardSuperseded) {
+			logger.AddToContext(ctx, zap.Bool("forward_superseded", true))
+			return cfg, pollInterval, false, nil
 		}
-		uc.logger.Info("forwarding configuration to worker", zap.String("correlation_id", corr), zap.String("etag", cfg.ETag))
+		if err != nil {
+			return nil, nil, false, err
+		}
+		// The applied config supersedes any earlier failure
+		uc.repo.ClearErrorsBefore(applyStart)
+	}
 
+	return cfg, pollInterval, false, nil
+}
+
+// reforwardStored forwards the stored config again while the worker has not
+// accepted it, e.g. after a failed forward. Polls send the stored ETag as
+// If-None-Match, so the controller answers 304 and nothing else would retry
+// the forward.
+func (uc *UseCase) reforwardStored(ctx context.Context, pollInterval *int) (*models.Configuration, *int, bool, error) {
+	if !uc.forwardingEnabled() || uc.repo.IsConfigPinned() {
+		return nil, pollInterval, true, nil
+	}
+	cfg, seq := uc.repo.UnforwardedConfig()
+	if cfg == nil {
+		return nil, pollInterval, true, nil
+	}
+
+	applyStart := time.Now().UTC()
+	logger.AddToContext(ctx, zap.Bool("reforward", true))
+	err := uc.forwardPolled(ctx, cfg, seq)
+	if errors.Is(err, repository.ErrForwardSuperseded) {
+		logger.AddToContext(ctx, zap.Bool("forward_superseded", true))
+		return nil, pollInterval, true, nil
+	}
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return nil, nil, false, err
+	}
+	uc.repo.ClearErrorsBefore(applyStart)
+	return cfg, pollInterval, false, nil
+}
+
+// forwardPolled sends cfg, fetched under seq, to the worker, with the retry
+// wrapper if the worker client supports it
+func (uc *UseCase) forwardPolled(ctx context.Context, cfg *models.Configuration, seq uint64) error {
+	// Ensure correlation ID is present in context for downstream worker calls
+	ctx, corr := logger.EnsureCorrelationID(ctx)
+	ctx = repository.WithDeliveryMethod(ctx, "poll")
+	uc.logger.Info("forwarding configuration to worker",
+		zap.String("correlation_id", corr),
+		zap.String("etag", cfg.ETag),
+		zap.String("delivery_method", "poll"),
+		zap.Any("config", cfg.RedactedData()),
+	)
+
+	// Forwards are serialised with push forwards; a
+	// newer config queued meanwhile replaces this one
+	return uc.repo.QueueWorkerForward(ctx, cfg.ETag, seq, func(ctx context.Context) error {
 		if wc, ok := uc.worker.(interface {
 			SendConfigurationWithRetry(context.Context, *models.Configuration, int) error
 		}); ok {
 			if err := wc.SendConfigurationWithRetry(ctx, cfg, 5); err != nil {
-				return nil, nil, false, fmt.Errorf("send configuration to worker (with retry): %w", err)
+				uc.repo.RecordWorkerForward(uc.logger, cfg.ETag, err)
+				return fmt.Errorf("send configuration to worker (with retry): %w", err)
 			}
 		} else {
 			if err := uc.worker.SendConfiguration(ctx, cfg); err != nil {
-				return nil, nil, false, fmt.Errorf("send configuration to worker: %w", err)
+				uc.repo.RecordWorkerForward(uc.logger, cfg.ETag, err)
+				return fmt.Errorf("send configuration to worker: %w", err)
 			}
 		}
-	}
-
-	return cfg, pollInterval, false, nil
+		uc.repo.RecordWorkerForward(uc.logger, cfg.ETag, nil)
+		return nil
+	})
 }
 
 // GetPollInfo returns the stored poll URL and interval
@@ -206,7 +343,98 @@ func (uc *UseCase) SetStoredPollInterval(newInterval int) {
 	uc.repo.UpdatePollInterval(newInterval)
 }
 
+// GetDebugState returns a snapshot of the agent's runtime state
+func (uc *UseCase) GetDebugState() dto.DebugStateResponse {
+	agentID, _ := uc.repo.GetAgentID()
+	pollURL, pollInterval, _ := uc.repo.GetPollInfo()
+	_, etag := uc.repo.GetConfig()
+
+	return dto.DebugStateResponse{
+		AgentID:             agentID,
+		ConfigETag:          etag,
+		PollURL:             pollURL,
+		PollIntervalSeconds: pollInterval,
+		Worker:              uc.repo.GetWorkerSyncState(),
+		Pinned:              uc.repo.GetPinnedState(),
+		Redis:               uc.repo.GetRedisListenerStats(),
+		Delivery:            uc.repo.GetDeliveryMode(),
+		Heartbeat:           uc.repo.GetHeartbeatStats(),
+		Flags:               uc.repo.Flags(),
+	}
+}
+
+// PinConfig pins a local override config that is forwarded to the worker
+// instead of controller updates until UnpinConfig is called
+func (uc *UseCase) PinConfig(ctx context.Context, req *dto.PinConfigRequest) (*dto.PinnedConfigState, error) {
+	data, err := json.Marshal(req.Config)
+	if err != nil {
+		return nil, fmt.Errorf("marshal pinned config: %w", err)
+	}
+
+	etag := req.ETag
+	if etag == "" {
+		etag = fmt.Sprintf("pinned-%d", time.Now().UnixNano())
+	}
+
+	cfg := &models.Configuration{ETag: etag, ConfigData: string(data)}
+	if err := uc.repo.PinConfig(ctx, uc.logger, cfg); err != nil {
+		return nil, err
+	}
+	return uc.repo.GetPinnedState(), nil
+}
+
+// UnpinConfig removes the local override and restores the controller config
+func (uc *UseCase) UnpinConfig(ctx context.Context) error {
+	return uc.repo.UnpinConfig(ctx, uc.logger)
+}
+
+// OnPollIntervalUpdate sets how a poll interval pushed by the controller is
+// applied to the agent's poller
+func (uc *UseCase) OnPollIntervalUpdate(update func(intervalSeconds int)) {
+	uc.repo.SetIntervalUpdater(update)
+}
+
 // GetAgentID returns the currently stored agent ID
 func (uc *UseCase) GetAgentID() (string, error) {
 	return uc.repo.GetAgentID()
 }
+
+// workerSchemaVersion returns the config schema the worker supports, asking
+// the worker again once the remembered answer is older than workerSchemaTTL.
+// While the worker cannot be asked the last known version is kept. Zero means
+// unknown, in which case the controller serves without negotiation.
+func (uc *UseCase) workerSchemaVersion(ctx context.Context) int {
+	if !uc.forwardingEnabled() {
+		return 0
+	}
+	known := uc.repo.GetWorkerSchemaVersion()
+	if known > 0 && time.Since(time.Unix(0, uc.schemaCheckedAt.Load())) < workerSchemaTTL {
+		return known
+	}
+	v, err := uc.worker.SchemaVersion(ctx)
+	if err != nil {
+		uc.logger.Debug("worker schema version unavailable", zap.Error(err))
+		return known
+	}
+	uc.schemaCheckedAt.Store(time.Now().UnixNano())
+	if v != known {
+		if known > 0 {
+			uc.logger.Info("worker schema version changed", zap.Int("previous", known), zap.Int("schema_version", v))
+		}
+		uc.repo.SetWorkerSchemaVersion(v)
+	}
+	return v
+}
+
+// version returns the agent build reported at registration
+func (uc *UseCase) version() string {
+	if uc.cfg == nil {
+		return ""
+	}
+	return uc.cfg.Version
+}
+
+// forwardingEnabled reports whether configs are forwarded to a worker
+func (uc *UseCase) forwardingEnabled() bool {
+	return uc.cfg == nil || !uc.cfg.WorkerForwardingDisabled
+}
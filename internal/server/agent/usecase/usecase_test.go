@@ -0,0 +1,820 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Alwanly/service-distribute-management/internal/config"
+	"github.com/Alwanly/service-distribute-management/internal/models"
+	"github.com/Alwanly/service-distribute-management/internal/server/agent/dto"
+	"github.com/Alwanly/service-distribute-management/internal/server/agent/repository"
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+	"github.com/Alwanly/service-distribute-management/pkg/pubsub"
+)
+
+// mockControllerClient implements repository.IControllerClient with canned responses
+type mockControllerClient struct {
+	config      *models.Configuration
+	etag        string
+	interval    *int
+	notModified bool
+	err         error
+	registerErr error
+	registers   int
+	gotVersion  string
+
+	gotPollURL       string
+	gotIfNoneMatch   string
+	gotSchemaVersion int
+}
+
+var _ repository.IControllerClient = (*mockControllerClient)(nil)
+
+func (m *mockControllerClient) Register(ctx context.Context, hostname, version, startTime string) (*models.RegistrationResponse, error) {
+	m.registers++
+	m.gotVersion = version
+	if m.registerErr != nil {
+		return nil, m.registerErr
+	}
+	return &models.RegistrationResponse{AgentID: "agent-1", PollURL: "/config", PollIntervalSeconds: 30, APIToken: "token"}, nil
+}
+
+func (m *mockControllerClient) CheckRegistration(ctx context.Context, hostname, version, startTime string) error {
+	return nil
+}
+
+func (m *mockControllerClient) RefreshToken(ctx context.Context, agentID string) (string, error) {
+	return "token", nil
+}
+
+func (m *mockControllerClient) CheckHealth(ctx context.Context) error {
+	return nil
+}
+
+func (m *mockControllerClient) GetConfiguration(ctx context.Context, agentID, pollURL, ifNoneMatch string) (*models.Configuration, string, *int, bool, error) {
+	m.gotPollURL = pollURL
+	m.gotIfNoneMatch = ifNoneMatch
+	m.gotSchemaVersion = repository.WorkerSchemaVersion(ctx)
+	return m.config, m.etag, m.interval, m.notModified, m.err
+}
+
+// mockWorkerClient implements repository.IWorkerClient and records forwarded configs
+type mockWorkerClient struct {
+	sent          []string
+	err           error
+	schemaVersion int
+	// unhealthy fails that many CheckHealth calls before passing
+	unhealthy atomic.Int32
+	mu        sync.Mutex
+}
+
+var _ repository.IWorkerClient = (*mockWorkerClient)(nil)
+
+func (m *mockWorkerClient) SendConfiguration(ctx context.Context, config *models.Configuration) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, config.ETag)
+	return nil
+}
+
+// sentETags returns the ETags sent so far, for forwards made in the background
+func (m *mockWorkerClient) sentETags() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.sent...)
+}
+
+func (m *mockWorkerClient) CheckHealth(ctx context.Context) error {
+	if m.unhealthy.Add(-1) >= 0 {
+		return errors.New("worker starting")
+	}
+	return nil
+}
+
+func (m *mockWorkerClient) SchemaVersion(ctx context.Context) (int, error) {
+	if m.schemaVersion == 0 {
+		return 0, errors.New("worker unreachable")
+	}
+	return m.schemaVersion, nil
+}
+
+func (m *mockWorkerClient) SendConfigurationWithRetry(ctx context.Context, config *models.Configuration, maxRetries int) error {
+	return m.SendConfiguration(ctx, config)
+}
+
+func newTestUseCase(ctrl *mockControllerClient, worker *mockWorkerClient) *UseCase {
+	repo := repository.NewRepository("http://controller", "http://worker", "agent-1", "token", nil)
+	_ = repo.SetPollInfo("/config", 30)
+	return NewUseCase(ctrl, repo, worker, nil, logger.New(zap.NewNop()))
+}
+
+func TestFetchConfiguration(t *testing.T) {
+	interval := 15
+	tests := []struct {
+		name        string
+		ctrl        *mockControllerClient
+		worker      *mockWorkerClient
+		wantErr     bool
+		wantNotMod  bool
+		wantForward []string
+		noWorker    bool
+	}{
+		{
+			name:        "new config is forwarded",
+			ctrl:        &mockControllerClient{config: &models.Configuration{ConfigData: `{"url":"http://example.com"}`}, etag: "etag-1", interval: &interval},
+			worker:      &mockWorkerClient{},
+			wantForward: []string{"etag-1"},
+		},
+		{
+			name:       "not modified skips forward",
+			ctrl:       &mockControllerClient{notModified: true},
+			worker:     &mockWorkerClient{},
+			wantNotMod: true,
+		},
+		{
+			name:    "controller error",
+			ctrl:    &mockControllerClient{err: errors.New("boom")},
+			worker:  &mockWorkerClient{},
+			wantErr: true,
+		},
+		{
+			name:    "worker error",
+			ctrl:    &mockControllerClient{config: &models.Configuration{ConfigData: `{}`}, etag: "etag-2"},
+			worker:  &mockWorkerClient{err: errors.New("worker down")},
+			wantErr: true,
+		},
+		{
+			name:     "forwarding disabled stores without forwarding",
+			ctrl:     &mockControllerClient{config: &models.Configuration{ConfigData: `{}`}, etag: "etag-3"},
+			worker:   &mockWorkerClient{err: errors.New("no worker")},
+			noWorker: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := newTestUseCase(tt.ctrl, tt.worker)
+			if tt.noWorker {
+				uc.cfg = &config.AgentConfig{WorkerForwardingDisabled: true}
+			}
+
+			_, _, notModified, err := uc.FetchConfiguration(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got err %v, wantErr %v", err, tt.wantErr)
+			}
+			if notModified != tt.wantNotMod {
+				t.Errorf("got notModified %v, want %v", notModified, tt.wantNotMod)
+			}
+			if tt.ctrl.gotPollURL != "/config" {
+				t.Errorf("got poll URL %q, want /config", tt.ctrl.gotPollURL)
+			}
+			if len(tt.worker.sent) != len(tt.wantForward) {
+				t.Fatalf("forwarded %v, want %v", tt.worker.sent, tt.wantForward)
+			}
+			for i := range tt.wantForward {
+				if tt.worker.sent[i] != tt.wantForward[i] {
+					t.Errorf("forward %d: got %q, want %q", i, tt.worker.sent[i], tt.wantForward[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFetchConfiguration_UnconditionalResponseForStoredETag(t *testing.T) {
+	// A controller that ignores If-None-Match and answers 200 with the
+	// stored version must not cause a second forward
+	ctrl := &mockControllerClient{config: &models.Configuration{ConfigData: `{"url":"http://example.com"}`}, etag: "etag-1"}
+	worker := &mockWorkerClient{}
+	uc := newTestUseCase(ctrl, worker)
+
+	for i := 0; i < 2; i++ {
+		if _, _, _, err := uc.FetchConfiguration(context.Background()); err != nil {
+			t.Fatalf("fetch %d: %v", i+1, err)
+		}
+	}
+	if ctrl.gotIfNoneMatch != "etag-1" {
+		t.Errorf("second fetch sent If-None-Match %q, want etag-1", ctrl.gotIfNoneMatch)
+	}
+	if len(worker.sent) != 1 {
+		t.Fatalf("forwarded %v, want etag-1 once", worker.sent)
+	}
+}
+
+func TestFetchConfiguration_ReforwardsAfterWorkerRecovers(t *testing.T) {
+	ctrl := &mockControllerClient{config: &models.Configuration{ConfigData: `{"url":"http://example.com"}`}, etag: "etag-1"}
+	worker := &mockWorkerClient{err: errors.New("worker down")}
+	uc := newTestUseCase(ctrl, worker)
+	ctx := context.Background()
+
+	if _, _, _, err := uc.FetchConfiguration(ctx); err == nil {
+		t.Fatal("expected the first forward to fail")
+	}
+
+	// The stored ETag makes the controller answer 304 from now on
+	ctrl.config, ctrl.notModified = nil, true
+	worker.err = nil
+	cfg, _, notModified, err := uc.FetchConfiguration(ctx)
+	if err != nil {
+		t.Fatalf("second fetch: %v", err)
+	}
+	if ctrl.gotIfNoneMatch != "etag-1" {
+		t.Errorf("second fetch sent If-None-Match %q, want etag-1", ctrl.gotIfNoneMatch)
+	}
+	if notModified || cfg == nil || cfg.ETag != "etag-1" {
+		t.Fatalf("expected the stored config to be forwarded again, got %+v (not modified %v)", cfg, notModified)
+	}
+
+	if _, _, notModified, err := uc.FetchConfiguration(ctx); err != nil || !notModified {
+		t.Fatalf("third fetch: not modified %v, %v", notModified, err)
+	}
+	if sent := worker.sentETags(); len(sent) != 1 || sent[0] != "etag-1" {
+		t.Fatalf("forwarded %v, want etag-1 once the worker recovered", sent)
+	}
+}
+
+// pushSubscriber hands the agent's listener a channel the test publishes
+// config update notifications on
+type pushSubscriber struct {
+	ch chan pubsub.Message
+}
+
+func (s *pushSubscriber) Subscribe(ctx context.Context, channels ...string) (<-chan pubsub.Message, error) {
+	return s.ch, nil
+}
+
+func (s *pushSubscriber) Unsubscribe(ctx context.Context, channels ...string) error { return nil }
+func (s *pushSubscriber) Close() error                                              { return nil }
+
+func TestConcurrentPushAndPoll_ForwardOnce(t *testing.T) {
+	// The poll fetch is held until the push that started after it has
+	// fetched, stored and forwarded the same version
+	var arrivals atomic.Int32
+	pollInFlight := make(chan struct{})
+	pushForwarded := make(chan struct{})
+	controller := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if arrivals.Add(1) == 1 {
+			close(pollInFlight)
+			select {
+			case <-pushForwarded:
+			case <-time.After(2 * time.Second):
+			}
+		}
+		_ = json.NewEncoder(w).Encode(dto.ConfigurationResponse{
+			ID:     1,
+			ETag:   "etag-1",
+			Config: map[string]string{"url": "http://example.com"},
+		})
+	}))
+	defer controller.Close()
+
+	var forwards atomic.Int32
+	worker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/config" {
+			if forwards.Add(1) == 1 {
+				close(pushForwarded)
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer worker.Close()
+
+	cfg := &config.AgentConfig{ControllerURL: controller.URL, WorkerURL: worker.URL, RequestTimeout: 5 * time.Second}
+	log := logger.New(zap.NewNop())
+	sub := &pushSubscriber{ch: make(chan pubsub.Message, 1)}
+	repo := repository.NewRepository(controller.URL, worker.URL, "agent-1", "token", sub)
+	_ = repo.SetPollInfo("/config", 30)
+	repo.SetWorkerSchemaVersion(models.ConfigSchemaVersion)
+	uc := NewUseCase(repository.NewControllerClient(cfg, log), repo, repository.NewWorkerClient(cfg, log), cfg, log)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := repo.StartRedisListener(ctx, log); err != nil {
+		t.Fatalf("StartRedisListener: %v", err)
+	}
+
+	polled := make(chan error, 1)
+	go func() {
+		_, _, _, err := uc.FetchConfiguration(ctx)
+		polled <- err
+	}()
+	<-pollInFlight
+	payload, _ := json.Marshal(pubsub.ConfigUpdateNotification{SchemaVersion: pubsub.NotificationSchemaVersion, ETag: "etag-1"})
+	sub.ch <- pubsub.Message{Channel: pubsub.ConfigUpdatesChannel, Payload: string(payload)}
+
+	if err := <-polled; err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	// Let a second forward, if any, reach the worker
+	time.Sleep(100 * time.Millisecond)
+	if n := forwards.Load(); n != 1 {
+		t.Fatalf("expected a single worker forward, got %d", n)
+	}
+	if cur, _ := repo.GetCurrentConfig(); cur == nil || cur.ETag != "etag-1" {
+		t.Fatalf("stored config = %+v, want etag-1", cur)
+	}
+}
+
+func TestRegisterWithController_DeadlineBoundsRetries(t *testing.T) {
+	ctrl := &mockControllerClient{registerErr: errors.New("controller unavailable")}
+	uc := newTestUseCase(ctrl, &mockWorkerClient{})
+	uc.cfg = &config.AgentConfig{
+		RegistrationMaxRetries:        1000,
+		RegistrationInitialBackoff:    20 * time.Millisecond,
+		RegistrationMaxBackoff:        20 * time.Millisecond,
+		RegistrationBackoffMultiplier: 1,
+		RegistrationTimeout:           150 * time.Millisecond,
+	}
+
+	start := time.Now()
+	_, err := uc.RegisterWithController(context.Background(), "host", "now")
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatal("expected registration to fail")
+	}
+	if !strings.Contains(err.Error(), "deadline") || !strings.Contains(err.Error(), "controller unavailable") {
+		t.Errorf("got %q, want a deadline error wrapping the last attempt's error", err)
+	}
+	if elapsed > time.Second {
+		t.Errorf("registration took %v, want it bounded by the 150ms deadline", elapsed)
+	}
+	if ctrl.registers < 2 || ctrl.registers >= 1000 {
+		t.Errorf("got %d attempts, want several retries cut short by the deadline", ctrl.registers)
+	}
+}
+
+// newHealthServer serves /health with the given status and counts requests
+func newHealthServer(t *testing.T, status int, hits *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			http.NotFound(w, r)
+			return
+		}
+		hits.Add(1)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHealth_DeepProbesDependencies(t *testing.T) {
+	var controllerHits, workerHits atomic.Int32
+	controller := newHealthServer(t, http.StatusOK, &controllerHits)
+	worker := newHealthServer(t, http.StatusServiceUnavailable, &workerHits)
+
+	cfg := &config.AgentConfig{
+		ControllerURL:       controller.URL,
+		WorkerURL:           worker.URL,
+		RequestTimeout:      time.Second,
+		HealthProbeCacheTTL: time.Minute,
+	}
+	log := logger.New(zap.NewNop())
+	repo := repository.NewRepository(controller.URL, worker.URL, "", "", nil)
+	uc := NewUseCase(repository.NewControllerClient(cfg, log), repo, repository.NewWorkerClient(cfg, log), cfg, log)
+
+	shallow := uc.Health(context.Background(), false)
+	if shallow.Status != "healthy" || shallow.Dependencies != nil || controllerHits.Load() != 0 {
+		t.Fatalf("shallow check should not probe dependencies, got %+v", shallow)
+	}
+
+	res := uc.Health(context.Background(), true)
+	if res.Status != "degraded" {
+		t.Errorf("got status %q, want degraded", res.Status)
+	}
+	if dep := res.Dependencies["controller"]; !dep.Reachable || dep.Error != "" {
+		t.Errorf("controller: got %+v, want reachable", dep)
+	}
+	if dep := res.Dependencies["worker"]; dep.Reachable || !strings.Contains(dep.Error, "503") {
+		t.Errorf("worker: got %+v, want unreachable with status error", dep)
+	}
+
+	// A second deep check within the TTL is served from cache
+	uc.Health(context.Background(), true)
+	if controllerHits.Load() != 1 || workerHits.Load() != 1 {
+		t.Errorf("got %d controller and %d worker probes, want 1 each", controllerHits.Load(), workerHits.Load())
+	}
+}
+
+func TestHealth_ProbeCacheExpires(t *testing.T) {
+	var hits atomic.Int32
+	srv := newHealthServer(t, http.StatusOK, &hits)
+
+	cfg := &config.AgentConfig{ControllerURL: srv.URL, WorkerURL: srv.URL, RequestTimeout: time.Second, HealthProbeCacheTTL: 20 * time.Millisecond}
+	log := logger.New(zap.NewNop())
+	repo := repository.NewRepository(srv.URL, srv.URL, "", "", nil)
+	uc := NewUseCase(repository.NewControllerClient(cfg, log), repo, repository.NewWorkerClient(cfg, log), cfg, log)
+
+	if res := uc.Health(context.Background(), true); res.Status != "healthy" {
+		t.Fatalf("got %+v, want healthy", res)
+	}
+	time.Sleep(30 * time.Millisecond)
+	uc.Health(context.Background(), true)
+
+	if got := hits.Load(); got != 4 {
+		t.Errorf("got %d probes, want 4 (two dependencies, probed twice)", got)
+	}
+}
+
+func TestDependencyProbe_SlowProbeDoesNotBlockReaders(t *testing.T) {
+	probe := newDependencyProbe(time.Millisecond)
+	release := make(chan struct{})
+	var slow atomic.Bool
+	checks := map[string]func(context.Context) error{
+		"controller": func(ctx context.Context) error {
+			if slow.Load() {
+				<-release
+			}
+			return nil
+		},
+	}
+
+	if res := probe.check(context.Background(), checks); !res["controller"].Reachable {
+		t.Fatalf("got %+v, want reachable", res)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	slow.Store(true)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		probe.check(context.Background(), checks)
+	}()
+	// Wait for the slow probe to start
+	for deadline := time.Now().Add(time.Second); ; {
+		probe.mutex.Lock()
+		started := probe.probing != nil
+		probe.mutex.Unlock()
+		if started {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("probe did not start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	read := make(chan map[string]dto.DependencyHealth, 1)
+	go func() { read <- probe.check(context.Background(), checks) }()
+	select {
+	case res := <-read:
+		if !res["controller"].Reachable {
+			t.Errorf("got %+v, want the previous results", res)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a reader was blocked by the probe in flight")
+	}
+
+	close(release)
+	<-done
+}
+
+func TestFetchConfiguration_NegotiatesWorkerSchema(t *testing.T) {
+	ctrl := &mockControllerClient{notModified: true}
+	worker := &mockWorkerClient{}
+	uc := newTestUseCase(ctrl, worker)
+
+	// Unknown worker schema: fetch without negotiating
+	if _, _, _, err := uc.FetchConfiguration(context.Background()); err != nil {
+		t.Fatalf("FetchConfiguration: %v", err)
+	}
+	if ctrl.gotSchemaVersion != 0 {
+		t.Fatalf("schema version = %d, want 0 while the worker is unreachable", ctrl.gotSchemaVersion)
+	}
+
+	worker.schemaVersion = 1
+	if _, _, _, err := uc.FetchConfiguration(context.Background()); err != nil {
+		t.Fatalf("FetchConfiguration: %v", err)
+	}
+	if ctrl.gotSchemaVersion != 1 {
+		t.Fatalf("schema version = %d, want 1", ctrl.gotSchemaVersion)
+	}
+
+	// The discovered version is remembered
+	worker.schemaVersion = 0
+	if _, _, _, err := uc.FetchConfiguration(context.Background()); err != nil {
+		t.Fatalf("FetchConfiguration: %v", err)
+	}
+	if ctrl.gotSchemaVersion != 1 {
+		t.Fatalf("schema version = %d, want cached 1", ctrl.gotSchemaVersion)
+	}
+
+	// Once the TTL passes an upgraded worker is picked up
+	defer func(ttl time.Duration) { workerSchemaTTL = ttl }(workerSchemaTTL)
+	workerSchemaTTL = 0
+	worker.schemaVersion = 2
+	if _, _, _, err := uc.FetchConfiguration(context.Background()); err != nil {
+		t.Fatalf("FetchConfiguration: %v", err)
+	}
+	if ctrl.gotSchemaVersion != 2 {
+		t.Fatalf("schema version = %d, want refreshed 2", ctrl.gotSchemaVersion)
+	}
+
+	// A worker that cannot be asked keeps the last known version
+	worker.schemaVersion = 0
+	if _, _, _, err := uc.FetchConfiguration(context.Background()); err != nil {
+		t.Fatalf("FetchConfiguration: %v", err)
+	}
+	if ctrl.gotSchemaVersion != 2 {
+		t.Fatalf("schema version = %d, want last known 2", ctrl.gotSchemaVersion)
+	}
+}
+
+func TestHealth_ReportsRegistrationStatus(t *testing.T) {
+	ctrl := &mockControllerClient{registerErr: errors.New("registration failed with status 503: unavailable")}
+	uc := newTestUseCase(ctrl, &mockWorkerClient{})
+	uc.cfg = &config.AgentConfig{
+		Version:                       "1.4.0",
+		RegistrationMaxRetries:        2,
+		RegistrationInitialBackoff:    time.Millisecond,
+		RegistrationMaxBackoff:        time.Millisecond,
+		RegistrationBackoffMultiplier: 1,
+	}
+
+	if got := uc.Health(context.Background(), false).Registration.State; got != dto.RegistrationPending {
+		t.Fatalf("before registration: state = %s, want pending", got)
+	}
+
+	if _, err := uc.RegisterWithController(context.Background(), "host", "now"); err == nil {
+		t.Fatal("expected registration to fail")
+	}
+	reg := uc.Health(context.Background(), false).Registration
+	if reg.State != dto.RegistrationFailed || reg.Attempts != ctrl.registers {
+		t.Fatalf("got %s after %d attempts, want failed after %d", reg.State, reg.Attempts, ctrl.registers)
+	}
+	if !strings.Contains(reg.LastError, "status 503") {
+		t.Errorf("last error = %q, want the controller's response", reg.LastError)
+	}
+
+	ctrl.registerErr = nil
+	if _, err := uc.RegisterWithController(context.Background(), "host", "now"); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	reg = uc.Health(context.Background(), false).Registration
+	if reg.State != dto.RegistrationRegistered || reg.LastError != "" || reg.CompletedAt == nil {
+		t.Fatalf("got %+v, want registered with the error cleared", reg)
+	}
+	if ctrl.gotVersion != "1.4.0" {
+		t.Errorf("registered with version %q, want the agent build", ctrl.gotVersion)
+	}
+}
+
+// newTokenController serves /register/refresh with token-N for the Nth
+// refresh, answering 403 once revoked is set, and accepts GET /config only
+// with the token in accepted. Any registration fails the test.
+func newTokenController(t *testing.T, accepted string, refreshes *atomic.Int32, revoked *atomic.Bool) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/register":
+			t.Error("expected the agent to refresh its token, not register again")
+			w.WriteHeader(http.StatusConflict)
+		case "/register/refresh":
+			var req struct {
+				AgentID string `json:"agent_id"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if revoked != nil && revoked.Load() {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"message":"api token revoked"}`))
+				return
+			}
+			n := refreshes.Add(1)
+			_, _ = fmt.Fprintf(w, `{"agent_id":%q,"api_token":"token-%d"}`, req.AgentID, n)
+		case "/config":
+			if r.Header.Get("Authorization") != "Bearer "+accepted {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"id":1,"etag":"etag-1","config":{"url":"http://example.com"}}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchConfiguration_RefreshesTokenAfterUnauthorized(t *testing.T) {
+	var refreshes atomic.Int32
+	controller := newTokenController(t, "token-1", &refreshes, nil)
+
+	cfg := &config.AgentConfig{ControllerURL: controller.URL, RequestTimeout: time.Second, Hostname: "host-a", WorkerForwardingDisabled: true}
+	log := logger.New(zap.NewNop())
+	// The stored token was rotated away by an admin
+	repo := repository.NewRepository(controller.URL, "", "agent-0", "stale", nil)
+	uc := NewUseCase(repository.NewControllerClient(cfg, log), repo, &mockWorkerClient{}, cfg, log)
+
+	got, _, _, err := uc.FetchConfiguration(context.Background())
+	if err != nil {
+		t.Fatalf("expected the retried fetch to succeed, got %v", err)
+	}
+	if got == nil || got.ETag != "etag-1" {
+		t.Fatalf("expected etag-1, got %+v", got)
+	}
+	if refreshes.Load() != 1 {
+		t.Fatalf("expected one token refresh, got %d", refreshes.Load())
+	}
+	if id, _ := repo.GetAgentID(); id != "agent-0" || repo.GetAPIToken() != "token-1" {
+		t.Fatalf("expected a new token under the same agent ID, got %s/%s", id, repo.GetAPIToken())
+	}
+}
+
+func TestFetchConfiguration_CapsTokenRefreshes(t *testing.T) {
+	var refreshes atomic.Int32
+	// No refreshed token is ever accepted
+	controller := newTokenController(t, "never", &refreshes, nil)
+
+	cfg := &config.AgentConfig{ControllerURL: controller.URL, RequestTimeout: time.Second, WorkerForwardingDisabled: true}
+	log := logger.New(zap.NewNop())
+	repo := repository.NewRepository(controller.URL, "", "agent-0", "stale", nil)
+	uc := NewUseCase(repository.NewControllerClient(cfg, log), repo, &mockWorkerClient{}, cfg, log)
+
+	for i := 0; i < maxReauthAttempts+2; i++ {
+		if _, _, _, err := uc.FetchConfiguration(context.Background()); err == nil {
+			t.Fatal("expected the fetch to keep failing")
+		}
+	}
+	if n := refreshes.Load(); n != maxReauthAttempts {
+		t.Fatalf("expected %d token refreshes, got %d", maxReauthAttempts, n)
+	}
+	if _, _, _, err := uc.FetchConfiguration(context.Background()); !errors.Is(err, ErrReauthLimit) {
+		t.Fatalf("expected ErrReauthLimit once capped, got %v", err)
+	}
+
+	// An operator-forced refresh is not capped
+	if _, err := uc.ForceReauthenticate(context.Background()); err != nil {
+		t.Fatalf("ForceReauthenticate: %v", err)
+	}
+	if n := refreshes.Load(); n != maxReauthAttempts+1 {
+		t.Fatalf("expected the forced refresh to reach the controller, got %d", n)
+	}
+}
+
+func TestFetchConfiguration_RevokedAgentStopsRefreshing(t *testing.T) {
+	var refreshes atomic.Int32
+	var revoked atomic.Bool
+	revoked.Store(true)
+	controller := newTokenController(t, "token-1", &refreshes, &revoked)
+
+	cfg := &config.AgentConfig{ControllerURL: controller.URL, RequestTimeout: time.Second, WorkerForwardingDisabled: true}
+	log := logger.New(zap.NewNop())
+	repo := repository.NewRepository(controller.URL, "", "agent-0", "stale", nil)
+	uc := NewUseCase(repository.NewControllerClient(cfg, log), repo, &mockWorkerClient{}, cfg, log)
+
+	for i := 0; i < 2; i++ {
+		if _, _, _, err := uc.FetchConfiguration(context.Background()); !errors.Is(err, ErrAgentRevoked) {
+			t.Fatalf("fetch %d: expected ErrAgentRevoked, got %v", i+1, err)
+		}
+	}
+	if id, _ := repo.GetAgentID(); id != "agent-0" || repo.GetAPIToken() != "stale" {
+		t.Fatalf("expected the identity to be left alone, got %s/%s", id, repo.GetAPIToken())
+	}
+
+	// An admin restores the agent and the operator forces a refresh
+	revoked.Store(false)
+	if _, err := uc.ForceReauthenticate(context.Background()); err != nil {
+		t.Fatalf("ForceReauthenticate: %v", err)
+	}
+	if _, _, _, err := uc.FetchConfiguration(context.Background()); err != nil {
+		t.Fatalf("expected the fetch to succeed after the forced refresh, got %v", err)
+	}
+}
+
+func TestServeCachedConfig_AfterRegistrationFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	// A previous run received a config from the controller
+	previous := repository.NewRepository("http://controller", "http://worker", "agent-1", "token", nil)
+	previous.SetConfigCachePath(path)
+	if err := previous.UpdateConfig(&models.Configuration{ID: 3, ETag: "etag-3", ConfigData: `{"url":"http://example.com"}`}); err != nil {
+		t.Fatalf("UpdateConfig: %v", err)
+	}
+
+	ctrl := &mockControllerClient{registerErr: errors.New("controller unavailable"), notModified: true}
+	worker := &mockWorkerClient{}
+	repo := repository.NewRepository("http://controller", "http://worker", "", "", nil)
+	repo.SetConfigCachePath(path)
+	uc := NewUseCase(ctrl, repo, worker, &config.AgentConfig{
+		RegistrationMaxRetries:        1,
+		RegistrationInitialBackoff:    time.Millisecond,
+		RegistrationMaxBackoff:        time.Millisecond,
+		RegistrationBackoffMultiplier: 1,
+	}, logger.New(zap.NewNop()))
+
+	if _, err := uc.RegisterWithController(context.Background(), "host", "now"); err == nil {
+		t.Fatal("expected registration to fail")
+	}
+	cfg, err := uc.ServeCachedConfig(context.Background())
+	if err != nil || cfg == nil {
+		t.Fatalf("ServeCachedConfig: %+v, %v", cfg, err)
+	}
+	if sent := waitForSent(t, worker, 1); sent[0] != "etag-3" {
+		t.Fatalf("expected the cached config to be forwarded, got %v", sent)
+	}
+
+	// Once registered, polls only fetch a version newer than the cached one
+	ctrl.registerErr = nil
+	if _, err := uc.RetryRegistration(context.Background(), "host", "now"); err != nil {
+		t.Fatalf("RetryRegistration: %v", err)
+	}
+	if _, _, notModified, err := uc.FetchConfiguration(context.Background()); err != nil || !notModified {
+		t.Fatalf("expected not modified, got %v, %v", notModified, err)
+	}
+	if ctrl.gotIfNoneMatch != "etag-3" {
+		t.Fatalf("expected the poll to send the cached ETag, got %q", ctrl.gotIfNoneMatch)
+	}
+}
+
+// waitForSent waits until worker received n configs and returns their ETags
+func waitForSent(t *testing.T, worker *mockWorkerClient, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		sent := worker.sentETags()
+		if len(sent) >= n {
+			return sent
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d forwards, got %v", n, sent)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestServeCachedConfig_WaitsForWorkerReadiness(t *testing.T) {
+	prev := cachedForwardRetry
+	cachedForwardRetry = time.Millisecond
+	t.Cleanup(func() { cachedForwardRetry = prev })
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	previous := repository.NewRepository("http://controller", "http://worker", "agent-1", "token", nil)
+	previous.SetConfigCachePath(path)
+	if err := previous.UpdateConfig(&models.Configuration{ID: 3, ETag: "etag-3", ConfigData: `{"url":"http://example.com"}`}); err != nil {
+		t.Fatalf("UpdateConfig: %v", err)
+	}
+
+	// The worker is still starting when the agent serves the cache
+	worker := &mockWorkerClient{}
+	worker.unhealthy.Store(3)
+	repo := repository.NewRepository("http://controller", "http://worker", "", "", nil)
+	repo.SetConfigCachePath(path)
+	uc := NewUseCase(&mockControllerClient{}, repo, worker, nil, logger.New(zap.NewNop()))
+
+	if cfg, err := uc.ServeCachedConfig(context.Background()); err != nil || cfg == nil {
+		t.Fatalf("ServeCachedConfig: %+v, %v", cfg, err)
+	}
+	if sent := waitForSent(t, worker, 1); len(sent) != 1 || sent[0] != "etag-3" {
+		t.Fatalf("expected one forward of the cached config once the worker is ready, got %v", sent)
+	}
+	if left := worker.unhealthy.Load(); left > 0 {
+		t.Fatalf("forwarded before the worker passed its health check (%d failures left)", left)
+	}
+}
+
+func TestServeCachedConfig_NothingCached(t *testing.T) {
+	worker := &mockWorkerClient{}
+	uc := newTestUseCase(&mockControllerClient{}, worker)
+
+	cfg, err := uc.ServeCachedConfig(context.Background())
+	if err != nil || cfg != nil {
+		t.Fatalf("expected no cached config, got %+v: %v", cfg, err)
+	}
+	if len(worker.sent) != 0 {
+		t.Fatalf("expected nothing forwarded, got %v", worker.sent)
+	}
+}
+
+func TestRetryRegistration_StopsWithContext(t *testing.T) {
+	ctrl := &mockControllerClient{registerErr: errors.New("controller unavailable")}
+	uc := newTestUseCase(ctrl, &mockWorkerClient{})
+	uc.cfg = &config.AgentConfig{
+		RegistrationMaxRetries:        1,
+		RegistrationInitialBackoff:    time.Millisecond,
+		RegistrationMaxBackoff:        10 * time.Millisecond,
+		RegistrationBackoffMultiplier: 1,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := uc.RetryRegistration(ctx, "host", "now"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the context error, got %v", err)
+	}
+	if ctrl.registers < 2 {
+		t.Fatalf("expected registration to be retried, got %d attempts", ctrl.registers)
+	}
+}
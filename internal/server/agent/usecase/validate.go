@@ -0,0 +1,43 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ValidateConnectivity checks that the agent could start without starting
+// it: the controller and worker health endpoints must answer, and the
+// controller must accept the agent's registration credentials. The check
+// uses the controller's dry-run endpoint, so no agent is registered and a
+// bootstrap token keeps its uses for the real deployment. The error lists
+// every check that failed.
+func (uc *UseCase) ValidateConnectivity(ctx context.Context, hostname, startTime string) error {
+	var errs []error
+
+	controllerErr := uc.controller.CheckHealth(ctx)
+	if controllerErr != nil {
+		errs = append(errs, fmt.Errorf("controller: %w", controllerErr))
+	} else {
+		uc.logger.Info("validate: controller reachable")
+	}
+
+	if uc.forwardingEnabled() {
+		if err := uc.worker.CheckHealth(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("worker: %w", err))
+		} else {
+			uc.logger.Info("validate: worker reachable")
+		}
+	}
+
+	// Registration cannot be accepted by an unreachable controller
+	if controllerErr == nil {
+		if err := uc.controller.CheckRegistration(ctx, hostname, uc.version(), startTime); err != nil {
+			errs = append(errs, fmt.Errorf("registration: %w", err))
+		} else {
+			uc.logger.Info("validate: registration credentials accepted")
+		}
+	}
+
+	return errors.Join(errs...)
+}
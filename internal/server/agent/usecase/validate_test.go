@@ -0,0 +1,103 @@
+package usecase
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Alwanly/service-distribute-management/internal/config"
+	"github.com/Alwanly/service-distribute-management/internal/server/agent/repository"
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+)
+
+// newValidateUseCase builds a usecase on real clients for the given URLs
+func newValidateUseCase(controllerURL, workerURL string) (*UseCase, repository.IRepository) {
+	cfg := &config.AgentConfig{ControllerURL: controllerURL, WorkerURL: workerURL, RequestTimeout: time.Second, BootstrapToken: "bootstrap-1"}
+	log := logger.New(zap.NewNop())
+	repo := repository.NewRepository(controllerURL, workerURL, "", "", nil)
+	return NewUseCase(repository.NewControllerClient(cfg, log), repo, repository.NewWorkerClient(cfg, log), cfg, log), repo
+}
+
+func TestValidateConnectivity_ChecksRegistrationWithoutRegistering(t *testing.T) {
+	var checked, registered atomic.Int32
+	controller := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/health":
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/register/check" && r.Method == http.MethodPost:
+			if r.Header.Get("Authorization") != "Bearer bootstrap-1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			checked.Add(1)
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/register":
+			// A real registration would spend the single-use bootstrap token
+			registered.Add(1)
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer controller.Close()
+	var workerHits atomic.Int32
+	worker := newHealthServer(t, http.StatusOK, &workerHits)
+
+	uc, repo := newValidateUseCase(controller.URL, worker.URL)
+	if err := uc.ValidateConnectivity(context.Background(), "host", "now"); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if checked.Load() != 1 || registered.Load() != 0 {
+		t.Errorf("got %d registration checks and %d registrations, want 1 and 0", checked.Load(), registered.Load())
+	}
+	if workerHits.Load() != 1 {
+		t.Errorf("got %d worker probes, want 1", workerHits.Load())
+	}
+	if id, _ := repo.GetAgentID(); id != "" {
+		t.Errorf("expected nothing persisted, got agent id %q", id)
+	}
+}
+
+func TestValidateConnectivity_RejectedCredentials(t *testing.T) {
+	controller := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer controller.Close()
+	var workerHits atomic.Int32
+	worker := newHealthServer(t, http.StatusOK, &workerHits)
+
+	uc, _ := newValidateUseCase(controller.URL, worker.URL)
+	err := uc.ValidateConnectivity(context.Background(), "host", "now")
+	if err == nil || !strings.Contains(err.Error(), "registration:") || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("got %v, want a rejected registration", err)
+	}
+}
+
+func TestValidateConnectivity_UnreachableController(t *testing.T) {
+	controller := httptest.NewServer(http.NotFoundHandler())
+	controller.Close()
+	var workerHits atomic.Int32
+	worker := newHealthServer(t, http.StatusOK, &workerHits)
+
+	uc, _ := newValidateUseCase(controller.URL, worker.URL)
+	err := uc.ValidateConnectivity(context.Background(), "host", "now")
+	if err == nil || !strings.Contains(err.Error(), "controller:") {
+		t.Fatalf("got %v, want a controller error", err)
+	}
+	if strings.Contains(err.Error(), "registration") {
+		t.Errorf("expected registration to be skipped, got %v", err)
+	}
+	if workerHits.Load() != 1 {
+		t.Errorf("expected the worker to be probed anyway, got %d probes", workerHits.Load())
+	}
+}
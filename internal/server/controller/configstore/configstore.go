@@ -0,0 +1,67 @@
+// Package configstore keeps the versions of the configuration the controller
+// distributes. The usecase depends on ConfigStore only, so the SQL backend can
+// be swapped for another one (memory, Redis, files) without touching it.
+package configstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Version is one stored version of a config. Name is the profile the version
+// belongs to; empty for the default config.
+type Version struct {
+	Name      string
+	ETag      string
+	Data      string
+	CreatedAt time.Time
+}
+
+// Profile summarizes the versions stored for a named config
+type Profile struct {
+	Name      string
+	ETag      string `gorm:"column:etag"`
+	Versions  int64
+	UpdatedAt time.Time
+}
+
+// ConfigStore stores config versions. Every profile has its own history and
+// the empty name is the default config.
+type ConfigStore interface {
+	// LatestETag returns the ETag of the newest version of name, or "" when
+	// it has no versions
+	LatestETag(ctx context.Context, name string) (string, error)
+	// Get returns the version with the given ETag, or nil when it is unknown
+	Get(ctx context.Context, etag string) (*Version, error)
+	// Put stores data as the newest version of name and returns its ETag
+	Put(ctx context.Context, name string, data string) (string, error)
+	// PutIfChanged stores data as the newest version of name unless the
+	// newest version already holds the same data, in which case it returns
+	// that version's ETag and false. The compare and the store are one
+	// atomic step, so identical pushes racing each other store a single
+	// version; see the implementations for what they guarantee across
+	// processes.
+	PutIfChanged(ctx context.Context, name string, data string) (string, bool, error)
+	// PutIfAbsent stores data as the first version of name unless name
+	// already has versions, in which case it returns the newest one's ETag
+	// and false
+	PutIfAbsent(ctx context.Context, name string, data string) (string, bool, error)
+	// History returns up to limit versions of name, newest first. A limit
+	// of zero or less returns every version.
+	History(ctx context.Context, name string, limit int) ([]Version, error)
+	// Delete removes the versions with the given ETags and returns how many
+	// were removed; unknown ETags are ignored
+	Delete(ctx context.Context, etags []string) (int64, error)
+	// Profiles returns every named config with its newest version, sorted
+	// by name; the default config is not included
+	Profiles(ctx context.Context) ([]Profile, error)
+	// DeleteProfile removes every version of name and returns how many were
+	// removed
+	DeleteProfile(ctx context.Context, name string) (int64, error)
+}
+
+// newETag derives a version's ETag from its size and the time it was stored
+func newETag(data string) string {
+	return fmt.Sprintf("%x-%d", len(data), time.Now().UnixNano())
+}
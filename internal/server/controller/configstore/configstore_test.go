@@ -0,0 +1,256 @@
+package configstore
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/Alwanly/service-distribute-management/pkg/database"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testConfigStore(t, func(t *testing.T) ConfigStore {
+		return NewMemoryStore()
+	})
+}
+
+func TestSQLStore(t *testing.T) {
+	testConfigStore(t, func(t *testing.T) ConfigStore {
+		db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+			Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+		})
+		if err != nil {
+			t.Fatalf("open database: %v", err)
+		}
+		if err := database.RunMigrations(db); err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+		return NewSQLStore(db)
+	})
+}
+
+// testConfigStore is the behaviour every ConfigStore implementation must have
+func testConfigStore(t *testing.T, newStore func(t *testing.T) ConfigStore) {
+	ctx := context.Background()
+
+	t.Run("empty", func(t *testing.T) {
+		store := newStore(t)
+
+		if etag, err := store.LatestETag(ctx, ""); err != nil || etag != "" {
+			t.Fatalf("expected no latest version, got %q: %v", etag, err)
+		}
+		if v, err := store.Get(ctx, "missing"); err != nil || v != nil {
+			t.Fatalf("expected nil for an unknown etag, got %+v: %v", v, err)
+		}
+		if history, err := store.History(ctx, "", 10); err != nil || len(history) != 0 {
+			t.Fatalf("expected empty history, got %+v: %v", history, err)
+		}
+	})
+
+	t.Run("put and get", func(t *testing.T) {
+		store := newStore(t)
+
+		etag, err := store.Put(ctx, "", `{"url":"http://example.com"}`)
+		if err != nil || etag == "" {
+			t.Fatalf("put: %q, %v", etag, err)
+		}
+		if latest, _ := store.LatestETag(ctx, ""); latest != etag {
+			t.Fatalf("expected latest %s, got %s", etag, latest)
+		}
+		v, err := store.Get(ctx, etag)
+		if err != nil || v == nil {
+			t.Fatalf("get: %+v, %v", v, err)
+		}
+		if v.ETag != etag || v.Name != "" || v.Data != `{"url":"http://example.com"}` || v.CreatedAt.IsZero() {
+			t.Fatalf("unexpected version %+v", v)
+		}
+	})
+
+	t.Run("history is newest first", func(t *testing.T) {
+		store := newStore(t)
+
+		var etags []string
+		for _, data := range []string{`{"n":1}`, `{"n":2}`, `{"n":3}`} {
+			etag, err := store.Put(ctx, "", data)
+			if err != nil {
+				t.Fatalf("put: %v", err)
+			}
+			etags = append(etags, etag)
+		}
+		if etags[0] == etags[1] || etags[1] == etags[2] {
+			t.Fatalf("expected a distinct etag per version, got %v", etags)
+		}
+		if latest, _ := store.LatestETag(ctx, ""); latest != etags[2] {
+			t.Fatalf("expected latest %s, got %s", etags[2], latest)
+		}
+
+		history, err := store.History(ctx, "", 0)
+		if err != nil || len(history) != 3 {
+			t.Fatalf("expected 3 versions, got %+v: %v", history, err)
+		}
+		for i, v := range history {
+			if v.ETag != etags[2-i] {
+				t.Fatalf("version %d: expected %s, got %s", i, etags[2-i], v.ETag)
+			}
+		}
+
+		limited, _ := store.History(ctx, "", 2)
+		if len(limited) != 2 || limited[0].ETag != etags[2] || limited[1].ETag != etags[1] {
+			t.Fatalf("expected the 2 newest versions, got %+v", limited)
+		}
+	})
+
+	t.Run("profiles are separate", func(t *testing.T) {
+		store := newStore(t)
+
+		def, _ := store.Put(ctx, "", `{"n":1}`)
+		scraper, _ := store.Put(ctx, "scraper", `{"n":2}`)
+
+		if latest, _ := store.LatestETag(ctx, ""); latest != def {
+			t.Fatalf("expected default latest %s, got %s", def, latest)
+		}
+		if latest, _ := store.LatestETag(ctx, "scraper"); latest != scraper {
+			t.Fatalf("expected profile latest %s, got %s", scraper, latest)
+		}
+		if latest, _ := store.LatestETag(ctx, "other"); latest != "" {
+			t.Fatalf("expected no versions for an unknown profile, got %s", latest)
+		}
+		history, _ := store.History(ctx, "scraper", 0)
+		if len(history) != 1 || history[0].Name != "scraper" {
+			t.Fatalf("expected one profile version, got %+v", history)
+		}
+		if v, _ := store.Get(ctx, scraper); v == nil || v.Name != "scraper" {
+			t.Fatalf("expected get to return the profile version, got %+v", v)
+		}
+	})
+
+	t.Run("profiles", func(t *testing.T) {
+		store := newStore(t)
+
+		_, _ = store.Put(ctx, "", `{"n":0}`)
+		_, _ = store.Put(ctx, "scraper", `{"n":1}`)
+		latest, _ := store.Put(ctx, "scraper", `{"n":2}`)
+		other, _ := store.Put(ctx, "api", `{"n":3}`)
+
+		profiles, err := store.Profiles(ctx)
+		if err != nil || len(profiles) != 2 {
+			t.Fatalf("expected two profiles, got %+v: %v", profiles, err)
+		}
+		if p := profiles[0]; p.Name != "api" || p.ETag != other || p.Versions != 1 || p.UpdatedAt.IsZero() {
+			t.Fatalf("unexpected first profile %+v", p)
+		}
+		if p := profiles[1]; p.Name != "scraper" || p.ETag != latest || p.Versions != 2 {
+			t.Fatalf("unexpected second profile %+v", p)
+		}
+
+		deleted, err := store.DeleteProfile(ctx, "scraper")
+		if err != nil || deleted != 2 {
+			t.Fatalf("expected 2 deleted versions, got %d: %v", deleted, err)
+		}
+		if etag, _ := store.LatestETag(ctx, "scraper"); etag != "" {
+			t.Fatalf("expected the profile to be gone, got %s", etag)
+		}
+		if etag, _ := store.LatestETag(ctx, ""); etag == "" {
+			t.Fatal("expected the default config to be kept")
+		}
+		if deleted, _ := store.DeleteProfile(ctx, "missing"); deleted != 0 {
+			t.Fatalf("expected nothing deleted for an unknown profile, got %d", deleted)
+		}
+	})
+
+	t.Run("put if changed", func(t *testing.T) {
+		store := newStore(t)
+
+		first, stored, err := store.PutIfChanged(ctx, "", `{"n":1}`)
+		if err != nil || !stored {
+			t.Fatalf("expected the first version stored, got %q %v: %v", first, stored, err)
+		}
+		if etag, stored, _ := store.PutIfChanged(ctx, "", `{"n":1}`); stored || etag != first {
+			t.Fatalf("expected identical data to return %q unstored, got %q %v", first, etag, stored)
+		}
+		// Only the newest version is compared, and each profile on its own
+		if _, stored, _ := store.PutIfChanged(ctx, "scraper", `{"n":1}`); !stored {
+			t.Fatal("expected the same data stored under another profile")
+		}
+		second, _, _ := store.PutIfChanged(ctx, "", `{"n":2}`)
+		back, stored, _ := store.PutIfChanged(ctx, "", `{"n":1}`)
+		if !stored || back == first || back == second {
+			t.Fatalf("expected reverting to older data to store a new version, got %q %v", back, stored)
+		}
+		if history, _ := store.History(ctx, "", 0); len(history) != 3 {
+			t.Fatalf("expected 3 default versions, got %+v", history)
+		}
+	})
+
+	t.Run("put if changed concurrently", func(t *testing.T) {
+		store := newStore(t)
+
+		var wg sync.WaitGroup
+		var stored atomic.Int32
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, ok, err := store.PutIfChanged(ctx, "", `{"n":1}`)
+				if err != nil {
+					t.Errorf("put: %v", err)
+				}
+				if ok {
+					stored.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		if history, _ := store.History(ctx, "", 0); stored.Load() != 1 || len(history) != 1 {
+			t.Fatalf("expected one version from identical concurrent pushes, got %d stored and %d versions", stored.Load(), len(history))
+		}
+	})
+
+	t.Run("put if absent", func(t *testing.T) {
+		store := newStore(t)
+
+		first, stored, err := store.PutIfAbsent(ctx, "", `{}`)
+		if err != nil || !stored || first == "" {
+			t.Fatalf("expected the first version stored, got %q %v: %v", first, stored, err)
+		}
+		if latest, _ := store.LatestETag(ctx, ""); latest != first {
+			t.Fatalf("expected latest %s, got %s", first, latest)
+		}
+		second, _ := store.Put(ctx, "", `{"n":2}`)
+		if etag, stored, err := store.PutIfAbsent(ctx, "", `{}`); err != nil || stored || etag != second {
+			t.Fatalf("expected the newest version %q unstored, got %q %v: %v", second, etag, stored, err)
+		}
+		if history, _ := store.History(ctx, "", 0); len(history) != 2 {
+			t.Fatalf("expected 2 default versions, got %+v", history)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		store := newStore(t)
+
+		first, _ := store.Put(ctx, "", `{"n":1}`)
+		second, _ := store.Put(ctx, "", `{"n":2}`)
+		third, _ := store.Put(ctx, "", `{"n":3}`)
+
+		deleted, err := store.Delete(ctx, []string{first, "unknown"})
+		if err != nil || deleted != 1 {
+			t.Fatalf("expected 1 deleted version, got %d: %v", deleted, err)
+		}
+		if v, _ := store.Get(ctx, first); v != nil {
+			t.Fatalf("expected the deleted version to be gone, got %+v", v)
+		}
+		history, _ := store.History(ctx, "", 0)
+		if len(history) != 2 || history[0].ETag != third || history[1].ETag != second {
+			t.Fatalf("expected the two newer versions, got %+v", history)
+		}
+		if deleted, err := store.Delete(ctx, nil); err != nil || deleted != 0 {
+			t.Fatalf("expected deleting nothing to be a no-op, got %d: %v", deleted, err)
+		}
+	})
+}
@@ -0,0 +1,160 @@
+package configstore
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps versions in memory; they are lost on restart. It suits
+// tests and single-process setups that do not need history across restarts.
+type MemoryStore struct {
+	mu sync.RWMutex
+	// versions are kept in insertion order, newest last
+	versions []Version
+}
+
+var _ ConfigStore = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) LatestETag(ctx context.Context, name string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := len(s.versions) - 1; i >= 0; i-- {
+		if s.versions[i].Name == name {
+			return s.versions[i].ETag, nil
+		}
+	}
+	return "", nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, etag string) (*Version, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, v := range s.versions {
+		if v.ETag == etag {
+			return &v, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *MemoryStore) Put(ctx context.Context, name string, data string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	etag := newETag(data)
+	s.versions = append(s.versions, Version{Name: name, ETag: etag, Data: data, CreatedAt: time.Now().UTC()})
+	return etag, nil
+}
+
+func (s *MemoryStore) PutIfChanged(ctx context.Context, name string, data string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.versions) - 1; i >= 0; i-- {
+		if s.versions[i].Name != name {
+			continue
+		}
+		if s.versions[i].Data == data {
+			return s.versions[i].ETag, false, nil
+		}
+		break
+	}
+	etag := newETag(data)
+	s.versions = append(s.versions, Version{Name: name, ETag: etag, Data: data, CreatedAt: time.Now().UTC()})
+	return etag, true, nil
+}
+
+func (s *MemoryStore) PutIfAbsent(ctx context.Context, name string, data string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.versions) - 1; i >= 0; i-- {
+		if s.versions[i].Name == name {
+			return s.versions[i].ETag, false, nil
+		}
+	}
+	etag := newETag(data)
+	s.versions = append(s.versions, Version{Name: name, ETag: etag, Data: data, CreatedAt: time.Now().UTC()})
+	return etag, true, nil
+}
+
+func (s *MemoryStore) History(ctx context.Context, name string, limit int) ([]Version, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var versions []Version
+	for i := len(s.versions) - 1; i >= 0 && (limit <= 0 || len(versions) < limit); i-- {
+		if s.versions[i].Name == name {
+			versions = append(versions, s.versions[i])
+		}
+	}
+	return versions, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, etags []string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	remove := make(map[string]bool, len(etags))
+	for _, etag := range etags {
+		remove[etag] = true
+	}
+	kept := s.versions[:0]
+	for _, v := range s.versions {
+		if !remove[v.ETag] {
+			kept = append(kept, v)
+		}
+	}
+	deleted := int64(len(s.versions) - len(kept))
+	s.versions = kept
+	return deleted, nil
+}
+
+func (s *MemoryStore) Profiles(ctx context.Context) ([]Profile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	byName := make(map[string]*Profile)
+	for _, v := range s.versions {
+		if v.Name == "" {
+			continue
+		}
+		p, ok := byName[v.Name]
+		if !ok {
+			p = &Profile{Name: v.Name}
+			byName[v.Name] = p
+		}
+		p.ETag = v.ETag
+		p.UpdatedAt = v.CreatedAt
+		p.Versions++
+	}
+	profiles := make([]Profile, 0, len(byName))
+	for _, p := range byName {
+		profiles = append(profiles, *p)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles, nil
+}
+
+func (s *MemoryStore) DeleteProfile(ctx context.Context, name string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.versions[:0]
+	for _, v := range s.versions {
+		if v.Name != name {
+			kept = append(kept, v)
+		}
+	}
+	deleted := int64(len(s.versions) - len(kept))
+	s.versions = kept
+	return deleted, nil
+}
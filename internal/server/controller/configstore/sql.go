@@ -0,0 +1,163 @@
+package configstore
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/Alwanly/service-distribute-management/internal/models"
+)
+
+// SQLStore keeps versions in the configurations table
+type SQLStore struct {
+	db *gorm.DB
+}
+
+var _ ConfigStore = (*SQLStore)(nil)
+
+func NewSQLStore(db *gorm.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+func (s *SQLStore) LatestETag(ctx context.Context, name string) (string, error) {
+	var etag string
+	err := s.db.WithContext(ctx).
+		Raw("SELECT etag FROM configurations WHERE name = ? ORDER BY created_at DESC, id DESC LIMIT 1", name).
+		Scan(&etag).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to get latest config version: %w", err)
+	}
+	return etag, nil
+}
+
+func (s *SQLStore) Get(ctx context.Context, etag string) (*Version, error) {
+	var configs []models.Configuration
+	if err := s.db.WithContext(ctx).Where("etag = ?", etag).Limit(1).Find(&configs).Error; err != nil {
+		return nil, fmt.Errorf("failed to get config version: %w", err)
+	}
+	if len(configs) == 0 {
+		return nil, nil
+	}
+	v := toVersion(configs[0])
+	return &v, nil
+}
+
+func (s *SQLStore) Put(ctx context.Context, name string, data string) (string, error) {
+	etag := newETag(data)
+	if err := s.db.WithContext(ctx).Create(&models.Configuration{
+		Name:       name,
+		ETag:       etag,
+		ConfigData: data,
+	}).Error; err != nil {
+		return "", fmt.Errorf("failed to store config version: %w", err)
+	}
+	return etag, nil
+}
+
+// PutIfChanged inserts with a single INSERT ... SELECT guarded by the
+// newest version's data. The statement is atomic because SQLite runs one
+// writer at a time, even across processes sharing the file; a database
+// that lets concurrent statements read before either writes would need a
+// transaction or a unique constraint instead.
+func (s *SQLStore) PutIfChanged(ctx context.Context, name string, data string) (string, bool, error) {
+	etag := newETag(data)
+	now := s.db.NowFunc()
+	result := s.db.WithContext(ctx).Exec(`INSERT INTO configurations (name, etag, config_data, created_at, updated_at)
+		SELECT ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM (SELECT config_data FROM configurations
+			WHERE name = ? ORDER BY created_at DESC, id DESC LIMIT 1) latest
+			WHERE latest.config_data = ?)`,
+		name, etag, data, now, now, name, data)
+	if result.Error != nil {
+		return "", false, fmt.Errorf("failed to store config version: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return etag, true, nil
+	}
+
+	latest, err := s.LatestETag(ctx, name)
+	if err != nil {
+		return "", false, err
+	}
+	return latest, false, nil
+}
+
+// PutIfAbsent inserts with a single INSERT ... SELECT guarded by the
+// absence of any version of name; like PutIfChanged it relies on SQLite's
+// single writer
+func (s *SQLStore) PutIfAbsent(ctx context.Context, name string, data string) (string, bool, error) {
+	etag := newETag(data)
+	now := s.db.NowFunc()
+	result := s.db.WithContext(ctx).Exec(`INSERT INTO configurations (name, etag, config_data, created_at, updated_at)
+		SELECT ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM configurations WHERE name = ?)`,
+		name, etag, data, now, now, name)
+	if result.Error != nil {
+		return "", false, fmt.Errorf("failed to store config version: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return etag, true, nil
+	}
+
+	latest, err := s.LatestETag(ctx, name)
+	if err != nil {
+		return "", false, err
+	}
+	return latest, false, nil
+}
+
+func (s *SQLStore) History(ctx context.Context, name string, limit int) ([]Version, error) {
+	query := s.db.WithContext(ctx).Where("name = ?", name).Order("created_at DESC, id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	var configs []models.Configuration
+	if err := query.Find(&configs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list config versions: %w", err)
+	}
+	versions := make([]Version, len(configs))
+	for i, c := range configs {
+		versions[i] = toVersion(c)
+	}
+	return versions, nil
+}
+
+func (s *SQLStore) Delete(ctx context.Context, etags []string) (int64, error) {
+	if len(etags) == 0 {
+		return 0, nil
+	}
+	result := s.db.WithContext(ctx).Where("etag IN ?", etags).Delete(&models.Configuration{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete config versions: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// Profiles reads every profile's newest version and count in one query.
+// Versions are only appended, so the highest id is the newest.
+func (s *SQLStore) Profiles(ctx context.Context) ([]Profile, error) {
+	var profiles []Profile
+	err := s.db.WithContext(ctx).Raw(`SELECT c.name, c.etag, p.versions, c.created_at AS updated_at
+		FROM configurations c
+		JOIN (SELECT name, COUNT(*) AS versions, MAX(id) AS latest_id
+			FROM configurations WHERE name <> '' GROUP BY name) p ON c.id = p.latest_id
+		ORDER BY c.name`).Scan(&profiles).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list config profiles: %w", err)
+	}
+	return profiles, nil
+}
+
+func (s *SQLStore) DeleteProfile(ctx context.Context, name string) (int64, error) {
+	result := s.db.WithContext(ctx).Where("name = ?", name).Delete(&models.Configuration{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete config profile: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+func toVersion(c models.Configuration) Version {
+	return Version{Name: c.Name, ETag: c.ETag, Data: c.ConfigData, CreatedAt: c.CreatedAt}
+}
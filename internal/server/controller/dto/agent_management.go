@@ -1,18 +1,51 @@
 package dto
 
-import "github.com/Alwanly/service-distribute-management/internal/models"
+import (
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/internal/models"
+)
 
 type UpdatePollIntervalRequest struct {
 	PollIntervalSeconds *int `json:"poll_interval_seconds"`
 }
 
+// UpdateDefaultPollIntervalRequest changes the global default poll interval
+// served to agents without a per-agent override
+type UpdateDefaultPollIntervalRequest struct {
+	PollIntervalSeconds int `json:"poll_interval_seconds" example:"30" validate:"required,min=1,max=86400"`
+}
+
+type DefaultPollIntervalResponse struct {
+	PollIntervalSeconds         int `json:"poll_interval_seconds"`
+	PreviousPollIntervalSeconds int `json:"previous_poll_interval_seconds"`
+}
+
 type RotateTokenResponse struct {
 	AgentID  string `json:"agent_id"`
 	APIToken string `json:"api_token"`
 	Message  string `json:"message"`
 }
 
+// RefreshTokenRequest asks for a new token for an already registered agent
+type RefreshTokenRequest struct {
+	AgentID string `json:"agent_id" example:"0190a8c2-7d4e-7c3b-9f1a-2b3c4d5e6f70" validate:"required"`
+}
+
+type RevokeTokenResponse struct {
+	AgentID   string    `json:"agent_id"`
+	RevokedAt time.Time `json:"revoked_at"`
+	Message   string    `json:"message"`
+}
+
 type ListAgentsResponse struct {
 	Agents []models.AgentPublic `json:"agents"`
 	Total  int                  `json:"total"`
 }
+
+// AgentDetailResponse is an agent with how far its applied config trails the
+// version it would be served now
+type AgentDetailResponse struct {
+	models.AgentPublic
+	ConfigLag ConfigLag `json:"config_lag"`
+}
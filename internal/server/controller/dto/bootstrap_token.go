@@ -0,0 +1,15 @@
+package dto
+
+import "time"
+
+type CreateBootstrapTokenRequest struct {
+	MaxUses    int `json:"max_uses" example:"1" validate:"omitempty,min=1,max=1000"`           // Defaults to 1 (single use)
+	TTLSeconds int `json:"ttl_seconds" example:"3600" validate:"omitempty,min=60,max=2592000"` // Defaults to 1 hour
+}
+
+type CreateBootstrapTokenResponse struct {
+	ID        string    `json:"id"`
+	Token     string    `json:"token"` // Shown only once
+	MaxUses   int       `json:"max_uses"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,33 @@
+package dto
+
+import "time"
+
+// PruneConfigVersionsRequest overrides the configured retention policy for
+// one prune; fields left out fall back to CONFIG_RETENTION_KEEP and
+// CONFIG_RETENTION_MAX_AGE. DryRun lists what would be pruned without
+// deleting anything.
+type PruneConfigVersionsRequest struct {
+	Keep          *int `json:"keep,omitempty" example:"20" validate:"omitempty,min=0"`
+	MaxAgeSeconds *int `json:"max_age_seconds,omitempty" example:"2592000" validate:"omitempty,min=0"`
+	DryRun        bool `json:"dry_run,omitempty" example:"false"`
+}
+
+// PrunedConfigVersion is a config version removed (or, in a dry run, due
+// to be removed) by a prune
+type PrunedConfigVersion struct {
+	Profile   string    `json:"profile,omitempty" example:"scraper"`
+	ETag      string    `json:"etag" example:"1a-1700000000000000000"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PruneConfigVersionsResponse reports the policy applied and its outcome.
+// Protected counts versions outside the policy that were kept because they
+// are the latest of their profile or an agent runs or is served them.
+type PruneConfigVersionsResponse struct {
+	DryRun        bool                  `json:"dry_run"`
+	Keep          int                   `json:"keep" example:"20"`
+	MaxAgeSeconds int                   `json:"max_age_seconds" example:"2592000"`
+	Pruned        []PrunedConfigVersion `json:"pruned"`
+	Kept          int                   `json:"kept" example:"20"`
+	Protected     int                   `json:"protected" example:"1"`
+}
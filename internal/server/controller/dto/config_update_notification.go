@@ -4,3 +4,26 @@ type ConfigUpdateNotification struct {
 	AgentID string `json:"agent_id"`
 	ETag    string `json:"etag"`
 }
+
+// ReplayConfigResponse reports a re-published config update notification
+type ReplayConfigResponse struct {
+	ETag          string `json:"etag" example:"a1b2c3"`
+	CorrelationID string `json:"correlation_id" example:"0190f5c2-7d1e-7b3a-9c4d-2f6e8a1b3c5d"`
+	// Subscribers is how many Redis subscribers received the notification
+	Subscribers int64 `json:"subscribers" example:"12"`
+}
+
+// RedisPingResponse is the result of a live Redis connectivity check
+type RedisPingResponse struct {
+	// Configured is false when the controller runs without Redis (poll-only)
+	Configured bool `json:"configured" example:"true"`
+	Success    bool `json:"success" example:"true"`
+	// Stage is the step that failed: ping or publish
+	Stage     string   `json:"stage,omitempty" example:"ping"`
+	Error     string   `json:"error,omitempty"`
+	PingMs    *float64 `json:"ping_ms,omitempty" example:"0.8"`
+	PublishMs *float64 `json:"publish_ms,omitempty" example:"1.1"`
+	// Subscribers is how many subscribers received the test publish; it
+	// goes to a throwaway channel so this is normally 0
+	Subscribers int64 `json:"subscribers" example:"0"`
+}
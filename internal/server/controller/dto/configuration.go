@@ -1,8 +1,54 @@
 package dto
 
+import "github.com/Alwanly/service-distribute-management/internal/models"
+
+// SetConfigAgentRequest is a config as set through the admin API. It mirrors
+// models.ConfigData field for field (selectors are selector transforms), so
+// every setting the worker reads can be pushed; the controller stamps the
+// schema version when serving it.
 type SetConfigAgentRequest struct {
 	URl   string `json:"url" example:"http://example.com/api" validate:"required,url"`
 	Proxy string `json:"proxy" example:"http://proxy.example.com:8080" validate:"omitempty"`
+	// ResponseEncoding is how the worker returns the target response; empty means text
+	ResponseEncoding string `json:"response_encoding,omitempty" example:"base64" validate:"omitempty,oneof=text base64 raw stream"`
+	// Match limits the config to agents whose metadata has every key/value listed
+	Match map[string]string `json:"match,omitempty" validate:"omitempty,max=16,dive,keys,required,max=64,endkeys,max=256"`
+	// InsecureSkipVerify makes the worker skip TLS verification for this target
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty" example:"false"`
+	// Transforms post-process the worker's response in order
+	Transforms []models.Transform `json:"transforms,omitempty" validate:"omitempty,max=16"`
+	// CollectEnabled makes the worker poll the target every CollectInterval seconds
+	CollectEnabled  bool `json:"collect_enabled,omitempty" example:"false"`
+	CollectInterval int  `json:"collect_interval,omitempty" example:"60" validate:"omitempty,min=1,max=86400"`
+	// Assertions are expectations the worker checks on every target response
+	Assertions []models.Assertion `json:"assertions,omitempty" validate:"omitempty,max=16"`
+	// Flags are feature flags (boolean or string values) for the agent and worker
+	Flags models.Flags `json:"flags,omitempty" swaggertype:"object" validate:"omitempty,max=64"`
+}
+
+// ConfigData returns the config as the worker receives it
+func (r *SetConfigAgentRequest) ConfigData() models.ConfigData {
+	return models.ConfigData{
+		URL:                r.URl,
+		Proxy:              r.Proxy,
+		ResponseEncoding:   r.ResponseEncoding,
+		Match:              r.Match,
+		InsecureSkipVerify: r.InsecureSkipVerify,
+		Transforms:         r.Transforms,
+		CollectEnabled:     r.CollectEnabled,
+		CollectInterval:    r.CollectInterval,
+		Assertions:         r.Assertions,
+		Flags:              r.Flags,
+	}
+}
+
+// SetConfigAgentResponse reports the ETag of the stored config. NoChange is
+// set when the push was identical to the latest version, in which case no
+// version was stored and agents were not notified.
+type SetConfigAgentResponse struct {
+	Message  string `json:"message" example:"Config updated successfully"`
+	ETag     string `json:"etag" example:"1a-1700000000000000000"`
+	NoChange bool   `json:"no_change" example:"false"`
 }
 
 type GetConfigAgentRequest struct {
@@ -13,5 +59,13 @@ type GetConfigAgentResponse struct {
 	ID                  int64       `json:"id" example:"1"`
 	ETag                string      `json:"etag" example:"1"`
 	Config              interface{} `json:"config" swaggertype:"object"`
-	PollIntervalSeconds *int        `json:"poll_interval_seconds,omitempty"` // Optional: allows dynamic updates
+	PollIntervalSeconds *int        `json:"poll_interval_seconds,omitempty"`     // Optional: allows dynamic updates
+	Profile             string      `json:"profile,omitempty" example:"scraper"` // Named profile served; empty for the default config
+}
+
+// FetchQuotaExceededResponse is returned with 429 when an agent polls faster
+// than its poll interval allows
+type FetchQuotaExceededResponse struct {
+	Error             string `json:"error" example:"config fetch quota exceeded"`
+	RetryAfterSeconds int    `json:"retry_after_seconds" example:"12"`
 }
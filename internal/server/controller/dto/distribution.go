@@ -0,0 +1,94 @@
+package dto
+
+import "time"
+
+// ConfigVersionCount is the number of agents reporting a config version.
+// An empty ETag groups agents that have not sent a heartbeat yet.
+type ConfigVersionCount struct {
+	ETag   string `json:"etag" example:"1a-1700000000000000000"`
+	Agents int64  `json:"agents" example:"12"`
+}
+
+// LaggingAgent is an agent whose reported config version differs from the
+// version it would be served now
+type LaggingAgent struct {
+	AgentID         string     `json:"agent_id"`
+	AgentName       string     `json:"agent_name"`
+	ConfigVersion   string     `json:"config_version"`
+	ExpectedVersion string     `json:"expected_version"`
+	LastHeartbeat   *time.Time `json:"last_heartbeat,omitempty"`
+}
+
+type ConfigDistributionResponse struct {
+	LatestETag  string               `json:"latest_etag" example:"1a-1700000000000000000"` // Latest default config
+	TotalAgents int                  `json:"total_agents" example:"15"`
+	UpToDate    int                  `json:"up_to_date" example:"12"`
+	Versions    []ConfigVersionCount `json:"versions"`
+	Lagging     []LaggingAgent       `json:"lagging"`
+}
+
+// ConfigLag is how far an agent's reported config version trails the
+// version it would be served now. Known is false when the reported version
+// is not an older version of the expected config, e.g. the agent has not
+// sent a heartbeat yet or moved to another profile.
+type ConfigLag struct {
+	ReportedVersion string `json:"reported_version"`
+	ExpectedVersion string `json:"expected_version"`
+	Known           bool   `json:"known" example:"true"`
+	VersionsBehind  int64  `json:"versions_behind" example:"2"`
+	// LagSeconds is how long the oldest version the agent is missing has
+	// been stored; 0 when the agent is up to date
+	LagSeconds int64 `json:"lag_seconds" example:"340"`
+}
+
+// LagBucket counts agents whose versions_behind is at most MaxVersionsBehind
+// and above the previous bucket's bound; the last bucket has no bound
+type LagBucket struct {
+	MaxVersionsBehind *int64 `json:"max_versions_behind" example:"1"`
+	Agents            int    `json:"agents" example:"3"`
+}
+
+// ConfigLagHistogram summarizes config lag across the fleet
+type ConfigLagHistogram struct {
+	Buckets []LagBucket `json:"buckets"`
+	// Unknown counts agents whose lag could not be computed
+	Unknown       int   `json:"unknown" example:"1"`
+	MaxLagSeconds int64 `json:"max_lag_seconds" example:"340"`
+}
+
+// DistributionTestRequest bounds how long a distribution test waits for
+// agents to report the sentinel config; 0 uses the default of 30 seconds.
+// Restore re-pushes the config as it was before the test once the test
+// ends, so the distribution_test flag does not stay in the live config; the
+// restored config is stored and distributed as one more version.
+type DistributionTestRequest struct {
+	TimeoutSeconds int  `json:"timeout_seconds,omitempty" example:"60" validate:"omitempty,min=1,max=300"`
+	Restore        bool `json:"restore,omitempty" example:"true"`
+}
+
+// DistributionTestAgent is an agent's state at the end of a distribution
+// test. ExpectedVersion is set for agents that are served another config.
+type DistributionTestAgent struct {
+	AgentID         string     `json:"agent_id"`
+	AgentName       string     `json:"agent_name"`
+	ConfigVersion   string     `json:"config_version"`
+	ExpectedVersion string     `json:"expected_version,omitempty"`
+	LastHeartbeat   *time.Time `json:"last_heartbeat,omitempty"`
+}
+
+// DistributionTestResponse reports which agents acknowledged the sentinel
+// config by reporting its ETag in a heartbeat before the timeout. Agents a
+// profile or match rules keep on another config are skipped, not pending.
+type DistributionTestResponse struct {
+	TestID         string                  `json:"test_id" example:"0190b6a2-6f1e-7c3a-9d4e-2b8f5a1c3d7e"`
+	ETag           string                  `json:"etag" example:"1a-1700000000000000000"`
+	Complete       bool                    `json:"complete" example:"true"`
+	TimeoutSeconds int                     `json:"timeout_seconds" example:"30"`
+	ElapsedMs      int64                   `json:"elapsed_ms" example:"4210"`
+	Acknowledged   []DistributionTestAgent `json:"acknowledged"`
+	Pending        []DistributionTestAgent `json:"pending"`
+	Skipped        []DistributionTestAgent `json:"skipped"`
+	// RestoredETag is the version storing the pre-test config when the
+	// request asked to restore it
+	RestoredETag string `json:"restored_etag,omitempty" example:"1a-1700000004210000000"`
+}
@@ -0,0 +1,16 @@
+package dto
+
+import "github.com/Alwanly/service-distribute-management/internal/models"
+
+type ListEventsRequest struct {
+	Type   string `query:"type" example:"config_changed" validate:"omitempty,oneof=agent_registered heartbeat_received config_changed token_rotated token_revoked token_refreshed agent_deleted config_pruned"`
+	Limit  int    `query:"limit" example:"50" validate:"omitempty,min=1,max=500"` // Defaults to 50
+	Offset int    `query:"offset" example:"0" validate:"omitempty,min=0"`
+}
+
+type ListEventsResponse struct {
+	Events []models.Event `json:"events"`
+	Total  int64          `json:"total"`
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+}
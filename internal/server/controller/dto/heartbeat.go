@@ -1,13 +1,71 @@
 package dto
 
-import "time"
+import (
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/internal/models"
+)
 
 type HeartbeatRequest struct {
-	ConfigVersion string `json:"config_version" validate:"required"`
-	Status        string `json:"status"`
+	ConfigVersion         string `json:"config_version" validate:"required"`
+	Status                string `json:"status"`
+	WorkerOutOfSync       bool   `json:"worker_out_of_sync,omitempty"`
+	WorkerForwardFailures int    `json:"worker_forward_failures,omitempty"`
+	ConfigPinned          bool   `json:"config_pinned,omitempty"`
+	DeliveryMode          string `json:"delivery_mode,omitempty"`
+	// LastError is the agent's most recent operational error (worker
+	// unreachable, config parse failure, ...); empty clears it
+	LastError   string     `json:"last_error,omitempty" example:"failed to send config to worker: connection refused"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
 }
 
 type HeartbeatResponse struct {
 	LatestConfigVersion string    `json:"latest_config_version"`
 	ReceivedAt          time.Time `json:"received_at"`
 }
+
+// BatchHeartbeatItem is a single agent heartbeat inside a batch request.
+// APIToken is required unless the batch is sent with admin credentials.
+type BatchHeartbeatItem struct {
+	AgentID       string `json:"agent_id" validate:"required"`
+	APIToken      string `json:"api_token,omitempty"`
+	ConfigVersion string `json:"config_version" validate:"required"`
+	Status        string `json:"status"`
+	// LastError is reported like in a single heartbeat; empty clears it
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+type BatchHeartbeatRequest struct {
+	Heartbeats []BatchHeartbeatItem `json:"heartbeats" validate:"required,min=1,max=500,dive"`
+}
+
+type BatchHeartbeatResult struct {
+	AgentID             string `json:"agent_id"`
+	Success             bool   `json:"success"`
+	Error               string `json:"error,omitempty"`
+	LatestConfigVersion string `json:"latest_config_version,omitempty"`
+}
+
+type BatchHeartbeatResponse struct {
+	Results    []BatchHeartbeatResult `json:"results"`
+	Succeeded  int                    `json:"succeeded"`
+	Failed     int                    `json:"failed"`
+	ReceivedAt time.Time              `json:"received_at"`
+}
+
+type ListAgentHeartbeatsRequest struct {
+	Limit  int `query:"limit" example:"50" validate:"omitempty,min=1,max=500"` // Defaults to 50
+	Offset int `query:"offset" example:"0" validate:"omitempty,min=0"`
+}
+
+// ListAgentHeartbeatsResponse is a page of an agent's heartbeat history,
+// newest first. History older than RetentionSeconds has been pruned.
+type ListAgentHeartbeatsResponse struct {
+	AgentID          string                  `json:"agent_id"`
+	Heartbeats       []models.AgentHeartbeat `json:"heartbeats"`
+	Total            int64                   `json:"total"`
+	Limit            int                     `json:"limit"`
+	Offset           int                     `json:"offset"`
+	RetentionSeconds int                     `json:"retention_seconds" example:"604800"`
+}
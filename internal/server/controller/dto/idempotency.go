@@ -0,0 +1,9 @@
+package dto
+
+// HeaderIdempotencyKey names a config mutation so a client retrying it
+// after a timeout gets the original result instead of a second version
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// HeaderIdempotentReplayed is set to "true" on a response replayed for a
+// repeated Idempotency-Key
+const HeaderIdempotentReplayed = "Idempotent-Replayed"
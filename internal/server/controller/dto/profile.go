@@ -0,0 +1,22 @@
+package dto
+
+import "time"
+
+// ConfigProfileResponse summarizes a named configuration profile
+type ConfigProfileResponse struct {
+	Name      string    `json:"name" example:"scraper"`
+	ETag      string    `json:"etag" example:"1a-1700000000000000000"`
+	Versions  int64     `json:"versions" example:"3"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ListConfigProfilesResponse struct {
+	Profiles []ConfigProfileResponse `json:"profiles"`
+	Total    int                     `json:"total"`
+}
+
+// SetAgentProfileRequest assigns a named config profile to an agent.
+// An empty profile makes the agent follow the default config again.
+type SetAgentProfileRequest struct {
+	Profile string `json:"profile" example:"scraper"`
+}
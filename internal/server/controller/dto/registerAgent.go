@@ -3,6 +3,12 @@ package dto
 type RegisterAgentRequest struct {
 	Hostname  string `json:"hostname" validate:"required"`
 	StartTime string `json:"start_time" validate:"required"`
+	// Metadata are facts about the agent (os, region, datacenter) that config
+	// match rules are evaluated against
+	Metadata map[string]string `json:"metadata,omitempty" validate:"omitempty,max=32,dive,keys,required,max=64,endkeys,max=256"`
+	// BootstrapToken is the token the request authenticated with, set by
+	// the handler; registering uses up one of its uses
+	BootstrapToken string `json:"-"`
 }
 
 type RegisterAgentResponse struct {
@@ -0,0 +1,32 @@
+package dto
+
+import "time"
+
+// PushStatus reports whether Redis push notifications currently work
+type PushStatus struct {
+	Configured bool   `json:"configured"`
+	Healthy    bool   `json:"healthy"`
+	Error      string `json:"error,omitempty"`
+}
+
+// FleetSummaryResponse aggregates the state of every registered agent.
+// Online agents sent a heartbeat within HEARTBEAT_LATE_AFTER, stale ones
+// within AGENT_OFFLINE_AFTER; the rest, including agents that never sent
+// one, are offline.
+type FleetSummaryResponse struct {
+	TotalAgents int `json:"total_agents" example:"15"`
+	Online      int `json:"online" example:"12"`
+	Stale       int `json:"stale" example:"1"`
+	Offline     int `json:"offline" example:"2"`
+	// UpToDate agents report the version they would be served now
+	UpToDate int `json:"up_to_date" example:"13"`
+	Lagging  int `json:"lagging" example:"2"`
+	// Lag buckets every agent by how many versions behind it is
+	Lag ConfigLagHistogram `json:"lag"`
+	// LatestETag is the latest default config; empty when none is stored
+	LatestETag             string     `json:"latest_etag" example:"1a-1700000000000000000"`
+	LatestConfigAt         *time.Time `json:"latest_config_at,omitempty"`
+	LatestConfigAgeSeconds *int64     `json:"latest_config_age_seconds,omitempty" example:"3600"`
+	Push                   PushStatus `json:"push"`
+	GeneratedAt            time.Time  `json:"generated_at"`
+}
@@ -1,9 +1,12 @@
 package handler
 
 import (
+	"encoding/json"
 	"strconv"
+	"strings"
 
 	"github.com/Alwanly/service-distribute-management/internal/config"
+	"github.com/Alwanly/service-distribute-management/internal/models"
 	"github.com/Alwanly/service-distribute-management/internal/server/controller/dto"
 	"github.com/Alwanly/service-distribute-management/internal/server/controller/repository"
 	"github.com/Alwanly/service-distribute-management/internal/server/controller/usecase"
@@ -26,6 +29,7 @@ type Handler struct {
 func NewHandler(d deps.App, cfg *config.ControllerConfig) *Handler {
 
 	repo := repository.NewRepository(d.Database, d.Pub)
+	repo.Locker = d.Locker
 
 	uc := usecase.NewUseCase(usecase.UseCase{
 		Repo:   repo,
@@ -43,11 +47,49 @@ func NewHandler(d deps.App, cfg *config.ControllerConfig) *Handler {
 	// Health check endpoint (no auth required)
 	d.Fiber.Get("/health", h.health)
 
-	// Public registration endpoint (agents register without Bearer token)
-	d.Fiber.Post("/register", d.Middleware.BasicAuth(), h.register)
+	// Public registration endpoint: shared agent Basic Auth or a bootstrap token
+	d.Fiber.Post("/register", middleware.RegistrationAuth(d.Middleware, uc.CheckBootstrapToken, d.Logger), h.register)
+
+	// Dry run of /register for validate-only agent runs: authenticates and
+	// validates without creating an agent or spending a bootstrap token use
+	d.Fiber.Post("/register/check", middleware.RegistrationAuth(d.Middleware, uc.CheckBootstrapToken, d.Logger), h.checkRegistration)
+
+	// Token refresh for a registered agent, under the same agent ID (Basic Auth: agent)
+	d.Fiber.Post("/register/refresh", d.Middleware.BasicAuth(), h.refreshToken)
+
+	// Agents remove their own registration
+	d.Fiber.Delete("/register", middleware.AgentTokenAuth(d.Database, d.Logger), h.deregister)
+
+	// Rollout progress: agents per applied config version (admin only)
+	d.Fiber.Get("/config/distribution", d.Middleware.BasicAuthAdmin(), h.getConfigDistribution)
+
+	// Re-publish the current config notification without a new version (admin only)
+	d.Fiber.Post("/config/replay", d.Middleware.BasicAuthAdmin(), h.replayConfig)
+
+	// Fleet activity feed (admin only)
+	d.Fiber.Get("/events", d.Middleware.BasicAuthAdmin(), h.listEvents)
+
+	// Bootstrap registration tokens (admin only)
+	d.Fiber.Post("/admin/bootstrap-tokens", d.Middleware.BasicAuthAdmin(), h.createBootstrapToken)
+
+	// Live Redis connectivity check (admin only)
+	d.Fiber.Get("/admin/redis/ping", d.Middleware.BasicAuthAdmin(), h.pingRedis)
+
+	// Global default poll interval for agents without an override (admin only)
+	d.Fiber.Put("/admin/poll-interval", d.Middleware.BasicAuthAdmin(), h.setDefaultPollInterval)
+
+	// Fleet-level health overview (admin only)
+	d.Fiber.Get("/admin/summary", d.Middleware.BasicAuthAdmin(), h.getFleetSummary)
+
+	// Config version retention (admin only)
+	d.Fiber.Post("/admin/config/prune", d.Middleware.BasicAuthAdmin(), h.pruneConfigVersions)
+
+	// End-to-end distribution check with a sentinel config (admin only)
+	d.Fiber.Post("/admin/distribution-test", d.Middleware.BasicAuthAdmin(), h.runDistributionTest)
 
 	// Admin-protected endpoints
 	d.Fiber.Post("/config", d.Middleware.BasicAuthAdmin(), h.setConfig)
+	d.Fiber.Patch("/config", d.Middleware.BasicAuthAdmin(), h.patchConfig)
 
 	// Agent-authenticated endpoint for fetching configuration
 	d.Fiber.Get("/config", middleware.AgentTokenAuth(d.Database, d.Logger), h.getConfig)
@@ -55,26 +97,41 @@ func NewHandler(d deps.App, cfg *config.ControllerConfig) *Handler {
 	// Agent-authenticated endpoint for sending heartbeat
 	d.Fiber.Post("/heartbeat", middleware.AgentTokenAuth(d.Database, d.Logger), h.heartbeat)
 
+	// Batch heartbeat for processes representing several agents. Each entry is
+	// authorized by its own token, or the whole batch by admin Basic Auth.
+	d.Fiber.Post("/heartbeat/batch", h.batchHeartbeat)
+
 	// Management endpoints for agents (admin only)
 	adminRoutes := d.Fiber.Group("/agents", d.Middleware.BasicAuthAdmin())
 	adminRoutes.Put(":id/interval", h.updateAgentInterval)
 	adminRoutes.Post(":id/token/rotate", h.rotateAgentToken)
+	adminRoutes.Post(":id/revoke", h.revokeAgentToken)
 	adminRoutes.Get("", h.listAgents)
 	adminRoutes.Get(":id", h.getAgent)
+	adminRoutes.Get(":id/heartbeats", h.listAgentHeartbeats)
 	adminRoutes.Delete(":id", h.deleteAgent)
+	adminRoutes.Put(":id/profile", h.setAgentProfile)
+
+	// Named configuration profiles (admin only)
+	profileRoutes := d.Fiber.Group("/configs", d.Middleware.BasicAuthAdmin())
+	profileRoutes.Get("", h.listConfigProfiles)
+	profileRoutes.Get(":name", h.getConfigProfile)
+	profileRoutes.Put(":name", h.setConfigProfile)
+	profileRoutes.Delete(":name", h.deleteConfigProfile)
 
 	return h
 }
 
 // register godoc
 // @Summary      Register a new agent
-// @Description  Register a new agent with the controller service and receive polling configuration
+// @Description  Register a new agent with the controller service and receive polling configuration. Accepts the shared agent credentials or a bootstrap token sent as "Authorization: Bearer <token>"
 // @Tags         agents
 // @Accept       json
 // @Produce      json
 // @Param        request body dto.RegisterAgentRequest true "Agent registration details"
 // @Success      200 {object} dto.RegisterAgentResponse "Successfully registered agent"
 // @Failure      400 {object} wrapper.JSONResult "Invalid request body or validation error"
+// @Failure      415 {object} wrapper.JSONResult "Body not sent as application/json"
 // @Failure      500 {object} wrapper.JSONResult "Internal server error"
 // @Router       /register [post]
 // @Security     BasicAuth
@@ -82,21 +139,87 @@ func (h *Handler) register(c *fiber.Ctx) error {
 	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "register_agent"))
 
 	req := new(dto.RegisterAgentRequest)
-	if err := c.BodyParser(req); err != nil {
+	if err := validator.BindJSON(c, req); err != nil {
 		logger.AddToContext(c.UserContext(), zap.Error(err))
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		res := validator.BodyErrorResponse(err)
+		return c.Status(res.Code).JSON(res)
 	}
 
 	if err := validator.ValidateStruct(req); err != nil {
 		logger.AddToContext(c.UserContext(), zap.Error(err))
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return c.Status(fiber.StatusBadRequest).JSON(wrapper.ResponseBadRequest(err.Error()))
 	}
+	req.BootstrapToken, _ = c.Locals(middleware.BootstrapTokenContextKey).(string)
 
 	res := h.UseCase.RegisterAgent(c.UserContext(), req)
 
 	return c.Status(res.Code).JSON(res.Data)
 }
 
+// checkRegistration godoc
+// @Summary      Check an agent registration
+// @Description  Authenticate and validate a registration like POST /register without registering: no agent is created and a bootstrap token keeps its uses. Used by agents started with --validate
+// @Tags         agents
+// @Accept       json
+// @Produce      json
+// @Param        request body dto.RegisterAgentRequest true "Agent registration details"
+// @Success      200 {object} wrapper.JSONResult "Registration would be accepted"
+// @Failure      400 {object} wrapper.JSONResult "Invalid request body or validation error"
+// @Failure      401 {object} wrapper.JSONResult "Invalid credentials or bootstrap token"
+// @Failure      415 {object} wrapper.JSONResult "Body not sent as application/json"
+// @Router       /register/check [post]
+// @Security     BasicAuth
+func (h *Handler) checkRegistration(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "check_registration"))
+
+	req := new(dto.RegisterAgentRequest)
+	if err := validator.BindJSON(c, req); err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err))
+		res := validator.BodyErrorResponse(err)
+		return c.Status(res.Code).JSON(res)
+	}
+	if err := validator.ValidateStruct(req); err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(wrapper.ResponseBadRequest(err.Error()))
+	}
+
+	res := wrapper.ResponseSuccess(fiber.StatusOK, "registration would be accepted")
+	return c.Status(res.Code).JSON(res.Data)
+}
+
+// refreshToken godoc
+// @Summary      Refresh an agent token
+// @Description  Issue a new API token for a registered agent, keeping its agent ID. Agents call this when the controller rejects their token, e.g. after an admin rotation. A revoked agent is refused.
+// @Tags         agents
+// @Accept       json
+// @Produce      json
+// @Param        request body dto.RefreshTokenRequest true "Agent to refresh"
+// @Success      200 {object} dto.RotateTokenResponse "Token refreshed"
+// @Failure      400 {object} wrapper.JSONResult "Invalid request body or validation error"
+// @Failure      401 {object} wrapper.JSONResult "Invalid credentials"
+// @Failure      403 {object} wrapper.JSONResult "Agent token revoked"
+// @Failure      404 {object} wrapper.JSONResult "Agent not found"
+// @Failure      415 {object} wrapper.JSONResult "Body not sent as application/json"
+// @Security     BasicAuth
+// @Router       /register/refresh [post]
+func (h *Handler) refreshToken(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "refresh_agent_token"))
+
+	req := new(dto.RefreshTokenRequest)
+	if err := validator.BindJSON(c, req); err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err))
+		res := validator.BodyErrorResponse(err)
+		return c.Status(res.Code).JSON(res)
+	}
+	if err := validator.ValidateStruct(req); err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(wrapper.ResponseBadRequest(err.Error()))
+	}
+
+	res := h.UseCase.RefreshAgentToken(c.UserContext(), req)
+	return c.Status(res.Code).JSON(res.Data)
+}
+
 // setConfig godoc
 // @Summary      Set worker configuration
 // @Description  Set new configuration for all workers (admin only). Configuration includes target URL, headers, and timeout settings.
@@ -104,8 +227,13 @@ func (h *Handler) register(c *fiber.Ctx) error {
 // @Accept       json
 // @Produce      json
 // @Param        request body dto.SetConfigAgentRequest true "Configuration data"
-// @Success      200 {object} wrapper.JSONResult "Configuration set successfully"
+// @Param        Idempotency-Key header string false "Replays the first result for a retry with the same key and body instead of storing another version"
+// @Success      200 {object} dto.SetConfigAgentResponse "Configuration set successfully; no_change is true when it matched the latest version and nothing was stored"
+// @Header       200 {string} Idempotent-Replayed "true when the response was replayed for a repeated Idempotency-Key"
 // @Failure      400 {object} wrapper.JSONResult "Invalid request body or validation error"
+// @Failure      415 {object} wrapper.JSONResult "Body not sent as application/json"
+// @Failure      422 {object} wrapper.JSONResult "Idempotency-Key already used for a different request"
+// @Failure      413 {object} wrapper.JSONResult "Serialized config exceeds CONFIG_MAX_BYTES"
 // @Failure      500 {object} wrapper.JSONResult "Internal server error"
 // @Router       /config [post]
 // @Security     BasicAuth
@@ -113,17 +241,61 @@ func (h *Handler) setConfig(c *fiber.Ctx) error {
 	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "set_config"))
 
 	req := new(dto.SetConfigAgentRequest)
-	if err := c.BodyParser(req); err != nil {
+	if err := validator.BindJSON(c, req); err != nil {
 		logger.AddToContext(c.UserContext(), zap.Error(err))
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		res := validator.BodyErrorResponse(err)
+		return c.Status(res.Code).JSON(res)
 	}
 
 	if err := validator.ValidateStruct(req); err != nil {
 		logger.AddToContext(c.UserContext(), zap.Error(err))
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return c.Status(fiber.StatusBadRequest).JSON(wrapper.ResponseBadRequest(err.Error()))
+	}
+
+	res, replayed := h.UseCase.Idempotent(c.UserContext(), "POST /config", c.Get(dto.HeaderIdempotencyKey), c.Body(),
+		func() wrapper.JSONResult { return h.UseCase.UpdateConfig(c.UserContext(), req) })
+	if replayed {
+		c.Set(dto.HeaderIdempotentReplayed, "true")
+	}
+
+	return c.Status(res.Code).JSON(res.Data)
+}
+
+// patchConfig godoc
+// @Summary      Patch worker configuration
+// @Description  Apply a JSON merge patch (RFC 7386) to the latest configuration, producing a new version (admin only)
+// @Tags         configuration
+// @Accept       json
+// @Produce      json
+// @Param        request body object true "JSON merge patch"
+// @Param        Idempotency-Key header string false "Replays the first result for a retry with the same key and body instead of applying the patch again"
+// @Success      200 {object} dto.SetConfigAgentResponse "Configuration patched successfully; no_change is true when the patch left it unchanged"
+// @Header       200 {string} Idempotent-Replayed "true when the response was replayed for a repeated Idempotency-Key"
+// @Failure      400 {object} wrapper.JSONResult "Invalid patch or resulting configuration"
+// @Failure      404 {object} wrapper.JSONResult "No configuration to patch"
+// @Failure      415 {object} wrapper.JSONResult "Body not sent as application/json or application/merge-patch+json"
+// @Failure      422 {object} wrapper.JSONResult "Idempotency-Key already used for a different request"
+// @Failure      413 {object} wrapper.JSONResult "Serialized config exceeds CONFIG_MAX_BYTES"
+// @Failure      500 {object} wrapper.JSONResult "Internal server error"
+// @Router       /config [patch]
+// @Security     BasicAuth
+func (h *Handler) patchConfig(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "patch_config"))
+
+	if err := validator.RequireJSON(c); err != nil {
+		res := validator.BodyErrorResponse(err)
+		return c.Status(res.Code).JSON(res)
+	}
+	body := c.Body()
+	if len(body) == 0 || !json.Valid(body) {
+		return c.Status(fiber.StatusBadRequest).JSON(wrapper.ResponseBadRequest("Invalid request body"))
 	}
 
-	res := h.UseCase.UpdateConfig(c.UserContext(), req)
+	res, replayed := h.UseCase.Idempotent(c.UserContext(), "PATCH /config", c.Get(dto.HeaderIdempotencyKey), body,
+		func() wrapper.JSONResult { return h.UseCase.PatchConfig(c.UserContext(), body) })
+	if replayed {
+		c.Set(dto.HeaderIdempotentReplayed, "true")
+	}
 
 	return c.Status(res.Code).JSON(res.Data)
 }
@@ -135,9 +307,13 @@ func (h *Handler) setConfig(c *fiber.Ctx) error {
 // @Accept       json
 // @Produce      json
 // @Param        If-None-Match header string false "ETag for conditional requests"
+// @Param        profile query string false "Named config profile; defaults to the agent's assigned profile"
+// @Param        X-Config-Schema-Version header int false "Newest config schema the agent's worker supports"
 // @Param        agent_id header string true "Agent ID injected by authentication middleware"
 // @Param        Authorization header string true "Bearer token for agent authentication"
 // @Success      200 {object} dto.GetConfigAgentResponse "Current configuration data"
+// @Failure      406 {object} wrapper.JSONResult "Configuration needs a newer schema than the worker supports"
+// @Failure      429 {object} dto.FetchQuotaExceededResponse "Polling faster than the assigned interval allows"
 // @Failure      500 {object} wrapper.JSONResult "Internal server error"
 // @Router       /config [get]
 func (h *Handler) getConfig(c *fiber.Ctx) error {
@@ -146,14 +322,32 @@ func (h *Handler) getConfig(c *fiber.Ctx) error {
 	agentID, ok := c.Locals(middleware.AgentIDContextKey).(string)
 	if !ok || agentID == "" {
 		h.Logger.Error("agent_id not found in context")
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "authentication context error"})
+		return c.Status(fiber.StatusInternalServerError).JSON(wrapper.ResponseFailed(fiber.StatusInternalServerError, "authentication context error", nil))
 	}
 
 	// Get If-None-Match header for ETag comparison
 	etag := c.Get("If-None-Match")
 
 	// Get configuration for this agent
-	res := h.UseCase.GetConfigForAgent(c.UserContext(), agentID, etag)
+	// Optional profile override; otherwise the agent's assigned profile is used
+	profile := c.Query("profile")
+
+	// Newest config schema the agent's worker understands; absent means no negotiation
+	schemaVersion := 0
+	if v := c.Get(models.HeaderConfigSchemaVersion); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return c.Status(fiber.StatusBadRequest).JSON(wrapper.ResponseBadRequest("invalid " + models.HeaderConfigSchemaVersion + " header"))
+		}
+		schemaVersion = n
+	}
+
+	res := h.UseCase.GetConfigForAgent(c.UserContext(), agentID, etag, profile, schemaVersion)
+
+	if data, ok := res.Data.(dto.FetchQuotaExceededResponse); ok {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(data.RetryAfterSeconds))
+		return c.Status(res.Code).JSON(data)
+	}
 
 	// set header poll interval
 	if data, ok := res.Data.(dto.GetConfigAgentResponse); ok {
@@ -184,6 +378,7 @@ func (h *Handler) getConfig(c *fiber.Ctx) error {
 // @Param        request body dto.UpdatePollIntervalRequest true "Poll interval update"
 // @Success      200 {object} wrapper.JSONResult "Poll interval updated successfully"
 // @Failure      400 {object} wrapper.JSONResult "Invalid request body"
+// @Failure      415 {object} wrapper.JSONResult "Body not sent as application/json"
 // @Failure      404 {object} wrapper.JSONResult "Agent not found"
 // @Failure      500 {object} wrapper.JSONResult "Internal server error"
 // @Router       /agents/{id}/interval [put]
@@ -192,20 +387,119 @@ func (h *Handler) getConfig(c *fiber.Ctx) error {
 func (h *Handler) updateAgentInterval(c *fiber.Ctx) error {
 	agentID := c.Params("id")
 	req := new(dto.UpdatePollIntervalRequest)
-	if err := c.BodyParser(req); err != nil {
+	if err := validator.BindJSON(c, req); err != nil {
 		logger.AddToContext(c.UserContext(), zap.Error(err))
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+		res := validator.BodyErrorResponse(err)
+		return c.Status(res.Code).JSON(res)
 	}
 
-	if err := h.UseCase.UpdateAgentPollInterval(agentID, req.PollIntervalSeconds); err != nil {
+	if err := h.UseCase.UpdateAgentPollInterval(c.UserContext(), agentID, req.PollIntervalSeconds); err != nil {
 		logger.AddToContext(c.UserContext(), zap.Error(err))
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return c.Status(fiber.StatusInternalServerError).JSON(wrapper.ResponseFailed(fiber.StatusInternalServerError, err.Error(), nil))
 	}
 
 	res := wrapper.ResponseSuccess(fiber.StatusOK, "poll interval updated")
 	return c.Status(res.Code).JSON(res.Data)
 }
 
+// setDefaultPollInterval godoc
+// @Summary      Set the default poll interval
+// @Description  Change the global default poll interval at runtime. Newly registered agents and agents without a per-agent override get it (within the jitter band) on their next config fetch; it lasts until restart, and a configuration reload keeps it (admin only)
+// @Tags         agents
+// @Accept       json
+// @Produce      json
+// @Param        request body dto.UpdateDefaultPollIntervalRequest true "New default interval"
+// @Success      200 {object} dto.DefaultPollIntervalResponse "Default poll interval updated"
+// @Failure      400 {object} wrapper.JSONResult "Invalid request body or validation error"
+// @Failure      415 {object} wrapper.JSONResult "Body not sent as application/json"
+// @Router       /admin/poll-interval [put]
+// @Security     BasicAuth
+func (h *Handler) setDefaultPollInterval(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "set_default_poll_interval"))
+
+	req := new(dto.UpdateDefaultPollIntervalRequest)
+	if err := validator.BindJSON(c, req); err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err))
+		res := validator.BodyErrorResponse(err)
+		return c.Status(res.Code).JSON(res)
+	}
+	if err := validator.ValidateStruct(req); err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(wrapper.ResponseBadRequest(err.Error()))
+	}
+
+	res := h.UseCase.SetDefaultPollInterval(c.UserContext(), req)
+	return c.Status(res.Code).JSON(res.Data)
+}
+
+// pruneConfigVersions godoc
+// @Summary      Prune old config versions
+// @Description  Delete config versions outside the retention policy: a version is kept while it is one of the newest keep versions of its profile or younger than max_age_seconds. Omitted fields use CONFIG_RETENTION_KEEP and CONFIG_RETENTION_MAX_AGE. The latest version of every profile and any version an agent runs or would be served are never deleted. With dry_run nothing is deleted (admin only)
+// @Tags         configuration
+// @Accept       json
+// @Produce      json
+// @Param        request body dto.PruneConfigVersionsRequest false "Retention policy overrides"
+// @Success      200 {object} dto.PruneConfigVersionsResponse "Versions pruned, or due to be pruned in a dry run"
+// @Failure      400 {object} wrapper.JSONResult "Invalid request body, or no retention policy given or configured"
+// @Failure      415 {object} wrapper.JSONResult "Body not sent as application/json"
+// @Failure      500 {object} wrapper.JSONResult "Internal server error"
+// @Router       /admin/config/prune [post]
+// @Security     BasicAuth
+func (h *Handler) pruneConfigVersions(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "prune_config_versions"))
+
+	req := new(dto.PruneConfigVersionsRequest)
+	if len(c.Body()) > 0 {
+		if err := validator.BindJSON(c, req); err != nil {
+			logger.AddToContext(c.UserContext(), zap.Error(err))
+			res := validator.BodyErrorResponse(err)
+			return c.Status(res.Code).JSON(res)
+		}
+	}
+	if err := validator.ValidateStruct(req); err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(wrapper.ResponseBadRequest(err.Error()))
+	}
+
+	res := h.UseCase.PruneConfigVersions(c.UserContext(), req)
+	return c.Status(res.Code).JSON(res.Data)
+}
+
+// runDistributionTest godoc
+// @Summary      Run a config distribution test
+// @Description  Push the latest default config again tagged with a unique distribution_test flag, then wait until every agent served it reports its ETag in a heartbeat or timeout_seconds pass (default 30, at most 300). Reports the agents that acknowledged, those still pending at the timeout, and those skipped because a profile or match rules serve them another config or their worker's schema is too old for the sentinel. The sentinel stays the latest config unless restore is true, which stores the previous config again afterwards. One test runs at a time across replicas (admin only)
+// @Tags         configuration
+// @Accept       json
+// @Produce      json
+// @Param        request body dto.DistributionTestRequest false "Wait bound and whether to restore the previous config"
+// @Success      200 {object} dto.DistributionTestResponse "Test finished; complete is false when agents were still pending at the timeout"
+// @Failure      400 {object} wrapper.JSONResult "Invalid request body"
+// @Failure      404 {object} wrapper.JSONResult "No configuration to distribute"
+// @Failure      409 {object} wrapper.JSONResult "A distribution test is already running"
+// @Failure      415 {object} wrapper.JSONResult "Body not sent as application/json"
+// @Failure      500 {object} wrapper.JSONResult "Internal server error"
+// @Router       /admin/distribution-test [post]
+// @Security     BasicAuth
+func (h *Handler) runDistributionTest(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "run_distribution_test"))
+
+	req := new(dto.DistributionTestRequest)
+	if len(c.Body()) > 0 {
+		if err := validator.BindJSON(c, req); err != nil {
+			logger.AddToContext(c.UserContext(), zap.Error(err))
+			res := validator.BodyErrorResponse(err)
+			return c.Status(res.Code).JSON(res)
+		}
+	}
+	if err := validator.ValidateStruct(req); err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(wrapper.ResponseBadRequest(err.Error()))
+	}
+
+	res := h.UseCase.RunDistributionTest(c.UserContext(), req)
+	return c.Status(res.Code).JSON(res.Data)
+}
+
 // rotateAgentToken godoc
 // @Summary      Rotate agent API token
 // @Description  Rotate and return a new API token for the specified agent (admin only)
@@ -225,6 +519,24 @@ func (h *Handler) rotateAgentToken(c *fiber.Ctx) error {
 	return c.Status(res.Code).JSON(res.Data)
 }
 
+// revokeAgentToken godoc
+// @Summary      Revoke agent API token
+// @Description  Suspend the agent's API token without deleting the agent. Requests with the token get 403 until it is rotated (admin only)
+// @Tags         agents
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "Agent ID"
+// @Success      200 {object} dto.RevokeTokenResponse "Token revoked"
+// @Failure      404 {object} wrapper.JSONResult "Agent not found"
+// @Failure      500 {object} wrapper.JSONResult "Internal server error"
+// @Router       /agents/{id}/revoke [post]
+// @Security     BasicAuth
+func (h *Handler) revokeAgentToken(c *fiber.Ctx) error {
+	agentID := c.Params("id")
+	res := h.UseCase.RevokeAgentToken(c.UserContext(), agentID)
+	return c.Status(res.Code).JSON(res.Data)
+}
+
 // getAgent godoc
 // @Summary      Get agent details
 // @Description  Retrieve details for a specific agent (admin only)
@@ -232,7 +544,7 @@ func (h *Handler) rotateAgentToken(c *fiber.Ctx) error {
 // @Accept       json
 // @Produce      json
 // @Param        id path string true "Agent ID"
-// @Success      200 {object} wrapper.JSONResult "Agent details returned"
+// @Success      200 {object} dto.AgentDetailResponse "Agent details with config lag"
 // @Failure      404 {object} wrapper.JSONResult "Agent not found"
 // @Failure      500 {object} wrapper.JSONResult "Internal server error"
 // @Router       /agents/{id} [get]
@@ -244,6 +556,39 @@ func (h *Handler) getAgent(c *fiber.Ctx) error {
 	return c.Status(res.Code).JSON(res.Data)
 }
 
+// listAgentHeartbeats godoc
+// @Summary      List agent heartbeat history
+// @Description  Recent heartbeats of an agent with the config version each reported, newest first, for uptime over the retention window (HEARTBEAT_HISTORY_RETENTION) (admin only)
+// @Tags         agents
+// @Accept       json
+// @Produce      json
+// @Param        id     path  string true  "Agent ID"
+// @Param        limit  query int    false "Page size (1-500, default 50)"
+// @Param        offset query int    false "Number of heartbeats to skip"
+// @Success      200 {object} dto.ListAgentHeartbeatsResponse "Heartbeat history"
+// @Failure      400 {object} wrapper.JSONResult "Invalid query parameters"
+// @Failure      404 {object} wrapper.JSONResult "Agent not found"
+// @Failure      500 {object} wrapper.JSONResult "Internal server error"
+// @Router       /agents/{id}/heartbeats [get]
+// @Security     BasicAuth
+func (h *Handler) listAgentHeartbeats(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "list_agent_heartbeats"))
+
+	req := new(dto.ListAgentHeartbeatsRequest)
+	if err := c.QueryParser(req); err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(wrapper.ResponseBadRequest("Invalid query parameters"))
+	}
+
+	if err := validator.ValidateStruct(req); err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(wrapper.ResponseBadRequest(err.Error()))
+	}
+
+	res := h.UseCase.ListAgentHeartbeats(c.UserContext(), c.Params("id"), req)
+	return c.Status(res.Code).JSON(res.Data)
+}
+
 // listAgents godoc
 // @Summary      List agents
 // @Description  List all registered agents (admin only)
@@ -260,6 +605,34 @@ func (h *Handler) listAgents(c *fiber.Ctx) error {
 	return c.Status(res.Code).JSON(res.Data)
 }
 
+// deregister godoc
+// @Summary      Deregister the calling agent
+// @Description  Delete the agent that owns the bearer token, e.g. when a host is decommissioned
+// @Tags         agents
+// @Produce      json
+// @Param        Authorization header string true "Bearer token for agent authentication"
+// @Success      200 {object} wrapper.JSONResult "Agent deregistered"
+// @Failure      401 {object} wrapper.JSONResult "Missing or invalid token"
+// @Failure      500 {object} wrapper.JSONResult "Internal server error"
+// @Router       /register [delete]
+// @Security     ApiKeyAuth
+func (h *Handler) deregister(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "deregister_agent"))
+
+	agentID, ok := c.Locals(middleware.AgentIDContextKey).(string)
+	if !ok || agentID == "" {
+		h.Logger.Error("agent_id not found in context for deregistration")
+		return c.Status(fiber.StatusInternalServerError).JSON(wrapper.ResponseFailed(fiber.StatusInternalServerError, "authentication context error", nil))
+	}
+
+	if err := h.UseCase.DeleteAgent(c.UserContext(), agentID); err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(wrapper.ResponseFailed(fiber.StatusInternalServerError, "failed to deregister agent", nil))
+	}
+	res := wrapper.ResponseSuccess(fiber.StatusOK, "agent deregistered")
+	return c.Status(res.Code).JSON(res.Data)
+}
+
 // deleteAgent godoc
 // @Summary      Delete agent
 // @Description  Delete the specified agent (admin only)
@@ -277,12 +650,255 @@ func (h *Handler) deleteAgent(c *fiber.Ctx) error {
 	agentID := c.Params("id")
 	if err := h.UseCase.DeleteAgent(c.UserContext(), agentID); err != nil {
 		logger.AddToContext(c.UserContext(), zap.Error(err))
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return c.Status(fiber.StatusInternalServerError).JSON(wrapper.ResponseFailed(fiber.StatusInternalServerError, err.Error(), nil))
 	}
 	res := wrapper.ResponseSuccess(fiber.StatusOK, "agent deleted")
 	return c.Status(res.Code).JSON(res.Data)
 }
 
+// setAgentProfile godoc
+// @Summary      Assign config profile to agent
+// @Description  Assign a named configuration profile to an agent; an empty profile restores the default config (admin only)
+// @Tags         agents
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "Agent ID"
+// @Param        request body dto.SetAgentProfileRequest true "Profile assignment"
+// @Success      200 {object} wrapper.JSONResult "Profile assigned"
+// @Failure      400 {object} wrapper.JSONResult "Invalid request body or profile name"
+// @Failure      415 {object} wrapper.JSONResult "Body not sent as application/json"
+// @Failure      404 {object} wrapper.JSONResult "Agent not found"
+// @Router       /agents/{id}/profile [put]
+// @Security     BasicAuth
+func (h *Handler) setAgentProfile(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "set_agent_profile"))
+
+	req := new(dto.SetAgentProfileRequest)
+	if err := validator.BindJSON(c, req); err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err))
+		res := validator.BodyErrorResponse(err)
+		return c.Status(res.Code).JSON(res)
+	}
+
+	res := h.UseCase.SetAgentProfile(c.UserContext(), c.Params("id"), req.Profile)
+	return c.Status(res.Code).JSON(res.Data)
+}
+
+// listConfigProfiles godoc
+// @Summary      List config profiles
+// @Description  List named configuration profiles with their latest version (admin only)
+// @Tags         configuration
+// @Produce      json
+// @Success      200 {object} dto.ListConfigProfilesResponse "Config profiles"
+// @Failure      500 {object} wrapper.JSONResult "Internal server error"
+// @Router       /configs [get]
+// @Security     BasicAuth
+func (h *Handler) listConfigProfiles(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "list_config_profiles"))
+
+	res := h.UseCase.ListConfigProfiles(c.UserContext())
+	return c.Status(res.Code).JSON(res.Data)
+}
+
+// getConfigProfile godoc
+// @Summary      Get config profile
+// @Description  Get the latest version of a named configuration profile (admin only)
+// @Tags         configuration
+// @Produce      json
+// @Param        name path string true "Profile name"
+// @Success      200 {object} dto.GetConfigAgentResponse "Latest profile configuration"
+// @Failure      404 {object} wrapper.JSONResult "Profile not found"
+// @Router       /configs/{name} [get]
+// @Security     BasicAuth
+func (h *Handler) getConfigProfile(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "get_config_profile"))
+
+	res := h.UseCase.GetConfigProfile(c.UserContext(), c.Params("name"))
+	return c.Status(res.Code).JSON(res.Data)
+}
+
+// setConfigProfile godoc
+// @Summary      Set config profile
+// @Description  Create a new version of a named configuration profile (admin only)
+// @Tags         configuration
+// @Accept       json
+// @Produce      json
+// @Param        name path string true "Profile name"
+// @Param        request body dto.SetConfigAgentRequest true "Configuration data"
+// @Success      200 {object} dto.GetConfigAgentResponse "Profile version stored"
+// @Failure      400 {object} wrapper.JSONResult "Invalid request body, profile name or validation error"
+// @Failure      415 {object} wrapper.JSONResult "Body not sent as application/json"
+// @Failure      413 {object} wrapper.JSONResult "Serialized config exceeds CONFIG_MAX_BYTES"
+// @Failure      500 {object} wrapper.JSONResult "Internal server error"
+// @Router       /configs/{name} [put]
+// @Security     BasicAuth
+func (h *Handler) setConfigProfile(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "set_config_profile"))
+
+	req := new(dto.SetConfigAgentRequest)
+	if err := validator.BindJSON(c, req); err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err))
+		res := validator.BodyErrorResponse(err)
+		return c.Status(res.Code).JSON(res)
+	}
+
+	if err := validator.ValidateStruct(req); err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(wrapper.ResponseBadRequest(err.Error()))
+	}
+
+	res := h.UseCase.SetConfigProfile(c.UserContext(), c.Params("name"), req)
+	return c.Status(res.Code).JSON(res.Data)
+}
+
+// deleteConfigProfile godoc
+// @Summary      Delete config profile
+// @Description  Delete all versions of a named configuration profile; assigned agents fall back to the default config (admin only)
+// @Tags         configuration
+// @Produce      json
+// @Param        name path string true "Profile name"
+// @Success      200 {object} wrapper.JSONResult "Profile deleted"
+// @Failure      404 {object} wrapper.JSONResult "Profile not found"
+// @Router       /configs/{name} [delete]
+// @Security     BasicAuth
+func (h *Handler) deleteConfigProfile(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "delete_config_profile"))
+
+	res := h.UseCase.DeleteConfigProfile(c.UserContext(), c.Params("name"))
+	return c.Status(res.Code).JSON(res.Data)
+}
+
+// getConfigDistribution godoc
+// @Summary      Get config version distribution
+// @Description  Count agents per reported config version and list agents lagging behind the version they would be served (admin only)
+// @Tags         configuration
+// @Accept       json
+// @Produce      json
+// @Success      200 {object} dto.ConfigDistributionResponse "Config version distribution"
+// @Failure      500 {object} wrapper.JSONResult "Internal server error"
+// @Router       /config/distribution [get]
+// @Security     BasicAuth
+func (h *Handler) getConfigDistribution(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "get_config_distribution"))
+	res := h.UseCase.GetConfigDistribution(c.UserContext())
+	return c.Status(res.Code).JSON(res.Data)
+}
+
+// replayConfig godoc
+// @Summary      Replay config update notification
+// @Description  Re-publish the current config's update notification to Redis without creating a new version, e.g. after restoring Redis (admin only)
+// @Tags         configuration
+// @Accept       json
+// @Produce      json
+// @Success      200 {object} dto.ReplayConfigResponse "Notification published"
+// @Failure      404 {object} wrapper.JSONResult "No configuration stored"
+// @Failure      502 {object} wrapper.JSONResult "Publishing to Redis failed"
+// @Failure      503 {object} wrapper.JSONResult "Redis pub/sub is not configured"
+// @Router       /config/replay [post]
+// @Security     BasicAuth
+func (h *Handler) replayConfig(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "replay_config"))
+	res := h.UseCase.ReplayConfigNotification(c.UserContext())
+	return c.Status(res.Code).JSON(res.Data)
+}
+
+// pingRedis godoc
+// @Summary      Check Redis connectivity
+// @Description  Ping Redis and publish a test message to a throwaway channel, returning the latency of each step (admin only)
+// @Tags         configuration
+// @Produce      json
+// @Success      200 {object} dto.RedisPingResponse "Redis reachable"
+// @Failure      502 {object} dto.RedisPingResponse "Ping or publish failed; stage and error say which"
+// @Failure      503 {object} dto.RedisPingResponse "Redis is not configured"
+// @Router       /admin/redis/ping [get]
+// @Security     BasicAuth
+func (h *Handler) pingRedis(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "ping_redis"))
+	res := h.UseCase.PingRedis(c.UserContext())
+	return c.Status(res.Code).JSON(res.Data)
+}
+
+// getFleetSummary godoc
+// @Summary      Get fleet summary
+// @Description  Count agents by liveness and config rollout state, with the latest config version and Redis push health (admin only)
+// @Tags         agents
+// @Produce      json
+// @Success      200 {object} dto.FleetSummaryResponse "Fleet summary"
+// @Failure      500 {object} wrapper.JSONResult "Internal server error"
+// @Router       /admin/summary [get]
+// @Security     BasicAuth
+func (h *Handler) getFleetSummary(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "get_fleet_summary"))
+	res := h.UseCase.GetFleetSummary(c.UserContext())
+	return c.Status(res.Code).JSON(res.Data)
+}
+
+// listEvents godoc
+// @Summary      List fleet activity events
+// @Description  Chronological feed of agent registrations, heartbeats, config changes, token rotations/revocations/refreshes and deletions, newest first (admin only)
+// @Tags         agents
+// @Accept       json
+// @Produce      json
+// @Param        type   query string false "Filter by event type" Enums(agent_registered, heartbeat_received, config_changed, token_rotated, token_revoked, token_refreshed, agent_deleted, config_pruned)
+// @Param        limit  query int    false "Page size (1-500, default 50)"
+// @Param        offset query int    false "Number of events to skip"
+// @Success      200 {object} dto.ListEventsResponse "Events"
+// @Failure      400 {object} wrapper.JSONResult "Invalid query parameters"
+// @Failure      500 {object} wrapper.JSONResult "Internal server error"
+// @Router       /events [get]
+// @Security     BasicAuth
+func (h *Handler) listEvents(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "list_events"))
+
+	req := new(dto.ListEventsRequest)
+	if err := c.QueryParser(req); err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(wrapper.ResponseBadRequest("Invalid query parameters"))
+	}
+
+	if err := validator.ValidateStruct(req); err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(wrapper.ResponseBadRequest(err.Error()))
+	}
+
+	res := h.UseCase.ListEvents(c.UserContext(), req)
+	return c.Status(res.Code).JSON(res.Data)
+}
+
+// createBootstrapToken godoc
+// @Summary      Create bootstrap registration token
+// @Description  Issue a short-lived registration token that agents send as a Bearer token to /register instead of the shared agent credentials (admin only)
+// @Tags         agents
+// @Accept       json
+// @Produce      json
+// @Param        request body dto.CreateBootstrapTokenRequest false "Token uses and lifetime"
+// @Success      201 {object} dto.CreateBootstrapTokenResponse "Token created; the token value is only returned once"
+// @Failure      400 {object} wrapper.JSONResult "Invalid request body or validation error"
+// @Failure      415 {object} wrapper.JSONResult "Body not sent as application/json"
+// @Failure      500 {object} wrapper.JSONResult "Internal server error"
+// @Router       /admin/bootstrap-tokens [post]
+// @Security     BasicAuth
+func (h *Handler) createBootstrapToken(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "create_bootstrap_token"))
+
+	req := new(dto.CreateBootstrapTokenRequest)
+	if len(c.Body()) > 0 {
+		if err := validator.BindJSON(c, req); err != nil {
+			logger.AddToContext(c.UserContext(), zap.Error(err))
+			res := validator.BodyErrorResponse(err)
+			return c.Status(res.Code).JSON(res)
+		}
+	}
+
+	if err := validator.ValidateStruct(req); err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(wrapper.ResponseBadRequest(err.Error()))
+	}
+
+	res := h.UseCase.CreateBootstrapToken(c.UserContext(), req)
+	return c.Status(res.Code).JSON(res.Data)
+}
+
 // health godoc
 // @Summary     Health check
 // @Description Get controller health status (unauthenticated)
@@ -307,6 +923,7 @@ func (h *Handler) health(c *fiber.Ctx) error {
 // @Param        Authorization header string true "Bearer token for agent authentication"
 // @Success      200 {object} wrapper.JSONResult "Heartbeat processed"
 // @Failure      400 {object} wrapper.JSONResult "Invalid request body"
+// @Failure      415 {object} wrapper.JSONResult "Body not sent as application/json"
 // @Failure      500 {object} wrapper.JSONResult "Internal server error"
 // @Router       /heartbeat [post]
 // @Security     ApiKeyAuth
@@ -317,24 +934,72 @@ func (h *Handler) heartbeat(c *fiber.Ctx) error {
 	agentID, ok := c.Locals(middleware.AgentIDContextKey).(string)
 	if !ok || agentID == "" {
 		h.Logger.Error("agent_id not found in context for heartbeat")
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "authentication context error"})
+		return c.Status(fiber.StatusInternalServerError).JSON(wrapper.ResponseFailed(fiber.StatusInternalServerError, "authentication context error", nil))
 	}
 
 	req := new(dto.HeartbeatRequest)
-	if err := c.BodyParser(req); err != nil {
+	if err := validator.BindJSON(c, req); err != nil {
 		logger.AddToContext(c.UserContext(), zap.Error(err))
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		res := validator.BodyErrorResponse(err)
+		return c.Status(res.Code).JSON(res)
 	}
 
 	if err := validator.ValidateStruct(req); err != nil {
 		logger.AddToContext(c.UserContext(), zap.Error(err))
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return c.Status(fiber.StatusBadRequest).JSON(wrapper.ResponseBadRequest(err.Error()))
 	}
 
 	resp, err := h.UseCase.HandleHeartbeat(agentID, req)
 	if err != nil {
 		logger.AddToContext(c.UserContext(), zap.Error(err))
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to process heartbeat"})
+		return c.Status(fiber.StatusInternalServerError).JSON(wrapper.ResponseFailed(fiber.StatusInternalServerError, "failed to process heartbeat", nil))
+	}
+
+	res := wrapper.ResponseSuccess(fiber.StatusOK, resp)
+	return c.Status(res.Code).JSON(res.Data)
+}
+
+// batchHeartbeat godoc
+// @Summary      Agent batch heartbeat
+// @Description  Receive heartbeats for several agents in one request. Each entry must carry its agent's API token unless the request uses admin Basic Auth. Results are reported per agent.
+// @Tags         agents
+// @Accept       json
+// @Produce      json
+// @Param        request body dto.BatchHeartbeatRequest true "Batch heartbeat payload"
+// @Success      200 {object} wrapper.JSONResult{data=dto.BatchHeartbeatResponse} "Batch processed, see per-agent results"
+// @Failure      400 {object} wrapper.JSONResult "Invalid request body"
+// @Failure      415 {object} wrapper.JSONResult "Body not sent as application/json"
+// @Failure      401 {object} wrapper.JSONResult "Invalid admin credentials"
+// @Failure      500 {object} wrapper.JSONResult "Internal server error"
+// @Router       /heartbeat/batch [post]
+func (h *Handler) batchHeartbeat(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "agent_heartbeat_batch"))
+
+	adminAuthorized := false
+	if auth := c.Get(fiber.HeaderAuthorization); strings.HasPrefix(auth, "Basic ") {
+		username, password := h.Middleware.Basic.DecodeFromHeader(auth)
+		if !h.Middleware.Basic.ValidateAdmin(username, password) {
+			return c.Status(fiber.StatusUnauthorized).JSON(wrapper.ResponseUnauthorized("invalid admin credentials"))
+		}
+		adminAuthorized = true
+	}
+
+	req := new(dto.BatchHeartbeatRequest)
+	if err := validator.BindJSON(c, req); err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err))
+		res := validator.BodyErrorResponse(err)
+		return c.Status(res.Code).JSON(res)
+	}
+
+	if err := validator.ValidateStruct(req); err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(wrapper.ResponseBadRequest(err.Error()))
+	}
+
+	resp, err := h.UseCase.HandleHeartbeatBatch(c.UserContext(), req, adminAuthorized)
+	if err != nil {
+		logger.AddToContext(c.UserContext(), zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(wrapper.ResponseFailed(fiber.StatusInternalServerError, "failed to process heartbeat batch", nil))
 	}
 
 	res := wrapper.ResponseSuccess(fiber.StatusOK, resp)
@@ -3,8 +3,11 @@ package repository
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -12,27 +15,107 @@ import (
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 
+	"github.com/Alwanly/service-distribute-management/internal/server/controller/configstore"
+	"github.com/Alwanly/service-distribute-management/pkg/lock"
 	"github.com/Alwanly/service-distribute-management/pkg/pubsub"
+	"github.com/Alwanly/service-distribute-management/pkg/tracing"
+)
+
+var (
+	// ErrAgentNotFound is returned when an agent ID does not match any registered agent
+	ErrAgentNotFound = errors.New("agent not found")
+	// ErrAgentUnauthorized is returned when a token does not belong to the given agent
+	ErrAgentUnauthorized = errors.New("agent not authorized")
+	// ErrAgentRevoked is returned when the agent's token has been revoked
+	ErrAgentRevoked = errors.New("agent token revoked")
+	// ErrConfigCorrupt is returned when stored config_data is not valid JSON
+	ErrConfigCorrupt = errors.New("stored configuration is corrupt")
+	// ErrBootstrapTokenInvalid is returned when a bootstrap token is unknown, expired or used up
+	ErrBootstrapTokenInvalid = errors.New("bootstrap token invalid")
 )
 
 type Repository struct {
 	DB  *gorm.DB
 	Pub pubsub.Publisher
+	// Locker coordinates replicas sharing Pub; nil when there is only one
+	Locker lock.Locker
+	// Configs stores the config versions; it is backed by DB
+	Configs configstore.ConfigStore
 }
 
 func NewRepository(db *gorm.DB, publisher pubsub.Publisher) *Repository {
-	return &Repository{DB: db, Pub: publisher}
+	return &Repository{DB: db, Pub: publisher, Configs: configstore.NewSQLStore(db)}
 }
 
+// IRepository is the storage the controller usecase depends on
 type IRepository interface {
-	RegisterAgent(ctx context.Context, data *models.Agent) error
-	UpdateConfig(ctx context.Context, config string) error
-	GetConfigETag(ctx context.Context) (string, error)
-	GetConfig(ctx context.Context, config string) (models.ConfigData, error)
-	GetConfigIfChanged(currentETag string) (string, models.ConfigData, error)
-	PublishConfigUpdate(agentID string, etag string, correlationID string) error
+	// Agents
+	CreateAgent(agentName string, pollIntervalSeconds *int) (*models.AgentConfig, error)
+	CreateAgentWithMetadata(agentName string, pollIntervalSeconds *int, metadata map[string]string) (*models.AgentConfig, error)
+	GetAgentByID(agentID string) (*models.AgentConfig, error)
+	GetAgentsByIDs(ctx context.Context, agentIDs []string) ([]models.AgentConfig, error)
+	UpdateAgentPollInterval(agentID string, intervalSeconds *int) error
+	RotateAgentToken(agentID string) (string, error)
+	RevokeAgentToken(agentID string) (*models.AgentConfig, error)
+	RefreshAgentToken(ctx context.Context, agentID string) (string, error)
+	ListAgents() ([]models.AgentPublic, error)
+	DeleteAgent(agentID string) error
+	SetAgentProfile(agentID string, profile string) error
+	SetAgentWorkerSchemaVersion(agentID string, version int) error
+
+	// Bootstrap tokens
+	CreateBootstrapToken(ctx context.Context, maxUses int, expiresAt time.Time) (string, *models.BootstrapToken, error)
+	CheckBootstrapToken(ctx context.Context, token string) error
+	CreateAgentWithBootstrapToken(ctx context.Context, token string, agentName string, metadata map[string]string) (*models.AgentConfig, error)
+
+	// Idempotency keys
+	GetIdempotencyKey(ctx context.Context, scope, key string, now time.Time) (*models.IdempotencyKey, error)
+	SaveIdempotencyKey(ctx context.Context, record *models.IdempotencyKey) error
+
+	// Configurations; versions are read and written through ConfigStore
+	ConfigStore() configstore.ConfigStore
+
+	// Heartbeats
 	UpdateAgentHeartbeat(agentID string, configVersion string) (*models.Agent, error)
-	GetLatestConfigVersionForAgent(agentID string) (string, error)
+	UpdateAgentHeartbeatsBatch(ctx context.Context, entries []HeartbeatEntry, checkToken bool) ([]error, error)
+	UpdateAgentLastError(agentID string, lastError string, at *time.Time) error
+	GetAgentLastHeartbeat(agentID string) (*time.Time, error)
+	ListAgentHeartbeats(ctx context.Context, agentID string, limit, offset int) ([]models.AgentHeartbeat, int64, error)
+	PruneAgentHeartbeats(ctx context.Context, before time.Time) (int64, error)
+	GetAgentConfigVersion(ctx context.Context, agentID string) (string, error)
+	GetAgentConfigVersions(ctx context.Context, agentIDs []string) (map[string]string, error)
+	CountAgentsByConfigVersion(ctx context.Context) ([]ConfigVersionCount, error)
+	ListAgentConfigVersions(ctx context.Context) ([]AgentConfigVersion, error)
+	GroupAgentConfigVersions(ctx context.Context, lateBefore, offlineBefore time.Time) ([]AgentConfigGroup, error)
+
+	// Events
+	RecordEvent(ctx context.Context, event *models.Event) error
+	ListEvents(ctx context.Context, eventType string, limit, offset int) ([]models.Event, int64, error)
+
+	// Notifications; Publisher is nil when Redis is not configured
+	Publisher() pubsub.Publisher
+	// ClaimConfigPublish reports whether this replica should publish the
+	// notification for a config change
+	ClaimConfigPublish(ctx context.Context, agentID, etag, correlationID string) (bool, error)
+	// ClaimDistributionTest reports whether this replica may run a
+	// distribution test; ReleaseDistributionTest ends the claim
+	ClaimDistributionTest(ctx context.Context, ttl time.Duration) (bool, error)
+	ReleaseDistributionTest(ctx context.Context) error
+	PublishConfigUpdate(ctx context.Context, agentID string, etag string, correlationID string) (int64, error)
+	PublishIntervalUpdate(agentID string, intervalSeconds int, correlationID string) (int64, error)
+	PublishDebugEvent(event *models.DebugEvent) error
+}
+
+var _ IRepository = (*Repository)(nil)
+
+// ConfigStore returns the store holding the config versions
+func (r *Repository) ConfigStore() configstore.ConfigStore {
+	return r.Configs
+}
+
+// Publisher returns the pub/sub publisher, or nil when Redis is not configured
+func (r *Repository) Publisher() pubsub.Publisher {
+	return r.Pub
 }
 
 func (r *Repository) RegisterAgent(ctx context.Context, data *models.Agent) error {
@@ -41,39 +124,62 @@ func (r *Repository) RegisterAgent(ctx context.Context, data *models.Agent) erro
 }
 
 func (r *Repository) CreateAgent(agentName string, pollIntervalSeconds *int) (*models.AgentConfig, error) {
-	agentID := uuid.Must(uuid.NewV7()).String()
+	return r.CreateAgentWithMetadata(agentName, pollIntervalSeconds, nil)
+}
+
+// CreateAgentWithMetadata creates an agent along with the facts it reported
+// at registration
+func (r *Repository) CreateAgentWithMetadata(agentName string, pollIntervalSeconds *int, metadata map[string]string) (*models.AgentConfig, error) {
+	agent, err := newAgentConfig(agentName, pollIntervalSeconds, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.DB.Create(agent).Error; err != nil {
+		return nil, fmt.Errorf("failed to create agent: %w", err)
+	}
+
+	return agent, nil
+}
 
+// newAgentConfig builds a new agent with a fresh ID and API token
+func newAgentConfig(agentName string, pollIntervalSeconds *int, metadata map[string]string) (*models.AgentConfig, error) {
 	// Generate secure random API token (32 bytes = 64 hex chars)
 	apiToken, err := generateSecureToken(32)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate api token: %w", err)
 	}
 
-	agent := &models.AgentConfig{
-		ID:                  agentID,
+	return &models.AgentConfig{
+		ID:                  uuid.Must(uuid.NewV7()).String(),
 		AgentName:           agentName,
 		APIToken:            apiToken,
 		PollIntervalSeconds: pollIntervalSeconds,
-	}
-
-	if err := r.DB.Create(agent).Error; err != nil {
-		return nil, fmt.Errorf("failed to create agent: %w", err)
-	}
-
-	return agent, nil
+		Metadata:            metadata,
+	}, nil
 }
 
 func (r *Repository) GetAgentByID(agentID string) (*models.AgentConfig, error) {
 	var agent models.AgentConfig
 	if err := r.DB.Where("id = ?", agentID).First(&agent).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("agent not found: %s", agentID)
+			return nil, fmt.Errorf("%w: %s", ErrAgentNotFound, agentID)
 		}
 		return nil, fmt.Errorf("failed to get agent: %w", err)
 	}
 	return &agent, nil
 }
 
+// GetAgentsByIDs returns the registered agents among agentIDs; unknown IDs
+// are left out
+func (r *Repository) GetAgentsByIDs(ctx context.Context, agentIDs []string) ([]models.AgentConfig, error) {
+	var agents []models.AgentConfig
+	if err := r.DB.WithContext(ctx).Where("id IN ?", agentIDs).Find(&agents).Error; err != nil {
+		return nil, fmt.Errorf("failed to get agents: %w", err)
+	}
+	return agents, nil
+}
+
 func (r *Repository) GetAgentByToken(apiToken string) (*models.AgentConfig, error) {
 	var agent models.AgentConfig
 	if err := r.DB.Where("api_token = ?", apiToken).First(&agent).Error; err != nil {
@@ -107,9 +213,14 @@ func (r *Repository) RotateAgentToken(agentID string) (string, error) {
 		return "", fmt.Errorf("failed to generate new token: %w", err)
 	}
 
+	// A fresh token lifts any revocation on the old one
 	result := r.DB.Model(&models.AgentConfig{}).
 		Where("id = ?", agentID).
-		Update("api_token", newToken)
+		Updates(map[string]interface{}{
+			"api_token":  newToken,
+			"revoked":    false,
+			"revoked_at": nil,
+		})
 
 	if result.Error != nil {
 		return "", fmt.Errorf("failed to rotate token: %w", result.Error)
@@ -122,6 +233,68 @@ func (r *Repository) RotateAgentToken(agentID string) (string, error) {
 	return newToken, nil
 }
 
+// RefreshAgentToken issues a new token for an agent that lost its old one,
+// e.g. to a rotation. Unlike RotateAgentToken it never lifts a revocation.
+func (r *Repository) RefreshAgentToken(ctx context.Context, agentID string) (string, error) {
+	newToken, err := generateSecureToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate new token: %w", err)
+	}
+
+	err = r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var agent models.AgentConfig
+		if err := tx.Where("id = ?", agentID).First(&agent).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: %s", ErrAgentNotFound, agentID)
+			}
+			return fmt.Errorf("failed to get agent: %w", err)
+		}
+		if agent.Revoked {
+			return fmt.Errorf("%w: %s", ErrAgentRevoked, agentID)
+		}
+		if err := tx.Model(&agent).Update("api_token", newToken).Error; err != nil {
+			return fmt.Errorf("failed to refresh token: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return newToken, nil
+}
+
+// RevokeAgentToken suspends an agent's token without deleting the agent.
+// Revoking an already revoked agent keeps the original revocation time.
+func (r *Repository) RevokeAgentToken(agentID string) (*models.AgentConfig, error) {
+	var agent models.AgentConfig
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", agentID).First(&agent).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: %s", ErrAgentNotFound, agentID)
+			}
+			return fmt.Errorf("failed to get agent: %w", err)
+		}
+		if agent.Revoked {
+			return nil
+		}
+
+		now := time.Now().UTC()
+		if err := tx.Model(&agent).Updates(map[string]interface{}{
+			"revoked":    true,
+			"revoked_at": now,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to revoke token: %w", err)
+		}
+		agent.Revoked = true
+		agent.RevokedAt = &now
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &agent, nil
+}
+
 func (r *Repository) ListAgents() ([]models.AgentPublic, error) {
 	var agents []models.AgentConfig
 	if err := r.DB.Order("created_at DESC").Find(&agents).Error; err != nil {
@@ -135,19 +308,130 @@ func (r *Repository) ListAgents() ([]models.AgentPublic, error) {
 	return public, nil
 }
 
+// DeleteAgent removes an agent together with its heartbeat history
 func (r *Repository) DeleteAgent(agentID string) error {
-	result := r.DB.Delete(&models.AgentConfig{}, "id = ?", agentID)
-	if result.Error != nil {
-		return fmt.Errorf("failed to delete agent: %w", result.Error)
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.AgentConfig{}, "id = ?", agentID)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete agent: %w", result.Error)
+		}
+
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("agent not found: %s", agentID)
+		}
+
+		if err := tx.Delete(&models.AgentHeartbeat{}, "agent_id = ?", agentID).Error; err != nil {
+			return fmt.Errorf("failed to delete agent heartbeat history: %w", err)
+		}
+		return nil
+	})
+}
+
+// CreateBootstrapToken issues a registration token usable maxUses times until
+// expiresAt. The plaintext token is returned once; only its hash is stored.
+func (r *Repository) CreateBootstrapToken(ctx context.Context, maxUses int, expiresAt time.Time) (string, *models.BootstrapToken, error) {
+	token, err := generateSecureToken(32)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate bootstrap token: %w", err)
 	}
 
-	if result.RowsAffected == 0 {
-		return fmt.Errorf("agent not found: %s", agentID)
+	record := &models.BootstrapToken{
+		ID:        uuid.Must(uuid.NewV7()).String(),
+		TokenHash: hashToken(token),
+		MaxUses:   maxUses,
+		ExpiresAt: expiresAt.UTC(),
+	}
+	if err := r.DB.WithContext(ctx).Create(record).Error; err != nil {
+		return "", nil, fmt.Errorf("failed to create bootstrap token: %w", err)
 	}
 
+	return token, record, nil
+}
+
+// CheckBootstrapToken reports ErrBootstrapTokenInvalid unless the token is
+// known, unexpired and has uses left. Nothing is used up; see
+// CreateAgentWithBootstrapToken.
+func (r *Repository) CheckBootstrapToken(ctx context.Context, token string) error {
+	var count int64
+	err := r.DB.WithContext(ctx).Model(&models.BootstrapToken{}).
+		Where("token_hash = ? AND uses < max_uses AND expires_at > ?", hashToken(token), time.Now().UTC()).
+		Count(&count).Error
+	if err != nil {
+		return fmt.Errorf("failed to check bootstrap token: %w", err)
+	}
+	if count == 0 {
+		return ErrBootstrapTokenInvalid
+	}
 	return nil
 }
 
+// CreateAgentWithBootstrapToken creates an agent and uses up one use of the
+// bootstrap token in the same transaction, so a registration that fails
+// leaves the token's use in place. The check and the increment happen in a
+// single UPDATE so concurrent registrations cannot exceed MaxUses.
+func (r *Repository) CreateAgentWithBootstrapToken(ctx context.Context, token string, agentName string, metadata map[string]string) (*models.AgentConfig, error) {
+	agent, err := newAgentConfig(agentName, nil, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.BootstrapToken{}).
+			Where("token_hash = ? AND uses < max_uses AND expires_at > ?", hashToken(token), time.Now().UTC()).
+			Update("uses", gorm.Expr("uses + 1"))
+		if result.Error != nil {
+			return fmt.Errorf("failed to consume bootstrap token: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrBootstrapTokenInvalid
+		}
+		if err := tx.Create(agent).Error; err != nil {
+			return fmt.Errorf("failed to create agent: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return agent, nil
+}
+
+// GetIdempotencyKey returns the stored result for key on scope, or nil when
+// the key is unknown or expired at now
+func (r *Repository) GetIdempotencyKey(ctx context.Context, scope, key string, now time.Time) (*models.IdempotencyKey, error) {
+	var record models.IdempotencyKey
+	err := r.DB.WithContext(ctx).
+		Where("scope = ? AND key = ? AND expires_at > ?", scope, key, now.UTC()).
+		First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	return &record, nil
+}
+
+// SaveIdempotencyKey stores the result for a key. Expired keys, including an
+// expired record of the same key, are deleted first so the table only
+// holds keys still inside their window.
+func (r *Repository) SaveIdempotencyKey(ctx context.Context, record *models.IdempotencyKey) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at <= ?", time.Now().UTC()).Delete(&models.IdempotencyKey{}).Error; err != nil {
+			return fmt.Errorf("failed to prune idempotency keys: %w", err)
+		}
+		if err := tx.Create(record).Error; err != nil {
+			return fmt.Errorf("failed to save idempotency key: %w", err)
+		}
+		return nil
+	})
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func generateSecureToken(byteLength int) (string, error) {
 	bytes := make([]byte, byteLength)
 	if _, err := rand.Read(bytes); err != nil {
@@ -156,148 +440,440 @@ func generateSecureToken(byteLength int) (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-func generateETag(config string) string {
-	// Simple ETag generation using length and timestamp
-	return fmt.Sprintf("%x-%d", len(config), time.Now().UnixNano())
-}
+// SetAgentWorkerSchemaVersion records the config schema version the agent's
+// worker supports
+func (r *Repository) SetAgentWorkerSchemaVersion(agentID string, version int) error {
+	result := r.DB.Model(&models.AgentConfig{}).
+		Where("id = ?", agentID).
+		Update("worker_schema_version", version)
 
-func (r *Repository) UpdateConfig(ctx context.Context, config string) error {
-	etag := generateETag(config)
-	result := r.DB.WithContext(ctx).Create(&models.Configuration{
-		ETag:       etag,
-		ConfigData: config,
-	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update agent worker schema version: %w", result.Error)
+	}
 
-	return result.Error
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrAgentNotFound, agentID)
+	}
+
+	return nil
 }
 
-func (r *Repository) GetConfigETag(ctx context.Context) (string, error) {
-	var etag string
-	err := r.DB.WithContext(ctx).Raw("SELECT etag FROM configurations ORDER BY created_at DESC LIMIT 1").Scan(&etag).Error
-	if err == gorm.ErrRecordNotFound {
-		// create default configuration when none exists
-		defaultConfig := "{}"
-		etag = generateETag(defaultConfig)
-		if createErr := r.DB.WithContext(ctx).Create(&models.Configuration{
-			ETag:       etag,
-			ConfigData: defaultConfig,
-		}).Error; createErr != nil {
-			return "", createErr
-		}
-		return etag, nil
+// SetAgentProfile assigns a config profile to an agent; empty clears it
+func (r *Repository) SetAgentProfile(agentID string, profile string) error {
+	result := r.DB.Model(&models.AgentConfig{}).
+		Where("id = ?", agentID).
+		Update("profile", profile)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update agent profile: %w", result.Error)
 	}
-	return etag, err
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrAgentNotFound, agentID)
+	}
+
+	return nil
 }
 
-func (r *Repository) GetConfig(ctx context.Context, config string) (*models.ConfigData, error) {
-	var rawConfigData string
-	var configData *models.ConfigData
+// PublishConfigUpdate publishes a configuration change notification to Redis
+// (if configured), carrying ctx's trace so agents continue it
+func (r *Repository) PublishConfigUpdate(ctx context.Context, agentID string, etag string, correlationID string) (int64, error) {
+	if r.Pub == nil {
+		// Redis not configured; nothing to do
+		return 0, nil
+	}
 
-	err := r.DB.WithContext(ctx).Raw("SELECT config_data FROM configurations WHERE etag = ? LIMIT 1", config).Scan(&rawConfigData).Error
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	n := pubsub.NewConfigUpdateNotification(agentID, etag, correlationID)
+	n.TraceParent = tracing.TraceParent(ctx)
+	payload, err := n.Encode()
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, nil
-		}
-		return nil, err
+		return 0, err
 	}
 
-	err = json.Unmarshal([]byte(rawConfigData), &configData)
+	receivers, err := r.Pub.Publish(ctx, pubsub.ConfigUpdatesChannel, payload)
 	if err != nil {
-		return nil, err
+		return 0, fmt.Errorf("failed to publish config update: %w", err)
 	}
 
-	return configData, nil
+	return receivers, nil
 }
 
-func (r *Repository) GetConfigIfChanged(currentETag string) (string, models.ConfigData, error) {
-	var etag string
-	var rawConfigData string
-	var configData models.ConfigData
+// publishClaimTTL is how long a claim on publishing one config change is
+// held; replicas handling the same request within it skip their publish
+const publishClaimTTL = time.Minute
+
+// ClaimConfigPublish reports whether this replica should publish the update
+// notification for etag (scoped to agentID, or every agent when empty) on
+// behalf of the request identified by correlationID. Only the first replica
+// to claim a publish gets true, so a request replayed to several replicas
+// notifies agents once. The claim is keyed on the request rather than the
+// ETag alone, so a later request publishing the same ETag again is not
+// suppressed. Without a Locker every claim succeeds.
+func (r *Repository) ClaimConfigPublish(ctx context.Context, agentID, etag, correlationID string) (bool, error) {
+	if r.Locker == nil {
+		return true, nil
+	}
+	scope := agentID
+	if scope == "" {
+		scope = "all"
+	}
+	return r.Locker.TryAcquire(ctx, fmt.Sprintf("config-publish:%s:%s:%s", scope, etag, correlationID), publishClaimTTL)
+}
 
-	err := r.DB.Raw("SELECT etag, config_data FROM configurations ORDER BY created_at DESC LIMIT 1").Scan(&struct {
-		ETag       *string
-		ConfigData *string
-	}{
-		ETag:       &etag,
-		ConfigData: &rawConfigData,
-	}).Error
+// distributionTestLock is the Locker key held while a distribution test runs
+const distributionTestLock = "distribution-test"
 
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return "", models.ConfigData{}, nil
-		}
-		return "", models.ConfigData{}, err
+// ClaimDistributionTest claims the fleet-wide distribution test for ttl, so
+// replicas sharing the Locker never run overlapping tests. Without a Locker
+// every claim succeeds.
+func (r *Repository) ClaimDistributionTest(ctx context.Context, ttl time.Duration) (bool, error) {
+	if r.Locker == nil {
+		return true, nil
 	}
+	return r.Locker.TryAcquire(ctx, distributionTestLock, ttl)
+}
 
-	if etag == currentETag {
-		return "", models.ConfigData{}, nil
+// ReleaseDistributionTest gives up a claim taken by ClaimDistributionTest
+func (r *Repository) ReleaseDistributionTest(ctx context.Context) error {
+	if r.Locker == nil {
+		return nil
 	}
+	return r.Locker.Release(ctx, distributionTestLock)
+}
 
-	err = json.Unmarshal([]byte(rawConfigData), &configData)
-	if err != nil {
-		return "", models.ConfigData{}, err
+// PublishIntervalUpdate tells an agent its poll interval changed (if Redis is
+// configured)
+func (r *Repository) PublishIntervalUpdate(agentID string, intervalSeconds int, correlationID string) (int64, error) {
+	if r.Pub == nil {
+		return 0, nil
 	}
 
-	return etag, configData, nil
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	payload, err := pubsub.NewIntervalUpdateNotification(agentID, intervalSeconds, correlationID).Encode()
+	if err != nil {
+		return 0, err
+	}
+	receivers, err := r.Pub.Publish(ctx, pubsub.ConfigUpdatesChannel, payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to publish interval update: %w", err)
+	}
+	return receivers, nil
 }
 
-// PublishConfigUpdate publishes a configuration change notification to Redis (if configured)
-func (r *Repository) PublishConfigUpdate(agentID string, etag string, correlationID string) error {
+// PublishDebugEvent publishes a diagnostic event on the agent debug channel
+// (if Redis is configured)
+func (r *Repository) PublishDebugEvent(event *models.DebugEvent) error {
 	if r.Pub == nil {
-		// Redis not configured; nothing to do
 		return nil
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	notification := map[string]string{
-		"agent_id":       agentID,
-		"etag":           etag,
-		"correlation_id": correlationID,
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal debug event: %w", err)
 	}
+	if _, err := r.Pub.Publish(ctx, models.DebugEventsChannel, string(payload)); err != nil {
+		return fmt.Errorf("failed to publish debug event: %w", err)
+	}
+	return nil
+}
 
-	payload, err := json.Marshal(notification)
-	if err != nil {
-		return fmt.Errorf("failed to marshal config update notification: %w", err)
+// GetAgentLastHeartbeat returns when the agent last sent a heartbeat, or nil
+// when it never has
+func (r *Repository) GetAgentLastHeartbeat(agentID string) (*time.Time, error) {
+	var agents []models.Agent
+	if err := r.DB.Where("agent_id = ?", agentID).Limit(1).Find(&agents).Error; err != nil {
+		return nil, fmt.Errorf("failed to get agent heartbeat: %w", err)
 	}
+	if len(agents) == 0 {
+		return nil, nil
+	}
+	return agents[0].LastHeartbeat, nil
+}
 
-	channel := "config-updates"
-	if err := r.Pub.Publish(ctx, channel, string(payload)); err != nil {
-		return fmt.Errorf("failed to publish config update: %w", err)
+// GetAgentConfigVersion returns the config version from the agent's last
+// heartbeat, or "" when it has not sent one
+func (r *Repository) GetAgentConfigVersion(ctx context.Context, agentID string) (string, error) {
+	var agents []models.Agent
+	if err := r.DB.WithContext(ctx).Select("last_config_version").
+		Where("agent_id = ?", agentID).Limit(1).
+		Find(&agents).Error; err != nil {
+		return "", fmt.Errorf("failed to get agent config version: %w", err)
+	}
+	if len(agents) == 0 {
+		return "", nil
 	}
+	return agents[0].LastConfigVersion, nil
+}
 
-	return nil
+// GetAgentConfigVersions returns the config version from the last heartbeat
+// of each of the agents, keyed by agent ID. Agents without a heartbeat are
+// left out.
+func (r *Repository) GetAgentConfigVersions(ctx context.Context, agentIDs []string) (map[string]string, error) {
+	var agents []models.Agent
+	if err := r.DB.WithContext(ctx).Select("agent_id", "last_config_version").
+		Where("agent_id IN ?", agentIDs).
+		Find(&agents).Error; err != nil {
+		return nil, fmt.Errorf("failed to get agent config versions: %w", err)
+	}
+	versions := make(map[string]string, len(agents))
+	for _, a := range agents {
+		versions[a.AgentID] = a.LastConfigVersion
+	}
+	return versions, nil
 }
 
 // UpdateAgentHeartbeat updates the agent's last heartbeat timestamp and last config version
 func (r *Repository) UpdateAgentHeartbeat(agentID string, configVersion string) (*models.Agent, error) {
 	var agent models.Agent
+
+	if err := saveHeartbeat(r.DB, agentID, configVersion, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	if err := r.DB.Where("agent_id = ?", agentID).First(&agent).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve agent after heartbeat update: %w", err)
+	}
+	return &agent, nil
+}
+
+// UpdateAgentLastError stores the most recent error an agent reported; an
+// empty lastError clears it
+func (r *Repository) UpdateAgentLastError(agentID string, lastError string, at *time.Time) error {
+	return saveLastError(r.DB, agentID, lastError, at)
+}
+
+func saveLastError(db *gorm.DB, agentID string, lastError string, at *time.Time) error {
+	if lastError == "" {
+		at = nil
+	} else if at == nil {
+		now := time.Now().UTC()
+		at = &now
+	}
+	result := db.Model(&models.AgentConfig{}).
+		Where("id = ?", agentID).
+		Updates(map[string]interface{}{
+			"last_error":    lastError,
+			"last_error_at": at,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update agent last error: %w", result.Error)
+	}
+	return nil
+}
+
+// HeartbeatEntry is a single agent heartbeat applied as part of a batch
+type HeartbeatEntry struct {
+	AgentID       string
+	APIToken      string
+	ConfigVersion string
+	LastError     string
+	LastErrorAt   *time.Time
+}
+
+// UpdateAgentHeartbeatsBatch applies several heartbeats in one transaction.
+// Entries for unknown agents, or whose token does not belong to the agent when
+// checkToken is set, are skipped and reported in the returned slice, which is
+// indexed like entries. The remaining entries are committed together.
+func (r *Repository) UpdateAgentHeartbeatsBatch(ctx context.Context, entries []HeartbeatEntry, checkToken bool) ([]error, error) {
+	results := make([]error, len(entries))
 	now := time.Now().UTC()
 
-	result := r.DB.Model(&models.Agent{}).
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i, entry := range entries {
+			var agent models.AgentConfig
+			if err := tx.Where("id = ?", entry.AgentID).First(&agent).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					results[i] = ErrAgentNotFound
+					continue
+				}
+				return fmt.Errorf("failed to get agent: %w", err)
+			}
+
+			if checkToken && subtle.ConstantTimeCompare([]byte(agent.APIToken), []byte(entry.APIToken)) != 1 {
+				results[i] = ErrAgentUnauthorized
+				continue
+			}
+			if checkToken && agent.Revoked {
+				results[i] = ErrAgentRevoked
+				continue
+			}
+
+			if err := saveHeartbeat(tx, entry.AgentID, entry.ConfigVersion, now); err != nil {
+				return err
+			}
+			if err := saveLastError(tx, entry.AgentID, entry.LastError, entry.LastErrorAt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func saveHeartbeat(db *gorm.DB, agentID string, configVersion string, at time.Time) error {
+	result := db.Model(&models.Agent{}).
 		Where("agent_id = ?", agentID).
 		Save(map[string]interface{}{
 			"agent_id":            agentID,
-			"last_heartbeat":      now,
+			"last_heartbeat":      at,
 			"last_config_version": configVersion,
 		})
 	if result.Error != nil {
-		return nil, fmt.Errorf("failed to update agent heartbeat: %w", result.Error)
+		return fmt.Errorf("failed to update agent heartbeat: %w", result.Error)
+	}
+	if err := db.Create(&models.AgentHeartbeat{AgentID: agentID, ConfigVersion: configVersion, CreatedAt: at}).Error; err != nil {
+		return fmt.Errorf("failed to record agent heartbeat: %w", err)
 	}
+	return nil
+}
 
-	if err := r.DB.Where("agent_id = ?", agentID).First(&agent).Error; err != nil {
-		return nil, fmt.Errorf("failed to retrieve agent after heartbeat update: %w", err)
+// ListAgentHeartbeats returns an agent's heartbeat history newest first,
+// along with the total number of recorded heartbeats
+func (r *Repository) ListAgentHeartbeats(ctx context.Context, agentID string, limit, offset int) ([]models.AgentHeartbeat, int64, error) {
+	query := r.DB.WithContext(ctx).Model(&models.AgentHeartbeat{}).Where("agent_id = ?", agentID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count agent heartbeats: %w", err)
 	}
-	return &agent, nil
+
+	heartbeats := make([]models.AgentHeartbeat, 0, limit)
+	if err := query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&heartbeats).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list agent heartbeats: %w", err)
+	}
+	return heartbeats, total, nil
 }
 
-// GetLatestConfigVersionForAgent returns the latest configuration ETag (global) for now
-func (r *Repository) GetLatestConfigVersionForAgent(agentID string) (string, error) {
-	// For now return the global latest configuration ETag
-	etag, err := r.GetConfigETag(context.Background())
+// PruneAgentHeartbeats deletes heartbeat history recorded before the given
+// time and returns how many heartbeats were removed
+func (r *Repository) PruneAgentHeartbeats(ctx context.Context, before time.Time) (int64, error) {
+	result := r.DB.WithContext(ctx).Where("created_at < ?", before).Delete(&models.AgentHeartbeat{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune agent heartbeats: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// RecordEvent appends an entry to the activity feed
+func (r *Repository) RecordEvent(ctx context.Context, event *models.Event) error {
+	if err := r.DB.WithContext(ctx).Create(event).Error; err != nil {
+		return fmt.Errorf("failed to record event: %w", err)
+	}
+	return nil
+}
+
+// ListEvents returns activity feed entries newest first, optionally filtered
+// by type, along with the total number of matching entries
+func (r *Repository) ListEvents(ctx context.Context, eventType string, limit, offset int) ([]models.Event, int64, error) {
+	query := r.DB.WithContext(ctx).Model(&models.Event{})
+	if eventType != "" {
+		query = query.Where("type = ?", eventType)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count events: %w", err)
+	}
+
+	events := make([]models.Event, 0, limit)
+	if err := query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&events).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list events: %w", err)
+	}
+	return events, total, nil
+}
+
+// ConfigVersionCount is the number of registered agents reporting an ETag
+type ConfigVersionCount struct {
+	ETag   string
+	Agents int64
+}
+
+// CountAgentsByConfigVersion groups registered agents by the config version
+// from their last heartbeat. Agents without a heartbeat are counted under "".
+func (r *Repository) CountAgentsByConfigVersion(ctx context.Context) ([]ConfigVersionCount, error) {
+	var counts []ConfigVersionCount
+	err := r.DB.WithContext(ctx).Raw(`SELECT COALESCE(a.last_config_version, '') AS e_tag, COUNT(*) AS agents
+		FROM agent_configs c
+		LEFT JOIN agents a ON a.agent_id = c.id
+		GROUP BY e_tag
+		ORDER BY agents DESC, e_tag`).Scan(&counts).Error
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("failed to count agents by config version: %w", err)
+	}
+	return counts, nil
+}
+
+// AgentConfigVersion is a registered agent with its last reported config
+// version, and the profile, metadata and worker schema that decide the
+// version it is served
+type AgentConfigVersion struct {
+	AgentID             string
+	AgentName           string
+	Profile             string
+	Metadata            map[string]string `gorm:"serializer:json"`
+	WorkerSchemaVersion int               // Schema the agent's worker last reported
+	ConfigVersion       string
+	LastHeartbeat       *time.Time
+}
+
+// ListAgentConfigVersions returns every registered agent with the config
+// version from its last heartbeat
+func (r *Repository) ListAgentConfigVersions(ctx context.Context) ([]AgentConfigVersion, error) {
+	var agents []AgentConfigVersion
+	err := r.DB.WithContext(ctx).Raw(`SELECT c.id AS agent_id, c.agent_name, c.profile, c.metadata, c.worker_schema_version, COALESCE(a.last_config_version, '') AS config_version, a.last_heartbeat
+		FROM agent_configs c
+		LEFT JOIN agents a ON a.agent_id = c.id
+		ORDER BY c.created_at, c.id`).Scan(&agents).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agent config versions: %w", err)
+	}
+	return agents, nil
+}
+
+// AgentConfigGroup counts the registered agents that share a profile,
+// metadata, worker schema and reported config version, and so are served
+// the same version. Online, Stale and Offline split Agents by last heartbeat.
+type AgentConfigGroup struct {
+	Profile             string
+	Metadata            map[string]string `gorm:"serializer:json"`
+	WorkerSchemaVersion int
+	ConfigVersion       string
+	Agents              int
+	Online              int
+	Stale               int
+	Offline             int // Includes agents that never sent a heartbeat
+}
+
+// GroupAgentConfigVersions aggregates registered agents into
+// AgentConfigGroups. An agent whose last heartbeat is before offlineBefore is
+// offline, before lateBefore stale, and online otherwise.
+func (r *Repository) GroupAgentConfigVersions(ctx context.Context, lateBefore, offlineBefore time.Time) ([]AgentConfigGroup, error) {
+	var groups []AgentConfigGroup
+	err := r.DB.WithContext(ctx).Raw(`SELECT c.profile, c.metadata, c.worker_schema_version, COALESCE(a.last_config_version, '') AS config_version,
+			COUNT(*) AS agents,
+			SUM(CASE WHEN a.last_heartbeat >= ? THEN 1 ELSE 0 END) AS online,
+			SUM(CASE WHEN a.last_heartbeat >= ? AND a.last_heartbeat < ? THEN 1 ELSE 0 END) AS stale,
+			SUM(CASE WHEN a.last_heartbeat IS NULL OR a.last_heartbeat < ? THEN 1 ELSE 0 END) AS offline
+		FROM agent_configs c
+		LEFT JOIN agents a ON a.agent_id = c.id
+		GROUP BY c.profile, c.metadata, c.worker_schema_version, config_version
+		ORDER BY agents DESC, config_version`,
+		lateBefore.UTC(), offlineBefore.UTC(), lateBefore.UTC(), offlineBefore.UTC(),
+	).Scan(&groups).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to group agent config versions: %w", err)
 	}
-	return etag, nil
+	return groups, nil
 }
@@ -0,0 +1,34 @@
+package usecase
+
+import "github.com/Alwanly/service-distribute-management/internal/server/controller/dto"
+
+// lagBucketBounds are the inclusive upper bounds of the fleet config lag
+// histogram; a final unbounded bucket holds everything further behind
+var lagBucketBounds = []int64{0, 1, 2, 5, 10}
+
+func newLagHistogram() dto.ConfigLagHistogram {
+	histogram := dto.ConfigLagHistogram{Buckets: make([]dto.LagBucket, 0, len(lagBucketBounds)+1)}
+	for i := range lagBucketBounds {
+		histogram.Buckets = append(histogram.Buckets, dto.LagBucket{MaxVersionsBehind: &lagBucketBounds[i]})
+	}
+	histogram.Buckets = append(histogram.Buckets, dto.LagBucket{})
+	return histogram
+}
+
+// observeLag adds the lag shared by a number of agents to the histogram
+func observeLag(histogram *dto.ConfigLagHistogram, lag dto.ConfigLag, agents int) {
+	if !lag.Known {
+		histogram.Unknown += agents
+		return
+	}
+	for i := range histogram.Buckets {
+		bound := histogram.Buckets[i].MaxVersionsBehind
+		if bound == nil || lag.VersionsBehind <= *bound {
+			histogram.Buckets[i].Agents += agents
+			break
+		}
+	}
+	if lag.LagSeconds > histogram.MaxLagSeconds {
+		histogram.MaxLagSeconds = lag.LagSeconds
+	}
+}
@@ -0,0 +1,202 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Alwanly/service-distribute-management/internal/models"
+	"github.com/Alwanly/service-distribute-management/internal/server/controller/dto"
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+	"github.com/Alwanly/service-distribute-management/pkg/wrapper"
+)
+
+// idleConfigPruneCheck is how often the background pruner checks whether an
+// interval was configured by a reload while it is disabled
+const idleConfigPruneCheck = time.Minute
+
+// configRetention is a retention policy for config versions. A version is
+// retained while it is one of the newest keep versions of its profile or
+// younger than maxAge; a zero value disables either rule.
+type configRetention struct {
+	keep   int
+	maxAge time.Duration
+}
+
+func (p configRetention) enabled() bool {
+	return p.keep > 0 || p.maxAge > 0
+}
+
+// retains reports whether the version at position i of its profile's
+// history, newest first, is kept by the policy
+func (p configRetention) retains(i int, createdAt, now time.Time) bool {
+	if p.keep > 0 && i < p.keep {
+		return true
+	}
+	return p.maxAge > 0 && now.Sub(createdAt) < p.maxAge
+}
+
+// configuredRetention is the retention policy from the running config
+func (uc *UseCase) configuredRetention() configRetention {
+	cfg := uc.CurrentConfig()
+	if cfg == nil {
+		return configRetention{}
+	}
+	return configRetention{keep: cfg.ConfigRetentionKeep, maxAge: cfg.ConfigRetentionMaxAge}
+}
+
+// PruneConfigVersions applies the retention policy, overridden by the
+// request, to every profile's history
+func (uc *UseCase) PruneConfigVersions(ctx context.Context, req *dto.PruneConfigVersionsRequest) wrapper.JSONResult {
+	policy := uc.configuredRetention()
+	if req.Keep != nil {
+		policy.keep = *req.Keep
+	}
+	if req.MaxAgeSeconds != nil {
+		policy.maxAge = time.Duration(*req.MaxAgeSeconds) * time.Second
+	}
+	if !policy.enabled() {
+		return wrapper.ResponseBadRequest("no retention policy: set keep or max_age_seconds, or configure CONFIG_RETENTION_KEEP or CONFIG_RETENTION_MAX_AGE")
+	}
+
+	resp, err := uc.pruneConfigVersions(ctx, policy, req.DryRun, time.Now().UTC())
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to prune config versions", nil)
+	}
+
+	logger.AddToContext(ctx,
+		zap.Int("pruned", len(resp.Pruned)),
+		zap.Bool("dry_run", resp.DryRun),
+		zap.Bool(logger.FieldSuccess, true),
+	)
+	return wrapper.ResponseSuccess(http.StatusOK, resp)
+}
+
+// pruneConfigVersions deletes the versions policy does not retain. The
+// latest version of every profile is never deleted, nor is a version an
+// agent last reported running (which covers agents holding a pinned
+// config) or would be served on its next fetch. A push landing during the
+// prune only adds a newer version, so the versions protected here stay
+// valid and the compare-and-store of a push always sees a latest version
+// that is kept.
+func (uc *UseCase) pruneConfigVersions(ctx context.Context, policy configRetention, dryRun bool, now time.Time) (dto.PruneConfigVersionsResponse, error) {
+	resp := dto.PruneConfigVersionsResponse{
+		DryRun:        dryRun,
+		Keep:          policy.keep,
+		MaxAgeSeconds: int(policy.maxAge / time.Second),
+		Pruned:        []dto.PrunedConfigVersion{},
+	}
+
+	protected, err := uc.protectedConfigVersions(ctx)
+	if err != nil {
+		return resp, err
+	}
+
+	names := []string{""}
+	profiles, err := uc.Configs.Profiles(ctx)
+	if err != nil {
+		return resp, err
+	}
+	for _, p := range profiles {
+		names = append(names, p.Name)
+	}
+
+	var etags []string
+	for _, name := range names {
+		versions, err := uc.Configs.History(ctx, name, 0)
+		if err != nil {
+			return resp, err
+		}
+		for i, v := range versions {
+			switch {
+			case policy.retains(i, v.CreatedAt, now):
+				resp.Kept++
+			case i == 0 || protected[v.ETag]:
+				resp.Kept++
+				resp.Protected++
+			default:
+				etags = append(etags, v.ETag)
+				resp.Pruned = append(resp.Pruned, dto.PrunedConfigVersion{Profile: name, ETag: v.ETag, CreatedAt: v.CreatedAt})
+			}
+		}
+	}
+
+	if dryRun || len(etags) == 0 {
+		return resp, nil
+	}
+	if _, err := uc.Configs.Delete(ctx, etags); err != nil {
+		return resp, err
+	}
+	uc.recordEvent(ctx, models.EventConfigPruned, "", fmt.Sprintf("%d versions", len(etags)))
+	return resp, nil
+}
+
+// protectedConfigVersions returns the ETags agents depend on: the version
+// each one last reported and the version it would be served now. The served
+// version comes from the resolver GetConfigForAgent uses, which reads each
+// profile's history once for the whole fleet; a version later refused for
+// the agent's worker schema is still protected, as the agent keeps running
+// the version it reported.
+func (uc *UseCase) protectedConfigVersions(ctx context.Context) (map[string]bool, error) {
+	now := time.Now().UTC()
+	groups, err := uc.Repo.GroupAgentConfigVersions(ctx, now, now)
+	if err != nil {
+		return nil, err
+	}
+	protected := make(map[string]bool, len(groups))
+	resolver := uc.newConfigResolver()
+	for _, g := range groups {
+		if g.ConfigVersion != "" {
+			protected[g.ConfigVersion] = true
+		}
+		served, _, err := resolver.served(ctx, g.Profile, g.Metadata, g.WorkerSchemaVersion)
+		if err != nil {
+			return nil, fmt.Errorf("resolve config served to profile %q: %w", g.Profile, err)
+		}
+		if served != "" {
+			protected[served] = true
+		}
+	}
+	return protected, nil
+}
+
+// RunConfigPruner applies the configured retention policy every
+// CONFIG_PRUNE_INTERVAL until ctx is done. The interval and policy are
+// read on every round, so a reload can enable, change or disable pruning.
+func (uc *UseCase) RunConfigPruner(ctx context.Context) {
+	for {
+		wait := idleConfigPruneCheck
+		if cfg := uc.CurrentConfig(); cfg != nil && cfg.ConfigPruneInterval > 0 {
+			wait = cfg.ConfigPruneInterval
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		cfg := uc.CurrentConfig()
+		policy := uc.configuredRetention()
+		if cfg == nil || cfg.ConfigPruneInterval <= 0 || !policy.enabled() {
+			continue
+		}
+		resp, err := uc.pruneConfigVersions(ctx, policy, false, time.Now().UTC())
+		if err != nil {
+			uc.Logger.Error("failed to prune config versions", zap.Error(err))
+			continue
+		}
+		if len(resp.Pruned) > 0 {
+			uc.Logger.Info("pruned config versions",
+				zap.Int("pruned", len(resp.Pruned)),
+				zap.Int("kept", resp.Kept),
+			)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/internal/models"
+	"github.com/Alwanly/service-distribute-management/internal/server/controller/configstore"
+	"github.com/Alwanly/service-distribute-management/internal/server/controller/dto"
+	"github.com/Alwanly/service-distribute-management/internal/server/controller/repository"
+)
+
+// getConfig returns the parsed config stored under etag, or nil for an
+// unknown ETag. A version that does not parse is ErrConfigCorrupt.
+func (uc *UseCase) getConfig(ctx context.Context, etag string) (*models.ConfigData, error) {
+	v, err := uc.Configs.Get(ctx, etag)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return decodeConfig(v)
+}
+
+func decodeConfig(v *configstore.Version) (*models.ConfigData, error) {
+	var configData *models.ConfigData
+	if err := json.Unmarshal([]byte(v.Data), &configData); err != nil {
+		return nil, fmt.Errorf("%w: etag %s: %v", repository.ErrConfigCorrupt, v.ETag, err)
+	}
+	return configData, nil
+}
+
+// storedVersion is a config version with its data decoded; data is nil for
+// a version that does not parse
+type storedVersion struct {
+	etag      string
+	createdAt time.Time
+	data      *models.ConfigData
+}
+
+// configResolver works out which version GetConfigForAgent serves an agent;
+// it is the one place that decision is made. Store reads are cached for the
+// resolver's lifetime, so one resolver can resolve a whole fleet with a few
+// reads per profile; create a new one for every request so it never serves
+// stale versions.
+type configResolver struct {
+	configs configstore.ConfigStore
+	latest  map[string]*storedVersion
+	history map[string][]storedVersion
+}
+
+func (uc *UseCase) newConfigResolver() *configResolver {
+	return &configResolver{
+		configs: uc.Configs,
+		latest:  make(map[string]*storedVersion),
+		history: make(map[string][]storedVersion),
+	}
+}
+
+// errNoMatchingConfig is returned by resolve when versions exist but none
+// matches the agent's metadata
+var errNoMatchingConfig = errors.New("no configuration matches agent metadata")
+
+// resolve returns the version GetConfigForAgent serves an agent with the
+// given profile and metadata and the config it comes from ("" for the
+// default config). An unknown profile falls back to the default config,
+// corrupt versions are skipped and the newest version matching the metadata
+// wins. The version is nil when the config has no versions; it is
+// ErrConfigCorrupt when none parses and errNoMatchingConfig when none
+// matches.
+func (r *configResolver) resolve(ctx context.Context, profile string, metadata map[string]string) (*storedVersion, string, error) {
+	name := ""
+	if profile != "" {
+		latest, err := r.newest(ctx, profile)
+		if err != nil {
+			return nil, "", err
+		}
+		if latest != nil {
+			name = profile
+		}
+	}
+
+	// The newest version nearly always parses and matches, which saves
+	// reading the history
+	latest, err := r.newest(ctx, name)
+	if err != nil || latest == nil {
+		return nil, name, err
+	}
+	if latest.data != nil && latest.data.Matches(metadata) {
+		return latest, name, nil
+	}
+
+	versions, err := r.versions(ctx, name)
+	if err != nil {
+		return nil, name, err
+	}
+	valid := false
+	for i := range versions {
+		if versions[i].data == nil {
+			continue
+		}
+		valid = true
+		if versions[i].data.Matches(metadata) {
+			return &versions[i], name, nil
+		}
+	}
+	if !valid {
+		return nil, name, repository.ErrConfigCorrupt
+	}
+	return nil, name, errNoMatchingConfig
+}
+
+// served returns the ETag resolve picks for an agent and the config it
+// comes from. The ETag is empty when nothing would be served, including
+// when the agent's worker reported a schema too old for the version, which
+// GetConfigForAgent refuses; a schema of 0 is unknown and not checked.
+func (r *configResolver) served(ctx context.Context, profile string, metadata map[string]string, schema int) (string, string, error) {
+	v, name, err := r.resolve(ctx, profile, metadata)
+	if errors.Is(err, repository.ErrConfigCorrupt) || errors.Is(err, errNoMatchingConfig) {
+		return "", name, nil
+	}
+	if err != nil || v == nil {
+		return "", name, err
+	}
+	if schema > 0 {
+		if _, err := v.data.ForSchema(schema); err != nil {
+			return "", name, nil
+		}
+	}
+	return v.etag, name, nil
+}
+
+// lag compares the version an agent reported with the version of the named
+// config it would be served now
+func (r *configResolver) lag(ctx context.Context, name, reported, expected string, now time.Time) (dto.ConfigLag, error) {
+	result := dto.ConfigLag{ReportedVersion: reported, ExpectedVersion: expected}
+	if reported == expected {
+		result.Known = reported != ""
+		return result, nil
+	}
+	if reported == "" || expected == "" {
+		return result, nil
+	}
+
+	versions, err := r.versions(ctx, name)
+	if err != nil {
+		return dto.ConfigLag{}, err
+	}
+	from, to := -1, -1
+	for i, v := range versions {
+		switch v.etag {
+		case reported:
+			from = i
+		case expected:
+			to = i
+		}
+	}
+	// A reported version missing from the config's history was never
+	// reported, was pruned or belongs to another profile
+	if from < 0 || to < 0 {
+		return result, nil
+	}
+	result.Known = true
+	if from < to {
+		// Ahead of the expected version, e.g. a newer version that does not
+		// match the agent's metadata
+		return result, nil
+	}
+	// Versions are newest first, so the ones the agent is missing sit
+	// between the expected version and the reported one
+	result.VersionsBehind = int64(from - to)
+	result.LagSeconds = int64(now.Sub(versions[from-1].createdAt).Seconds())
+	return result, nil
+}
+
+func (r *configResolver) newest(ctx context.Context, name string) (*storedVersion, error) {
+	if v, ok := r.latest[name]; ok {
+		return v, nil
+	}
+	if versions, ok := r.history[name]; ok {
+		var v *storedVersion
+		if len(versions) > 0 {
+			v = &versions[0]
+		}
+		r.latest[name] = v
+		return v, nil
+	}
+
+	etag, err := r.configs.LatestETag(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var latest *storedVersion
+	if etag != "" {
+		v, err := r.configs.Get(ctx, etag)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			latest = decodeStored(v)
+		}
+	}
+	r.latest[name] = latest
+	return latest, nil
+}
+
+func (r *configResolver) versions(ctx context.Context, name string) ([]storedVersion, error) {
+	if versions, ok := r.history[name]; ok {
+		return versions, nil
+	}
+	stored, err := r.configs.History(ctx, name, 0)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]storedVersion, len(stored))
+	for i := range stored {
+		versions[i] = *decodeStored(&stored[i])
+	}
+	r.history[name] = versions
+	return versions, nil
+}
+
+func decodeStored(v *configstore.Version) *storedVersion {
+	data, _ := decodeConfig(v)
+	return &storedVersion{etag: v.ETag, createdAt: v.CreatedAt, data: data}
+}
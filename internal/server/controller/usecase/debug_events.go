@@ -0,0 +1,43 @@
+package usecase
+
+import (
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/internal/models"
+	"go.uber.org/zap"
+)
+
+// defaultHeartbeatLateAfter is used when the config leaves HeartbeatLateAfter unset
+const defaultHeartbeatLateAfter = 90 * time.Second
+
+// publishDebugEvent sends a diagnostic event to agentID when debug events
+// are enabled. Failures are logged and never affect the calling request.
+func (uc *UseCase) publishDebugEvent(agentID, event, message string) {
+	if cfg := uc.CurrentConfig(); cfg == nil || !cfg.DebugEvents {
+		return
+	}
+
+	err := uc.Repo.PublishDebugEvent(&models.DebugEvent{
+		Type:    models.DebugEventType,
+		AgentID: agentID,
+		Event:   event,
+		Message: message,
+		At:      time.Now().UTC(),
+	})
+	if err != nil {
+		uc.Logger.Warn("failed to publish debug event",
+			zap.Error(err),
+			zap.String("event", event),
+			zap.String("agent_id", agentID),
+		)
+	}
+}
+
+// heartbeatLateAfter is the heartbeat gap reported as heartbeat_late
+func (uc *UseCase) heartbeatLateAfter() time.Duration {
+	cfg := uc.CurrentConfig()
+	if cfg == nil || cfg.HeartbeatLateAfter <= 0 {
+		return defaultHeartbeatLateAfter
+	}
+	return cfg.HeartbeatLateAfter
+}
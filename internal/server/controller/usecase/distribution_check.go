@@ -0,0 +1,237 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/Alwanly/service-distribute-management/internal/models"
+	"github.com/Alwanly/service-distribute-management/internal/server/controller/dto"
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+	"github.com/Alwanly/service-distribute-management/pkg/wrapper"
+)
+
+// DistributionTestFlag is the feature flag that tags a sentinel config with
+// the ID of the distribution test that pushed it
+const DistributionTestFlag = "distribution_test"
+
+// defaultDistributionTestTimeout is how long a distribution test waits for
+// heartbeats when the request does not say
+const defaultDistributionTestTimeout = 30 * time.Second
+
+// distributionTestClaimMargin keeps the fleet-wide claim on a test a little
+// past its timeout, so it lapses on its own if the release is lost
+const distributionTestClaimMargin = 30 * time.Second
+
+// distributionTestPoll is how often a running distribution test reads the
+// config versions agents reported
+var distributionTestPoll = 250 * time.Millisecond
+
+// RunDistributionTest verifies the whole distribution pipeline: it pushes
+// the latest default config again, tagged with a unique DistributionTestFlag
+// so it is stored and published as a new version, then waits until every
+// agent served it reports its ETag in a heartbeat or the timeout passes.
+// Agents whose worker reported a schema too old for the sentinel are never
+// served it and are skipped. The sentinel stays the latest config, differing
+// from the previous one only in the flag, unless the request asks to restore
+// the previous config afterwards. One test runs at a time across replicas
+// sharing a Locker.
+func (uc *UseCase) RunDistributionTest(ctx context.Context, req *dto.DistributionTestRequest) wrapper.JSONResult {
+	timeout := defaultDistributionTestTimeout
+	if req.TimeoutSeconds > 0 {
+		timeout = time.Duration(req.TimeoutSeconds) * time.Second
+	}
+
+	// A second test would replace the sentinel the first is waiting for,
+	// whether it runs here or on another replica
+	if !uc.distributionTest.TryLock() {
+		logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, false), zap.String("result", "already_running"))
+		return wrapper.ResponseFailed(http.StatusConflict, "a distribution test is already running", nil)
+	}
+	defer uc.distributionTest.Unlock()
+	claimed, err := uc.Repo.ClaimDistributionTest(ctx, timeout+distributionTestClaimMargin)
+	if err != nil {
+		// Like a publish, the test still runs when the Locker is down
+		uc.Logger.Warn("failed to claim the distribution test across replicas", zap.Error(err))
+		claimed = true
+	}
+	if !claimed {
+		logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, false), zap.String("result", "already_running_elsewhere"))
+		return wrapper.ResponseFailed(http.StatusConflict, "a distribution test is already running", nil)
+	}
+	defer func() {
+		if err := uc.Repo.ReleaseDistributionTest(context.WithoutCancel(ctx)); err != nil {
+			uc.Logger.Warn("failed to release the distribution test claim", zap.Error(err))
+		}
+	}()
+
+	sentinel, res := uc.sentinelConfig(ctx)
+	if sentinel == nil {
+		return res
+	}
+	previous := *sentinel
+	previous.Flags = maps.Clone(sentinel.Flags)
+	testID := uuid.Must(uuid.NewV7()).String()
+	sentinel.Flags[DistributionTestFlag] = testID
+	logger.AddToContext(ctx, zap.String("test_id", testID))
+
+	start := time.Now()
+	res = uc.UpdateConfig(ctx, sentinel)
+	if res.Code != http.StatusOK {
+		return res
+	}
+	etag := res.Data.(dto.SetConfigAgentResponse).ETag
+
+	resp := dto.DistributionTestResponse{
+		TestID:         testID,
+		ETag:           etag,
+		TimeoutSeconds: int(timeout / time.Second),
+	}
+	// Agents are those known when the sentinel was stored; one registering
+	// during the test is not waited for
+	targets, skipped, err := uc.distributionTargets(ctx, etag)
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to list agents", err)
+	}
+	resp.Skipped = skipped
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(distributionTestPoll)
+	defer ticker.Stop()
+wait:
+	for {
+		resp.Acknowledged, resp.Pending, err = uc.distributionAcks(ctx, etag, targets)
+		if err != nil {
+			logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+			return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to read agent config versions", err)
+		}
+		if len(resp.Pending) == 0 {
+			break
+		}
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			break wait
+		case <-ctx.Done():
+			break wait
+		}
+	}
+	resp.Complete = len(resp.Pending) == 0
+	resp.ElapsedMs = time.Since(start).Milliseconds()
+
+	if req.Restore {
+		res := uc.UpdateConfig(context.WithoutCancel(ctx), &previous)
+		if res.Code != http.StatusOK {
+			logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, false), zap.String("result", "restore_failed"))
+			return res
+		}
+		resp.RestoredETag = res.Data.(dto.SetConfigAgentResponse).ETag
+	}
+
+	logger.AddToContext(ctx,
+		zap.String(logger.FieldETag, etag),
+		zap.Int("acknowledged", len(resp.Acknowledged)),
+		zap.Int("pending", len(resp.Pending)),
+		zap.Int("skipped", len(resp.Skipped)),
+		zap.Bool(logger.FieldSuccess, true),
+	)
+	return wrapper.ResponseSuccess(http.StatusOK, resp)
+}
+
+// sentinelConfig returns a copy of the latest default config to push as a
+// sentinel, or nil and the response to return
+func (uc *UseCase) sentinelConfig(ctx context.Context) (*dto.SetConfigAgentRequest, wrapper.JSONResult) {
+	etag, err := uc.Configs.LatestETag(ctx, "")
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return nil, wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to get config", err)
+	}
+	if etag == "" {
+		logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, false))
+		return nil, wrapper.ResponseNotFound("no configuration to distribute; set one with POST /config first")
+	}
+
+	current, err := uc.getConfig(ctx, etag)
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return nil, wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to get config", err)
+	}
+	raw, err := json.Marshal(current)
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return nil, wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to marshal config data", err)
+	}
+	req := new(dto.SetConfigAgentRequest)
+	if err := json.Unmarshal(raw, req); err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return nil, wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to decode config data", err)
+	}
+	if req.Flags == nil {
+		req.Flags = models.Flags{}
+	}
+	return req, wrapper.JSONResult{}
+}
+
+// distributionTargets splits the known agents into those served etag, which
+// the test waits for, and the rest, which are skipped
+func (uc *UseCase) distributionTargets(ctx context.Context, etag string) (map[string]bool, []dto.DistributionTestAgent, error) {
+	agents, err := uc.Repo.ListAgentConfigVersions(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	targets := make(map[string]bool, len(agents))
+	skipped := []dto.DistributionTestAgent{}
+	resolver := uc.newConfigResolver()
+	for _, a := range agents {
+		expected, _, err := resolver.served(ctx, a.Profile, a.Metadata, a.WorkerSchemaVersion)
+		if err != nil {
+			return nil, nil, err
+		}
+		if expected == etag {
+			targets[a.AgentID] = true
+			continue
+		}
+		skipped = append(skipped, dto.DistributionTestAgent{
+			AgentID:         a.AgentID,
+			AgentName:       a.AgentName,
+			ConfigVersion:   a.ConfigVersion,
+			ExpectedVersion: expected,
+			LastHeartbeat:   a.LastHeartbeat,
+		})
+	}
+	return targets, skipped, nil
+}
+
+// distributionAcks splits the targeted agents by whether their last
+// heartbeat reported etag
+func (uc *UseCase) distributionAcks(ctx context.Context, etag string, targets map[string]bool) (acked, pending []dto.DistributionTestAgent, err error) {
+	agents, err := uc.Repo.ListAgentConfigVersions(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	acked, pending = []dto.DistributionTestAgent{}, []dto.DistributionTestAgent{}
+	for _, a := range agents {
+		if !targets[a.AgentID] {
+			continue
+		}
+		agent := dto.DistributionTestAgent{
+			AgentID:       a.AgentID,
+			AgentName:     a.AgentName,
+			ConfigVersion: a.ConfigVersion,
+			LastHeartbeat: a.LastHeartbeat,
+		}
+		if a.ConfigVersion == etag {
+			acked = append(acked, agent)
+		} else {
+			pending = append(pending, agent)
+		}
+	}
+	return acked, pending, nil
+}
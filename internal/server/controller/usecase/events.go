@@ -0,0 +1,54 @@
+package usecase
+
+import (
+	"context"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/Alwanly/service-distribute-management/internal/models"
+	"github.com/Alwanly/service-distribute-management/internal/server/controller/dto"
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+	"github.com/Alwanly/service-distribute-management/pkg/wrapper"
+)
+
+const defaultEventsLimit = 50
+
+// recordEvent adds an entry to the activity feed. The feed is informational,
+// so a failure is logged and never fails the action that triggered it.
+func (uc *UseCase) recordEvent(ctx context.Context, eventType, agentID, detail string) {
+	err := uc.Repo.RecordEvent(ctx, &models.Event{
+		Type:    eventType,
+		AgentID: agentID,
+		Detail:  detail,
+	})
+	if err != nil {
+		uc.Logger.Error("failed to record event",
+			zap.Error(err),
+			zap.String("event_type", eventType),
+			zap.String("agent_id", agentID),
+		)
+	}
+}
+
+// ListEvents returns the activity feed newest first
+func (uc *UseCase) ListEvents(ctx context.Context, req *dto.ListEventsRequest) wrapper.JSONResult {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultEventsLimit
+	}
+
+	events, total, err := uc.Repo.ListEvents(ctx, req.Type, limit, req.Offset)
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to list events", err)
+	}
+
+	logger.AddToContext(ctx, zap.Int64("total", total), zap.Bool(logger.FieldSuccess, true))
+	return wrapper.ResponseSuccess(http.StatusOK, dto.ListEventsResponse{
+		Events: events,
+		Total:  total,
+		Limit:  limit,
+		Offset: req.Offset,
+	})
+}
@@ -0,0 +1,619 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/internal/models"
+	"github.com/Alwanly/service-distribute-management/internal/server/controller/configstore"
+	"github.com/Alwanly/service-distribute-management/internal/server/controller/repository"
+	"github.com/Alwanly/service-distribute-management/pkg/pubsub"
+)
+
+type fakeBootstrapToken struct {
+	token  string
+	record *models.BootstrapToken
+}
+
+// publishedUpdate is a config update notification recorded by fakeRepository
+type publishedUpdate struct {
+	AgentID       string
+	ETag          string
+	CorrelationID string
+}
+
+// publishedInterval is an interval update notification recorded by fakeRepository
+type publishedInterval struct {
+	AgentID         string
+	IntervalSeconds int
+}
+
+// fakeRepository is an in-memory repository.IRepository for usecase tests
+// that do not need SQLite. Config versions live in a configstore.MemoryStore.
+type fakeRepository struct {
+	mu         sync.Mutex
+	seq        int
+	agents     map[string]*models.AgentConfig
+	order      []string
+	heartbeats map[string]*models.Agent
+	history    []models.AgentHeartbeat
+	configs    *configstore.MemoryStore
+	tokens     []fakeBootstrapToken
+	idemKeys   []models.IdempotencyKey
+	events     []models.Event
+	updates    []publishedUpdate
+	intervals  []publishedInterval
+	debug      []models.DebugEvent
+	pub        pubsub.Publisher
+}
+
+var _ repository.IRepository = (*fakeRepository)(nil)
+
+func newFakeRepository() *fakeRepository {
+	return &fakeRepository{
+		agents:     make(map[string]*models.AgentConfig),
+		heartbeats: make(map[string]*models.Agent),
+		configs:    configstore.NewMemoryStore(),
+	}
+}
+
+func (f *fakeRepository) next(prefix string) string {
+	f.seq++
+	return fmt.Sprintf("%s-%d", prefix, f.seq)
+}
+
+func (f *fakeRepository) CreateAgent(agentName string, pollIntervalSeconds *int) (*models.AgentConfig, error) {
+	return f.CreateAgentWithMetadata(agentName, pollIntervalSeconds, nil)
+}
+
+func (f *fakeRepository) CreateAgentWithMetadata(agentName string, pollIntervalSeconds *int, metadata map[string]string) (*models.AgentConfig, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	agent := &models.AgentConfig{
+		ID:                  f.next("agent"),
+		AgentName:           agentName,
+		APIToken:            f.next("token"),
+		PollIntervalSeconds: pollIntervalSeconds,
+		Metadata:            metadata,
+		CreatedAt:           time.Now().UTC(),
+	}
+	f.agents[agent.ID] = agent
+	f.order = append(f.order, agent.ID)
+	copied := *agent
+	return &copied, nil
+}
+
+func (f *fakeRepository) GetAgentByID(agentID string) (*models.AgentConfig, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	agent, ok := f.agents[agentID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", repository.ErrAgentNotFound, agentID)
+	}
+	copied := *agent
+	return &copied, nil
+}
+
+func (f *fakeRepository) GetAgentsByIDs(ctx context.Context, agentIDs []string) ([]models.AgentConfig, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	agents := make([]models.AgentConfig, 0, len(agentIDs))
+	for _, id := range agentIDs {
+		if agent, ok := f.agents[id]; ok {
+			agents = append(agents, *agent)
+		}
+	}
+	return agents, nil
+}
+
+func (f *fakeRepository) UpdateAgentPollInterval(agentID string, intervalSeconds *int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	agent, ok := f.agents[agentID]
+	if !ok {
+		return fmt.Errorf("agent not found: %s", agentID)
+	}
+	agent.PollIntervalSeconds = intervalSeconds
+	return nil
+}
+
+func (f *fakeRepository) RotateAgentToken(agentID string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	agent, ok := f.agents[agentID]
+	if !ok {
+		return "", fmt.Errorf("agent not found: %s", agentID)
+	}
+	agent.APIToken = f.next("token")
+	agent.Revoked = false
+	agent.RevokedAt = nil
+	return agent.APIToken, nil
+}
+
+func (f *fakeRepository) RevokeAgentToken(agentID string) (*models.AgentConfig, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	agent, ok := f.agents[agentID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", repository.ErrAgentNotFound, agentID)
+	}
+	if !agent.Revoked {
+		now := time.Now().UTC()
+		agent.Revoked = true
+		agent.RevokedAt = &now
+	}
+	copied := *agent
+	return &copied, nil
+}
+
+func (f *fakeRepository) RefreshAgentToken(_ context.Context, agentID string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	agent, ok := f.agents[agentID]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", repository.ErrAgentNotFound, agentID)
+	}
+	if agent.Revoked {
+		return "", fmt.Errorf("%w: %s", repository.ErrAgentRevoked, agentID)
+	}
+	agent.APIToken = f.next("token")
+	return agent.APIToken, nil
+}
+
+func (f *fakeRepository) ListAgents() ([]models.AgentPublic, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	public := make([]models.AgentPublic, 0, len(f.order))
+	for i := len(f.order) - 1; i >= 0; i-- {
+		public = append(public, f.agents[f.order[i]].ToPublic())
+	}
+	return public, nil
+}
+
+func (f *fakeRepository) DeleteAgent(agentID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.agents[agentID]; !ok {
+		return fmt.Errorf("agent not found: %s", agentID)
+	}
+	delete(f.agents, agentID)
+	delete(f.heartbeats, agentID)
+	kept := f.history[:0]
+	for _, hb := range f.history {
+		if hb.AgentID != agentID {
+			kept = append(kept, hb)
+		}
+	}
+	f.history = kept
+	for i, id := range f.order {
+		if id == agentID {
+			f.order = append(f.order[:i], f.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeRepository) SetAgentProfile(agentID string, profile string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	agent, ok := f.agents[agentID]
+	if !ok {
+		return fmt.Errorf("%w: %s", repository.ErrAgentNotFound, agentID)
+	}
+	agent.Profile = profile
+	return nil
+}
+
+func (f *fakeRepository) SetAgentWorkerSchemaVersion(agentID string, version int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	agent, ok := f.agents[agentID]
+	if !ok {
+		return fmt.Errorf("%w: %s", repository.ErrAgentNotFound, agentID)
+	}
+	agent.WorkerSchemaVersion = version
+	return nil
+}
+
+func (f *fakeRepository) CreateBootstrapToken(ctx context.Context, maxUses int, expiresAt time.Time) (string, *models.BootstrapToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	token := f.next("bootstrap")
+	record := &models.BootstrapToken{
+		ID:        f.next("bootstrap-id"),
+		MaxUses:   maxUses,
+		ExpiresAt: expiresAt.UTC(),
+	}
+	f.tokens = append(f.tokens, fakeBootstrapToken{token: token, record: record})
+	return token, record, nil
+}
+
+func (f *fakeRepository) CheckBootstrapToken(ctx context.Context, token string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.usableBootstrapToken(token) == nil {
+		return repository.ErrBootstrapTokenInvalid
+	}
+	return nil
+}
+
+func (f *fakeRepository) CreateAgentWithBootstrapToken(ctx context.Context, token string, agentName string, metadata map[string]string) (*models.AgentConfig, error) {
+	f.mu.Lock()
+	record := f.usableBootstrapToken(token)
+	if record == nil {
+		f.mu.Unlock()
+		return nil, repository.ErrBootstrapTokenInvalid
+	}
+	record.Uses++
+	f.mu.Unlock()
+	return f.CreateAgentWithMetadata(agentName, nil, metadata)
+}
+
+// usableBootstrapToken returns the record of a token with uses left; the
+// caller holds mu
+func (f *fakeRepository) usableBootstrapToken(token string) *models.BootstrapToken {
+	for _, t := range f.tokens {
+		if t.token == token && t.record.Uses < t.record.MaxUses && t.record.ExpiresAt.After(time.Now().UTC()) {
+			return t.record
+		}
+	}
+	return nil
+}
+
+func (f *fakeRepository) GetIdempotencyKey(ctx context.Context, scope, key string, now time.Time) (*models.IdempotencyKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, k := range f.idemKeys {
+		if k.Scope == scope && k.Key == key && k.ExpiresAt.After(now) {
+			record := k
+			return &record, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeRepository) SaveIdempotencyKey(ctx context.Context, record *models.IdempotencyKey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now().UTC()
+	kept := f.idemKeys[:0]
+	for _, k := range f.idemKeys {
+		if k.ExpiresAt.After(now) {
+			kept = append(kept, k)
+		}
+	}
+	f.idemKeys = append(kept, *record)
+	return nil
+}
+
+func (f *fakeRepository) ConfigStore() configstore.ConfigStore {
+	return f.configs
+}
+
+func (f *fakeRepository) UpdateAgentHeartbeat(agentID string, configVersion string) (*models.Agent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	agent := f.saveHeartbeat(agentID, configVersion, time.Now().UTC())
+	copied := *agent
+	return &copied, nil
+}
+
+func (f *fakeRepository) saveHeartbeat(agentID string, configVersion string, at time.Time) *models.Agent {
+	agent, ok := f.heartbeats[agentID]
+	if !ok {
+		agent = &models.Agent{AgentID: agentID, CreatedAt: at}
+		f.heartbeats[agentID] = agent
+	}
+	agent.LastHeartbeat = &at
+	agent.LastConfigVersion = configVersion
+	agent.UpdatedAt = at
+	f.history = append(f.history, models.AgentHeartbeat{
+		ID:            int64(len(f.history) + 1),
+		AgentID:       agentID,
+		ConfigVersion: configVersion,
+		CreatedAt:     at,
+	})
+	return agent
+}
+
+func (f *fakeRepository) ListAgentHeartbeats(ctx context.Context, agentID string, limit, offset int) ([]models.AgentHeartbeat, int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var matching []models.AgentHeartbeat
+	for i := len(f.history) - 1; i >= 0; i-- {
+		if f.history[i].AgentID == agentID {
+			matching = append(matching, f.history[i])
+		}
+	}
+
+	total := int64(len(matching))
+	if offset >= len(matching) {
+		return []models.AgentHeartbeat{}, total, nil
+	}
+	matching = matching[offset:]
+	if limit < len(matching) {
+		matching = matching[:limit]
+	}
+	return matching, total, nil
+}
+
+func (f *fakeRepository) PruneAgentHeartbeats(ctx context.Context, before time.Time) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	kept := f.history[:0]
+	for _, hb := range f.history {
+		if !hb.CreatedAt.Before(before) {
+			kept = append(kept, hb)
+		}
+	}
+	pruned := int64(len(f.history) - len(kept))
+	f.history = kept
+	return pruned, nil
+}
+
+func (f *fakeRepository) UpdateAgentHeartbeatsBatch(ctx context.Context, entries []repository.HeartbeatEntry, checkToken bool) ([]error, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	results := make([]error, len(entries))
+	now := time.Now().UTC()
+	for i, entry := range entries {
+		agent, ok := f.agents[entry.AgentID]
+		switch {
+		case !ok:
+			results[i] = repository.ErrAgentNotFound
+		case checkToken && agent.APIToken != entry.APIToken:
+			results[i] = repository.ErrAgentUnauthorized
+		case checkToken && agent.Revoked:
+			results[i] = repository.ErrAgentRevoked
+		default:
+			f.saveHeartbeat(entry.AgentID, entry.ConfigVersion, now)
+			at := entry.LastErrorAt
+			if entry.LastError == "" {
+				at = nil
+			} else if at == nil {
+				at = &now
+			}
+			agent.LastError = entry.LastError
+			agent.LastErrorAt = at
+		}
+	}
+	return results, nil
+}
+
+func (f *fakeRepository) UpdateAgentLastError(agentID string, lastError string, at *time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	agent, ok := f.agents[agentID]
+	if !ok {
+		return nil
+	}
+	if lastError == "" {
+		at = nil
+	} else if at == nil {
+		now := time.Now().UTC()
+		at = &now
+	}
+	agent.LastError = lastError
+	agent.LastErrorAt = at
+	return nil
+}
+
+func (f *fakeRepository) GetAgentLastHeartbeat(agentID string) (*time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if agent, ok := f.heartbeats[agentID]; ok {
+		return agent.LastHeartbeat, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeRepository) GetAgentConfigVersion(ctx context.Context, agentID string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if agent, ok := f.heartbeats[agentID]; ok {
+		return agent.LastConfigVersion, nil
+	}
+	return "", nil
+}
+
+func (f *fakeRepository) GetAgentConfigVersions(ctx context.Context, agentIDs []string) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	versions := make(map[string]string, len(agentIDs))
+	for _, id := range agentIDs {
+		if agent, ok := f.heartbeats[id]; ok {
+			versions[id] = agent.LastConfigVersion
+		}
+	}
+	return versions, nil
+}
+
+func (f *fakeRepository) CountAgentsByConfigVersion(ctx context.Context) ([]repository.ConfigVersionCount, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	byETag := make(map[string]int64)
+	for _, id := range f.order {
+		etag := ""
+		if hb, ok := f.heartbeats[id]; ok {
+			etag = hb.LastConfigVersion
+		}
+		byETag[etag]++
+	}
+
+	counts := make([]repository.ConfigVersionCount, 0, len(byETag))
+	for etag, n := range byETag {
+		counts = append(counts, repository.ConfigVersionCount{ETag: etag, Agents: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Agents != counts[j].Agents {
+			return counts[i].Agents > counts[j].Agents
+		}
+		return counts[i].ETag < counts[j].ETag
+	})
+	return counts, nil
+}
+
+func (f *fakeRepository) ListAgentConfigVersions(ctx context.Context) ([]repository.AgentConfigVersion, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	agents := make([]repository.AgentConfigVersion, 0, len(f.order))
+	for _, id := range f.order {
+		agent := f.agents[id]
+		v := repository.AgentConfigVersion{
+			AgentID:             id,
+			AgentName:           agent.AgentName,
+			Profile:             agent.Profile,
+			Metadata:            agent.Metadata,
+			WorkerSchemaVersion: agent.WorkerSchemaVersion,
+		}
+		if hb, ok := f.heartbeats[id]; ok {
+			v.ConfigVersion = hb.LastConfigVersion
+			v.LastHeartbeat = hb.LastHeartbeat
+		}
+		agents = append(agents, v)
+	}
+	return agents, nil
+}
+
+func (f *fakeRepository) GroupAgentConfigVersions(ctx context.Context, lateBefore, offlineBefore time.Time) ([]repository.AgentConfigGroup, error) {
+	agents, _ := f.ListAgentConfigVersions(ctx)
+
+	byKey := make(map[string]int)
+	groups := []repository.AgentConfigGroup{}
+	for _, a := range agents {
+		key := agentGroupKey(a.Profile, a.Metadata, a.WorkerSchemaVersion, a.ConfigVersion)
+		i, ok := byKey[key]
+		if !ok {
+			i = len(groups)
+			byKey[key] = i
+			groups = append(groups, repository.AgentConfigGroup{
+				Profile:             a.Profile,
+				Metadata:            a.Metadata,
+				WorkerSchemaVersion: a.WorkerSchemaVersion,
+				ConfigVersion:       a.ConfigVersion,
+			})
+		}
+		g := &groups[i]
+		g.Agents++
+		switch {
+		case a.LastHeartbeat == nil || a.LastHeartbeat.Before(offlineBefore):
+			g.Offline++
+		case a.LastHeartbeat.Before(lateBefore):
+			g.Stale++
+		default:
+			g.Online++
+		}
+	}
+	return groups, nil
+}
+
+func (f *fakeRepository) RecordEvent(ctx context.Context, event *models.Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	event.ID = int64(len(f.events) + 1)
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+	f.events = append(f.events, *event)
+	return nil
+}
+
+func (f *fakeRepository) ListEvents(ctx context.Context, eventType string, limit, offset int) ([]models.Event, int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var matching []models.Event
+	for i := len(f.events) - 1; i >= 0; i-- {
+		if eventType == "" || f.events[i].Type == eventType {
+			matching = append(matching, f.events[i])
+		}
+	}
+
+	total := int64(len(matching))
+	if offset >= len(matching) {
+		return []models.Event{}, total, nil
+	}
+	matching = matching[offset:]
+	if limit < len(matching) {
+		matching = matching[:limit]
+	}
+	return matching, total, nil
+}
+
+func (f *fakeRepository) Publisher() pubsub.Publisher {
+	return f.pub
+}
+
+func (f *fakeRepository) ClaimConfigPublish(ctx context.Context, agentID, etag, correlationID string) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeRepository) ClaimDistributionTest(ctx context.Context, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeRepository) ReleaseDistributionTest(ctx context.Context) error {
+	return nil
+}
+
+func (f *fakeRepository) PublishConfigUpdate(_ context.Context, agentID string, etag string, correlationID string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.updates = append(f.updates, publishedUpdate{AgentID: agentID, ETag: etag, CorrelationID: correlationID})
+	return 1, nil
+}
+
+func (f *fakeRepository) PublishIntervalUpdate(agentID string, intervalSeconds int, correlationID string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.intervals = append(f.intervals, publishedInterval{AgentID: agentID, IntervalSeconds: intervalSeconds})
+	return 1, nil
+}
+
+func (f *fakeRepository) PublishDebugEvent(event *models.DebugEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.debug = append(f.debug, *event)
+	return nil
+}
+
+// published returns the config update notifications recorded so far
+func (f *fakeRepository) published() []publishedUpdate {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]publishedUpdate(nil), f.updates...)
+}
@@ -0,0 +1,72 @@
+package usecase
+
+import (
+	"sync"
+	"time"
+)
+
+// fetchQuota limits how many config fetches an agent may make within one of
+// its poll intervals. It keeps the most recent fetch times per agent in memory.
+type fetchQuota struct {
+	limit   int
+	mutex   sync.Mutex
+	fetches map[string][]time.Time
+	now     func() time.Time
+}
+
+func newFetchQuota(limit int) *fetchQuota {
+	return &fetchQuota{
+		limit:   limit,
+		fetches: make(map[string][]time.Time),
+		now:     time.Now,
+	}
+}
+
+// allow records a fetch for agentID when it fits in the quota. Otherwise it
+// returns false and how long until the oldest fetch in the window expires.
+func (q *fetchQuota) allow(agentID string, interval time.Duration) (bool, time.Duration) {
+	if q == nil || interval <= 0 {
+		return true, 0
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.limit <= 0 {
+		return true, 0
+	}
+
+	now := q.now()
+	windowStart := now.Add(-interval)
+
+	recent := q.fetches[agentID][:0]
+	for _, t := range q.fetches[agentID] {
+		if t.After(windowStart) {
+			recent = append(recent, t)
+		}
+	}
+
+	if len(recent) >= q.limit {
+		q.fetches[agentID] = recent
+		return false, recent[0].Sub(windowStart)
+	}
+
+	q.fetches[agentID] = append(recent, now)
+	return true, 0
+}
+
+// setLimit changes the quota; fetches already recorded still count
+func (q *fetchQuota) setLimit(limit int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.limit = limit
+}
+
+// forget drops the fetch history of an agent
+func (q *fetchQuota) forget(agentID string) {
+	if q == nil {
+		return
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	delete(q.fetches, agentID)
+}
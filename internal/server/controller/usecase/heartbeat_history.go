@@ -0,0 +1,84 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Alwanly/service-distribute-management/internal/server/controller/dto"
+	"github.com/Alwanly/service-distribute-management/internal/server/controller/repository"
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+	"github.com/Alwanly/service-distribute-management/pkg/wrapper"
+)
+
+const (
+	defaultHeartbeatHistoryLimit     = 50
+	defaultHeartbeatHistoryRetention = 7 * 24 * time.Hour
+	// heartbeatPruneInterval is how often heartbeats trigger pruning of the
+	// history, so a busy fleet does not delete on every heartbeat
+	heartbeatPruneInterval = time.Minute
+)
+
+// heartbeatHistoryRetention is how long heartbeat history is kept
+func (uc *UseCase) heartbeatHistoryRetention() time.Duration {
+	cfg := uc.CurrentConfig()
+	if cfg == nil || cfg.HeartbeatHistoryRetention <= 0 {
+		return defaultHeartbeatHistoryRetention
+	}
+	return cfg.HeartbeatHistoryRetention
+}
+
+// pruneHeartbeatHistory deletes history older than the retention period, at
+// most once per heartbeatPruneInterval. Failures are logged; the heartbeat
+// that triggered pruning still succeeds.
+func (uc *UseCase) pruneHeartbeatHistory(ctx context.Context, now time.Time) {
+	last := uc.heartbeatPrunedAt.Load()
+	if now.UnixNano()-last < int64(heartbeatPruneInterval) || !uc.heartbeatPrunedAt.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+
+	pruned, err := uc.Repo.PruneAgentHeartbeats(ctx, now.Add(-uc.heartbeatHistoryRetention()))
+	if err != nil {
+		uc.Logger.Error("failed to prune heartbeat history", zap.Error(err))
+		return
+	}
+	if pruned > 0 {
+		uc.Logger.Info("pruned heartbeat history", zap.Int64("heartbeats", pruned))
+	}
+}
+
+// ListAgentHeartbeats returns a page of an agent's heartbeat history, newest
+// first
+func (uc *UseCase) ListAgentHeartbeats(ctx context.Context, agentID string, req *dto.ListAgentHeartbeatsRequest) wrapper.JSONResult {
+	if _, err := uc.Repo.GetAgentByID(agentID); err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		if errors.Is(err, repository.ErrAgentNotFound) {
+			return wrapper.ResponseNotFound("agent not found")
+		}
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to get agent", err)
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultHeartbeatHistoryLimit
+	}
+
+	heartbeats, total, err := uc.Repo.ListAgentHeartbeats(ctx, agentID, limit, req.Offset)
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to list heartbeats", err)
+	}
+
+	logger.AddToContext(ctx, zap.String("agent_id", agentID), zap.Int64("total", total), zap.Bool(logger.FieldSuccess, true))
+	return wrapper.ResponseSuccess(http.StatusOK, dto.ListAgentHeartbeatsResponse{
+		AgentID:          agentID,
+		Heartbeats:       heartbeats,
+		Total:            total,
+		Limit:            limit,
+		Offset:           req.Offset,
+		RetentionSeconds: int(uc.heartbeatHistoryRetention() / time.Second),
+	})
+}
@@ -0,0 +1,84 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Alwanly/service-distribute-management/internal/models"
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+	"github.com/Alwanly/service-distribute-management/pkg/wrapper"
+)
+
+// maxIdempotencyKeyLength bounds an Idempotency-Key header
+const maxIdempotencyKeyLength = 255
+
+// Idempotent runs op, the mutation for a request to scope with body, at
+// most once per key within IDEMPOTENCY_KEY_TTL. A repeat of the key with
+// the same body gets the stored response and replayed is true; a repeat
+// with a different body is refused with 422. Only successful results are
+// stored, so a failed request can be retried with the same key. An empty
+// key or a zero TTL runs op unconditionally.
+func (uc *UseCase) Idempotent(ctx context.Context, scope, key string, body []byte, op func() wrapper.JSONResult) (res wrapper.JSONResult, replayed bool) {
+	var ttl time.Duration
+	if cfg := uc.CurrentConfig(); cfg != nil {
+		ttl = cfg.IdempotencyKeyTTL
+	}
+	if key == "" || ttl <= 0 {
+		return op(), false
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return wrapper.ResponseBadRequest(fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength)), false
+	}
+
+	uc.idempotencyKeys.Lock()
+	defer uc.idempotencyKeys.Unlock()
+
+	sum := sha256.Sum256(body)
+	requestHash := hex.EncodeToString(sum[:])
+	now := time.Now().UTC()
+	stored, err := uc.Repo.GetIdempotencyKey(ctx, scope, key, now)
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to check idempotency key", nil), false
+	}
+	if stored != nil {
+		if stored.RequestHash != requestHash {
+			logger.AddToContext(ctx, zap.String("idempotency_key", key), zap.Bool(logger.FieldSuccess, false))
+			return wrapper.ResponseFailed(http.StatusUnprocessableEntity,
+				"Idempotency-Key was already used for a different request", nil), false
+		}
+		logger.AddToContext(ctx, zap.String("idempotency_key", key), zap.Bool("idempotent_replay", true))
+		return wrapper.ResponseSuccess(stored.StatusCode, json.RawMessage(stored.Response)), true
+	}
+
+	res = op()
+	if !res.Success {
+		return res, false
+	}
+	response, err := json.Marshal(res.Data)
+	if err != nil {
+		uc.Logger.Error("failed to encode idempotent response", zap.String("idempotency_key", key), zap.Error(err))
+		return res, false
+	}
+	// The mutation already happened, so failing to remember it only costs
+	// a retry its replay
+	record := &models.IdempotencyKey{
+		Scope:       scope,
+		Key:         key,
+		RequestHash: requestHash,
+		StatusCode:  res.Code,
+		Response:    string(response),
+		ExpiresAt:   now.Add(ttl),
+	}
+	if err := uc.Repo.SaveIdempotencyKey(ctx, record); err != nil {
+		uc.Logger.Error("failed to save idempotency key", zap.String("idempotency_key", key), zap.Error(err))
+	}
+	return res, false
+}
@@ -0,0 +1,163 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+	"github.com/Alwanly/service-distribute-management/pkg/tracing"
+)
+
+// errPublishClaimed is returned for a config change another replica is
+// already publishing
+var errPublishClaimed = errors.New("config update claimed by another replica")
+
+// claimTimeout bounds the wait for the publish claim
+const claimTimeout = 2 * time.Second
+
+// publishConfigChange publishes the notification for a config change unless
+// another replica sharing the Redis already claimed it for the same request. When the claim
+// cannot be checked it publishes anyway: a duplicate notification only costs
+// agents a 304 poll, a missed one leaves them on the old config.
+func (uc *UseCase) publishConfigChange(ctx context.Context, agentID, etag, correlationID string) (int64, error) {
+	claimCtx, cancel := context.WithTimeout(ctx, claimTimeout)
+	claimed, err := uc.Repo.ClaimConfigPublish(claimCtx, agentID, etag, correlationID)
+	cancel()
+	if err != nil {
+		uc.Logger.WithError(err).Warn("could not claim config update publish; publishing anyway",
+			zap.String("etag", etag),
+			zap.String("correlation_id", correlationID),
+		)
+	} else if !claimed {
+		return 0, errPublishClaimed
+	}
+	return uc.Repo.PublishConfigUpdate(ctx, agentID, etag, correlationID)
+}
+
+// notifyQueueSize bounds config update notifications waiting to be published
+const notifyQueueSize = 64
+
+type configNotification struct {
+	agentID       string
+	etag          string
+	correlationID string
+	// span is the request span that changed the config; the publish is
+	// traced as its child
+	span trace.SpanContext
+}
+
+// configNotifier publishes config update notifications in the background so
+// admin requests return as soon as the config is stored. A single goroutine
+// drains the queue, keeping notifications in the order they were queued,
+// until close stops it.
+type configNotifier struct {
+	publish func(ctx context.Context, agentID, etag, correlationID string) (int64, error)
+	log     *logger.CanonicalLogger
+
+	once  sync.Once
+	queue chan configNotification
+	done  chan struct{}
+
+	// mutex guards closed so no notification is sent on a closed queue
+	mutex  sync.Mutex
+	closed bool
+}
+
+func newConfigNotifier(publish func(ctx context.Context, agentID, etag, correlationID string) (int64, error), log *logger.CanonicalLogger) *configNotifier {
+	return &configNotifier{
+		publish: publish,
+		log:     log,
+		queue:   make(chan configNotification, notifyQueueSize),
+		done:    make(chan struct{}),
+	}
+}
+
+// enqueue schedules a notification without waiting for it to be published.
+// When the queue is full the notification is dropped; agents still pick the
+// config up on their next poll.
+func (n *configNotifier) enqueue(ctx context.Context, agentID, etag, correlationID string) {
+	n.once.Do(func() { go n.run() })
+
+	msg := configNotification{agentID: agentID, etag: etag, correlationID: correlationID, span: trace.SpanContextFromContext(ctx)}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.closed {
+		n.log.Warn("config update notifier stopped; dropping notification",
+			zap.String("etag", etag),
+			zap.String("correlation_id", correlationID),
+		)
+		return
+	}
+	select {
+	case n.queue <- msg:
+	default:
+		n.log.Error("config update notification queue full; dropping notification",
+			zap.String("etag", etag),
+			zap.String("correlation_id", correlationID),
+		)
+	}
+}
+
+// close stops accepting notifications and waits until the queued ones are
+// published or ctx is done
+func (n *configNotifier) close(ctx context.Context) error {
+	n.once.Do(func() { go n.run() })
+
+	n.mutex.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.queue)
+	}
+	pending := len(n.queue)
+	n.mutex.Unlock()
+
+	select {
+	case <-n.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("config update notifications not drained, %d were queued: %w", pending, ctx.Err())
+	}
+}
+
+func (n *configNotifier) run() {
+	defer close(n.done)
+	for msg := range n.queue {
+		n.publishOne(msg)
+	}
+}
+
+func (n *configNotifier) publishOne(msg configNotification) {
+	ctx, span := tracing.Start(trace.ContextWithSpanContext(context.Background(), msg.span), "config.publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String(logger.FieldETag, msg.etag), attribute.String(logger.FieldCorrelationID, msg.correlationID)))
+	defer span.End()
+
+	receivers, err := n.publish(ctx, msg.agentID, msg.etag, msg.correlationID)
+	if errors.Is(err, errPublishClaimed) {
+		span.SetAttributes(attribute.Bool("claimed_elsewhere", true))
+		n.log.Debug("config update published by another replica",
+			zap.String("correlation_id", msg.correlationID),
+			zap.String("etag", msg.etag),
+		)
+		return
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		n.log.WithError(err).Error("failed to publish config update", zap.String("correlation_id", msg.correlationID))
+		return
+	}
+	span.SetAttributes(attribute.Int64("subscribers", receivers))
+	n.log.Info("config update published",
+		zap.String("correlation_id", msg.correlationID),
+		zap.String("etag", msg.etag),
+		zap.Int64("subscribers", receivers),
+	)
+}
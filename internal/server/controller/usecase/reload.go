@@ -0,0 +1,54 @@
+package usecase
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+
+	"github.com/Alwanly/service-distribute-management/internal/config"
+)
+
+// WatchReload reloads the configuration on SIGHUP until ctx is done, then
+// hands the applied config to onReload for the settings held outside the
+// usecase, such as the Basic Auth credentials. A config that fails to load
+// or validate is logged and the running one stays in effect.
+func (uc *UseCase) WatchReload(ctx context.Context, onReload func(*config.ControllerConfig)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+
+		next, err := config.LoadControllerConfig()
+		if err == nil {
+			err = next.Validate()
+		}
+		if err != nil {
+			uc.Logger.Error("configuration reload failed, keeping the running configuration", zap.Error(err))
+			continue
+		}
+
+		next, restart := uc.CurrentConfig().Reloaded(next)
+		for _, key := range restart {
+			uc.Logger.Warn("setting changed but needs a restart to take effect", zap.String("key", key))
+		}
+		uc.ReloadConfig(next)
+		if onReload != nil {
+			onReload(next)
+		}
+		live := uc.CurrentConfig()
+		uc.Logger.Info("configuration reloaded",
+			zap.Duration("poll_interval", live.PollInterval),
+			zap.Int("fetch_quota_per_interval", live.FetchQuotaPerInterval),
+			zap.Bool("debug_events", live.DebugEvents),
+		)
+	}
+}
@@ -0,0 +1,124 @@
+package usecase
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Alwanly/service-distribute-management/internal/server/controller/dto"
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+	"github.com/Alwanly/service-distribute-management/pkg/pubsub"
+	"github.com/Alwanly/service-distribute-management/pkg/wrapper"
+)
+
+// defaultAgentOfflineAfter is used when the config leaves AgentOfflineAfter unset
+const defaultAgentOfflineAfter = 5 * time.Minute
+
+// GetFleetSummary aggregates agent liveness, config rollout and push
+// notification health into a single fleet overview
+func (uc *UseCase) GetFleetSummary(ctx context.Context) wrapper.JSONResult {
+	now := time.Now().UTC()
+	response := dto.FleetSummaryResponse{GeneratedAt: now}
+
+	latest, err := uc.Configs.LatestETag(ctx, "")
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to get latest config version", err)
+	}
+	response.LatestETag = latest
+	if latest != "" {
+		version, err := uc.Configs.Get(ctx, latest)
+		if err != nil {
+			logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+			return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to get latest config version", err)
+		}
+		if version != nil {
+			createdAt := version.CreatedAt
+			age := int64(now.Sub(createdAt).Seconds())
+			response.LatestConfigAt = &createdAt
+			response.LatestConfigAgeSeconds = &age
+		}
+	}
+
+	// Agents sharing a profile, metadata, worker schema and reported version
+	// are served the same version, so each group is resolved once
+	lateAfter, offlineAfter := uc.heartbeatLateAfter(), uc.agentOfflineAfter()
+	groups, err := uc.Repo.GroupAgentConfigVersions(ctx, now.Add(-lateAfter), now.Add(-offlineAfter))
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to list agents", err)
+	}
+
+	response.Lag = newLagHistogram()
+	resolver := uc.newConfigResolver()
+	for _, g := range groups {
+		response.TotalAgents += g.Agents
+		response.Online += g.Online
+		response.Stale += g.Stale
+		response.Offline += g.Offline
+
+		// Same comparison as the distribution report: profiles and match
+		// rules mean the expected version differs per agent
+		expected, name, err := resolver.served(ctx, g.Profile, g.Metadata, g.WorkerSchemaVersion)
+		if err != nil {
+			logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+			return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to get config distribution", err)
+		}
+		if g.ConfigVersion == expected {
+			response.UpToDate += g.Agents
+		} else {
+			response.Lagging += g.Agents
+		}
+
+		lag, err := resolver.lag(ctx, name, g.ConfigVersion, expected, now)
+		if err != nil {
+			logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+			return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to get config lag", err)
+		}
+		observeLag(&response.Lag, lag, g.Agents)
+	}
+
+	response.Push = uc.pushStatus(ctx)
+
+	logger.AddToContext(ctx,
+		zap.Int("total_agents", response.TotalAgents),
+		zap.Int("offline_agents", response.Offline),
+		zap.Int("lagging_agents", response.Lagging),
+		zap.Bool(logger.FieldSuccess, true),
+	)
+	return wrapper.ResponseSuccess(http.StatusOK, response)
+}
+
+// pushStatus pings Redis when the publisher supports it. A publisher that
+// cannot be pinged is reported healthy since there is nothing to check.
+func (uc *UseCase) pushStatus(ctx context.Context) dto.PushStatus {
+	pub := uc.Repo.Publisher()
+	if pub == nil {
+		return dto.PushStatus{}
+	}
+
+	status := dto.PushStatus{Configured: true, Healthy: true}
+	if pinger, ok := pub.(pubsub.Pinger); ok {
+		pingCtx, cancel := context.WithTimeout(ctx, redisPingTimeout)
+		defer cancel()
+		if err := pinger.Ping(pingCtx); err != nil {
+			status.Healthy = false
+			status.Error = err.Error()
+		}
+	}
+	return status
+}
+
+func (uc *UseCase) agentOfflineAfter() time.Duration {
+	offlineAfter := defaultAgentOfflineAfter
+	if cfg := uc.CurrentConfig(); cfg != nil && cfg.AgentOfflineAfter > 0 {
+		offlineAfter = cfg.AgentOfflineAfter
+	}
+	// An agent is late before it is offline, never the other way round
+	if lateAfter := uc.heartbeatLateAfter(); offlineAfter < lateAfter {
+		return lateAfter
+	}
+	return offlineAfter
+}
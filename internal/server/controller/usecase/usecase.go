@@ -3,46 +3,138 @@ package usecase
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
 	"net/http"
+	"regexp"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/google/uuid"
-
 	"github.com/Alwanly/service-distribute-management/internal/config"
+	"github.com/Alwanly/service-distribute-management/internal/models"
+	"github.com/Alwanly/service-distribute-management/internal/server/controller/configstore"
 	"github.com/Alwanly/service-distribute-management/internal/server/controller/dto"
 	"github.com/Alwanly/service-distribute-management/internal/server/controller/repository"
 	"github.com/Alwanly/service-distribute-management/pkg/logger"
+	"github.com/Alwanly/service-distribute-management/pkg/mergepatch"
+	"github.com/Alwanly/service-distribute-management/pkg/pubsub"
+	"github.com/Alwanly/service-distribute-management/pkg/validator"
 	"github.com/Alwanly/service-distribute-management/pkg/wrapper"
 	"go.uber.org/zap"
 )
 
 type UseCase struct {
-	Repo   *repository.Repository
+	Repo repository.IRepository
+	// Configs stores the config versions; NewUseCase defaults it to the
+	// repository's store
+	Configs configstore.ConfigStore
+	// Config is the configuration the usecase starts with; read the live
+	// one through CurrentConfig since ReloadConfig may replace it
 	Config *config.ControllerConfig
 	Logger *logger.CanonicalLogger
+
+	live       *atomic.Pointer[config.ControllerConfig]
+	fetchQuota *fetchQuota
+	notifier   *configNotifier
+	// idempotencyKeys serializes mutations sent with an Idempotency-Key so a
+	// retry racing the original waits for its result; see Idempotent
+	idempotencyKeys *sync.Mutex
+	// distributionTest is held while RunDistributionTest waits for agents
+	distributionTest *sync.Mutex
+	// heartbeatPrunedAt is when heartbeat history was last pruned, in Unix
+	// nanoseconds
+	heartbeatPrunedAt *atomic.Int64
+	// pollOverride is the default poll interval set through
+	// SetDefaultPollInterval in nanoseconds, or 0; ReloadConfig keeps it
+	// over the reloaded value
+	pollOverride *atomic.Int64
 }
 
 func NewUseCase(uc UseCase) *UseCase {
-	return &UseCase{
-		Repo:   uc.Repo,
-		Config: uc.Config,
-		Logger: uc.Logger,
+	u := &UseCase{
+		Repo:       uc.Repo,
+		Configs:    uc.Configs,
+		Config:     uc.Config,
+		Logger:     uc.Logger,
+		live:       new(atomic.Pointer[config.ControllerConfig]),
+		fetchQuota: newFetchQuota(uc.Config.FetchQuotaPerInterval),
+
+		idempotencyKeys:   new(sync.Mutex),
+		distributionTest:  new(sync.Mutex),
+		heartbeatPrunedAt: new(atomic.Int64),
+		pollOverride:      new(atomic.Int64),
 	}
+	if u.Configs == nil {
+		u.Configs = uc.Repo.ConfigStore()
+	}
+	u.live.Store(uc.Config)
+	u.notifier = newConfigNotifier(u.publishConfigChange, uc.Logger)
+	return u
+}
+
+// CurrentConfig returns the live configuration
+func (uc *UseCase) CurrentConfig() *config.ControllerConfig {
+	return uc.live.Load()
+}
+
+// DrainNotifications publishes the config update notifications still queued
+// and stops the notifier; later config changes are not pushed, so agents pick
+// them up on their next poll. Call it once the HTTP server stopped accepting
+// requests and before the database and Redis are closed.
+func (uc *UseCase) DrainNotifications(ctx context.Context) error {
+	return uc.notifier.close(ctx)
+}
+
+// ReloadConfig swaps in a new configuration. Everything read per request
+// picks it up: the default poll interval and jitter, the fetch quota, debug
+// events, heartbeat thresholds and the config size limit. A default poll
+// interval set through SetDefaultPollInterval outlives the reload, so the
+// reloaded POLL_INTERVAL only applies after a restart in that case.
+func (uc *UseCase) ReloadConfig(next *config.ControllerConfig) {
+	for {
+		cur := uc.live.Load()
+		merged := *next
+		if override := uc.pollOverride.Load(); override != 0 {
+			merged.PollInterval = time.Duration(override)
+		}
+		if uc.live.CompareAndSwap(cur, &merged) {
+			break
+		}
+	}
+	uc.fetchQuota.setLimit(next.FetchQuotaPerInterval)
 }
 
 func (uc *UseCase) RegisterAgent(ctx context.Context, req *dto.RegisterAgentRequest) wrapper.JSONResult {
-	defaultInterval := int(uc.Config.PollInterval.Seconds())
-	agent, err := uc.Repo.CreateAgent(req.Hostname, &defaultInterval)
+	// No per-agent override is stored so the agent keeps following the global
+	// default (and its jitter band) until an admin sets one explicitly.
+	var agent *models.AgentConfig
+	var err error
+	if req.BootstrapToken != "" {
+		// The token's use is spent only if the agent is created
+		agent, err = uc.Repo.CreateAgentWithBootstrapToken(ctx, req.BootstrapToken, req.Hostname, req.Metadata)
+	} else {
+		agent, err = uc.Repo.CreateAgentWithMetadata(req.Hostname, nil, req.Metadata)
+	}
+	if errors.Is(err, repository.ErrBootstrapTokenInvalid) {
+		// Used up by a concurrent registration since the middleware checked it
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseUnauthorized("invalid or expired bootstrap token")
+	}
 	if err != nil {
 		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
 		return wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to create agent", err)
 	}
+	defaultInterval := uc.defaultPollInterval(agent.ID)
 
 	uc.Logger.Info("agent registered successfully",
 		zap.String("agent_id", agent.ID),
 		zap.String("agent_name", agent.AgentName),
 		zap.Int("poll_interval_seconds", defaultInterval),
 	)
+	uc.recordEvent(ctx, models.EventAgentRegistered, agent.ID, "hostname "+agent.AgentName)
 
 	response := dto.RegisterAgentResponse{
 		AgentID:             agent.ID,
@@ -56,9 +148,15 @@ func (uc *UseCase) RegisterAgent(ctx context.Context, req *dto.RegisterAgentRequ
 }
 
 func (uc *UseCase) UpdateConfig(ctx context.Context, req *dto.SetConfigAgentRequest) wrapper.JSONResult {
-	correlationID := uuid.New().String()
+	_, correlationID := logger.EnsureCorrelationID(ctx)
 
-	logger.AddToContext(ctx, zap.String("correlation_id", correlationID))
+	logger.AddToContext(ctx, zap.String(logger.FieldCorrelationID, correlationID))
+
+	// Reject anything the worker would refuse at ReceiveConfig time
+	if err := req.ConfigData().Validate(); err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseBadRequest(err.Error())
+	}
 
 	config, err := json.Marshal(req)
 	if err != nil {
@@ -66,29 +164,177 @@ func (uc *UseCase) UpdateConfig(ctx context.Context, req *dto.SetConfigAgentRequ
 		return wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to marshal config data", err)
 	}
 
-	err = uc.Repo.UpdateConfig(ctx, string(config))
+	if uc.configTooLarge(config) {
+		logger.AddToContext(ctx, zap.Int("config_bytes", len(config)), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("config is %d bytes, the limit is %d", len(config), uc.CurrentConfig().MaxConfigBytes), nil)
+	}
+
+	// A push identical to the latest version (e.g. the same config submitted
+	// by two admins at once, possibly to different replicas) is accepted
+	// without a new version or publish; the store makes the check atomic
+	etag, stored, err := uc.Configs.PutIfChanged(ctx, "", string(config))
 	if err != nil {
 		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
 		return wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to update config", err)
 	}
+	if !stored {
+		logger.AddToContext(ctx, zap.String(logger.FieldETag, etag), zap.Bool("no_change", true), zap.Bool(logger.FieldSuccess, true))
+		return wrapper.ResponseSuccess(http.StatusOK, dto.SetConfigAgentResponse{
+			Message:  "Config unchanged",
+			ETag:     etag,
+			NoChange: true,
+		})
+	}
 
-	// Publish notification to Redis (best-effort) with correlation ID
-	if etag, gerr := uc.Repo.GetConfigETag(ctx); gerr == nil {
-		if perr := uc.Repo.PublishConfigUpdate("", etag, correlationID); perr != nil {
-			uc.Logger.WithError(perr).Error("failed to publish config update", zap.String("correlation_id", correlationID))
-		} else {
-			uc.Logger.Info("config update published", zap.String("correlation_id", correlationID), zap.String("etag", etag))
+	// Publish notification to Redis (best-effort, in the background) with correlation ID
+	uc.recordEvent(ctx, models.EventConfigChanged, "", "etag "+etag)
+	uc.notifier.enqueue(ctx, "", etag, correlationID)
+
+	logger.AddToContext(ctx, zap.String(logger.FieldETag, etag), zap.Bool(logger.FieldSuccess, true))
+	return wrapper.ResponseSuccess(http.StatusOK, dto.SetConfigAgentResponse{Message: "Config updated successfully", ETag: etag})
+}
+
+// ReplayConfigNotification re-publishes the update notification for the
+// current config without storing a new version, so agents that missed the
+// original push (e.g. while Redis was down) fetch it now
+func (uc *UseCase) ReplayConfigNotification(ctx context.Context) wrapper.JSONResult {
+	if uc.Repo.Publisher() == nil {
+		logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, false), zap.String("result", "pubsub_not_configured"))
+		return wrapper.ResponseFailed(http.StatusServiceUnavailable, "push notifications are not configured", nil)
+	}
+
+	etag, err := uc.Configs.LatestETag(ctx, "")
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to get config", err)
+	}
+	if etag == "" {
+		logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseNotFound("no configuration to replay")
+	}
+
+	_, correlationID := logger.EnsureCorrelationID(ctx)
+	receivers, err := uc.Repo.PublishConfigUpdate(ctx, "", etag, correlationID)
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusBadGateway, "failed to publish config update", nil)
+	}
+
+	logger.AddToContext(ctx,
+		zap.String(logger.FieldETag, etag),
+		zap.String(logger.FieldCorrelationID, correlationID),
+		zap.Int64("subscribers", receivers),
+		zap.Bool(logger.FieldSuccess, true),
+	)
+	return wrapper.ResponseSuccess(http.StatusOK, dto.ReplayConfigResponse{
+		ETag:          etag,
+		CorrelationID: correlationID,
+		Subscribers:   receivers,
+	})
+}
+
+// redisPingTimeout bounds each step of PingRedis
+const redisPingTimeout = 2 * time.Second
+
+// redisPingChannel receives the test publish; nothing subscribes to it
+const redisPingChannel = pubsub.ConfigUpdatesChannel + "-ping"
+
+// PingRedis checks the controller's Redis connection with a live ping and a
+// test publish to a throwaway channel, reporting the latency of each
+func (uc *UseCase) PingRedis(ctx context.Context) wrapper.JSONResult {
+	if uc.Repo.Publisher() == nil {
+		logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, false), zap.String("result", "pubsub_not_configured"))
+		return wrapper.ResponseFailed(http.StatusServiceUnavailable, "redis is not configured", dto.RedisPingResponse{
+			Configured: false,
+			Error:      "redis is not configured; the controller is running in poll-only mode",
+		})
+	}
+
+	resp := dto.RedisPingResponse{Configured: true}
+	failed := func(stage string, err error) wrapper.JSONResult {
+		resp.Stage = stage
+		resp.Error = err.Error()
+		logger.AddToContext(ctx, zap.Error(err), zap.String("stage", stage), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusBadGateway, "redis "+stage+" failed", resp)
+	}
+
+	if pinger, ok := uc.Repo.Publisher().(pubsub.Pinger); ok {
+		pingCtx, cancel := context.WithTimeout(ctx, redisPingTimeout)
+		start := time.Now()
+		err := pinger.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			return failed("ping", err)
 		}
-	} else {
-		uc.Logger.WithError(gerr).Error("failed to get config ETag after update", zap.String("correlation_id", correlationID))
+		ms := float64(time.Since(start).Microseconds()) / 1000
+		resp.PingMs = &ms
 	}
 
-	logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, true))
-	return wrapper.ResponseSuccess(http.StatusOK, "Config updated successfully")
+	publishCtx, cancel := context.WithTimeout(ctx, redisPingTimeout)
+	defer cancel()
+	start := time.Now()
+	receivers, err := uc.Repo.Publisher().Publish(publishCtx, redisPingChannel, time.Now().UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return failed("publish", err)
+	}
+	ms := float64(time.Since(start).Microseconds()) / 1000
+	resp.PublishMs = &ms
+	resp.Subscribers = receivers
+	resp.Success = true
+
+	logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, true), zap.Float64("publish_ms", ms))
+	return wrapper.ResponseSuccess(http.StatusOK, resp)
+}
+
+// PatchConfig applies a JSON merge patch (RFC 7386) to the latest configuration
+// and stores the result as a new version.
+func (uc *UseCase) PatchConfig(ctx context.Context, patch []byte) wrapper.JSONResult {
+	etag, err := uc.Configs.LatestETag(ctx, "")
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to get config", err)
+	}
+	if etag == "" {
+		logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseNotFound("No configuration to patch")
+	}
+
+	current, err := uc.getConfig(ctx, etag)
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to get config", err)
+	}
+
+	original, err := json.Marshal(current)
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to marshal config data", err)
+	}
+
+	patched, err := mergepatch.Apply(original, patch)
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusBadRequest, "Invalid merge patch", err)
+	}
+
+	req := new(dto.SetConfigAgentRequest)
+	if err := json.Unmarshal(patched, req); err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusBadRequest, "Patched config is not a valid configuration", err)
+	}
+
+	if err := validator.ValidateStruct(req); err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusBadRequest, err.Error(), err)
+	}
+
+	logger.AddToContext(ctx, zap.String("base_etag", etag))
+	return uc.UpdateConfig(ctx, req)
 }
 
 func (uc *UseCase) GetConfig(ctx context.Context, req *dto.GetConfigAgentRequest) wrapper.JSONResult {
-	etag, err := uc.Repo.GetConfigETag(ctx)
+	etag, err := uc.Configs.LatestETag(ctx, "")
 	if err != nil {
 		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
 		return wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to get config", err)
@@ -99,7 +345,7 @@ func (uc *UseCase) GetConfig(ctx context.Context, req *dto.GetConfigAgentRequest
 		return wrapper.ResponseSuccess(http.StatusNotModified, nil)
 	}
 
-	configData, err := uc.Repo.GetConfig(ctx, etag)
+	configData, err := uc.getConfig(ctx, etag)
 	if err != nil {
 		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
 		return wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to get config if changed", err)
@@ -122,8 +368,11 @@ func (uc *UseCase) GetConfig(ctx context.Context, req *dto.GetConfigAgentRequest
 	return wrapper.ResponseSuccess(http.StatusOK, response)
 }
 
-// GetConfigForAgent returns configuration for authenticated agent with poll interval
-func (uc *UseCase) GetConfigForAgent(ctx context.Context, agentID string, etag string) wrapper.JSONResult {
+// GetConfigForAgent returns configuration for authenticated agent with poll interval.
+// The requested profile takes precedence over the agent's assigned profile; an
+// unknown profile falls back to the default config, and a default config
+// without versions is created empty.
+func (uc *UseCase) GetConfigForAgent(ctx context.Context, agentID string, etag string, profile string, schemaVersion int) wrapper.JSONResult {
 	// Look up agent to get poll interval
 	agent, err := uc.Repo.GetAgentByID(agentID)
 	if err != nil {
@@ -131,34 +380,88 @@ func (uc *UseCase) GetConfigForAgent(ctx context.Context, agentID string, etag s
 		return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to get agent", err)
 	}
 
-	// Get current configuration
-	latestETag, err := uc.Repo.GetConfigETag(ctx)
-	if err != nil {
-		logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, false), zap.Error(err))
-		return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to get configuration ETag", err)
-	}
-
-	// Get configuration data
-	configData, err := uc.Repo.GetConfig(ctx, latestETag)
-	if err != nil {
-		logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, false), zap.Error(err))
-		return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to get configuration data", err)
-	}
-
 	// Determine poll interval (agent-specific or global default)
 	var pollInterval *int
 	if agent.PollIntervalSeconds != nil {
 		pollInterval = agent.PollIntervalSeconds
 	} else {
-		defaultInterval := int(uc.Config.PollInterval.Seconds())
+		defaultInterval := uc.defaultPollInterval(agent.ID)
 		pollInterval = &defaultInterval
 	}
 
+	if profile == "" {
+		profile = agent.Profile
+	}
+
+	// Remember the worker's schema so fleet views know which versions the
+	// agent can be served; it only changes when its worker is upgraded
+	if schemaVersion > 0 && schemaVersion != agent.WorkerSchemaVersion {
+		if err := uc.Repo.SetAgentWorkerSchemaVersion(agent.ID, schemaVersion); err != nil {
+			uc.Logger.Warn("failed to record agent worker schema version", zap.String("agent_id", agent.ID), zap.Error(err))
+		}
+	}
+
+	// Get the newest version the agent's metadata matches, skipping any
+	// that no longer parse
+	resolver := uc.newConfigResolver()
+	version, resolvedProfile, err := resolver.resolve(ctx, profile, agent.Metadata)
+	if err == nil && version == nil {
+		// Only the default config can be left without versions, e.g. once
+		// its rows were removed; store an empty one so the agent still gets
+		// a valid ETag
+		etag, created, putErr := uc.Configs.PutIfAbsent(ctx, "", "{}")
+		if putErr != nil {
+			logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, false), zap.Error(putErr))
+			return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to create default configuration", putErr)
+		}
+		if created {
+			uc.Logger.Warn("no default configuration stored, created an empty one", zap.String("etag", etag))
+		}
+		resolver = uc.newConfigResolver()
+		version, resolvedProfile, err = resolver.resolve(ctx, "", agent.Metadata)
+	}
+	logger.AddToContext(ctx, zap.String("profile", resolvedProfile))
+	if profile != "" && resolvedProfile == "" {
+		logger.AddToContext(ctx, zap.String("profile_fallback", profile))
+	}
+	if latest, _ := resolver.newest(ctx, resolvedProfile); latest != nil && latest.data == nil {
+		// Serve the last version that parses rather than failing every poll
+		uc.Logger.Error("skipping corrupt configuration", zap.String("etag", latest.etag), zap.String("profile", resolvedProfile))
+		logger.AddToContext(ctx, zap.String("corrupt_etag", latest.etag))
+	}
+	switch {
+	case errors.Is(err, repository.ErrConfigCorrupt):
+		logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, false), zap.Error(err))
+		return wrapper.ResponseFailed(http.StatusServiceUnavailable, "no valid configuration available", nil)
+	case errors.Is(err, errNoMatchingConfig):
+		logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, false), zap.String("result", "no_matching_config"))
+		return wrapper.ResponseNotFound("no configuration matches agent metadata")
+	case err != nil:
+		logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, false), zap.Error(err))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to get configuration data", err)
+	}
+	var latestETag string
+	var configData *models.ConfigData
+	if version != nil {
+		latestETag, configData = version.etag, version.data
+	}
+
+	// Stamp the schema version and refuse configs the agent's worker cannot run
+	if configData != nil {
+		served, err := configData.ForSchema(schemaVersion)
+		if err != nil {
+			logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, false), zap.Error(err), zap.Int("worker_schema_version", schemaVersion))
+			return wrapper.ResponseFailed(http.StatusNotAcceptable, err.Error(), nil)
+		}
+		configData = &served
+	}
+
 	response := dto.GetConfigAgentResponse{
 		ID:                  1, // Placeholder config ID
 		ETag:                latestETag,
 		Config:              configData,
 		PollIntervalSeconds: pollInterval,
+		Profile:             resolvedProfile,
 	}
 
 	// If ETag matches, return 304 Not Modified
@@ -168,6 +471,22 @@ func (uc *UseCase) GetConfigForAgent(ctx context.Context, agentID string, etag s
 		return wrapper.ResponseSuccess(http.StatusNotModified, response)
 	}
 
+	// Throttle agents fetching full configs faster than their interval
+	// allows; a 304 is cheap and never counts, so an agent told about a
+	// version it already has is not rate limited for the next one
+	if ok, retryAfter := uc.fetchQuota.allow(agent.ID, time.Duration(*pollInterval)*time.Second); !ok {
+		retrySeconds := int(math.Ceil(retryAfter.Seconds()))
+		logger.AddToContext(ctx,
+			zap.Bool(logger.FieldSuccess, false),
+			zap.String("result", "fetch_quota_exceeded"),
+			zap.Int("retry_after_seconds", retrySeconds),
+		)
+		return wrapper.ResponseFailed(http.StatusTooManyRequests, "config fetch quota exceeded", dto.FetchQuotaExceededResponse{
+			Error:             "config fetch quota exceeded",
+			RetryAfterSeconds: retrySeconds,
+		})
+	}
+
 	logger.AddToContext(ctx,
 		zap.String(logger.FieldETag, latestETag),
 		zap.Bool(logger.FieldSuccess, true),
@@ -176,13 +495,91 @@ func (uc *UseCase) GetConfigForAgent(ctx context.Context, agentID string, etag s
 	return wrapper.ResponseSuccess(http.StatusOK, response)
 }
 
-// UpdateAgentPollInterval updates the polling interval for a specific agent
-func (uc *UseCase) UpdateAgentPollInterval(agentID string, intervalSeconds *int) error {
+// servedConfigVersion returns the ETag GetConfigForAgent would serve the
+// agent now, or "" when it would not be served a config
+func (uc *UseCase) servedConfigVersion(ctx context.Context, agentID string) (string, error) {
+	agent, err := uc.Repo.GetAgentByID(agentID)
+	if err != nil {
+		return "", err
+	}
+	etag, _, err := uc.newConfigResolver().served(ctx, agent.Profile, agent.Metadata, agent.WorkerSchemaVersion)
+	return etag, err
+}
+
+// defaultPollInterval returns the global default poll interval in seconds,
+// shifted by a per-agent offset within the configured jitter band. The offset
+// is derived from the agent ID so an agent always gets the same interval.
+func (uc *UseCase) defaultPollInterval(agentID string) int {
+	cfg := uc.CurrentConfig()
+	base := int(cfg.PollInterval.Seconds())
+	band := int(math.Round(float64(base) * cfg.PollIntervalJitter))
+	if band <= 0 {
+		return base
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(agentID))
+	offset := int(h.Sum32()%uint32(2*band+1)) - band
+
+	if interval := base + offset; interval > 0 {
+		return interval
+	}
+	return 1
+}
+
+// SetDefaultPollInterval changes the global default poll interval at
+// runtime. Agents without an override get it, within the jitter band, on
+// registration and their next config fetch. It lasts until the controller
+// restarts; configuration reloads keep it.
+func (uc *UseCase) SetDefaultPollInterval(ctx context.Context, req *dto.UpdateDefaultPollIntervalRequest) wrapper.JSONResult {
+	interval := time.Duration(req.PollIntervalSeconds) * time.Second
+	for {
+		cur := uc.live.Load()
+		next := *cur
+		next.PollInterval = interval
+		// Stored before every attempt so whichever of two concurrent calls
+		// swaps last also leaves its interval as the override
+		uc.pollOverride.Store(int64(interval))
+		if uc.live.CompareAndSwap(cur, &next) {
+			previous := int(cur.PollInterval.Seconds())
+			logger.AddToContext(ctx,
+				zap.Int("previous_poll_interval_seconds", previous),
+				zap.Int("poll_interval_seconds", req.PollIntervalSeconds),
+				zap.Bool(logger.FieldSuccess, true),
+			)
+			return wrapper.ResponseSuccess(http.StatusOK, dto.DefaultPollIntervalResponse{
+				PollIntervalSeconds:         req.PollIntervalSeconds,
+				PreviousPollIntervalSeconds: previous,
+			})
+		}
+	}
+}
+
+// UpdateAgentPollInterval updates the polling interval for a specific agent;
+// nil clears the override so the agent follows the global default. The
+// agent is told its new effective interval over Redis so it does not wait
+// for a config change to pick it up.
+func (uc *UseCase) UpdateAgentPollInterval(ctx context.Context, agentID string, intervalSeconds *int) error {
 	if err := uc.Repo.UpdateAgentPollInterval(agentID, intervalSeconds); err != nil {
 		uc.Logger.Error("failed to update agent poll interval", zap.Error(err), zap.String("agent_id", agentID))
 		return err
 	}
 	uc.Logger.Info("agent poll interval updated", zap.String("agent_id", agentID))
+
+	effective := uc.defaultPollInterval(agentID)
+	if intervalSeconds != nil {
+		effective = *intervalSeconds
+	}
+	ctx, correlationID := logger.EnsureCorrelationID(ctx)
+	receivers, err := uc.Repo.PublishIntervalUpdate(agentID, effective, correlationID)
+	if err != nil {
+		// The agent still picks the interval up with its next config change
+		uc.Logger.Warn("failed to publish interval update", zap.Error(err), zap.String("agent_id", agentID))
+	}
+	logger.AddToContext(ctx,
+		zap.Int("poll_interval_seconds", effective),
+		zap.Int64("interval_update_receivers", receivers),
+	)
 	return nil
 }
 
@@ -194,6 +591,8 @@ func (uc *UseCase) RotateAgentToken(ctx context.Context, agentID string) wrapper
 		return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to rotate token", err)
 	}
 
+	uc.recordEvent(ctx, models.EventTokenRotated, agentID, "")
+
 	response := dto.RotateTokenResponse{
 		AgentID:  agentID,
 		APIToken: newToken,
@@ -203,6 +602,53 @@ func (uc *UseCase) RotateAgentToken(ctx context.Context, agentID string) wrapper
 	return wrapper.ResponseSuccess(http.StatusOK, response)
 }
 
+// RefreshAgentToken gives an agent whose token was rotated a new one under
+// the same agent ID. A revoked agent stays revoked; only an admin rotation
+// restores it.
+func (uc *UseCase) RefreshAgentToken(ctx context.Context, req *dto.RefreshTokenRequest) wrapper.JSONResult {
+	logger.AddToContext(ctx, zap.String("agent_id", req.AgentID))
+	newToken, err := uc.Repo.RefreshAgentToken(ctx, req.AgentID)
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		switch {
+		case errors.Is(err, repository.ErrAgentNotFound):
+			return wrapper.ResponseNotFound("agent not found")
+		case errors.Is(err, repository.ErrAgentRevoked):
+			return wrapper.ResponseFailed(http.StatusForbidden, "api token revoked", nil)
+		}
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to refresh token", err)
+	}
+
+	uc.recordEvent(ctx, models.EventTokenRefreshed, req.AgentID, "")
+	logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, true))
+	return wrapper.ResponseSuccess(http.StatusOK, dto.RotateTokenResponse{
+		AgentID:  req.AgentID,
+		APIToken: newToken,
+		Message:  "token refreshed",
+	})
+}
+
+// RevokeAgentToken suspends an agent's token while keeping the agent record.
+// Rotating the token restores access.
+func (uc *UseCase) RevokeAgentToken(ctx context.Context, agentID string) wrapper.JSONResult {
+	agent, err := uc.Repo.RevokeAgentToken(agentID)
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		if errors.Is(err, repository.ErrAgentNotFound) {
+			return wrapper.ResponseNotFound("agent not found")
+		}
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to revoke token", err)
+	}
+
+	uc.recordEvent(ctx, models.EventTokenRevoked, agentID, "")
+	logger.AddToContext(ctx, zap.String("agent_id", agentID), zap.Bool(logger.FieldSuccess, true))
+	return wrapper.ResponseSuccess(http.StatusOK, dto.RevokeTokenResponse{
+		AgentID:   agentID,
+		RevokedAt: *agent.RevokedAt,
+		Message:   "token revoked",
+	})
+}
+
 // GetAgent retrieves details for a specific agent
 func (uc *UseCase) GetAgent(ctx context.Context, agentID string) wrapper.JSONResult {
 	agent, err := uc.Repo.GetAgentByID(agentID)
@@ -210,21 +656,51 @@ func (uc *UseCase) GetAgent(ctx context.Context, agentID string) wrapper.JSONRes
 		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
 		return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to get agent", err)
 	}
-	logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, true))
-	return wrapper.ResponseSuccess(http.StatusOK, agent.ToPublic())
+
+	reported, err := uc.Repo.GetAgentConfigVersion(ctx, agentID)
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to get agent config version", err)
+	}
+	resolver := uc.newConfigResolver()
+	expected, name, err := resolver.served(ctx, agent.Profile, agent.Metadata, agent.WorkerSchemaVersion)
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to get latest config version", err)
+	}
+	lag, err := resolver.lag(ctx, name, reported, expected, time.Now().UTC())
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to get config lag", err)
+	}
+
+	logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, true), zap.Int64("versions_behind", lag.VersionsBehind))
+	return wrapper.ResponseSuccess(http.StatusOK, dto.AgentDetailResponse{AgentPublic: agent.ToPublic(), ConfigLag: lag})
 }
 
 // HandleHeartbeat processes an agent heartbeat and returns latest config version info
 func (uc *UseCase) HandleHeartbeat(agentID string, req *dto.HeartbeatRequest) (*dto.HeartbeatResponse, error) {
+	var previous *time.Time
+	if cfg := uc.CurrentConfig(); cfg != nil && cfg.DebugEvents {
+		previous, _ = uc.Repo.GetAgentLastHeartbeat(agentID)
+	}
+	// Only a change of the applied version goes to the activity feed; a
+	// failed read just leaves this heartbeat out of it
+	previousVersion, versionErr := uc.Repo.GetAgentConfigVersion(context.Background(), agentID)
+
 	// Update heartbeat timestamp in DB
 	agent, err := uc.Repo.UpdateAgentHeartbeat(agentID, req.ConfigVersion)
 	if err != nil {
 		uc.Logger.Error("failed to update agent heartbeat", zap.Error(err), zap.String("agent_id", agentID))
 		return nil, err
 	}
+	if err := uc.Repo.UpdateAgentLastError(agentID, req.LastError, req.LastErrorAt); err != nil {
+		uc.Logger.Error("failed to update agent last error", zap.Error(err), zap.String("agent_id", agentID))
+		return nil, err
+	}
 
-	// Get latest config version for agent
-	latest, err := uc.Repo.GetLatestConfigVersionForAgent(agentID)
+	// Get the config version the agent would be served
+	latest, err := uc.servedConfigVersion(context.Background(), agentID)
 	if err != nil {
 		uc.Logger.Error("failed to get latest config version", zap.Error(err), zap.String("agent_id", agentID))
 		return nil, err
@@ -234,12 +710,128 @@ func (uc *UseCase) HandleHeartbeat(agentID string, req *dto.HeartbeatRequest) (*
 		LatestConfigVersion: latest,
 		ReceivedAt:          time.Now().UTC(),
 	}
+	uc.pruneHeartbeatHistory(context.Background(), resp.ReceivedAt)
 
-	uc.Logger.Info("heartbeat processed", zap.String("agent_id", agentID), zap.String("latest_config", latest))
+	if previous != nil {
+		if gap := resp.ReceivedAt.Sub(*previous); gap > uc.heartbeatLateAfter() {
+			uc.publishDebugEvent(agentID, models.DebugEventHeartbeatLate,
+				fmt.Sprintf("heartbeat arrived %s after the previous one", gap.Round(time.Second)))
+		}
+	}
+
+	if req.LastError != "" {
+		uc.Logger.Warn("agent reports error",
+			zap.String("agent_id", agentID),
+			zap.String("last_error", req.LastError),
+		)
+	}
+	if req.WorkerOutOfSync {
+		uc.Logger.Error("agent reports worker out of sync",
+			zap.String("event", "worker_out_of_sync"),
+			zap.String("agent_id", agentID),
+			zap.Int("worker_forward_failures", req.WorkerForwardFailures),
+			zap.String("config_version", req.ConfigVersion),
+		)
+	}
+
+	if versionErr == nil && req.ConfigVersion != previousVersion {
+		uc.recordEvent(context.Background(), models.EventHeartbeatReceived, agentID, "config_version "+req.ConfigVersion)
+	}
+
+	uc.Logger.Info("heartbeat processed",
+		zap.String("agent_id", agentID),
+		zap.String("latest_config", latest),
+		zap.Bool("config_pinned", req.ConfigPinned),
+		zap.String("delivery_mode", req.DeliveryMode),
+	)
 	_ = agent
 	return resp, nil
 }
 
+// HandleHeartbeatBatch processes heartbeats for several agents in one transaction.
+// When adminAuthorized is false every entry must carry the agent's own API token.
+// Failures are reported per agent instead of failing the whole batch.
+func (uc *UseCase) HandleHeartbeatBatch(ctx context.Context, req *dto.BatchHeartbeatRequest, adminAuthorized bool) (*dto.BatchHeartbeatResponse, error) {
+	entries := make([]repository.HeartbeatEntry, len(req.Heartbeats))
+	for i, hb := range req.Heartbeats {
+		entries[i] = repository.HeartbeatEntry{
+			AgentID:       hb.AgentID,
+			APIToken:      hb.APIToken,
+			ConfigVersion: hb.ConfigVersion,
+			LastError:     hb.LastError,
+			LastErrorAt:   hb.LastErrorAt,
+		}
+	}
+
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.AgentID
+	}
+	previous, err := uc.Repo.GetAgentConfigVersions(ctx, ids)
+	if err != nil {
+		uc.Logger.Warn("failed to get agent config versions before heartbeat batch", zap.Error(err))
+	}
+
+	errs, err := uc.Repo.UpdateAgentHeartbeatsBatch(ctx, entries, !adminAuthorized)
+	if err != nil {
+		uc.Logger.Error("failed to apply heartbeat batch", zap.Error(err), zap.Int("size", len(entries)))
+		return nil, err
+	}
+
+	// Each agent is answered with the version it is served, resolved through
+	// one resolver so agents sharing a profile cost a single store read
+	var accepted []string
+	for i, entry := range entries {
+		if errs[i] == nil {
+			accepted = append(accepted, entry.AgentID)
+		}
+	}
+	agents, err := uc.Repo.GetAgentsByIDs(ctx, accepted)
+	if err != nil {
+		uc.Logger.Error("failed to get batched agents", zap.Error(err))
+		return nil, err
+	}
+	served := make(map[string]string, len(agents))
+	resolver := uc.newConfigResolver()
+	for _, agent := range agents {
+		etag, _, err := resolver.served(ctx, agent.Profile, agent.Metadata, agent.WorkerSchemaVersion)
+		if err != nil {
+			uc.Logger.Error("failed to resolve served config version", zap.Error(err), zap.String("agent_id", agent.ID))
+			return nil, err
+		}
+		served[agent.ID] = etag
+	}
+
+	resp := &dto.BatchHeartbeatResponse{
+		Results:    make([]dto.BatchHeartbeatResult, len(entries)),
+		ReceivedAt: time.Now().UTC(),
+	}
+	for i, entry := range entries {
+		result := dto.BatchHeartbeatResult{AgentID: entry.AgentID}
+		if errs[i] != nil {
+			result.Error = errs[i].Error()
+			resp.Failed++
+		} else {
+			result.Success = true
+			result.LatestConfigVersion = served[entry.AgentID]
+			resp.Succeeded++
+			if previous != nil && entry.ConfigVersion != previous[entry.AgentID] {
+				uc.recordEvent(ctx, models.EventHeartbeatReceived, entry.AgentID, "config_version "+entry.ConfigVersion)
+			}
+		}
+		resp.Results[i] = result
+	}
+	uc.pruneHeartbeatHistory(ctx, resp.ReceivedAt)
+
+	logger.AddToContext(ctx,
+		zap.Int("batch_size", len(entries)),
+		zap.Int("succeeded", resp.Succeeded),
+		zap.Int("failed", resp.Failed),
+	)
+	uc.Logger.Info("heartbeat batch processed", zap.Int("succeeded", resp.Succeeded), zap.Int("failed", resp.Failed))
+	return resp, nil
+}
+
 // ListAgents returns all registered agents
 func (uc *UseCase) ListAgents(ctx context.Context) wrapper.JSONResult {
 	agents, err := uc.Repo.ListAgents()
@@ -261,6 +853,294 @@ func (uc *UseCase) DeleteAgent(ctx context.Context, agentID string) error {
 		uc.Logger.Error("failed to delete agent", zap.Error(err), zap.String("agent_id", agentID))
 		return err
 	}
+	uc.fetchQuota.forget(agentID)
+	uc.recordEvent(ctx, models.EventAgentDeleted, agentID, "")
 	uc.Logger.Info("agent deleted", zap.String("agent_id", agentID))
 	return nil
 }
+
+// configTooLarge reports whether a serialized config exceeds the configured
+// size limit. Every stored config is sent to all agents and workers.
+func (uc *UseCase) configTooLarge(config []byte) bool {
+	cfg := uc.CurrentConfig()
+	return cfg != nil && cfg.MaxConfigBytes > 0 && len(config) > cfg.MaxConfigBytes
+}
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+func validProfileName(name string) bool {
+	return profileNamePattern.MatchString(name)
+}
+
+// SetConfigProfile stores a new version of a named config profile
+func (uc *UseCase) SetConfigProfile(ctx context.Context, name string, req *dto.SetConfigAgentRequest) wrapper.JSONResult {
+	logger.AddToContext(ctx, zap.String("profile", name))
+	if !validProfileName(name) {
+		logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseBadRequest("invalid profile name")
+	}
+
+	if err := req.ConfigData().Validate(); err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseBadRequest(err.Error())
+	}
+
+	config, err := json.Marshal(req)
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to marshal config data", err)
+	}
+
+	if uc.configTooLarge(config) {
+		logger.AddToContext(ctx, zap.Int("config_bytes", len(config)), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("config is %d bytes, the limit is %d", len(config), uc.CurrentConfig().MaxConfigBytes), nil)
+	}
+
+	etag, err := uc.Configs.Put(ctx, name, string(config))
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to update config profile", err)
+	}
+
+	uc.recordEvent(ctx, models.EventConfigChanged, "", "profile "+name+" etag "+etag)
+
+	_, correlationID := logger.EnsureCorrelationID(ctx)
+	uc.notifier.enqueue(ctx, "", etag, correlationID)
+
+	logger.AddToContext(ctx, zap.String(logger.FieldETag, etag), zap.Bool(logger.FieldSuccess, true))
+	return wrapper.ResponseSuccess(http.StatusOK, dto.GetConfigAgentResponse{ETag: etag, Config: req, Profile: name})
+}
+
+// GetConfigProfile returns the latest version of a named config profile
+func (uc *UseCase) GetConfigProfile(ctx context.Context, name string) wrapper.JSONResult {
+	logger.AddToContext(ctx, zap.String("profile", name))
+
+	etag, err := uc.Configs.LatestETag(ctx, name)
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to get config profile", err)
+	}
+	if etag == "" {
+		logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseNotFound("config profile not found")
+	}
+
+	configData, err := uc.getConfig(ctx, etag)
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to get config profile", err)
+	}
+
+	logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, true))
+	return wrapper.ResponseSuccess(http.StatusOK, dto.GetConfigAgentResponse{ETag: etag, Config: configData, Profile: name})
+}
+
+// ListConfigProfiles returns all named config profiles
+func (uc *UseCase) ListConfigProfiles(ctx context.Context) wrapper.JSONResult {
+	profiles, err := uc.Configs.Profiles(ctx)
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to list config profiles", err)
+	}
+
+	response := dto.ListConfigProfilesResponse{
+		Profiles: make([]dto.ConfigProfileResponse, len(profiles)),
+		Total:    len(profiles),
+	}
+	for i, p := range profiles {
+		response.Profiles[i] = dto.ConfigProfileResponse{
+			Name:      p.Name,
+			ETag:      p.ETag,
+			Versions:  p.Versions,
+			UpdatedAt: p.UpdatedAt,
+		}
+	}
+
+	logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, true))
+	return wrapper.ResponseSuccess(http.StatusOK, response)
+}
+
+// GetConfigDistribution reports how many agents are on each config version
+// and which agents have not applied the version they would be served now
+func (uc *UseCase) GetConfigDistribution(ctx context.Context) wrapper.JSONResult {
+	latest, err := uc.Configs.LatestETag(ctx, "")
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to get latest config version", err)
+	}
+
+	counts, err := uc.Repo.CountAgentsByConfigVersion(ctx)
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to get config distribution", err)
+	}
+
+	// Liveness is not reported here, so the heartbeat bounds do not matter
+	now := time.Now().UTC()
+	groups, err := uc.Repo.GroupAgentConfigVersions(ctx, now, now)
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to get config distribution", err)
+	}
+
+	response := dto.ConfigDistributionResponse{
+		LatestETag: latest,
+		Versions:   make([]dto.ConfigVersionCount, len(counts)),
+		Lagging:    []dto.LaggingAgent{},
+	}
+	for i, c := range counts {
+		response.Versions[i] = dto.ConfigVersionCount{ETag: c.ETag, Agents: c.Agents}
+	}
+
+	// Profiles and match rules mean agents can legitimately be on different
+	// versions, so compare each group with what its agents would be served
+	resolver := uc.newConfigResolver()
+	lagging := make(map[string]string)
+	for _, g := range groups {
+		response.TotalAgents += g.Agents
+		expected, _, err := resolver.served(ctx, g.Profile, g.Metadata, g.WorkerSchemaVersion)
+		if err != nil {
+			logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+			return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to get config distribution", err)
+		}
+		if g.ConfigVersion == expected {
+			response.UpToDate += g.Agents
+			continue
+		}
+		lagging[agentGroupKey(g.Profile, g.Metadata, g.WorkerSchemaVersion, g.ConfigVersion)] = expected
+	}
+
+	// Only a rollout in progress needs the agents listed one by one
+	if len(lagging) > 0 {
+		agents, err := uc.Repo.ListAgentConfigVersions(ctx)
+		if err != nil {
+			logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+			return wrapper.ResponseFailed(http.StatusInternalServerError, "failed to get config distribution", err)
+		}
+		for _, a := range agents {
+			expected, ok := lagging[agentGroupKey(a.Profile, a.Metadata, a.WorkerSchemaVersion, a.ConfigVersion)]
+			if !ok {
+				continue
+			}
+			response.Lagging = append(response.Lagging, dto.LaggingAgent{
+				AgentID:         a.AgentID,
+				AgentName:       a.AgentName,
+				ConfigVersion:   a.ConfigVersion,
+				ExpectedVersion: expected,
+				LastHeartbeat:   a.LastHeartbeat,
+			})
+		}
+	}
+
+	logger.AddToContext(ctx,
+		zap.Int("total_agents", response.TotalAgents),
+		zap.Int("lagging_agents", len(response.Lagging)),
+		zap.Bool(logger.FieldSuccess, true),
+	)
+	return wrapper.ResponseSuccess(http.StatusOK, response)
+}
+
+// agentGroupKey identifies the AgentConfigGroup an agent belongs to
+func agentGroupKey(profile string, metadata map[string]string, workerSchema int, configVersion string) string {
+	// fmt prints map keys sorted, so equal metadata gives equal keys
+	return fmt.Sprintf("%q %v %d %q", profile, metadata, workerSchema, configVersion)
+}
+
+// DeleteConfigProfile removes all versions of a named config profile. Agents
+// assigned to it fall back to the default config.
+func (uc *UseCase) DeleteConfigProfile(ctx context.Context, name string) wrapper.JSONResult {
+	logger.AddToContext(ctx, zap.String("profile", name))
+
+	deleted, err := uc.Configs.DeleteProfile(ctx, name)
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to delete config profile", err)
+	}
+	if deleted == 0 {
+		logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseNotFound("config profile not found")
+	}
+
+	uc.recordEvent(ctx, models.EventConfigChanged, "", "profile "+name+" deleted")
+	logger.AddToContext(ctx, zap.Int64("versions_deleted", deleted), zap.Bool(logger.FieldSuccess, true))
+	return wrapper.ResponseSuccess(http.StatusOK, "config profile deleted")
+}
+
+// SetAgentProfile assigns a config profile to an agent
+func (uc *UseCase) SetAgentProfile(ctx context.Context, agentID string, profile string) wrapper.JSONResult {
+	logger.AddToContext(ctx, zap.String("agent_id", agentID), zap.String("profile", profile))
+	if profile != "" && !validProfileName(profile) {
+		logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseBadRequest("invalid profile name")
+	}
+
+	if err := uc.Repo.SetAgentProfile(agentID, profile); err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		if errors.Is(err, repository.ErrAgentNotFound) {
+			return wrapper.ResponseNotFound("agent not found")
+		}
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to update agent profile", err)
+	}
+
+	if profile == "" {
+		uc.publishDebugEvent(agentID, models.DebugEventConfigTargeted, "profile cleared; the default config applies")
+	} else {
+		uc.publishDebugEvent(agentID, models.DebugEventConfigTargeted, "config profile "+profile+" assigned")
+	}
+
+	logger.AddToContext(ctx, zap.Bool(logger.FieldSuccess, true))
+	return wrapper.ResponseSuccess(http.StatusOK, "agent profile updated")
+}
+
+const (
+	defaultBootstrapTokenUses = 1
+	defaultBootstrapTokenTTL  = time.Hour
+)
+
+// CreateBootstrapToken issues a registration token agents can use instead of
+// the shared agent credentials
+func (uc *UseCase) CreateBootstrapToken(ctx context.Context, req *dto.CreateBootstrapTokenRequest) wrapper.JSONResult {
+	maxUses := req.MaxUses
+	if maxUses <= 0 {
+		maxUses = defaultBootstrapTokenUses
+	}
+	ttl := defaultBootstrapTokenTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+
+	token, record, err := uc.Repo.CreateBootstrapToken(ctx, maxUses, time.Now().Add(ttl))
+	if err != nil {
+		logger.AddToContext(ctx, zap.Error(err), zap.Bool(logger.FieldSuccess, false))
+		return wrapper.ResponseFailed(http.StatusInternalServerError, "Failed to create bootstrap token", err)
+	}
+
+	logger.AddToContext(ctx,
+		zap.String("bootstrap_token_id", record.ID),
+		zap.Int("max_uses", record.MaxUses),
+		zap.Time("expires_at", record.ExpiresAt),
+		zap.Bool(logger.FieldSuccess, true),
+	)
+	return wrapper.ResponseSuccess(http.StatusCreated, dto.CreateBootstrapTokenResponse{
+		ID:        record.ID,
+		Token:     token,
+		MaxUses:   record.MaxUses,
+		ExpiresAt: record.ExpiresAt,
+	})
+}
+
+// CheckBootstrapToken reports whether a bootstrap token may register an
+// agent, without using it up; RegisterAgent does that when the agent is
+// created. It reports false without error when the token is unknown,
+// expired or exhausted.
+func (uc *UseCase) CheckBootstrapToken(ctx context.Context, token string) (bool, error) {
+	err := uc.Repo.CheckBootstrapToken(ctx, token)
+	if errors.Is(err, repository.ErrBootstrapTokenInvalid) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
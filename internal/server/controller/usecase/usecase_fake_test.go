@@ -0,0 +1,498 @@
+package usecase
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Alwanly/service-distribute-management/internal/config"
+	"github.com/Alwanly/service-distribute-management/internal/models"
+	"github.com/Alwanly/service-distribute-management/internal/server/controller/dto"
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+)
+
+// newFakeUseCase builds a usecase on an in-memory repository
+func newFakeUseCase(t *testing.T) (*UseCase, *fakeRepository) {
+	t.Helper()
+
+	repo := newFakeRepository()
+	uc := NewUseCase(UseCase{
+		Repo:   repo,
+		Config: &config.ControllerConfig{PollInterval: 30 * time.Second},
+		Logger: logger.New(zap.NewNop()),
+	})
+	return uc, repo
+}
+
+func TestRegisterAgent_InMemory(t *testing.T) {
+	uc, repo := newFakeUseCase(t)
+
+	result := uc.RegisterAgent(context.Background(), &dto.RegisterAgentRequest{
+		Hostname: "host-a",
+		Metadata: map[string]string{"region": "eu"},
+	})
+	if result.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", result.Code, result.Message)
+	}
+
+	resp, ok := result.Data.(dto.RegisterAgentResponse)
+	if !ok {
+		t.Fatalf("unexpected response type %T", result.Data)
+	}
+	if resp.AgentName != "host-a" || resp.APIToken == "" || resp.PollIntervalSeconds != 30 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	agent, err := repo.GetAgentByID(resp.AgentID)
+	if err != nil {
+		t.Fatalf("agent not stored: %v", err)
+	}
+	if agent.Metadata["region"] != "eu" {
+		t.Fatalf("expected metadata to be stored, got %v", agent.Metadata)
+	}
+	if agent.PollIntervalSeconds != nil {
+		t.Fatalf("expected no poll interval override, got %d", *agent.PollIntervalSeconds)
+	}
+
+	events, _, _ := repo.ListEvents(context.Background(), models.EventAgentRegistered, 10, 0)
+	if len(events) != 1 || events[0].AgentID != resp.AgentID {
+		t.Fatalf("expected one registration event, got %+v", events)
+	}
+}
+
+func TestUpdateConfig_InMemory(t *testing.T) {
+	uc, repo := newFakeUseCase(t)
+
+	result := uc.UpdateConfig(context.Background(), &dto.SetConfigAgentRequest{URl: "http://example.com"})
+	if result.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", result.Code, result.Message)
+	}
+
+	etag, _ := repo.configs.LatestETag(context.Background(), "")
+	if etag == "" {
+		t.Fatal("expected a config version to be stored")
+	}
+	configData, err := uc.getConfig(context.Background(), etag)
+	if err != nil || configData == nil || configData.URL != "http://example.com" {
+		t.Fatalf("unexpected stored config %+v: %v", configData, err)
+	}
+
+	// Notifications are published in the background
+	deadline := time.Now().Add(2 * time.Second)
+	for len(repo.published()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	published := repo.published()
+	if len(published) != 1 || published[0].ETag != etag || published[0].AgentID != "" {
+		t.Fatalf("expected one broadcast for %s, got %+v", etag, published)
+	}
+}
+
+func TestUpdateConfig_ConcurrentIdenticalPushes(t *testing.T) {
+	uc, repo := newFakeUseCase(t)
+	ctx := context.Background()
+
+	results := make([]dto.SetConfigAgentResponse, 2)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result := uc.UpdateConfig(ctx, &dto.SetConfigAgentRequest{URl: "http://example.com", Proxy: "http://proxy:8080"})
+			if result.Code != http.StatusOK {
+				t.Errorf("push %d: expected 200, got %d: %s", i, result.Code, result.Message)
+				return
+			}
+			results[i] = result.Data.(dto.SetConfigAgentResponse)
+		}(i)
+	}
+	wg.Wait()
+
+	versions, _ := repo.configs.History(ctx, "", 0)
+	if len(versions) != 1 {
+		t.Fatalf("expected one stored version, got %d", len(versions))
+	}
+	etag := versions[0].ETag
+	if results[0].ETag != etag || results[1].ETag != etag {
+		t.Fatalf("expected both pushes to report %s, got %+v", etag, results)
+	}
+	if results[0].NoChange == results[1].NoChange {
+		t.Fatalf("expected exactly one push to report no_change, got %+v", results)
+	}
+
+	// Only the stored version is published
+	deadline := time.Now().Add(2 * time.Second)
+	for len(repo.published()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if published := repo.published(); len(published) != 1 {
+		t.Fatalf("expected one notification, got %+v", published)
+	}
+
+	// A different config is stored as usual
+	result := uc.UpdateConfig(ctx, &dto.SetConfigAgentRequest{URl: "http://example.org"})
+	versions, _ = repo.configs.History(ctx, "", 0)
+	if resp := result.Data.(dto.SetConfigAgentResponse); resp.NoChange || len(versions) != 2 {
+		t.Fatalf("expected a changed config to be stored, got %+v with %d versions", resp, len(versions))
+	}
+}
+
+func TestUpdateConfig_InMemoryRejectsInvalid(t *testing.T) {
+	uc, repo := newFakeUseCase(t)
+
+	result := uc.UpdateConfig(context.Background(), &dto.SetConfigAgentRequest{URl: "ftp://example.com"})
+	if result.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", result.Code)
+	}
+	if etag, _ := repo.configs.LatestETag(context.Background(), ""); etag != "" {
+		t.Fatalf("expected nothing stored, got %s", etag)
+	}
+}
+
+func TestGetConfigForAgent_InMemory(t *testing.T) {
+	uc, repo := newFakeUseCase(t)
+	ctx := context.Background()
+
+	agent, _ := repo.CreateAgent("host-a", nil)
+	if _, err := repo.configs.Put(ctx, "", `{"url":"http://example.com"}`); err != nil {
+		t.Fatalf("update config: %v", err)
+	}
+	etag, _ := repo.configs.LatestETag(ctx, "")
+
+	result := uc.GetConfigForAgent(ctx, agent.ID, "", "", 0)
+	if result.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", result.Code, result.Message)
+	}
+	resp := result.Data.(dto.GetConfigAgentResponse)
+	if resp.ETag != etag {
+		t.Fatalf("expected etag %s, got %s", etag, resp.ETag)
+	}
+	if configData, ok := resp.Config.(*models.ConfigData); !ok || configData.URL != "http://example.com" {
+		t.Fatalf("unexpected config %+v", resp.Config)
+	}
+	if resp.PollIntervalSeconds == nil || *resp.PollIntervalSeconds != 30 {
+		t.Fatalf("expected default poll interval, got %v", resp.PollIntervalSeconds)
+	}
+
+	// The agent already has the latest version
+	result = uc.GetConfigForAgent(ctx, agent.ID, etag, "", 0)
+	if result.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", result.Code)
+	}
+
+	// A newer version is served in full again
+	if _, err := repo.configs.Put(ctx, "", `{"url":"http://example.org"}`); err != nil {
+		t.Fatalf("update config: %v", err)
+	}
+	result = uc.GetConfigForAgent(ctx, agent.ID, etag, "", 0)
+	if result.Code != http.StatusOK {
+		t.Fatalf("expected 200 after update, got %d", result.Code)
+	}
+	if resp := result.Data.(dto.GetConfigAgentResponse); resp.ETag == etag {
+		t.Fatalf("expected a new etag, got %s", resp.ETag)
+	}
+}
+
+func TestGetConfigForAgent_InMemoryUnknownAgent(t *testing.T) {
+	uc, _ := newFakeUseCase(t)
+
+	result := uc.GetConfigForAgent(context.Background(), "missing", "", "", 0)
+	if result.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", result.Code)
+	}
+}
+
+func TestHandleHeartbeat_InMemory(t *testing.T) {
+	uc, repo := newFakeUseCase(t)
+	ctx := context.Background()
+
+	agent, _ := repo.CreateAgent("host-a", nil)
+	if _, err := repo.configs.Put(ctx, "", `{"url":"http://example.com"}`); err != nil {
+		t.Fatalf("update config: %v", err)
+	}
+	latest, _ := repo.configs.LatestETag(ctx, "")
+
+	resp, err := uc.HandleHeartbeat(agent.ID, &dto.HeartbeatRequest{
+		ConfigVersion: "old-etag",
+		LastError:     "worker unreachable",
+	})
+	if err != nil {
+		t.Fatalf("heartbeat: %v", err)
+	}
+	if resp.LatestConfigVersion != latest {
+		t.Fatalf("expected latest version %s, got %s", latest, resp.LatestConfigVersion)
+	}
+
+	versions, _ := repo.ListAgentConfigVersions(ctx)
+	if len(versions) != 1 || versions[0].ConfigVersion != "old-etag" || versions[0].LastHeartbeat == nil {
+		t.Fatalf("expected heartbeat to be stored, got %+v", versions)
+	}
+	stored, _ := repo.GetAgentByID(agent.ID)
+	if stored.LastError != "worker unreachable" || stored.LastErrorAt == nil {
+		t.Fatalf("expected last error to be stored, got %q at %v", stored.LastError, stored.LastErrorAt)
+	}
+}
+
+func TestUpdateConfig_RejectsOversizedConfig(t *testing.T) {
+	uc, repo := newFakeUseCase(t)
+	uc.Config.MaxConfigBytes = 1024
+	ctx := context.Background()
+
+	huge := &dto.SetConfigAgentRequest{URl: "http://example.com/" + strings.Repeat("a", 2048)}
+	if result := uc.UpdateConfig(ctx, huge); result.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d: %s", result.Code, result.Message)
+	}
+	if result := uc.SetConfigProfile(ctx, "scraper", huge); result.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for profile, got %d: %s", result.Code, result.Message)
+	}
+	if profiles, _ := repo.configs.Profiles(ctx); len(profiles) != 0 {
+		t.Fatalf("expected no profile stored, got %+v", profiles)
+	}
+	if etag, _ := repo.configs.LatestETag(ctx, ""); etag != "" {
+		t.Fatalf("expected nothing stored, got %s", etag)
+	}
+	if len(repo.published()) != 0 {
+		t.Fatal("expected no notification for a rejected config")
+	}
+
+	if result := uc.UpdateConfig(ctx, &dto.SetConfigAgentRequest{URl: "http://example.com"}); result.Code != http.StatusOK {
+		t.Fatalf("expected a small config to be accepted, got %d", result.Code)
+	}
+}
+
+func TestReloadConfig_AppliesToLaterRequests(t *testing.T) {
+	uc, repo := newFakeUseCase(t)
+	ctx := context.Background()
+	if _, err := repo.configs.Put(ctx, "", `{"url":"http://example.com"}`); err != nil {
+		t.Fatalf("update config: %v", err)
+	}
+
+	uc.ReloadConfig(&config.ControllerConfig{PollInterval: 90 * time.Second, FetchQuotaPerInterval: 1})
+
+	result := uc.RegisterAgent(ctx, &dto.RegisterAgentRequest{Hostname: "host-a"})
+	resp := result.Data.(dto.RegisterAgentResponse)
+	if resp.PollIntervalSeconds != 90 {
+		t.Fatalf("expected the reloaded poll interval 90, got %d", resp.PollIntervalSeconds)
+	}
+
+	if result := uc.GetConfigForAgent(ctx, resp.AgentID, "", "", 0); result.Code != http.StatusOK {
+		t.Fatalf("expected first fetch to pass, got %d", result.Code)
+	}
+	if result := uc.GetConfigForAgent(ctx, resp.AgentID, "", "", 0); result.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the reloaded fetch quota to apply, got %d", result.Code)
+	}
+}
+
+func TestReloadConfig_KeepsRuntimePollInterval(t *testing.T) {
+	uc, _ := newFakeUseCase(t)
+	ctx := context.Background()
+
+	if res := uc.SetDefaultPollInterval(ctx, &dto.UpdateDefaultPollIntervalRequest{PollIntervalSeconds: 90}); res.Code != http.StatusOK {
+		t.Fatalf("set default poll interval: got %d", res.Code)
+	}
+	uc.ReloadConfig(&config.ControllerConfig{PollInterval: 45 * time.Second, FetchQuotaPerInterval: 1})
+
+	cfg := uc.CurrentConfig()
+	if cfg.PollInterval != 90*time.Second {
+		t.Errorf("expected the runtime poll interval to survive the reload, got %s", cfg.PollInterval)
+	}
+	if cfg.FetchQuotaPerInterval != 1 {
+		t.Errorf("expected the other reloaded settings to apply, got quota %d", cfg.FetchQuotaPerInterval)
+	}
+}
+
+func TestWatchReload_AppliesConfigOnSIGHUP(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("POLL_INTERVAL", "5")
+	t.Setenv("ADMIN_PASSWORD", "old-secret")
+
+	cfg, err := config.LoadControllerConfig()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	uc := NewUseCase(UseCase{
+		Repo:   newFakeRepository(),
+		Config: cfg,
+		Logger: logger.New(zap.NewNop()),
+	})
+
+	// Keep SIGHUP from terminating the test before WatchReload subscribes
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var mu sync.Mutex
+	var adminPassword string
+	reloadedPassword := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return adminPassword
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		uc.WatchReload(ctx, func(next *config.ControllerConfig) {
+			mu.Lock()
+			adminPassword = next.AdminPassword
+			mu.Unlock()
+		})
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	t.Setenv("POLL_INTERVAL", "45")
+	t.Setenv("ADMIN_PASSWORD", "new-secret")
+
+	// WatchReload may not have subscribed yet, so signal until the reload
+	// shows up; reloading the same environment twice is harmless
+	deadline := time.Now().Add(5 * time.Second)
+	for uc.CurrentConfig().PollInterval != 45*time.Second || reloadedPassword() != "new-secret" {
+		if time.Now().After(deadline) {
+			t.Fatalf("poll interval %s and admin password %q after SIGHUP, want 45s and the reloaded one",
+				uc.CurrentConfig().PollInterval, reloadedPassword())
+		}
+		if err := syscall.Kill(syscall.Getpid(), syscall.SIGHUP); err != nil {
+			t.Fatalf("send SIGHUP: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestUpdateAgentPollInterval_PublishesEffectiveInterval(t *testing.T) {
+	uc, repo := newFakeUseCase(t)
+	ctx := context.Background()
+	reg := uc.RegisterAgent(ctx, &dto.RegisterAgentRequest{Hostname: "host-a"}).Data.(dto.RegisterAgentResponse)
+
+	override := 45
+	if err := uc.UpdateAgentPollInterval(ctx, reg.AgentID, &override); err != nil {
+		t.Fatalf("set override: %v", err)
+	}
+	// Clearing the override sends the agent back to the global default
+	if err := uc.UpdateAgentPollInterval(ctx, reg.AgentID, nil); err != nil {
+		t.Fatalf("clear override: %v", err)
+	}
+
+	want := []publishedInterval{{AgentID: reg.AgentID, IntervalSeconds: 45}, {AgentID: reg.AgentID, IntervalSeconds: 30}}
+	if len(repo.intervals) != len(want) || repo.intervals[0] != want[0] || repo.intervals[1] != want[1] {
+		t.Fatalf("got interval updates %+v, want %+v", repo.intervals, want)
+	}
+	if len(repo.published()) != 0 {
+		t.Fatalf("expected no config update notifications, got %+v", repo.published())
+	}
+}
+
+func TestRunDistributionTest_ReportsAcknowledgingAgents(t *testing.T) {
+	uc, repo := newFakeUseCase(t)
+	ctx := context.Background()
+	defer func(poll time.Duration) { distributionTestPoll = poll }(distributionTestPoll)
+	distributionTestPoll = 10 * time.Millisecond
+
+	if _, err := repo.configs.Put(ctx, "", `{"url":"http://example.com","flags":{"strict_validation":true}}`); err != nil {
+		t.Fatalf("update config: %v", err)
+	}
+	before, _ := repo.configs.LatestETag(ctx, "")
+	a, _ := repo.CreateAgent("host-a", nil)
+	b, _ := repo.CreateAgent("host-b", nil)
+	silent, _ := repo.CreateAgent("host-silent", nil)
+	onProfile, _ := repo.CreateAgent("host-profile", nil)
+	if _, err := repo.configs.Put(ctx, "scraper", `{"url":"http://scraper.example.com"}`); err != nil {
+		t.Fatalf("update profile: %v", err)
+	}
+	_ = repo.SetAgentProfile(onProfile.ID, "scraper")
+	// Flags need schema 7, so this agent's worker is never served the sentinel
+	oldWorker, _ := repo.CreateAgent("host-old-worker", nil)
+	_ = repo.SetAgentWorkerSchemaVersion(oldWorker.ID, 6)
+	for _, id := range []string{a.ID, b.ID, silent.ID} {
+		if _, err := uc.HandleHeartbeat(id, &dto.HeartbeatRequest{ConfigVersion: before}); err != nil {
+			t.Fatalf("heartbeat: %v", err)
+		}
+	}
+
+	// Simulated agents apply the sentinel once it is stored; the silent one
+	// keeps reporting the previous version
+	go func() {
+		for {
+			if etag, _ := repo.configs.LatestETag(ctx, ""); etag != before {
+				_, _ = uc.HandleHeartbeat(a.ID, &dto.HeartbeatRequest{ConfigVersion: etag})
+				_, _ = uc.HandleHeartbeat(b.ID, &dto.HeartbeatRequest{ConfigVersion: etag})
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	result := uc.RunDistributionTest(ctx, &dto.DistributionTestRequest{TimeoutSeconds: 1})
+	if result.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", result.Code, result.Message)
+	}
+	resp := result.Data.(dto.DistributionTestResponse)
+
+	latest, _ := repo.configs.LatestETag(ctx, "")
+	if resp.ETag != latest || resp.ETag == before {
+		t.Fatalf("expected the sentinel %s to be the new latest config (was %s), got %s", latest, before, resp.ETag)
+	}
+	sentinel, err := uc.getConfig(ctx, resp.ETag)
+	if err != nil {
+		t.Fatalf("get sentinel: %v", err)
+	}
+	if sentinel.URL != "http://example.com" || sentinel.Flags.String(DistributionTestFlag, "") != resp.TestID || !sentinel.Flags.Bool("strict_validation", false) {
+		t.Fatalf("expected the previous config tagged with test %s, got %+v", resp.TestID, sentinel)
+	}
+
+	ids := func(agents []dto.DistributionTestAgent) string {
+		var out []string
+		for _, agent := range agents {
+			out = append(out, agent.AgentName)
+		}
+		return strings.Join(out, ",")
+	}
+	if resp.Complete || ids(resp.Acknowledged) != "host-a,host-b" || ids(resp.Pending) != "host-silent" || ids(resp.Skipped) != "host-profile,host-old-worker" {
+		t.Fatalf("got complete=%v acknowledged=%s pending=%s skipped=%s",
+			resp.Complete, ids(resp.Acknowledged), ids(resp.Pending), ids(resp.Skipped))
+	}
+	if resp.Pending[0].ConfigVersion != before || resp.Skipped[0].ExpectedVersion == "" || resp.Skipped[1].ExpectedVersion != "" {
+		t.Fatalf("unexpected pending %+v or skipped %+v", resp.Pending[0], resp.Skipped[0])
+	}
+}
+
+func TestRunDistributionTest_CompletesOnceAllAcknowledge(t *testing.T) {
+	uc, repo := newFakeUseCase(t)
+	ctx := context.Background()
+
+	if _, err := repo.configs.Put(ctx, "", `{"url":"http://example.com"}`); err != nil {
+		t.Fatalf("update config: %v", err)
+	}
+	before, _ := repo.configs.LatestETag(ctx, "")
+	agent, _ := repo.CreateAgent("host-a", nil)
+	go func() {
+		for {
+			if etag, _ := repo.configs.LatestETag(ctx, ""); etag != before {
+				_, _ = uc.HandleHeartbeat(agent.ID, &dto.HeartbeatRequest{ConfigVersion: etag})
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	start := time.Now()
+	result := uc.RunDistributionTest(ctx, &dto.DistributionTestRequest{TimeoutSeconds: 30})
+	resp, ok := result.Data.(dto.DistributionTestResponse)
+	if result.Code != http.StatusOK || !ok || !resp.Complete || len(resp.Acknowledged) != 1 {
+		t.Fatalf("expected a complete test, got %d %+v", result.Code, result.Data)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("test waited %s after every agent acknowledged", elapsed)
+	}
+}
@@ -8,4 +8,31 @@ type ReceiveConfigRequest struct {
 	ID         int64             `json:"id" example:"1"`
 	ETag       string            `json:"etag" example:"v1.0.0"`
 	ConfigData models.ConfigData `json:"config_data"`
+	// DeliveryMethod is the agent path that delivered the config (push, poll,
+	// pin or cache); older agents leave it empty
+	DeliveryMethod string `json:"delivery_method,omitempty" example:"push"`
+}
+
+// ReceiveConfigResponse reports the applied ETag; NoChange is set when the
+// config was already applied and the update was skipped, and Duplicate when
+// that happened within the duplicate window of the forward that applied it
+type ReceiveConfigResponse struct {
+	ETag      string `json:"etag" example:"v1.0.0"`
+	NoChange  bool   `json:"no_change" example:"false"`
+	Duplicate bool   `json:"duplicate,omitempty" example:"false"`
+}
+
+// ConfigRejectedCode marks a ConfigRejection, telling it apart from any
+// other 400 such as a body that does not decode
+const ConfigRejectedCode = "config_rejected"
+
+// ConfigRejection explains why the worker refused a config: Field is the
+// top-level config field at fault (empty when unknown) and Reason the
+// validation message. It is the data of the 400 response to POST /config,
+// with Code set to ConfigRejectedCode.
+type ConfigRejection struct {
+	Code   string `json:"code" example:"config_rejected"`
+	ETag   string `json:"etag" example:"1a-1700000000000000000"`
+	Field  string `json:"field,omitempty" example:"url"`
+	Reason string `json:"reason" example:"invalid url: scheme must be http or https"`
 }
@@ -9,4 +9,15 @@ type HealthCheckResponse struct {
 	TargetURL   string            `json:"target_url,omitempty" example:"https://webhook.site/unique-id"`
 	Headers     map[string]string `json:"headers,omitempty" example:"{\"Authorization\":\"Bearer token123\"}"`
 	LastUpdated time.Time         `json:"last_updated,omitempty" example:"2026-01-27T12:30:45Z"`
+	// InsecureSkipVerify is true while the current target skips TLS verification
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty" example:"false"`
+	// SchemaVersion is the newest config schema this worker understands
+	SchemaVersion int `json:"schema_version" example:"2"`
+	// InFlight is the number of outbound requests currently running
+	InFlight int `json:"in_flight" example:"3"`
+	// MaxInFlight is the configured outbound concurrency limit; 0 means unlimited
+	MaxInFlight int `json:"max_in_flight" example:"32"`
+	// DuplicateForwardsSuppressed counts config forwards skipped because
+	// another delivery path applied the same ETag moments before
+	DuplicateForwardsSuppressed int64 `json:"duplicate_forwards_suppressed" example:"0"`
 }
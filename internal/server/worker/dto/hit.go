@@ -1,9 +1,66 @@
 package dto
 
+import (
+	"io"
+	"net/http"
+)
+
 type HitRequest struct{}
 
 type HitResponse struct {
-	ETag string      `json:"etag" example:"v1.0.0"`
-	URL  string      `json:"url" example:"http://example.com/api"`
-	Data interface{} `json:"data"`
+	ETag        string      `json:"etag" example:"v1.0.0"`
+	URL         string      `json:"url" example:"http://example.com/api"`
+	Data        interface{} `json:"data"`
+	ContentType string      `json:"content_type,omitempty" example:"image/png"`
+	Encoding    string      `json:"encoding,omitempty" example:"base64"`
+	// Assertions is the outcome of the config's assertions; absent when it has none
+	Assertions *AssertionReport `json:"assertions,omitempty"`
+}
+
+// AssertionReport is the outcome of checking a response against the
+// config's assertions. Passed is true only when every assertion passed.
+type AssertionReport struct {
+	Passed  bool              `json:"passed" example:"false"`
+	Results []AssertionResult `json:"results"`
+}
+
+// AssertionResult is the outcome of one assertion
+type AssertionResult struct {
+	Type   string `json:"type" example:"status"`
+	Passed bool   `json:"passed" example:"false"`
+	// Message says why the assertion failed
+	Message string `json:"message,omitempty" example:"got status 503, want 200"`
+}
+
+// HeaderAssertionsPassed reports the assertion outcome on raw responses,
+// which have no JSON envelope to carry an AssertionReport
+const HeaderAssertionsPassed = "X-Assertions-Passed"
+
+// RawHitResponse carries the upstream response unmodified for the raw
+// response encoding; the handler writes it out instead of a JSON envelope
+type RawHitResponse struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	Assertions  *AssertionReport
+}
+
+// StreamHitResponse carries the upstream response for the stream response
+// encoding. The handler copies Body to the client as it is read and must
+// close it, which frees the outbound request slot.
+type StreamHitResponse struct {
+	StatusCode int
+	// Header holds the upstream headers minus hop-by-hop ones
+	Header http.Header
+	// ContentLength is -1 when the upstream did not send one
+	ContentLength int64
+	Body          io.ReadCloser
+}
+
+// UpstreamRateLimitedResponse is returned with 429 when the upstream asked the
+// worker to slow down; hits are held back until RetryAfterSeconds elapse
+type UpstreamRateLimitedResponse struct {
+	URL               string `json:"url" example:"http://example.com/api"`
+	UpstreamStatus    int    `json:"upstream_status,omitempty" example:"429"`
+	RetryAfterSeconds int    `json:"retry_after_seconds" example:"30"`
 }
@@ -0,0 +1,42 @@
+package dto
+
+import "time"
+
+// HitRecord is one /hit outcome kept in the worker's debug history
+type HitRecord struct {
+	Timestamp  time.Time `json:"timestamp" example:"2026-01-27T12:30:45Z"`
+	Target     string    `json:"target" example:"https://ip.me"`
+	StatusCode int       `json:"status_code" example:"200"`
+	DurationMs float64   `json:"duration_ms" example:"130.5"`
+	ProxyUsed  string    `json:"proxy_used,omitempty" example:"proxy.example.com:8080"`
+	Error      string    `json:"error,omitempty"`
+	// AssertionsFailed counts the config's assertions this hit failed
+	AssertionsFailed int `json:"assertions_failed,omitempty" example:"1"`
+}
+
+// HitHistoryResponse is returned by GET /debug/hits, oldest hit first
+type HitHistoryResponse struct {
+	Enabled  bool        `json:"enabled" example:"true"`
+	Capacity int         `json:"capacity" example:"100"`
+	Hits     []HitRecord `json:"hits"`
+}
+
+// CollectResult is one scheduled hit made in collect mode
+type CollectResult struct {
+	Timestamp time.Time   `json:"timestamp" example:"2026-01-27T12:30:45Z"`
+	Success   bool        `json:"success" example:"true"`
+	ETag      string      `json:"etag,omitempty" example:"v1.0.0"`
+	URL       string      `json:"url,omitempty" example:"https://ip.me"`
+	Data      interface{} `json:"data,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	// Assertions is the outcome of the config's assertions; absent when it has none
+	Assertions *AssertionReport `json:"assertions,omitempty"`
+}
+
+// CollectResultsResponse is returned by GET /results, oldest result first
+type CollectResultsResponse struct {
+	Enabled         bool            `json:"enabled" example:"true"`
+	IntervalSeconds int             `json:"interval_seconds,omitempty" example:"60"`
+	Capacity        int             `json:"capacity" example:"100"`
+	Results         []CollectResult `json:"results"`
+}
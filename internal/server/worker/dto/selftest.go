@@ -0,0 +1,18 @@
+package dto
+
+// SelfTestResponse is the diagnostic returned by GET /selftest. Phase timings
+// are in milliseconds and omitted when the phase did not happen.
+type SelfTestResponse struct {
+	Configured          bool     `json:"configured" example:"true"`
+	ETag                string   `json:"etag,omitempty" example:"v1.0.0"`
+	TargetURL           string   `json:"target_url,omitempty" example:"https://ip.me"`
+	ProxyUsed           string   `json:"proxy_used,omitempty" example:"proxy.example.com:8080"`
+	DNSMs               *float64 `json:"dns_ms,omitempty" example:"1.2"`
+	ConnectMs           *float64 `json:"connect_ms,omitempty" example:"15.4"`
+	TLSMs               *float64 `json:"tls_ms,omitempty" example:"32.1"`
+	TTFBMs              *float64 `json:"ttfb_ms,omitempty" example:"120.8"`
+	TotalMs             float64  `json:"total_ms" example:"130.5"`
+	ConnectionReused    bool     `json:"connection_reused"`
+	ExtractionSucceeded bool     `json:"extraction_succeeded"`
+	Error               string   `json:"error,omitempty"`
+}
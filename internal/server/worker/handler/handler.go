@@ -1,8 +1,12 @@
 package handler
 
 import (
+	"context"
+	"strconv"
 	"time"
 
+	"github.com/Alwanly/service-distribute-management/internal/config"
+	"github.com/Alwanly/service-distribute-management/internal/models"
 	"github.com/Alwanly/service-distribute-management/internal/server/worker/dto"
 	"github.com/Alwanly/service-distribute-management/internal/server/worker/repository"
 	"github.com/Alwanly/service-distribute-management/internal/server/worker/usecase"
@@ -18,9 +22,9 @@ type Handler struct {
 	UseCase usecase.UseCaseInterface
 }
 
-func NewHandler(d deps.App, timeout time.Duration) *Handler {
+func NewHandler(d deps.App, cfg *config.WorkerConfig) *Handler {
 	repo := repository.NewRepository()
-	uc := usecase.NewUseCase(repo, timeout)
+	uc := usecase.NewUseCase(repo, cfg)
 
 	h := &Handler{
 		UseCase: uc,
@@ -29,26 +33,63 @@ func NewHandler(d deps.App, timeout time.Duration) *Handler {
 	d.Fiber.Get("/health", h.health)
 	d.Fiber.Post("/config", h.receiveConfig)
 	d.Fiber.Post("/hit", h.hit)
+	d.Fiber.Get("/selftest", h.selfTest)
+	d.Fiber.Get("/debug/hits", h.hitHistory)
+	d.Fiber.Get("/results", h.collectResults)
 
 	return h
 }
 
+// defaultDrainTimeout is how long in-flight hits may finish on shutdown
+// when the shutdown context has no deadline
+const defaultDrainTimeout = 5 * time.Second
+
+// Shutdown stops app accepting requests, gives in-flight hits half of the
+// remaining shutdown time to finish, then cancels those still waiting on an
+// upstream and waits for the server to close. Stopping the server first
+// means no hit can start after the cancellation and hold it open.
+func (h *Handler) Shutdown(ctx context.Context, app *fiber.App) error {
+	closed := make(chan error, 1)
+	go func() {
+		closed <- app.ShutdownWithContext(ctx)
+	}()
+
+	drain := defaultDrainTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		drain = time.Until(deadline) / 2
+	}
+	timer := time.NewTimer(drain)
+	defer timer.Stop()
+
+	select {
+	case err := <-closed:
+		h.UseCase.CancelInFlight()
+		return err
+	case <-timer.C:
+	}
+	cancelled := h.UseCase.CancelInFlight()
+	h.Logger.Info("cancelled in-flight proxy requests", logger.Int("count", cancelled))
+	return <-closed
+}
+
 // receiveConfig godoc
 // @Summary      Receive configuration update
 // @Description  Receive and apply new configuration from the agent service. Configuration includes target URL, headers, and timeout.
 // @Tags         configuration
 // @Accept       json
 // @Produce      json
-// @Success      200 {object} wrapper.JSONResult{data=dto.ReceiveConfigRequest} "Successfully applied configuration"
-// @Failure      400 {object} wrapper.JSONResult "Invalid request body or validation error"
+// @Success      200 {object} wrapper.JSONResult{data=dto.ReceiveConfigResponse} "Applied configuration; no_change is true when the ETag was already applied, duplicate when another delivery applied it moments before"
+// @Failure      400 {object} wrapper.JSONResult{data=dto.ConfigRejection} "Invalid request body, or a config the worker rejects (data names the field and reason)"
+// @Failure      415 {object} wrapper.JSONResult "Body not sent as application/json"
 // @Router       /config [post]
 func (h *Handler) receiveConfig(c *fiber.Ctx) error {
 	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "receive_config"))
 
 	req := new(dto.ReceiveConfigRequest)
-	if err := c.BodyParser(req); err != nil {
+	if err := validator.BindJSON(c, req); err != nil {
 		logger.AddToContext(c.UserContext(), zap.Error(err))
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		res := validator.BodyErrorResponse(err)
+		return c.Status(res.Code).JSON(res)
 	}
 
 	if err := validator.ValidateStruct(req); err != nil {
@@ -57,37 +98,114 @@ func (h *Handler) receiveConfig(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(errs)
 	}
 
-	// Idempotency check: if ETag matches current config, skip processing
-	current := h.UseCase.GetConfig()
-	if req.ETag != "" && current != nil && current.ETag == req.ETag {
-		logger.AddToContext(c.UserContext(), zap.String(logger.FieldETag, req.ETag))
-		h.Logger.Info("Configuration already applied (idempotent)", zap.String("etag", req.ETag), zap.Bool("skipped", true))
-		return c.Status(fiber.StatusOK).JSON(fiber.Map{
-			"message": "Configuration already up-to-date",
-			"etag":    req.ETag,
-		})
-	}
-
 	res := h.UseCase.ReceiveConfig(c.UserContext(), req)
+	if res.Success && req.ConfigData.InsecureSkipVerify {
+		h.Logger.Warn("TLS certificate verification is DISABLED for the configured target",
+			zap.String("target_url", req.ConfigData.URL),
+			zap.String("etag", req.ETag),
+			zap.Bool("insecure_skip_verify", true),
+		)
+	}
+	if !res.Success {
+		return c.Status(res.Code).JSON(res)
+	}
 	return c.Status(res.Code).JSON(res.Data)
 }
 
 // hit godoc
 // @Summary      Proxy request to target URL
-// @Description  Forward incoming request to the configured target URL with configured headers. Returns proxied response.
+// @Description  Forward incoming request to the configured target URL with configured headers. Returns proxied response; with response_encoding=base64 the body is base64 encoded, with raw it is passed through unmodified, and with stream it is passed through unmodified without being buffered in the worker. When the config has assertions, their outcome is returned in data.assertions (raw responses set X-Assertions-Passed instead).
 // @Tags         proxy
 // @Accept       */*
 // @Produce      */*
 // @Param        body body string false "Request body to forward"
 // @Router       /hit [post]
 // @Success      200 {object} wrapper.JSONResult{data=dto.HitResponse} "Successfully proxied request"
+// @Failure      429 {object} wrapper.JSONResult{data=dto.UpstreamRateLimitedResponse} "Too many in-flight outbound requests, or the upstream is rate limiting (Retry-After is set)"
 func (h *Handler) hit(c *fiber.Ctx) error {
 
 	res := h.UseCase.HitRequest(c.UserContext())
 
+	// Raw encoding passes the upstream bytes and content type through unmodified
+	if raw, ok := res.Data.(*dto.RawHitResponse); ok {
+		if raw.ContentType != "" {
+			c.Set(fiber.HeaderContentType, raw.ContentType)
+		}
+		if raw.Assertions != nil {
+			c.Set(dto.HeaderAssertionsPassed, strconv.FormatBool(raw.Assertions.Passed))
+		}
+		return c.Status(raw.StatusCode).Send(raw.Body)
+	}
+
+	// Stream encoding copies the upstream body to the client as it arrives;
+	// fasthttp closes the body once it has been written out
+	if stream, ok := res.Data.(*dto.StreamHitResponse); ok {
+		for name, values := range stream.Header {
+			for _, value := range values {
+				c.Response().Header.Add(name, value)
+			}
+		}
+		c.Status(stream.StatusCode)
+		return c.SendStream(stream.Body, int(stream.ContentLength))
+	}
+
+	if limited, ok := res.Data.(*dto.UpstreamRateLimitedResponse); ok {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(limited.RetryAfterSeconds))
+	}
+
 	return c.Status(res.Code).JSON(res)
 }
 
+// selfTest godoc
+// @Summary      Self-test current configuration
+// @Description  Perform a request against the configured target and return a timing breakdown (DNS, connect, TLS, time to first byte) and whether extraction succeeded
+// @Tags         proxy
+// @Produce      json
+// @Success      200 {object} dto.SelfTestResponse "Target reachable and response extracted"
+// @Failure      502 {object} dto.SelfTestResponse "Request or extraction failed"
+// @Failure      503 {object} dto.SelfTestResponse "No configuration available"
+// @Router       /selftest [get]
+func (h *Handler) selfTest(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "self_test"))
+
+	result := h.UseCase.SelfTest(c.UserContext())
+
+	status := fiber.StatusOK
+	switch {
+	case !result.Configured:
+		status = fiber.StatusServiceUnavailable
+	case !result.ExtractionSucceeded:
+		status = fiber.StatusBadGateway
+	}
+	return c.Status(status).JSON(result)
+}
+
+// hitHistory godoc
+// @Summary      Recent hit history
+// @Description  Return the most recent /hit outcomes (timestamp, target, upstream status, duration, proxy, error), oldest first. Empty unless WORKER_HIT_HISTORY_SIZE is set.
+// @Tags         debug
+// @Produce      json
+// @Success      200 {object} dto.HitHistoryResponse
+// @Router       /debug/hits [get]
+func (h *Handler) hitHistory(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "hit_history"))
+
+	return c.JSON(h.UseCase.HitHistory())
+}
+
+// collectResults godoc
+// @Summary      Collect mode results
+// @Description  Return the results of the worker's scheduled hits made while the config has collect_enabled set, oldest first
+// @Tags         proxy
+// @Produce      json
+// @Success      200 {object} dto.CollectResultsResponse
+// @Router       /results [get]
+func (h *Handler) collectResults(c *fiber.Ctx) error {
+	logger.AddToContext(c.UserContext(), logger.String(logger.FieldOperation, "collect_results"))
+
+	return c.JSON(h.UseCase.CollectResults())
+}
+
 // health godoc
 // @Summary     Health check
 // @Description Get worker health status and current configuration state
@@ -101,13 +219,20 @@ func (h *Handler) health(c *fiber.Ctx) error {
 
 	cfg := h.UseCase.GetCurrentConfig()
 
+	inFlight, maxInFlight := h.UseCase.InFlight()
 	response := dto.HealthCheckResponse{
-		Status:     "healthy",
-		Configured: cfg != nil,
+		Status:        "healthy",
+		Configured:    cfg != nil,
+		SchemaVersion: models.ConfigSchemaVersion,
+		InFlight:      inFlight,
+		MaxInFlight:   maxInFlight,
+
+		DuplicateForwardsSuppressed: h.UseCase.DuplicateForwards(),
 	}
 
 	if cfg != nil {
 		response.TargetURL = cfg.URL
+		response.InsecureSkipVerify = cfg.InsecureSkipVerify
 	}
 
 	return c.JSON(response)
@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"github.com/Alwanly/service-distribute-management/internal/config"
+	"github.com/Alwanly/service-distribute-management/internal/server/worker/dto"
+	"github.com/Alwanly/service-distribute-management/pkg/deps"
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+)
+
+func TestNewHandler_UsesInjectedLogger(t *testing.T) {
+	log := logger.New(zap.NewNop())
+	h := NewHandler(deps.App{Fiber: fiber.New(), Logger: log}, &config.WorkerConfig{RequestTimeout: time.Second})
+	if h.Logger != log {
+		t.Fatal("expected the handler to log through the logger from the dependency container")
+	}
+}
+
+func TestReceiveConfig_ContentType(t *testing.T) {
+	app := fiber.New()
+	NewHandler(deps.App{Fiber: app, Logger: logger.New(zap.NewNop())}, &config.WorkerConfig{RequestTimeout: time.Second})
+
+	validBody := `{"id":1,"etag":"etag-1","config_data":{"url":"http://example.com"}}`
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantMessage string
+	}{
+		{
+			name:        "form encoded",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "etag=etag-1",
+			wantStatus:  http.StatusUnsupportedMediaType,
+			wantMessage: `unsupported Content-Type "application/x-www-form-urlencoded", expected application/json`,
+		},
+		{
+			name:        "missing content type",
+			body:        validBody,
+			wantStatus:  http.StatusUnsupportedMediaType,
+			wantMessage: "missing Content-Type, expected application/json",
+		},
+		{
+			name:        "malformed json",
+			contentType: "application/json",
+			body:        `{"etag":`,
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "malformed JSON body: unexpected end of JSON input",
+		},
+		{
+			name:        "json with charset",
+			contentType: "application/json; charset=utf-8",
+			body:        validBody,
+			wantStatus:  http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/config", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set(fiber.HeaderContentType, tt.contentType)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			defer resp.Body.Close()
+
+			raw, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, raw)
+			}
+			if tt.wantMessage == "" {
+				return
+			}
+			var body struct {
+				Success bool   `json:"success"`
+				Message string `json:"message"`
+			}
+			if err := json.Unmarshal(raw, &body); err != nil {
+				t.Fatalf("decode %s: %v", raw, err)
+			}
+			if body.Success || body.Message != tt.wantMessage {
+				t.Fatalf("got %+v, want message %q", body, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestReceiveConfig_RejectionNamesField(t *testing.T) {
+	app := fiber.New()
+	NewHandler(deps.App{Fiber: app, Logger: logger.New(zap.NewNop())}, &config.WorkerConfig{RequestTimeout: time.Second})
+
+	req := httptest.NewRequest(http.MethodPost, "/config",
+		strings.NewReader(`{"id":1,"etag":"etag-1","config_data":{"url":"http://example.com","collect_interval":-1}}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	raw, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400: %s", resp.StatusCode, raw)
+	}
+	var body struct {
+		Success bool `json:"success"`
+		Data    struct {
+			Code   string `json:"code"`
+			ETag   string `json:"etag"`
+			Field  string `json:"field"`
+			Reason string `json:"reason"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		t.Fatalf("decode %s: %v", raw, err)
+	}
+	if body.Success || body.Data.Code != dto.ConfigRejectedCode || body.Data.ETag != "etag-1" || body.Data.Field != "collect_interval" || body.Data.Reason == "" {
+		t.Fatalf("unexpected rejection %s", raw)
+	}
+}
+
+func TestHit_DropsHopByHopHeaders(t *testing.T) {
+	const payload = "upstream body"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Connection", "X-Hop-Token")
+		w.Header().Set("X-Hop-Token", "per-connection")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("Proxy-Authenticate", "Basic")
+		w.Header().Set("X-Upstream", "yes")
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(payload))
+	}))
+	defer upstream.Close()
+
+	for _, encoding := range []string{"raw", "stream"} {
+		t.Run(encoding, func(t *testing.T) {
+			app := fiber.New()
+			NewHandler(deps.App{Fiber: app, Logger: logger.New(zap.NewNop())}, &config.WorkerConfig{RequestTimeout: time.Second})
+
+			cfg := `{"id":1,"etag":"etag-1","config_data":{"url":"` + upstream.URL + `","response_encoding":"` + encoding + `"}}`
+			req := httptest.NewRequest(http.MethodPost, "/config", strings.NewReader(cfg))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			if resp, err := app.Test(req); err != nil || resp.StatusCode != http.StatusOK {
+				t.Fatalf("apply config: %v %+v", err, resp)
+			}
+
+			resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/hit", nil), 5000)
+			if err != nil {
+				t.Fatalf("hit: %v", err)
+			}
+			defer resp.Body.Close()
+			raw, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusOK || string(raw) != payload {
+				t.Fatalf("got %d %q, want 200 %q", resp.StatusCode, raw, payload)
+			}
+
+			for _, name := range []string{"X-Hop-Token", "Keep-Alive", "Proxy-Authenticate"} {
+				if v := resp.Header.Get(name); v != "" {
+					t.Errorf("hop-by-hop header %s forwarded: %q", name, v)
+				}
+			}
+			if got := resp.Header.Get(fiber.HeaderContentLength); got != strconv.Itoa(len(raw)) {
+				t.Errorf("Content-Length = %q, body is %d bytes", got, len(raw))
+			}
+			if encoding == "stream" && resp.Header.Get("X-Upstream") != "yes" {
+				t.Errorf("end-to-end header dropped: %v", resp.Header)
+			}
+		})
+	}
+}
+
+func TestShutdown_CancelsHitsStillInFlightAfterDrain(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer upstream.Close()
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	h := NewHandler(deps.App{Fiber: app, Logger: logger.New(zap.NewNop())}, &config.WorkerConfig{RequestTimeout: 30 * time.Second})
+	cfg := `{"id":1,"etag":"etag-1","config_data":{"url":"` + upstream.URL + `"}}`
+	req := httptest.NewRequest(http.MethodPost, "/config", strings.NewReader(cfg))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if resp, err := app.Test(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("apply config: %v %+v", err, resp)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = app.Listener(ln) }()
+	base := "http://" + ln.Addr().String()
+
+	hit := make(chan int, 1)
+	go func() {
+		resp, err := http.Post(base+"/hit", "", nil)
+		if err != nil {
+			hit <- 0
+			return
+		}
+		resp.Body.Close()
+		hit <- resp.StatusCode
+	}()
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if current, _ := h.UseCase.InFlight(); current == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("hit never reached the upstream")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- h.Shutdown(ctx, app) }()
+
+	// The listener closes first, so a request arriving now never starts a hit
+	time.Sleep(50 * time.Millisecond)
+	if resp, err := http.Post(base+"/hit", "", nil); err == nil {
+		resp.Body.Close()
+		t.Fatalf("request during shutdown got %d, want it refused", resp.StatusCode)
+	}
+
+	select {
+	case code := <-hit:
+		if code != http.StatusServiceUnavailable {
+			t.Fatalf("in-flight hit got %d, want 503", code)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("in-flight hit was not cancelled")
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("shutdown: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("shutdown did not return")
+	}
+	if current, _ := h.UseCase.InFlight(); current != 0 {
+		t.Fatalf("%d hits still in flight after shutdown", current)
+	}
+}
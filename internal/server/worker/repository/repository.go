@@ -2,7 +2,7 @@ package repository
 
 import (
 	"encoding/json"
-	"sync"
+	"sync/atomic"
 
 	"github.com/Alwanly/service-distribute-management/internal/models"
 )
@@ -14,38 +14,42 @@ type StorageData struct {
 type IRepository interface {
 	GetCurrentConfig() (*StorageData, error)
 	UpdateConfig(config *models.Configuration) error
+	// Flags returns the feature flags of the active config, nil before one
+	// is applied
+	Flags() models.Flags
 }
+
+// Repository keeps the active configuration behind an atomic pointer. Updates
+// build a new StorageData and swap it in, so readers always see a complete
+// config and requests already holding the old pointer finish on it.
 type Repository struct {
-	currentConfig *StorageData
-	mutex         sync.RWMutex
+	currentConfig atomic.Pointer[StorageData]
 }
 
 func NewRepository() IRepository {
-	return &Repository{
-		currentConfig: nil,
-		mutex:         sync.RWMutex{},
-	}
+	return &Repository{}
 }
 func (r *Repository) GetCurrentConfig() (*StorageData, error) {
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
-
-	return r.currentConfig, nil
+	return r.currentConfig.Load(), nil
 }
 func (r *Repository) UpdateConfig(config *models.Configuration) error {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
-
 	var configData models.ConfigData
 	err := json.Unmarshal([]byte(config.ConfigData), &configData)
 	if err != nil {
 		return err
 	}
 
-	r.currentConfig = &StorageData{
+	r.currentConfig.Store(&StorageData{
 		Config: configData,
 		ETag:   config.ETag,
-	}
+	})
 
 	return nil
 }
+
+func (r *Repository) Flags() models.Flags {
+	if data := r.currentConfig.Load(); data != nil {
+		return data.Config.Flags
+	}
+	return nil
+}
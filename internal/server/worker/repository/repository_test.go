@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Alwanly/service-distribute-management/internal/models"
+)
+
+func TestUpdateConfig_ReadersNeverSeeTornConfig(t *testing.T) {
+	repo := NewRepository()
+
+	configs := []*models.Configuration{
+		{ETag: "a", ConfigData: `{"url":"http://a.example","proxy":"proxy-a:8080"}`},
+		{ETag: "b", ConfigData: `{"url":"http://b.example","proxy":"proxy-b:8080"}`},
+	}
+	want := map[string]models.ConfigData{
+		"a": {URL: "http://a.example", Proxy: "proxy-a:8080"},
+		"b": {URL: "http://b.example", Proxy: "proxy-b:8080"},
+	}
+	if err := repo.UpdateConfig(configs[0]); err != nil {
+		t.Fatalf("update config: %v", err)
+	}
+
+	var stop atomic.Bool
+	var torn atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stop.Load() {
+				data, _ := repo.GetCurrentConfig()
+				w := want[data.ETag]
+				if data.Config.URL != w.URL || data.Config.Proxy != w.Proxy {
+					torn.Add(1)
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 10000; i++ {
+		if err := repo.UpdateConfig(configs[i%2]); err != nil {
+			t.Fatalf("update config: %v", err)
+		}
+	}
+	stop.Store(true)
+	wg.Wait()
+
+	if n := torn.Load(); n > 0 {
+		t.Fatalf("observed %d torn config reads", n)
+	}
+}
+
+func TestFlags(t *testing.T) {
+	repo := NewRepository()
+	if flags := repo.Flags(); flags != nil || !flags.Bool("enable_cache", true) || flags.String("mode", "lenient") != "lenient" {
+		t.Fatalf("expected defaults before a config is applied, got %v", flags)
+	}
+
+	err := repo.UpdateConfig(&models.Configuration{ETag: "a", ConfigData: `{
+		"url": "http://a.example",
+		"flags": {"enable_cache": true, "strict_validation": "false", "rollout": "1", "mode": "strict", "weight": 3}
+	}`})
+	if err != nil {
+		t.Fatalf("update config: %v", err)
+	}
+	flags := repo.Flags()
+
+	bools := []struct {
+		name string
+		def  bool
+		want bool
+	}{
+		{name: "enable_cache", def: false, want: true},
+		{name: "strict_validation", def: true, want: false},
+		{name: "rollout", def: false, want: true},
+		// Unusable values and missing flags fall back to the default
+		{name: "mode", def: true, want: true},
+		{name: "weight", def: true, want: true},
+		{name: "missing", def: true, want: true},
+	}
+	for _, tt := range bools {
+		if got := flags.Bool(tt.name, tt.def); got != tt.want {
+			t.Errorf("Bool(%q, %v) = %v, want %v", tt.name, tt.def, got, tt.want)
+		}
+	}
+
+	strs := []struct {
+		name string
+		want string
+	}{
+		{name: "mode", want: "strict"},
+		{name: "enable_cache", want: "true"},
+		{name: "weight", want: "default"},
+		{name: "missing", want: "default"},
+	}
+	for _, tt := range strs {
+		if got := flags.String(tt.name, "default"); got != tt.want {
+			t.Errorf("String(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package usecase
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Alwanly/service-distribute-management/internal/models"
+	"github.com/Alwanly/service-distribute-management/internal/server/worker/dto"
+)
+
+// checkAssertions checks the upstream status and body against the config's
+// assertions, returning nil when there are none. The assertions were
+// validated when the config was received.
+func checkAssertions(status int, body []byte, assertions []models.Assertion) *dto.AssertionReport {
+	if len(assertions) == 0 {
+		return nil
+	}
+
+	report := &dto.AssertionReport{Passed: true, Results: make([]dto.AssertionResult, 0, len(assertions))}
+	for _, a := range assertions {
+		result := dto.AssertionResult{Type: a.Type, Passed: true}
+		if msg := checkAssertion(status, body, a); msg != "" {
+			result.Passed = false
+			result.Message = msg
+			report.Passed = false
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+// checkAssertion returns why the response fails a, or "" when it passes
+func checkAssertion(status int, body []byte, a models.Assertion) string {
+	switch a.Type {
+	case models.AssertionStatus:
+		if status != a.Status {
+			return fmt.Sprintf("got status %d, want %d", status, a.Status)
+		}
+	case models.AssertionContains:
+		if !bytes.Contains(body, []byte(a.Value)) {
+			return fmt.Sprintf("body does not contain %q", a.Value)
+		}
+	case models.AssertionJSON:
+		if !json.Valid(body) {
+			return "body is not valid JSON"
+		}
+	default:
+		return fmt.Sprintf("unknown assertion type %q", a.Type)
+	}
+	return ""
+}
+
+// failedAssertions counts the failed assertions of report
+func failedAssertions(report *dto.AssertionReport) int {
+	if report == nil {
+		return 0
+	}
+	failed := 0
+	for _, r := range report.Results {
+		if !r.Passed {
+			failed++
+		}
+	}
+	return failed
+}
@@ -0,0 +1,103 @@
+package usecase
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// minUpstreamBackoff is the first pause after a rate-limit response
+	// without a usable Retry-After; each further one doubles it
+	minUpstreamBackoff = time.Second
+	// maxUpstreamBackoff caps both the doubling and Retry-After values
+	maxUpstreamBackoff = 5 * time.Minute
+)
+
+// upstreamBackoff pauses hits to a target that answered 429 (or 503 with
+// Retry-After) so the worker doesn't keep hammering a rate-limited upstream.
+// Only the current target is tracked; a config change to another URL starts
+// clean.
+type upstreamBackoff struct {
+	mutex   sync.Mutex
+	target  string
+	until   time.Time
+	strikes int
+	now     func() time.Time
+}
+
+func newUpstreamBackoff() *upstreamBackoff {
+	return &upstreamBackoff{now: time.Now}
+}
+
+// wait returns how much longer hits to target must be held back, or 0
+func (b *upstreamBackoff) wait(target string) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.target != target {
+		return 0
+	}
+	if d := b.until.Sub(b.now()); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// observe inspects an upstream response. Rate-limit responses start or extend
+// the backoff and return its length; anything else clears it and returns 0.
+func (b *upstreamBackoff) observe(target string, resp *http.Response) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.target != target {
+		b.target = target
+		b.strikes = 0
+		b.until = time.Time{}
+	}
+
+	now := b.now()
+	retryAfter, hasRetryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), now)
+	limited := resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode == http.StatusServiceUnavailable && hasRetryAfter)
+	if !limited {
+		b.strikes = 0
+		b.until = time.Time{}
+		return 0
+	}
+
+	b.strikes++
+	delay := retryAfter
+	if !hasRetryAfter {
+		delay = minUpstreamBackoff << min(b.strikes-1, 16)
+	}
+	if delay > maxUpstreamBackoff {
+		delay = maxUpstreamBackoff
+	}
+	b.until = now.Add(delay)
+	return delay
+}
+
+// parseRetryAfter reads a Retry-After header given either as delay seconds or
+// as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := at.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
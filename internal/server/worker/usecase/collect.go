@@ -0,0 +1,96 @@
+package usecase
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	dto "github.com/Alwanly/service-distribute-management/internal/server/worker/dto"
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+	"github.com/Alwanly/service-distribute-management/pkg/wrapper"
+	"go.uber.org/zap"
+)
+
+// defaultCollectResults is how many collected results are kept when the
+// worker config does not say
+const defaultCollectResults = 100
+
+// RunCollector hits the target every collect_interval seconds while the
+// current config has collect_enabled set, storing each outcome for
+// GET /results. It reacts to config changes immediately and returns when ctx
+// is cancelled.
+func (uc *UseCase) RunCollector(ctx context.Context, log *logger.CanonicalLogger) {
+	for {
+		var tick <-chan time.Time
+		var timer *time.Timer
+
+		if data, err := uc.repo.GetCurrentConfig(); err == nil && data != nil && data.Config.CollectEnabled {
+			uc.collectOnce(ctx, log)
+			timer = time.NewTimer(time.Duration(data.Config.CollectInterval) * uc.collectUnit)
+			tick = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-uc.configChanged:
+		case <-tick:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// collectOnce performs one scheduled hit and stores its outcome
+func (uc *UseCase) collectOnce(ctx context.Context, log *logger.CanonicalLogger) {
+	lc := logger.NewLogContext()
+	hitCtx := logger.WithLogContext(ctx, lc)
+	result := dto.CollectResult{Timestamp: time.Now().UTC()}
+
+	res := uc.HitRequest(hitCtx)
+	if err := drainStream(res); err != nil {
+		res = wrapper.ResponseFailed(http.StatusBadGateway, "failed to read response body", nil)
+	}
+	result.Success = res.Success
+	if hit, ok := res.Data.(*dto.HitResponse); ok && res.Success {
+		result.ETag = hit.ETag
+		result.URL = hit.URL
+		result.Data = hit.Data
+		result.Assertions = hit.Assertions
+	} else {
+		result.Error = res.Message
+	}
+	uc.results.add(result)
+
+	// Scheduled hits have no request to hang a canonical log line on, so log here
+	fields := append(lc.Fields(), zap.String(logger.FieldOperation, "collect"), zap.Int("status", res.Code))
+	if res.Success {
+		log.Debug("collect hit completed", fields...)
+	} else {
+		log.Warn("collect hit failed", append(fields, zap.String("error", res.Message))...)
+	}
+}
+
+func (uc *UseCase) CollectResults() dto.CollectResultsResponse {
+	resp := dto.CollectResultsResponse{
+		Capacity: uc.results.capacity(),
+		Results:  uc.results.list(),
+	}
+	if data, err := uc.repo.GetCurrentConfig(); err == nil && data != nil {
+		resp.Enabled = data.Config.CollectEnabled
+		resp.IntervalSeconds = data.Config.CollectInterval
+	}
+	return resp
+}
+
+// notifyConfigChanged wakes the collector so a new schedule applies at once
+func (uc *UseCase) notifyConfigChanged() {
+	select {
+	case uc.configChanged <- struct{}{}:
+	default:
+	}
+}
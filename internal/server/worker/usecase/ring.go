@@ -0,0 +1,59 @@
+package usecase
+
+import (
+	"sync"
+)
+
+// ringBuffer is a fixed-size, thread-safe buffer of the most recent items.
+// Once full, each new item overwrites the oldest one. A nil ringBuffer is
+// disabled: adds are dropped and list returns an empty slice.
+type ringBuffer[T any] struct {
+	mu    sync.Mutex
+	items []T
+	next  int
+	full  bool
+}
+
+func newRingBuffer[T any](size int) *ringBuffer[T] {
+	if size <= 0 {
+		return nil
+	}
+	return &ringBuffer[T]{items: make([]T, size)}
+}
+
+func (r *ringBuffer[T]) add(item T) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.items[r.next] = item
+	r.next = (r.next + 1) % len(r.items)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list returns a copy of the stored items, oldest first
+func (r *ringBuffer[T]) list() []T {
+	if r == nil {
+		return []T{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]T{}, r.items[:r.next]...)
+	}
+	out := make([]T, 0, len(r.items))
+	out = append(out, r.items[r.next:]...)
+	return append(out, r.items[:r.next]...)
+}
+
+func (r *ringBuffer[T]) capacity() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.items)
+}
@@ -0,0 +1,72 @@
+package usecase
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	dto "github.com/Alwanly/service-distribute-management/internal/server/worker/dto"
+	"github.com/Alwanly/service-distribute-management/pkg/wrapper"
+)
+
+// hopByHopHeaders apply to a single connection and are not forwarded.
+// Content-Length is dropped too; the handler sets it from ContentLength.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Content-Length",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// streamHeaders returns the upstream headers to pass on with a streamed
+// body: the standard hop-by-hop headers and any header the upstream named
+// in Connection as specific to its connection (RFC 7230 section 6.1)
+func streamHeaders(upstream http.Header) http.Header {
+	header := upstream.Clone()
+	for _, value := range upstream.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		header.Del(name)
+	}
+	return header
+}
+
+// streamBody is an upstream body handed to the handler. Closing it closes
+// the upstream body and releases the request's slot, once.
+type streamBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *streamBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// drainStream reads and closes the body of a streamed hit result, for
+// callers that have no client to stream to. Other results are left as is.
+func drainStream(res wrapper.JSONResult) error {
+	stream, ok := res.Data.(*dto.StreamHitResponse)
+	if !ok {
+		return nil
+	}
+	_, err := io.Copy(io.Discard, stream.Body)
+	if closeErr := stream.Body.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+package usecase
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// hitTiming records the phases of an outbound request through httptrace.
+// Hooks may fire from dialer goroutines, so all fields are guarded.
+type hitTiming struct {
+	mutex     sync.Mutex
+	start     time.Time
+	dnsStart  time.Time
+	dnsDone   time.Time
+	connStart time.Time
+	connDone  time.Time
+	tlsStart  time.Time
+	tlsDone   time.Time
+	firstByte time.Time
+	reused    bool
+}
+
+// timingBreakdown holds the measured phase durations. A nil phase did not
+// happen, e.g. no DNS lookup for an IP literal or no TLS for plain HTTP.
+type timingBreakdown struct {
+	DNS     *time.Duration
+	Connect *time.Duration
+	TLS     *time.Duration
+	TTFB    *time.Duration
+	Reused  bool
+}
+
+func newHitTiming() *hitTiming {
+	return &hitTiming{start: time.Now()}
+}
+
+// withTrace attaches the timing hooks to ctx
+func (t *hitTiming) withTrace(ctx context.Context) context.Context {
+	mark := func(field *time.Time) {
+		t.mutex.Lock()
+		if field.IsZero() {
+			*field = time.Now()
+		}
+		t.mutex.Unlock()
+	}
+	markLast := func(field *time.Time) {
+		t.mutex.Lock()
+		*field = time.Now()
+		t.mutex.Unlock()
+	}
+
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { mark(&t.dnsStart) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { markLast(&t.dnsDone) },
+		ConnectStart:      func(string, string) { mark(&t.connStart) },
+		ConnectDone:       func(string, string, error) { markLast(&t.connDone) },
+		TLSHandshakeStart: func() { mark(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { markLast(&t.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mutex.Lock()
+			t.reused = info.Reused
+			t.mutex.Unlock()
+		},
+		GotFirstResponseByte: func() { mark(&t.firstByte) },
+	})
+}
+
+func (t *hitTiming) breakdown() timingBreakdown {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	between := func(from, to time.Time) *time.Duration {
+		if from.IsZero() || to.IsZero() {
+			return nil
+		}
+		d := to.Sub(from)
+		return &d
+	}
+
+	return timingBreakdown{
+		DNS:     between(t.dnsStart, t.dnsDone),
+		Connect: between(t.connStart, t.connDone),
+		TLS:     between(t.tlsStart, t.tlsDone),
+		TTFB:    between(t.start, t.firstByte),
+		Reused:  t.reused,
+	}
+}
+
+// durationMillis converts an optional duration to fractional milliseconds
+func durationMillis(d *time.Duration) *float64 {
+	if d == nil {
+		return nil
+	}
+	ms := float64(d.Microseconds()) / 1000
+	return &ms
+}
+
+// logFields returns the measured phases as log fields in milliseconds;
+// phases that did not happen are left out
+func (b timingBreakdown) logFields() []zap.Field {
+	fields := []zap.Field{zap.Bool("connection_reused", b.Reused)}
+	for _, phase := range []struct {
+		key string
+		d   *time.Duration
+	}{
+		{"dns_ms", b.DNS},
+		{"connect_ms", b.Connect},
+		{"tls_ms", b.TLS},
+		{"ttfb_ms", b.TTFB},
+	} {
+		if ms := durationMillis(phase.d); ms != nil {
+			fields = append(fields, zap.Float64(phase.key, *ms))
+		}
+	}
+	return fields
+}
@@ -0,0 +1,106 @@
+package usecase
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/Alwanly/service-distribute-management/internal/models"
+	"github.com/Alwanly/service-distribute-management/internal/server/worker/repository"
+)
+
+// transformPipeline is a config's transforms with their regular expressions
+// compiled once, when the config is applied, instead of on every hit
+type transformPipeline struct {
+	etag     string
+	steps    []models.Transform
+	patterns []*regexp.Regexp // By step; nil for steps without a pattern
+}
+
+// compileTransforms prepares the transforms of the config with etag
+func compileTransforms(etag string, transforms []models.Transform) (*transformPipeline, error) {
+	p := &transformPipeline{etag: etag, steps: transforms, patterns: make([]*regexp.Regexp, len(transforms))}
+	for i, t := range transforms {
+		if t.Op != models.TransformRegexMatch {
+			continue
+		}
+		re, err := regexp.Compile(t.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("transforms[%d] %s: %w", i, t.Op, err)
+		}
+		p.patterns[i] = re
+	}
+	return p, nil
+}
+
+// transformPipeline returns the compiled pipeline of data, compiling it only
+// when data was stored without going through ReceiveConfig
+func (uc *UseCase) transformPipeline(data *repository.StorageData) (*transformPipeline, error) {
+	if p := uc.transforms.Load(); p != nil && p.etag == data.ETag {
+		return p, nil
+	}
+	p, err := compileTransforms(data.ETag, data.Config.Transforms)
+	if err != nil {
+		return nil, err
+	}
+	uc.transforms.Store(p)
+	return p, nil
+}
+
+// apply runs the pipeline over the response body
+func (p *transformPipeline) apply(body string) (string, error) {
+	out := body
+	for i, t := range p.steps {
+		var err error
+		out, err = applyTransform(out, t, p.patterns[i])
+		if err != nil {
+			return "", fmt.Errorf("transforms[%d] %s: %w", i, t.Op, err)
+		}
+	}
+	return out, nil
+}
+
+// applyTransform runs one step; re is the step's compiled pattern
+func applyTransform(in string, t models.Transform, re *regexp.Regexp) (string, error) {
+	switch t.Op {
+	case models.TransformTrim:
+		return strings.TrimSpace(in), nil
+	case models.TransformLowercase:
+		return strings.ToLower(in), nil
+	case models.TransformRegexMatch:
+		m := re.FindStringSubmatch(in)
+		if m == nil {
+			return "", fmt.Errorf("no match")
+		}
+		return m[t.Group], nil
+	case models.TransformJSONPrettify:
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, []byte(in), "", "  "); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	case models.TransformSelector:
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(in))
+		if err != nil {
+			return "", fmt.Errorf("failed to parse HTML: %w", err)
+		}
+		var values []string
+		doc.Find(t.Selector).Each(func(_ int, s *goquery.Selection) {
+			if t.Attr == "" {
+				values = append(values, strings.TrimSpace(s.Text()))
+			} else if v, ok := s.Attr(t.Attr); ok {
+				values = append(values, v)
+			}
+		})
+		if len(values) == 0 {
+			return "", fmt.Errorf("selector %q matched nothing", t.Selector)
+		}
+		return strings.Join(values, "\n"), nil
+	default:
+		return "", fmt.Errorf("unknown transform op %q", t.Op)
+	}
+}
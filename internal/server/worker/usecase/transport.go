@@ -0,0 +1,133 @@
+package usecase
+
+import (
+	"container/list"
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/internal/config"
+)
+
+const (
+	defaultMaxIdleConnsPerHost = 10
+	defaultIdleConnTimeout     = 90 * time.Second
+	// maxPooledTransports bounds the transports kept for distinct proxies;
+	// the least recently used one is dropped beyond it
+	maxPooledTransports = 16
+)
+
+// transportKey identifies a pooled transport by proxy and TLS verification
+type transportKey struct {
+	proxy    string
+	insecure bool
+}
+
+// pooledTransport is an entry of the pool's recency list
+type pooledTransport struct {
+	key       transportKey
+	transport *http.Transport
+}
+
+// transportPool hands out shared transports so repeated hits to the same
+// host reuse connections instead of dialling for every request. It keeps at
+// most maxPooledTransports, evicting the least recently used.
+type transportPool struct {
+	keepAlive           bool
+	proxyKeepAlive      bool
+	maxIdleConnsPerHost int
+	idleConnTimeout     time.Duration
+	// responseHeaderTimeout bounds the wait for the upstream's headers; the
+	// body is bounded per request, since a streamed one may take longer
+	responseHeaderTimeout time.Duration
+
+	mu         sync.Mutex
+	transports map[transportKey]*list.Element
+	// recent orders the pooled transports, most recently used first
+	recent *list.List
+}
+
+func newTransportPool(cfg *config.WorkerConfig) *transportPool {
+	p := &transportPool{
+		keepAlive:           !cfg.DisableKeepAlives,
+		proxyKeepAlive:      cfg.ProxyKeepAlives,
+		maxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		idleConnTimeout:     cfg.IdleConnTimeout,
+		transports:          make(map[transportKey]*list.Element),
+		recent:              list.New(),
+
+		responseHeaderTimeout: cfg.RequestTimeout,
+	}
+	if p.maxIdleConnsPerHost <= 0 {
+		p.maxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	if p.idleConnTimeout <= 0 {
+		p.idleConnTimeout = defaultIdleConnTimeout
+	}
+	return p
+}
+
+// get returns the shared transport for the given proxy (nil for a direct
+// connection). When keep-alives are off for that path the transport closes
+// every connection after its request, so none outlives it.
+func (p *transportPool) get(proxyURL *url.URL, insecure bool) *http.Transport {
+	key := transportKey{insecure: insecure}
+	reuse := p.keepAlive
+	if proxyURL != nil {
+		key.proxy = proxyURL.String()
+		reuse = p.proxyKeepAlive
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.transports[key]; ok {
+		p.recent.MoveToFront(e)
+		return e.Value.(*pooledTransport).transport
+	}
+	t := p.build(proxyURL, insecure, reuse)
+	p.transports[key] = p.recent.PushFront(&pooledTransport{key: key, transport: t})
+	if p.recent.Len() > maxPooledTransports {
+		oldest := p.recent.Remove(p.recent.Back()).(*pooledTransport)
+		delete(p.transports, oldest.key)
+		// Requests still using it finish; its idle connections go now
+		oldest.transport.CloseIdleConnections()
+	}
+	return t
+}
+
+func (p *transportPool) build(proxyURL *url.URL, insecure, reuse bool) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.ResponseHeaderTimeout = p.responseHeaderTimeout
+	if proxyURL != nil {
+		// HTTP/2 is only attempted on direct connections
+		t.Proxy = http.ProxyURL(proxyURL)
+		t.ForceAttemptHTTP2 = false
+		t.TLSHandshakeTimeout = 30 * time.Second
+	} else {
+		t.ForceAttemptHTTP2 = true
+	}
+	if reuse {
+		t.MaxIdleConnsPerHost = p.maxIdleConnsPerHost
+		t.IdleConnTimeout = p.idleConnTimeout
+	} else {
+		t.DisableKeepAlives = true
+		t.MaxIdleConns = 0
+		t.MaxIdleConnsPerHost = -1
+		t.IdleConnTimeout = 0
+	}
+	if insecure {
+		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return t
+}
+
+// closeIdle drops idle pooled connections, e.g. after the target changes
+func (p *transportPool) closeIdle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for e := p.recent.Front(); e != nil; e = e.Next() {
+		e.Value.(*pooledTransport).transport.CloseIdleConnections()
+	}
+}
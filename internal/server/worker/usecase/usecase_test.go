@@ -0,0 +1,1574 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/internal/config"
+	"github.com/Alwanly/service-distribute-management/internal/models"
+	dto "github.com/Alwanly/service-distribute-management/internal/server/worker/dto"
+	"github.com/Alwanly/service-distribute-management/internal/server/worker/repository"
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+	"github.com/Alwanly/service-distribute-management/pkg/wrapper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestCancelInFlight_CancelsSlowHit(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer upstream.Close()
+
+	repo := repository.NewRepository()
+	if err := repo.UpdateConfig(&models.Configuration{
+		ETag:       "1",
+		ConfigData: `{"url":"` + upstream.URL + `"}`,
+	}); err != nil {
+		t.Fatalf("update config: %v", err)
+	}
+	uc := NewUseCase(repo, &config.WorkerConfig{RequestTimeout: 30 * time.Second}).(*UseCase)
+
+	results := make(chan wrapper.JSONResult, 1)
+	go func() {
+		results <- uc.HitRequest(context.Background())
+	}()
+
+	// Wait for the hit to be registered as in flight
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		uc.inFlightMutex.Lock()
+		n := len(uc.inFlight)
+		uc.inFlightMutex.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("hit request never became in flight")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	start := time.Now()
+	if got := uc.CancelInFlight(); got != 1 {
+		t.Fatalf("CancelInFlight() = %d, want 1", got)
+	}
+
+	select {
+	case res := <-results:
+		if res.Code != http.StatusServiceUnavailable {
+			t.Errorf("status = %d, want %d", res.Code, http.StatusServiceUnavailable)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("hit took %v to return after cancel", elapsed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("hit request was not cancelled promptly")
+	}
+
+	if got := uc.CancelInFlight(); got != 0 {
+		t.Errorf("CancelInFlight() after completion = %d, want 0", got)
+	}
+}
+
+// newConfiguredUseCase returns a worker usecase whose current config targets url
+func newConfiguredUseCase(t *testing.T, url string) *UseCase {
+	t.Helper()
+	repo := repository.NewRepository()
+	if err := repo.UpdateConfig(&models.Configuration{
+		ETag:       "1",
+		ConfigData: `{"url":"` + url + `"}`,
+	}); err != nil {
+		t.Fatalf("update config: %v", err)
+	}
+	return NewUseCase(repo, &config.WorkerConfig{RequestTimeout: 5 * time.Second}).(*UseCase)
+}
+
+func jsonHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"ok":true}`))
+}
+
+func TestSelfTest_TLSTimings(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(jsonHandler))
+	defer upstream.Close()
+
+	uc := newConfiguredUseCase(t, upstream.URL)
+	uc.httpClient = upstream.Client()
+
+	result := uc.SelfTest(context.Background())
+	if !result.Configured || !result.ExtractionSucceeded {
+		t.Fatalf("expected successful self-test, got %+v", result)
+	}
+	if result.ConnectMs == nil || result.TLSMs == nil || result.TTFBMs == nil {
+		t.Fatalf("expected connect, tls and ttfb timings, got %+v", result)
+	}
+	if result.DNSMs != nil {
+		t.Errorf("expected no DNS phase for an IP literal, got %v", *result.DNSMs)
+	}
+	if result.TotalMs < *result.TTFBMs {
+		t.Errorf("total %vms shorter than ttfb %vms", result.TotalMs, *result.TTFBMs)
+	}
+}
+
+func TestSelfTest_DNSTiming(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(jsonHandler))
+	defer upstream.Close()
+
+	uc := newConfiguredUseCase(t, strings.Replace(upstream.URL, "127.0.0.1", "localhost", 1))
+
+	result := uc.SelfTest(context.Background())
+	if !result.ExtractionSucceeded {
+		t.Fatalf("expected successful self-test, got %+v", result)
+	}
+	if result.DNSMs == nil || result.ConnectMs == nil || result.TTFBMs == nil {
+		t.Fatalf("expected dns, connect and ttfb timings, got %+v", result)
+	}
+	if result.TLSMs != nil {
+		t.Errorf("expected no TLS phase for plain HTTP, got %v", *result.TLSMs)
+	}
+}
+
+func TestSelfTest_Unconfigured(t *testing.T) {
+	uc := NewUseCase(repository.NewRepository(), &config.WorkerConfig{RequestTimeout: time.Second})
+
+	result := uc.SelfTest(context.Background())
+	if result.Configured || result.Error == "" {
+		t.Fatalf("expected unconfigured result with error, got %+v", result)
+	}
+}
+
+func TestHitRequest_LogsTimingFields(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(jsonHandler))
+	defer upstream.Close()
+	// A forward proxy receives the absolute URL; answering directly is enough here
+	proxy := httptest.NewServer(http.HandlerFunc(jsonHandler))
+	defer proxy.Close()
+
+	localhost := func(u string) string { return strings.Replace(u, "127.0.0.1", "localhost", 1) }
+
+	tests := []struct {
+		name  string
+		proxy string
+	}{
+		{"direct", ""},
+		{"proxied", strings.TrimPrefix(localhost(proxy.URL), "http://")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := repository.NewRepository()
+			if err := repo.UpdateConfig(&models.Configuration{
+				ETag:       "1",
+				ConfigData: `{"url":"` + localhost(upstream.URL) + `","proxy":"` + tt.proxy + `"}`,
+			}); err != nil {
+				t.Fatalf("update config: %v", err)
+			}
+			uc := NewUseCase(repo, &config.WorkerConfig{RequestTimeout: 5 * time.Second})
+
+			logCtx := logger.NewLogContext()
+			res := uc.HitRequest(logger.WithLogContext(context.Background(), logCtx))
+			if !res.Success {
+				t.Fatalf("hit failed: %s", res.Message)
+			}
+
+			fields := make(map[string]bool)
+			for _, f := range logCtx.Fields() {
+				fields[f.Key] = true
+			}
+			for _, key := range []string{"dns_ms", "connect_ms", "ttfb_ms"} {
+				if !fields[key] {
+					t.Errorf("expected %s in log context", key)
+				}
+			}
+			if fields["tls_ms"] {
+				t.Error("did not expect tls_ms for plain HTTP")
+			}
+		})
+	}
+}
+
+func TestHitRequest_BinaryResponseEncodings(t *testing.T) {
+	// PNG signature followed by bytes that are not valid UTF-8
+	payload := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0x00, 0xff, 0xfe, 0x80}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(payload)
+	}))
+	defer upstream.Close()
+
+	newUseCase := func(encoding string) UseCaseInterface {
+		repo := repository.NewRepository()
+		if err := repo.UpdateConfig(&models.Configuration{
+			ETag:       "1",
+			ConfigData: `{"url":"` + upstream.URL + `","response_encoding":"` + encoding + `"}`,
+		}); err != nil {
+			t.Fatalf("update config: %v", err)
+		}
+		return NewUseCase(repo, &config.WorkerConfig{RequestTimeout: 5 * time.Second})
+	}
+
+	t.Run("base64", func(t *testing.T) {
+		res := newUseCase(models.ResponseEncodingBase64).HitRequest(context.Background())
+		hit, ok := res.Data.(*dto.HitResponse)
+		if !res.Success || !ok {
+			t.Fatalf("unexpected result: %+v", res)
+		}
+		if hit.Encoding != "base64" || hit.ContentType != "image/png" {
+			t.Errorf("encoding=%q content_type=%q", hit.Encoding, hit.ContentType)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(hit.Data.(string))
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if !bytes.Equal(decoded, payload) {
+			t.Errorf("round trip = %v, want %v", decoded, payload)
+		}
+	})
+
+	t.Run("raw", func(t *testing.T) {
+		res := newUseCase(models.ResponseEncodingRaw).HitRequest(context.Background())
+		raw, ok := res.Data.(*dto.RawHitResponse)
+		if !res.Success || !ok {
+			t.Fatalf("unexpected result: %+v", res)
+		}
+		if raw.ContentType != "image/png" || raw.StatusCode != http.StatusOK {
+			t.Errorf("content_type=%q status=%d", raw.ContentType, raw.StatusCode)
+		}
+		if !bytes.Equal(raw.Body, payload) {
+			t.Errorf("body = %v, want %v", raw.Body, payload)
+		}
+	})
+}
+
+func TestHitRequest_StreamsLargeBody(t *testing.T) {
+	const size = 32 << 20
+	chunk := bytes.Repeat([]byte("x"), 32<<10)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+		w.Header().Set("X-Upstream", "yes")
+		w.WriteHeader(http.StatusNonAuthoritativeInfo)
+		for written := 0; written < size; written += len(chunk) {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+		}
+	}))
+	defer upstream.Close()
+
+	repo := repository.NewRepository()
+	if err := repo.UpdateConfig(&models.Configuration{
+		ETag:       "1",
+		ConfigData: `{"url":"` + upstream.URL + `","response_encoding":"stream"}`,
+	}); err != nil {
+		t.Fatalf("update config: %v", err)
+	}
+	uc := NewUseCase(repo, &config.WorkerConfig{RequestTimeout: 30 * time.Second, MaxInFlight: 1})
+
+	res := uc.HitRequest(context.Background())
+	stream, ok := res.Data.(*dto.StreamHitResponse)
+	if !res.Success || !ok {
+		t.Fatalf("expected a streamed response, got %+v", res)
+	}
+	if stream.StatusCode != http.StatusNonAuthoritativeInfo || stream.ContentLength != size {
+		t.Fatalf("status=%d content_length=%d", stream.StatusCode, stream.ContentLength)
+	}
+	if stream.Header.Get("X-Upstream") != "yes" || stream.Header.Get("Content-Type") != "application/octet-stream" {
+		t.Fatalf("upstream headers not preserved: %v", stream.Header)
+	}
+	if stream.Header.Get("Content-Length") != "" {
+		t.Fatal("expected Content-Length to be left to the handler")
+	}
+
+	// The slot stays taken until the client has read the body
+	if current, _ := uc.InFlight(); current != 1 {
+		t.Fatalf("expected the request to stay in flight while streaming, got %d", current)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	n, err := io.Copy(io.Discard, stream.Body)
+	runtime.ReadMemStats(&after)
+	if err != nil || n != size {
+		t.Fatalf("copied %d bytes: %v", n, err)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > size/4 {
+		t.Fatalf("streaming %d bytes allocated %d bytes", size, allocated)
+	}
+
+	if err := stream.Body.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if current, _ := uc.InFlight(); current != 0 {
+		t.Fatalf("expected the slot to be released on close, got %d in flight", current)
+	}
+}
+
+func TestHitRequest_RequestTimeoutSparesStreamedBody(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		for i := 0; i < 5; i++ {
+			w.Write([]byte("chunk"))
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(60 * time.Millisecond):
+			}
+		}
+	}))
+	defer upstream.Close()
+
+	hit := func(encoding string) wrapper.JSONResult {
+		repo := repository.NewRepository()
+		if err := repo.UpdateConfig(&models.Configuration{
+			ETag:       "1",
+			ConfigData: `{"url":"` + upstream.URL + `","response_encoding":"` + encoding + `"}`,
+		}); err != nil {
+			t.Fatalf("update config: %v", err)
+		}
+		return NewUseCase(repo, &config.WorkerConfig{RequestTimeout: 150 * time.Millisecond}).HitRequest(context.Background())
+	}
+
+	// The body takes longer than the request timeout; a stream still
+	// delivers all of it since its headers arrived in time
+	res := hit(models.ResponseEncodingStream)
+	stream, ok := res.Data.(*dto.StreamHitResponse)
+	if !res.Success || !ok {
+		t.Fatalf("expected a streamed response, got %+v", res)
+	}
+	body, err := io.ReadAll(stream.Body)
+	stream.Body.Close()
+	if err != nil || string(body) != strings.Repeat("chunk", 5) {
+		t.Fatalf("streamed body %q: %v", body, err)
+	}
+
+	// A buffered hit must finish within the timeout, and timing out is not
+	// reported as a shutdown
+	res = hit(models.ResponseEncodingRaw)
+	if res.Success || res.Code != http.StatusInternalServerError {
+		t.Fatalf("expected the buffered hit to time out with 500, got %d: %s", res.Code, res.Message)
+	}
+}
+
+// mockRepository implements repository.IRepository with injectable failures
+type mockRepository struct {
+	data      *repository.StorageData
+	getErr    error
+	updateErr error
+	updated   []*models.Configuration
+}
+
+var _ repository.IRepository = (*mockRepository)(nil)
+
+func (m *mockRepository) GetCurrentConfig() (*repository.StorageData, error) {
+	return m.data, m.getErr
+}
+
+func (m *mockRepository) Flags() models.Flags {
+	if m.data == nil {
+		return nil
+	}
+	return m.data.Config.Flags
+}
+
+func (m *mockRepository) UpdateConfig(config *models.Configuration) error {
+	if m.updateErr != nil {
+		return m.updateErr
+	}
+	m.updated = append(m.updated, config)
+	return nil
+}
+
+func TestReceiveConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		repo     *mockRepository
+		wantCode int
+	}{
+		{"stored", &mockRepository{}, http.StatusOK},
+		{"repository failure", &mockRepository{updateErr: errors.New("disk full")}, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := NewUseCase(tt.repo, &config.WorkerConfig{RequestTimeout: 5 * time.Second})
+			res := uc.ReceiveConfig(context.Background(), &dto.ReceiveConfigRequest{
+				ID:         7,
+				ETag:       "etag-7",
+				ConfigData: models.ConfigData{URL: "http://example.com", Proxy: "proxy.local:8080"},
+			})
+			if res.Code != tt.wantCode {
+				t.Fatalf("got %d, want %d", res.Code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			if len(tt.repo.updated) != 1 {
+				t.Fatalf("expected one stored config, got %d", len(tt.repo.updated))
+			}
+			stored := tt.repo.updated[0]
+			if stored.ID != 7 || stored.ETag != "etag-7" {
+				t.Errorf("got id=%d etag=%q, want 7/etag-7", stored.ID, stored.ETag)
+			}
+			var data models.ConfigData
+			if err := json.Unmarshal([]byte(stored.ConfigData), &data); err != nil {
+				t.Fatalf("stored config data is not JSON: %v", err)
+			}
+			if data.URL != "http://example.com" || data.Proxy != "proxy.local:8080" {
+				t.Errorf("got %+v, want URL and proxy preserved", data)
+			}
+		})
+	}
+}
+
+func TestReceiveConfig_Flags(t *testing.T) {
+	repo := repository.NewRepository()
+	uc := NewUseCase(repo, &config.WorkerConfig{RequestTimeout: 5 * time.Second})
+	receive := func(etag string, flags models.Flags) wrapper.JSONResult {
+		return uc.ReceiveConfig(context.Background(), &dto.ReceiveConfigRequest{
+			ETag:       etag,
+			ConfigData: models.ConfigData{URL: "http://example.com", Flags: flags},
+		})
+	}
+
+	if res := receive("etag-1", models.Flags{"enable_cache": false, "mode": "lenient"}); res.Code != http.StatusOK {
+		t.Fatalf("got %d, want 200 (%s)", res.Code, res.Message)
+	}
+	if flags := repo.Flags(); flags.Bool("enable_cache", true) || flags.String("mode", "") != "lenient" {
+		t.Fatalf("unexpected flags after the first config: %v", flags)
+	}
+
+	// A config update flips the flags without a restart
+	if res := receive("etag-2", models.Flags{"enable_cache": true}); res.Code != http.StatusOK {
+		t.Fatalf("got %d, want 200 (%s)", res.Code, res.Message)
+	}
+	if flags := repo.Flags(); !flags.Bool("enable_cache", false) || flags.String("mode", "default") != "default" {
+		t.Fatalf("expected the update to replace the flags, got %v", flags)
+	}
+
+	for _, bad := range []models.Flags{
+		{"Enable Cache": true},
+		{"weight": 3},
+		{"mode": strings.Repeat("x", 257)},
+	} {
+		if res := receive("etag-bad", bad); res.Code != http.StatusBadRequest {
+			t.Errorf("flags %v: got %d, want 400", bad, res.Code)
+		}
+	}
+	if !repo.Flags().Bool("enable_cache", false) {
+		t.Fatal("a rejected config replaced the flags")
+	}
+}
+
+func TestReceiveConfig_ThenGetConfig(t *testing.T) {
+	uc := NewUseCase(repository.NewRepository(), &config.WorkerConfig{RequestTimeout: 5 * time.Second})
+
+	if got := uc.GetConfig(); got != nil {
+		t.Fatalf("expected no config before receipt, got %+v", got)
+	}
+	res := uc.ReceiveConfig(context.Background(), &dto.ReceiveConfigRequest{
+		ETag:       "etag-1",
+		ConfigData: models.ConfigData{URL: "http://example.com"},
+	})
+	if res.Code != http.StatusOK {
+		t.Fatalf("receive: got %d", res.Code)
+	}
+
+	got := uc.GetConfig()
+	if got == nil || got.ETag != "etag-1" || got.ConfigData.URL != "http://example.com" {
+		t.Fatalf("got %+v, want received config", got)
+	}
+}
+
+func TestHitRequest(t *testing.T) {
+	closed := httptest.NewServer(http.HandlerFunc(jsonHandler))
+	closedURL := closed.URL
+	closed.Close()
+
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		url      string // overrides the upstream server URL when set
+		wantCode int
+		wantData string
+	}{
+		{
+			name: "html body extraction",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				_, _ = w.Write([]byte("<html><head><title>t</title></head><body>  hello world  </body></html>"))
+			},
+			wantCode: http.StatusOK,
+			wantData: "hello world",
+		},
+		{
+			name: "html sniffed without content type",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header()["Content-Type"] = nil
+				_, _ = w.Write([]byte("<html><body>sniffed</body></html>"))
+			},
+			wantCode: http.StatusOK,
+			wantData: "sniffed",
+		},
+		{
+			name:     "json response",
+			handler:  jsonHandler,
+			wantCode: http.StatusOK,
+			wantData: `{"ok":true}`,
+		},
+		{
+			name: "plain text trimmed",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				_, _ = w.Write([]byte("  pong \n"))
+			},
+			wantCode: http.StatusOK,
+			wantData: "pong",
+		},
+		{
+			name:     "upstream unreachable",
+			url:      closedURL,
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := tt.url
+			if tt.handler != nil {
+				upstream := httptest.NewServer(tt.handler)
+				defer upstream.Close()
+				target = upstream.URL
+			}
+
+			uc := newConfiguredUseCase(t, target)
+			res := uc.HitRequest(context.Background())
+			if res.Code != tt.wantCode {
+				t.Fatalf("got %d (%s), want %d", res.Code, res.Message, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			hit, ok := res.Data.(*dto.HitResponse)
+			if !ok {
+				t.Fatalf("got data %T, want *dto.HitResponse", res.Data)
+			}
+			if hit.Data != tt.wantData {
+				t.Errorf("got data %q, want %q", hit.Data, tt.wantData)
+			}
+			if hit.URL != target || hit.ETag != "1" {
+				t.Errorf("got url=%q etag=%q, want %q/1", hit.URL, hit.ETag, target)
+			}
+		})
+	}
+}
+
+func TestHitRequest_ThroughProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A forward proxy sees the absolute target URL and the credentials
+		user, pass, _ := parseProxyAuth(r.Header.Get("Proxy-Authorization"))
+		proxied = append(proxied, r.URL.String()+" "+user+":"+pass)
+		jsonHandler(w, r)
+	}))
+	defer proxy.Close()
+
+	host := strings.TrimPrefix(proxy.URL, "http://")
+	hostname, port, _ := strings.Cut(host, ":")
+
+	repo := repository.NewRepository()
+	if err := repo.UpdateConfig(&models.Configuration{
+		ETag:       "1",
+		ConfigData: `{"url":"http://upstream.invalid/path","proxy":"` + hostname + ":" + port + `:user:secret"}`,
+	}); err != nil {
+		t.Fatalf("update config: %v", err)
+	}
+	uc := NewUseCase(repo, &config.WorkerConfig{RequestTimeout: 5 * time.Second})
+
+	res := uc.HitRequest(context.Background())
+	if res.Code != http.StatusOK {
+		t.Fatalf("got %d (%s), want 200", res.Code, res.Message)
+	}
+	if len(proxied) != 1 || proxied[0] != "http://upstream.invalid/path user:secret" {
+		t.Fatalf("got proxied requests %v, want one authenticated request for the target", proxied)
+	}
+}
+
+func TestHitRequest_RepositoryStates(t *testing.T) {
+	tests := []struct {
+		name     string
+		repo     *mockRepository
+		wantCode int
+	}{
+		{"no config", &mockRepository{}, http.StatusBadRequest},
+		{"repository error", &mockRepository{getErr: errors.New("boom")}, http.StatusInternalServerError},
+		{"invalid proxy", &mockRepository{data: &repository.StorageData{
+			ETag:   "1",
+			Config: models.ConfigData{URL: "http://example.com", Proxy: "http://bad host:80"},
+		}}, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := NewUseCase(tt.repo, &config.WorkerConfig{RequestTimeout: 5 * time.Second})
+			if res := uc.HitRequest(context.Background()); res.Code != tt.wantCode {
+				t.Fatalf("got %d (%s), want %d", res.Code, res.Message, tt.wantCode)
+			}
+		})
+	}
+}
+
+// parseProxyAuth decodes a Basic Proxy-Authorization header value
+func parseProxyAuth(header string) (user, pass string, ok bool) {
+	encoded, found := strings.CutPrefix(header, "Basic ")
+	if !found {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
+
+func TestReceiveConfig_SameETagIsNoOp(t *testing.T) {
+	repo := &mockRepository{}
+	uc := NewUseCase(repo, &config.WorkerConfig{RequestTimeout: 5 * time.Second})
+	req := &dto.ReceiveConfigRequest{ID: 3, ETag: "etag-3", ConfigData: models.ConfigData{URL: "http://example.com"}}
+
+	first := uc.ReceiveConfig(context.Background(), req)
+	if first.Code != http.StatusOK {
+		t.Fatalf("first receive: got %d", first.Code)
+	}
+	if resp := first.Data.(dto.ReceiveConfigResponse); resp.NoChange {
+		t.Fatal("first receive reported no_change")
+	}
+
+	repo.data = &repository.StorageData{Config: req.ConfigData, ETag: req.ETag}
+	second := uc.ReceiveConfig(context.Background(), req)
+	if second.Code != http.StatusOK {
+		t.Fatalf("second receive: got %d", second.Code)
+	}
+	if resp := second.Data.(dto.ReceiveConfigResponse); !resp.NoChange || resp.ETag != "etag-3" {
+		t.Fatalf("second receive: got %+v, want no_change for etag-3", resp)
+	}
+	if len(repo.updated) != 1 {
+		t.Fatalf("expected the duplicate to skip the update, got %d updates", len(repo.updated))
+	}
+}
+
+func TestHitRequest_InsecureSkipVerify(t *testing.T) {
+	// httptest TLS servers use a self-signed certificate
+	upstream := httptest.NewTLSServer(http.HandlerFunc(jsonHandler))
+	defer upstream.Close()
+
+	for _, skip := range []bool{false, true} {
+		t.Run("insecure_skip_verify="+strconv.FormatBool(skip), func(t *testing.T) {
+			repo := repository.NewRepository()
+			data, _ := json.Marshal(models.ConfigData{URL: upstream.URL, InsecureSkipVerify: skip})
+			if err := repo.UpdateConfig(&models.Configuration{ETag: "1", ConfigData: string(data)}); err != nil {
+				t.Fatalf("update config: %v", err)
+			}
+			uc := NewUseCase(repo, &config.WorkerConfig{RequestTimeout: 5 * time.Second})
+
+			res := uc.HitRequest(context.Background())
+			if res.Success != skip {
+				t.Fatalf("success = %v, want %v (code %d, %s)", res.Success, skip, res.Code, res.Message)
+			}
+		})
+	}
+}
+
+func TestReceiveConfig_SchemaVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  int
+		wantCode int
+	}{
+		{"unversioned", 0, http.StatusOK},
+		{"current", models.ConfigSchemaVersion, http.StatusOK},
+		{"newer than supported", models.ConfigSchemaVersion + 1, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockRepository{}
+			uc := NewUseCase(repo, &config.WorkerConfig{RequestTimeout: 5 * time.Second})
+			res := uc.ReceiveConfig(context.Background(), &dto.ReceiveConfigRequest{
+				ETag:       "etag-1",
+				ConfigData: models.ConfigData{URL: "http://example.com", SchemaVersion: tt.version},
+			})
+			if res.Code != tt.wantCode {
+				t.Fatalf("got %d, want %d (%s)", res.Code, tt.wantCode, res.Message)
+			}
+			if tt.wantCode != http.StatusOK && len(repo.updated) != 0 {
+				t.Fatal("rejected config was applied")
+			}
+		})
+	}
+}
+
+func TestReceiveConfig_LogsRedactedConfig(t *testing.T) {
+	lc := logger.NewLogContext()
+	ctx := logger.WithLogContext(context.Background(), lc)
+
+	uc := NewUseCase(&mockRepository{}, &config.WorkerConfig{RequestTimeout: 5 * time.Second})
+	res := uc.ReceiveConfig(ctx, &dto.ReceiveConfigRequest{
+		ETag:       "etag-1",
+		ConfigData: models.ConfigData{URL: "http://example.com", Proxy: "proxy.local:8080:bob:s3cr:et"},
+	})
+	if res.Code != http.StatusOK {
+		t.Fatalf("got %d", res.Code)
+	}
+
+	enc := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	buf, err := enc.EncodeEntry(zapcore.Entry{Message: "http_request"}, lc.Fields())
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	line := buf.String()
+	if strings.Contains(line, "s3cr") {
+		t.Fatalf("log line leaks the proxy password: %s", line)
+	}
+	if !strings.Contains(line, `"proxy_host":"proxy.local:8080"`) {
+		t.Errorf("expected proxy host in log line: %s", line)
+	}
+}
+
+func TestHitRequest_TransformChain(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><body>
+			<div class="price"> Total: {"Amount": 42, "Currency": "EUR"} </div>
+		</body></html>`))
+	}))
+	defer upstream.Close()
+
+	cfg := models.ConfigData{
+		URL: upstream.URL,
+		Transforms: []models.Transform{
+			{Op: models.TransformSelector, Selector: "div.price"},
+			{Op: models.TransformRegexMatch, Pattern: `(\{.*\})`, Group: 1},
+			{Op: models.TransformLowercase},
+			{Op: models.TransformJSONPrettify},
+			{Op: models.TransformTrim},
+		},
+	}
+	uc := NewUseCase(repository.NewRepository(), &config.WorkerConfig{RequestTimeout: 5 * time.Second})
+	if res := uc.ReceiveConfig(context.Background(), &dto.ReceiveConfigRequest{ETag: "1", ConfigData: cfg}); res.Code != http.StatusOK {
+		t.Fatalf("receive: got %d (%s)", res.Code, res.Message)
+	}
+
+	res := uc.HitRequest(context.Background())
+	if res.Code != http.StatusOK {
+		t.Fatalf("hit: got %d (%s)", res.Code, res.Message)
+	}
+	want := "{\n  \"amount\": 42,\n  \"currency\": \"eur\"\n}"
+	if got := res.Data.(*dto.HitResponse).Data; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// The pattern was compiled when the config was applied, not per hit
+	pipeline := uc.(*UseCase).transforms.Load()
+	if pipeline == nil || pipeline.etag != "1" || pipeline.patterns[1] == nil {
+		t.Fatalf("expected the applied config's pipeline to be compiled, got %+v", pipeline)
+	}
+	uc.HitRequest(context.Background())
+	if uc.(*UseCase).transforms.Load() != pipeline {
+		t.Error("expected hits to reuse the compiled pipeline")
+	}
+
+	// A step that finds nothing fails the hit instead of returning partial output
+	cfg.Transforms = []models.Transform{{Op: models.TransformSelector, Selector: "table"}}
+	uc.ReceiveConfig(context.Background(), &dto.ReceiveConfigRequest{ETag: "2", ConfigData: cfg})
+	if res := uc.HitRequest(context.Background()); res.Code != http.StatusInternalServerError {
+		t.Fatalf("unmatched selector: got %d, want 500", res.Code)
+	}
+}
+
+func TestReceiveConfig_RejectsInvalidTransforms(t *testing.T) {
+	tests := []struct {
+		name       string
+		transforms []models.Transform
+		encoding   string
+	}{
+		{name: "unknown op", transforms: []models.Transform{{Op: "eval"}}},
+		{name: "regex without pattern", transforms: []models.Transform{{Op: models.TransformRegexMatch}}},
+		{name: "bad regex", transforms: []models.Transform{{Op: models.TransformRegexMatch, Pattern: "("}}},
+		{name: "group out of range", transforms: []models.Transform{{Op: models.TransformRegexMatch, Pattern: "a(b)", Group: 2}}},
+		{name: "bad selector", transforms: []models.Transform{{Op: models.TransformSelector, Selector: "div[["}}},
+		{name: "binary encoding", transforms: []models.Transform{{Op: models.TransformTrim}}, encoding: models.ResponseEncodingBase64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockRepository{}
+			uc := NewUseCase(repo, &config.WorkerConfig{RequestTimeout: 5 * time.Second})
+			res := uc.ReceiveConfig(context.Background(), &dto.ReceiveConfigRequest{
+				ETag: "1",
+				ConfigData: models.ConfigData{
+					URL:              "http://example.com",
+					ResponseEncoding: tt.encoding,
+					Transforms:       tt.transforms,
+				},
+			})
+			if res.Code != http.StatusBadRequest {
+				t.Fatalf("got %d, want 400", res.Code)
+			}
+			if len(repo.updated) != 0 {
+				t.Fatal("invalid config was applied")
+			}
+		})
+	}
+}
+
+func TestHitHistory_KeepsLastHitsInOrder(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every third request fails upstream
+		if calls.Add(1)%3 == 0 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer upstream.Close()
+
+	repo := &mockRepository{data: &repository.StorageData{ETag: "1", Config: models.ConfigData{URL: upstream.URL}}}
+	uc := NewUseCase(repo, &config.WorkerConfig{RequestTimeout: 5 * time.Second, HitHistorySize: 3})
+
+	for i := 0; i < 5; i++ {
+		uc.HitRequest(context.Background())
+	}
+	// A hit without a config is recorded with its error
+	repo.data = nil
+	uc.HitRequest(context.Background())
+
+	history := uc.HitHistory()
+	if !history.Enabled || history.Capacity != 3 {
+		t.Fatalf("got enabled=%v capacity=%d, want true/3", history.Enabled, history.Capacity)
+	}
+	if len(history.Hits) != 3 {
+		t.Fatalf("got %d hits, want 3 (oldest evicted)", len(history.Hits))
+	}
+
+	// Hits 4 and 5 reach upstream (200, 200 after the 502 on hit 3); hit 6 has no config
+	wantStatus := []int{http.StatusOK, http.StatusOK, 0}
+	for i, hit := range history.Hits {
+		if hit.StatusCode != wantStatus[i] {
+			t.Errorf("hit %d: status %d, want %d", i, hit.StatusCode, wantStatus[i])
+		}
+		if i > 0 && hit.Timestamp.Before(history.Hits[i-1].Timestamp) {
+			t.Errorf("hit %d recorded out of order", i)
+		}
+	}
+	if history.Hits[0].Target != upstream.URL {
+		t.Errorf("target = %q, want %q", history.Hits[0].Target, upstream.URL)
+	}
+	if last := history.Hits[2]; last.Error != "no configuration available" || last.Target != "" {
+		t.Errorf("last hit = %+v, want no-config error", last)
+	}
+}
+
+func TestHitHistory_RedactsTargetCredentials(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	target := strings.Replace(upstream.URL, "http://", "http://user:hunter2@", 1) + "/feed?api_key=s3cret&page=2"
+	repo := &mockRepository{data: &repository.StorageData{ETag: "1", Config: models.ConfigData{URL: target}}}
+	uc := NewUseCase(repo, &config.WorkerConfig{RequestTimeout: 5 * time.Second, HitHistorySize: 1})
+	uc.HitRequest(context.Background())
+
+	history := uc.HitHistory()
+	if len(history.Hits) != 1 {
+		t.Fatalf("got %d hits, want 1", len(history.Hits))
+	}
+	got := history.Hits[0].Target
+	if strings.Contains(got, "hunter2") || strings.Contains(got, "s3cret") || !strings.Contains(got, "page=2") {
+		t.Fatalf("expected credentials masked and other parameters kept, got %s", got)
+	}
+}
+
+func TestHitHistory_DisabledByDefault(t *testing.T) {
+	uc := NewUseCase(&mockRepository{}, &config.WorkerConfig{RequestTimeout: 5 * time.Second})
+	uc.HitRequest(context.Background())
+
+	history := uc.HitHistory()
+	if history.Enabled || len(history.Hits) != 0 {
+		t.Fatalf("got %+v, want disabled and empty", history)
+	}
+}
+
+func TestHitRequest_ConcurrencyLimit(t *testing.T) {
+	var active, peak atomic.Int32
+	release := make(chan struct{})
+	// arrived is the barrier: one value per request that reached upstream
+	arrived := make(chan struct{}, 16)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		arrived <- struct{}{}
+		<-release
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	repo := &mockRepository{data: &repository.StorageData{ETag: "1", Config: models.ConfigData{URL: upstream.URL}}}
+
+	t.Run("rejects beyond the limit", func(t *testing.T) {
+		uc := NewUseCase(repo, &config.WorkerConfig{RequestTimeout: 5 * time.Second, MaxInFlight: 2})
+
+		const total = 10
+		codes := make(chan int, total)
+		for i := 0; i < total; i++ {
+			go func() { codes <- uc.HitRequest(context.Background()).Code }()
+		}
+
+		// Everything over the limit is turned away without waiting for upstream
+		for i := 0; i < total-2; i++ {
+			if code := <-codes; code != http.StatusTooManyRequests {
+				t.Fatalf("got %d, want 429", code)
+			}
+		}
+		// Both admitted requests are held at upstream before counting them
+		for i := 0; i < 2; i++ {
+			select {
+			case <-arrived:
+			case <-time.After(2 * time.Second):
+				t.Fatalf("only %d requests reached upstream, want 2", i)
+			}
+		}
+		if current, limit := uc.InFlight(); current != 2 || limit != 2 {
+			t.Fatalf("in flight = %d/%d, want 2/2", current, limit)
+		}
+		close(release)
+		for i := 0; i < 2; i++ {
+			if code := <-codes; code != http.StatusOK {
+				t.Fatalf("got %d, want 200", code)
+			}
+		}
+		if p := peak.Load(); p != 2 {
+			t.Fatalf("peak upstream concurrency = %d, want 2", p)
+		}
+	})
+
+	t.Run("queues until a slot frees up", func(t *testing.T) {
+		peak.Store(0)
+		uc := NewUseCase(repo, &config.WorkerConfig{RequestTimeout: 5 * time.Second, MaxInFlight: 1, QueueTimeout: 5 * time.Second})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if code := uc.HitRequest(context.Background()).Code; code != http.StatusOK {
+					t.Errorf("got %d, want 200", code)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if p := peak.Load(); p != 1 {
+			t.Fatalf("peak upstream concurrency = %d, want 1", p)
+		}
+	})
+}
+
+func TestHitRequest_HonorsUpstreamRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	var responses = []func(w http.ResponseWriter){
+		func(w http.ResponseWriter) {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+		},
+		func(w http.ResponseWriter) { _, _ = w.Write([]byte("ok")) },
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1)) - 1
+		responses[min(n, len(responses)-1)](w)
+	}))
+	defer upstream.Close()
+
+	repo := &mockRepository{data: &repository.StorageData{ETag: "1", Config: models.ConfigData{URL: upstream.URL}}}
+	uc := NewUseCase(repo, &config.WorkerConfig{RequestTimeout: 5 * time.Second}).(*UseCase)
+	now := time.Now()
+	uc.backoff.now = func() time.Time { return now }
+
+	res := uc.HitRequest(context.Background())
+	limited, ok := res.Data.(*dto.UpstreamRateLimitedResponse)
+	if res.Code != http.StatusTooManyRequests || !ok {
+		t.Fatalf("got %d %T, want 429 with rate limit details", res.Code, res.Data)
+	}
+	if limited.RetryAfterSeconds != 30 || limited.UpstreamStatus != http.StatusTooManyRequests {
+		t.Fatalf("got %+v, want retry after 30s from an upstream 429", limited)
+	}
+
+	// Within the window the worker answers itself instead of calling upstream
+	now = now.Add(20 * time.Second)
+	res = uc.HitRequest(context.Background())
+	if res.Code != http.StatusTooManyRequests || res.Data.(*dto.UpstreamRateLimitedResponse).RetryAfterSeconds != 10 {
+		t.Fatalf("got %d %+v, want 429 with 10s left", res.Code, res.Data)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("upstream called %d times during backoff, want 1", got)
+	}
+
+	now = now.Add(11 * time.Second)
+	if res := uc.HitRequest(context.Background()); res.Code != http.StatusOK {
+		t.Fatalf("after backoff: got %d, want 200", res.Code)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("upstream called %d times, want 2", got)
+	}
+}
+
+func TestUpstreamBackoff_Observe(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	response := func(status int, retryAfter string) *http.Response {
+		resp := &http.Response{StatusCode: status, Header: http.Header{}}
+		if retryAfter != "" {
+			resp.Header.Set("Retry-After", retryAfter)
+		}
+		return resp
+	}
+
+	tests := []struct {
+		name      string
+		responses []*http.Response
+		want      time.Duration
+	}{
+		{name: "429 with seconds", responses: []*http.Response{response(429, "5")}, want: 5 * time.Second},
+		{name: "503 with http date", responses: []*http.Response{response(503, now.Add(90*time.Second).Format(http.TimeFormat))}, want: 90 * time.Second},
+		{name: "503 without retry-after is not a rate limit", responses: []*http.Response{response(503, "")}, want: 0},
+		{name: "429 without retry-after doubles", responses: []*http.Response{response(429, ""), response(429, ""), response(429, "")}, want: 4 * time.Second},
+		{name: "success resets the doubling", responses: []*http.Response{response(429, ""), response(429, ""), response(200, ""), response(429, "")}, want: time.Second},
+		{name: "retry-after is capped", responses: []*http.Response{response(429, "86400")}, want: maxUpstreamBackoff},
+		{name: "garbage retry-after falls back to doubling", responses: []*http.Response{response(429, "soon")}, want: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newUpstreamBackoff()
+			b.now = func() time.Time { return now }
+
+			var got time.Duration
+			for _, resp := range tt.responses {
+				got = b.observe("http://target", resp)
+			}
+			if got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			if wait := b.wait("http://target"); wait != tt.want {
+				t.Errorf("wait = %v, want %v", wait, tt.want)
+			}
+			if wait := b.wait("http://other"); wait != 0 {
+				t.Errorf("other target wait = %v, want 0", wait)
+			}
+		})
+	}
+}
+
+// waitFor polls cond until it holds or a second passes
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRunCollector_CollectsOnSchedule(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`"hit-` + strconv.Itoa(int(calls.Add(1))) + `"`))
+	}))
+	defer upstream.Close()
+
+	uc := NewUseCase(repository.NewRepository(), &config.WorkerConfig{RequestTimeout: 5 * time.Second, CollectResultsSize: 3}).(*UseCase)
+	uc.collectUnit = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		uc.RunCollector(ctx, logger.New(zap.NewNop()))
+		close(stopped)
+	}()
+
+	// Nothing is collected until a config enables it
+	time.Sleep(20 * time.Millisecond)
+	if got := calls.Load(); got != 0 {
+		t.Fatalf("collector hit upstream %d times without collect mode", got)
+	}
+
+	cfg := models.ConfigData{URL: upstream.URL, CollectEnabled: true, CollectInterval: 5}
+	if res := uc.ReceiveConfig(context.Background(), &dto.ReceiveConfigRequest{ETag: "1", ConfigData: cfg}); res.Code != http.StatusOK {
+		t.Fatalf("receive: got %d (%s)", res.Code, res.Message)
+	}
+	waitFor(t, func() bool { return calls.Load() >= 5 })
+
+	results := uc.CollectResults()
+	if !results.Enabled || results.IntervalSeconds != 5 || results.Capacity != 3 || len(results.Results) != 3 {
+		t.Fatalf("got enabled=%v interval=%d capacity=%d results=%d, want true/5/3/3",
+			results.Enabled, results.IntervalSeconds, results.Capacity, len(results.Results))
+	}
+	// Oldest results were evicted; the rest are consecutive and in order
+	first, _ := strconv.Atoi(strings.Trim(strings.TrimPrefix(results.Results[0].Data.(string), `"hit-`), `"`))
+	for i, r := range results.Results {
+		want := `"hit-` + strconv.Itoa(first+i) + `"`
+		if !r.Success || r.Data != want || r.ETag != "1" {
+			t.Errorf("result %d = %+v, want successful %s", i, r, want)
+		}
+	}
+	if first < 2 {
+		t.Errorf("first kept result is hit-%d, want older hits evicted", first)
+	}
+
+	// Disabling collect mode stops the schedule
+	cfg.CollectEnabled = false
+	cfg.CollectInterval = 0
+	uc.ReceiveConfig(context.Background(), &dto.ReceiveConfigRequest{ETag: "2", ConfigData: cfg})
+	time.Sleep(20 * time.Millisecond)
+	settled := calls.Load()
+	time.Sleep(30 * time.Millisecond)
+	if got := calls.Load(); got != settled {
+		t.Fatalf("collector made %d more hits after collect mode was disabled", got-settled)
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("collector did not stop on cancel")
+	}
+}
+
+func TestReceiveConfig_RejectsCollectWithoutInterval(t *testing.T) {
+	uc := NewUseCase(&mockRepository{}, &config.WorkerConfig{RequestTimeout: 5 * time.Second})
+	res := uc.ReceiveConfig(context.Background(), &dto.ReceiveConfigRequest{
+		ETag:       "1",
+		ConfigData: models.ConfigData{URL: "http://example.com", CollectEnabled: true},
+	})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("got %d, want 400", res.Code)
+	}
+}
+
+// countingServer starts a keep-alive test server and counts new connections
+func countingServer(t testing.TB) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var conns atomic.Int32
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(jsonHandler))
+	upstream.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	upstream.Start()
+	t.Cleanup(upstream.Close)
+	return upstream, &conns
+}
+
+func newKeepAliveUseCase(t testing.TB, url string, disableKeepAlives bool) UseCaseInterface {
+	t.Helper()
+	repo := repository.NewRepository()
+	if err := repo.UpdateConfig(&models.Configuration{
+		ETag:       "1",
+		ConfigData: `{"url":"` + url + `"}`,
+	}); err != nil {
+		t.Fatalf("update config: %v", err)
+	}
+	return NewUseCase(repo, &config.WorkerConfig{
+		RequestTimeout:    5 * time.Second,
+		DisableKeepAlives: disableKeepAlives,
+	})
+}
+
+func TestHitRequest_ReusesConnections(t *testing.T) {
+	tests := []struct {
+		name              string
+		disableKeepAlives bool
+		wantConns         int32
+	}{
+		{name: "keep-alive", wantConns: 1},
+		{name: "keep-alive disabled", disableKeepAlives: true, wantConns: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream, conns := countingServer(t)
+			uc := newKeepAliveUseCase(t, upstream.URL, tt.disableKeepAlives)
+
+			for i := 0; i < 3; i++ {
+				if res := uc.HitRequest(context.Background()); !res.Success {
+					t.Fatalf("hit %d failed: %+v", i, res)
+				}
+			}
+			if got := conns.Load(); got != tt.wantConns {
+				t.Errorf("new connections = %d, want %d", got, tt.wantConns)
+			}
+		})
+	}
+}
+
+func TestTransportPool_ProxyKeepAlivesOffByDefault(t *testing.T) {
+	pool := newTransportPool(&config.WorkerConfig{})
+	proxyURL, _ := url.Parse("http://proxy.example:8080")
+
+	if !pool.get(proxyURL, false).DisableKeepAlives {
+		t.Error("proxy transport should not keep connections alive by default")
+	}
+	if pool.get(proxyURL, false) != pool.get(proxyURL, false) {
+		t.Error("proxy transport should be shared even without keep-alives")
+	}
+	if pool.get(nil, false) != pool.get(nil, false) {
+		t.Error("direct transport should be shared between requests")
+	}
+	if !pool.get(nil, false).ForceAttemptHTTP2 {
+		t.Error("direct transport should attempt HTTP/2")
+	}
+
+	pool = newTransportPool(&config.WorkerConfig{ProxyKeepAlives: true})
+	if pool.get(proxyURL, false) != pool.get(proxyURL, false) {
+		t.Error("proxy transport should be shared when proxy keep-alives are enabled")
+	}
+}
+
+func TestTransportPool_EvictsLeastRecentlyUsed(t *testing.T) {
+	pool := newTransportPool(&config.WorkerConfig{ProxyKeepAlives: true})
+	proxy := func(i int) *url.URL {
+		u, _ := url.Parse("http://proxy" + strconv.Itoa(i) + ".example:8080")
+		return u
+	}
+
+	first := pool.get(proxy(0), false)
+	second := pool.get(proxy(1), false)
+	for i := 2; i < maxPooledTransports; i++ {
+		pool.get(proxy(i), false)
+	}
+	// Using the first again makes the second the least recently used
+	pool.get(proxy(0), false)
+	pool.get(proxy(maxPooledTransports), false)
+
+	if got := len(pool.transports); got != maxPooledTransports {
+		t.Errorf("pooled transports = %d, want %d", got, maxPooledTransports)
+	}
+	if pool.get(proxy(0), false) != first {
+		t.Error("recently used transport was evicted")
+	}
+	if pool.get(proxy(1), false) == second {
+		t.Error("least recently used transport was kept")
+	}
+}
+
+func BenchmarkHitRequest_KeepAlive(b *testing.B) {
+	for _, disable := range []bool{false, true} {
+		name := "reuse"
+		if disable {
+			name = "new-connection"
+		}
+		b.Run(name, func(b *testing.B) {
+			upstream, _ := countingServer(b)
+			uc := newKeepAliveUseCase(b, upstream.URL, disable)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if res := uc.HitRequest(context.Background()); !res.Success {
+					b.Fatalf("hit failed: %+v", res)
+				}
+			}
+		})
+	}
+}
+
+func TestReceiveConfig_PushAndPollApplyOnce(t *testing.T) {
+	uc := NewUseCase(repository.NewRepository(), &config.WorkerConfig{RequestTimeout: 5 * time.Second}).(*UseCase)
+
+	type delivery struct {
+		method string
+		lc     *logger.LogContext
+		res    wrapper.JSONResult
+	}
+	deliveries := []*delivery{{method: "push"}, {method: "poll"}}
+
+	// The agent's push listener and poll loop forward the same ETag at once
+	var wg sync.WaitGroup
+	for _, d := range deliveries {
+		d.lc = logger.NewLogContext()
+		ctx := logger.WithCorrelationID(logger.WithLogContext(context.Background(), d.lc), "corr-"+d.method)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.res = uc.ReceiveConfig(ctx, &dto.ReceiveConfigRequest{
+				ETag:           "etag-9",
+				ConfigData:     models.ConfigData{URL: "http://example.com"},
+				DeliveryMethod: d.method,
+			})
+		}()
+	}
+	wg.Wait()
+
+	var applied, duplicate *delivery
+	for _, d := range deliveries {
+		if d.res.Code != http.StatusOK {
+			t.Fatalf("%s: got %d", d.method, d.res.Code)
+		}
+		if resp := d.res.Data.(dto.ReceiveConfigResponse); resp.NoChange {
+			if !resp.Duplicate {
+				t.Fatalf("%s: expected the skipped forward to be reported as a duplicate", d.method)
+			}
+			duplicate = d
+		} else {
+			applied = d
+		}
+	}
+	if applied == nil || duplicate == nil {
+		t.Fatalf("expected exactly one application, got %+v and %+v", deliveries[0].res.Data, deliveries[1].res.Data)
+	}
+	if n := uc.DuplicateForwards(); n != 1 {
+		t.Fatalf("expected 1 suppressed duplicate, got %d", n)
+	}
+
+	enc := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	buf, err := enc.EncodeEntry(zapcore.Entry{Message: "http_request"}, duplicate.lc.Fields())
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	line := buf.String()
+	for _, want := range []string{
+		`"duplicate_forward":true`,
+		`"delivery_method":"` + duplicate.method + `"`,
+		`"applied_by":"` + applied.method + `"`,
+		`"applied_correlation_id":"corr-` + applied.method + `"`,
+	} {
+		if !strings.Contains(line, want) {
+			t.Errorf("expected %s in duplicate log line: %s", want, line)
+		}
+	}
+
+	// Outside the window the same ETag is still skipped but not counted
+	uc.duplicateWindow = 0
+	uc.lastApply.at = time.Now().Add(-time.Second)
+	res := uc.ReceiveConfig(context.Background(), &dto.ReceiveConfigRequest{ETag: "etag-9", ConfigData: models.ConfigData{URL: "http://example.com"}})
+	if resp := res.Data.(dto.ReceiveConfigResponse); !resp.NoChange || resp.Duplicate {
+		t.Fatalf("expected a late resend to be a plain no_change, got %+v", resp)
+	}
+	if n := uc.DuplicateForwards(); n != 1 {
+		t.Fatalf("expected the late resend not to count, got %d", n)
+	}
+}
+
+func TestHitRequest_Assertions(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("maintenance"))
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer upstream.Close()
+
+	tests := []struct {
+		name      string
+		path      string
+		assertion models.Assertion
+		wantPass  bool
+		wantMsg   string
+	}{
+		{name: "status passes", assertion: models.Assertion{Type: models.AssertionStatus, Status: 200}, wantPass: true},
+		{name: "status fails", path: "/down", assertion: models.Assertion{Type: models.AssertionStatus, Status: 200}, wantMsg: "got status 503, want 200"},
+		{name: "contains passes", assertion: models.Assertion{Type: models.AssertionContains, Value: `"ok"`}, wantPass: true},
+		{name: "contains fails", path: "/down", assertion: models.Assertion{Type: models.AssertionContains, Value: `"ok"`}, wantMsg: `body does not contain "\"ok\""`},
+		{name: "json passes", assertion: models.Assertion{Type: models.AssertionJSON}, wantPass: true},
+		{name: "json fails", path: "/down", assertion: models.Assertion{Type: models.AssertionJSON}, wantMsg: "body is not valid JSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := NewUseCase(repository.NewRepository(), &config.WorkerConfig{RequestTimeout: 5 * time.Second, HitHistorySize: 1})
+			cfg := models.ConfigData{URL: upstream.URL + tt.path, Assertions: []models.Assertion{tt.assertion}}
+			if res := uc.ReceiveConfig(context.Background(), &dto.ReceiveConfigRequest{ETag: "1", ConfigData: cfg}); res.Code != http.StatusOK {
+				t.Fatalf("receive: got %d (%s)", res.Code, res.Message)
+			}
+
+			res := uc.HitRequest(context.Background())
+			if res.Code != http.StatusOK {
+				t.Fatalf("hit: got %d (%s)", res.Code, res.Message)
+			}
+			report := res.Data.(*dto.HitResponse).Assertions
+			if report == nil || len(report.Results) != 1 {
+				t.Fatalf("expected one assertion result, got %+v", report)
+			}
+			if report.Passed != tt.wantPass || report.Results[0].Passed != tt.wantPass || report.Results[0].Type != tt.assertion.Type {
+				t.Fatalf("got %+v, want passed=%v", report, tt.wantPass)
+			}
+			if report.Results[0].Message != tt.wantMsg {
+				t.Fatalf("message = %q, want %q", report.Results[0].Message, tt.wantMsg)
+			}
+
+			wantFailed := 0
+			if !tt.wantPass {
+				wantFailed = 1
+			}
+			if hits := uc.HitHistory().Hits; len(hits) != 1 || hits[0].AssertionsFailed != wantFailed {
+				t.Fatalf("expected %d failed assertions in the hit history, got %+v", wantFailed, hits)
+			}
+		})
+	}
+}
+
+func TestHitRequest_NoAssertionsNoReport(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer upstream.Close()
+
+	repo := &mockRepository{data: &repository.StorageData{ETag: "1", Config: models.ConfigData{URL: upstream.URL}}}
+	uc := NewUseCase(repo, &config.WorkerConfig{RequestTimeout: 5 * time.Second})
+	res := uc.HitRequest(context.Background())
+	if report := res.Data.(*dto.HitResponse).Assertions; report != nil {
+		t.Fatalf("expected no assertion report without assertions, got %+v", report)
+	}
+}
+
+func TestReceiveConfig_RejectsInvalidAssertions(t *testing.T) {
+	tests := []struct {
+		name       string
+		assertions []models.Assertion
+		encoding   string
+	}{
+		{name: "unknown type", assertions: []models.Assertion{{Type: "regex"}}},
+		{name: "status out of range", assertions: []models.Assertion{{Type: models.AssertionStatus, Status: 42}}},
+		{name: "contains without value", assertions: []models.Assertion{{Type: models.AssertionContains}}},
+		{name: "stream encoding", assertions: []models.Assertion{{Type: models.AssertionJSON}}, encoding: models.ResponseEncodingStream},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockRepository{}
+			uc := NewUseCase(repo, &config.WorkerConfig{RequestTimeout: 5 * time.Second})
+			res := uc.ReceiveConfig(context.Background(), &dto.ReceiveConfigRequest{
+				ETag: "1",
+				ConfigData: models.ConfigData{
+					URL:              "http://example.com",
+					ResponseEncoding: tt.encoding,
+					Assertions:       tt.assertions,
+				},
+			})
+			if res.Code != http.StatusBadRequest {
+				t.Fatalf("got %d, want 400", res.Code)
+			}
+			if len(repo.updated) != 0 {
+				t.Fatal("invalid config was applied")
+			}
+		})
+	}
+}
+
+func TestAllowedHosts(t *testing.T) {
+	target, conns := countingServer(t)
+	newUseCase := func(allowed ...string) *UseCase {
+		repo := repository.NewRepository()
+		return NewUseCase(repo, &config.WorkerConfig{RequestTimeout: 5 * time.Second, AllowedHosts: allowed}).(*UseCase)
+	}
+	receive := func(uc *UseCase, url string) wrapper.JSONResult {
+		return uc.ReceiveConfig(context.Background(), &dto.ReceiveConfigRequest{
+			ETag:       "1",
+			ConfigData: models.ConfigData{URL: url},
+		})
+	}
+
+	t.Run("allowed host", func(t *testing.T) {
+		uc := newUseCase("127.0.0.1")
+		if res := receive(uc, target.URL); res.Code != http.StatusOK {
+			t.Fatalf("receive config: got %d (%s)", res.Code, res.Message)
+		}
+		if res := uc.HitRequest(context.Background()); !res.Success {
+			t.Fatalf("hit: got %d (%s)", res.Code, res.Message)
+		}
+	})
+
+	t.Run("disallowed host rejected on receipt", func(t *testing.T) {
+		uc := newUseCase("example.com", "*.example.com")
+		if res := receive(uc, target.URL); res.Code != http.StatusBadRequest {
+			t.Fatalf("got %d, want 400", res.Code)
+		}
+		if cfg := uc.GetCurrentConfig(); cfg != nil {
+			t.Fatalf("disallowed config was applied: %+v", cfg)
+		}
+	})
+
+	t.Run("disallowed host blocked on hit", func(t *testing.T) {
+		// The config was stored before the worker restarted with an allowlist
+		repo := repository.NewRepository()
+		if err := repo.UpdateConfig(&models.Configuration{ETag: "1", ConfigData: `{"url":"` + target.URL + `"}`}); err != nil {
+			t.Fatal(err)
+		}
+		uc := NewUseCase(repo, &config.WorkerConfig{RequestTimeout: 5 * time.Second, AllowedHosts: []string{"example.com"}})
+
+		before := conns.Load()
+		if res := uc.HitRequest(context.Background()); res.Code != http.StatusForbidden {
+			t.Fatalf("got %d, want 403", res.Code)
+		}
+		if conns.Load() != before {
+			t.Fatal("blocked target was connected to")
+		}
+	})
+
+	t.Run("redirect to disallowed host", func(t *testing.T) {
+		// localhost resolves to the target but is not on the allowlist
+		redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, strings.Replace(target.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+		}))
+		defer redirect.Close()
+
+		uc := newUseCase("127.0.0.1")
+		if res := receive(uc, redirect.URL); res.Code != http.StatusOK {
+			t.Fatalf("receive config: got %d (%s)", res.Code, res.Message)
+		}
+		before := conns.Load()
+		if res := uc.HitRequest(context.Background()); res.Success {
+			t.Fatal("expected the redirect to be refused")
+		}
+		if conns.Load() != before {
+			t.Fatal("redirect target was connected to")
+		}
+	})
+
+	t.Run("empty allowlist allows all", func(t *testing.T) {
+		uc := newUseCase()
+		if res := receive(uc, target.URL); res.Code != http.StatusOK {
+			t.Fatalf("receive config: got %d (%s)", res.Code, res.Message)
+		}
+	})
+}
@@ -3,12 +3,15 @@ package authentication
 import (
 	"encoding/base64"
 	"strings"
+	"sync/atomic"
 )
 
 type IBasicAuthService interface {
 	Validate(username, password string) bool
 	ValidateAdmin(username, password string) bool
 	DecodeFromHeader(auth string) (string, string)
+	// SetCredentials replaces the accepted credentials for later requests
+	SetCredentials(config *BasicAuthTConfig)
 }
 
 type BasicAuthTConfig struct {
@@ -22,23 +25,23 @@ type BasicAuthTConfig struct {
 }
 
 type basicAuth struct {
-	username      string
-	password      string
-	adminUsername string
-	adminPassword string
+	credentials atomic.Pointer[BasicAuthTConfig]
 }
 
 func NewBasicAuthService(config *BasicAuthTConfig) IBasicAuthService {
-	return &basicAuth{
-		username:      config.Username,
-		password:      config.Password,
-		adminUsername: config.AdminUsername,
-		adminPassword: config.AdminPassword,
-	}
+	b := &basicAuth{}
+	b.SetCredentials(config)
+	return b
+}
+
+func (b *basicAuth) SetCredentials(config *BasicAuthTConfig) {
+	c := *config
+	b.credentials.Store(&c)
 }
 
 func (b *basicAuth) Validate(username, password string) bool {
-	return b.username == username && b.password == password
+	c := b.credentials.Load()
+	return c.Username == username && c.Password == password
 }
 
 func (b *basicAuth) DecodeFromHeader(auth string) (string, string) {
@@ -60,5 +63,6 @@ func (b *basicAuth) DecodeFromHeader(auth string) (string, string) {
 }
 
 func (b *basicAuth) ValidateAdmin(username, password string) bool {
-	return b.adminUsername == username && b.adminPassword == password
+	c := b.credentials.Load()
+	return c.AdminUsername == username && c.AdminPassword == password
 }
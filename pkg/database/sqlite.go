@@ -1,6 +1,7 @@
 package database
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -31,6 +32,10 @@ func RunMigrations(db *gorm.DB) error {
 		&models.Agent{},
 		&models.Configuration{},
 		&models.AgentConfig{},
+		&models.BootstrapToken{},
+		&models.Event{},
+		&models.AgentHeartbeat{},
+		&models.IdempotencyKey{},
 	}
 	if err := db.AutoMigrate(models...); err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
@@ -38,17 +43,35 @@ func RunMigrations(db *gorm.DB) error {
 	return nil
 }
 
-func SeedInitialData(db *gorm.DB) error {
+// SeedInitialData stores the default configuration when none exists yet.
+// defaultConfig is the worker config JSON to seed; empty seeds "{}".
+func SeedInitialData(db *gorm.DB, defaultConfig string) error {
 	// Check if initial configuration exists
 	var count int64
-	if err := db.Model(&models.Configuration{}).Count(&count).Error; err != nil {
+	if err := db.Model(&models.Configuration{}).Where("name = ?", "").Count(&count).Error; err != nil {
 		return fmt.Errorf("failed to check existing configurations: %w", err)
 	}
 
 	if count == 0 {
+		configData := "{}"
+		if defaultConfig != "" {
+			var seed models.ConfigData
+			if err := json.Unmarshal([]byte(defaultConfig), &seed); err != nil {
+				return fmt.Errorf("invalid default configuration: %w", err)
+			}
+			if err := seed.Validate(); err != nil {
+				return fmt.Errorf("invalid default configuration: %w", err)
+			}
+			normalized, err := json.Marshal(seed)
+			if err != nil {
+				return fmt.Errorf("failed to encode default configuration: %w", err)
+			}
+			configData = string(normalized)
+		}
+
 		initialConfig := models.Configuration{
-			ETag:       fmt.Sprintf("%x-%d", 1, time.Now().UnixNano()),
-			ConfigData: "{}",
+			ETag:       fmt.Sprintf("%x-%d", len(configData), time.Now().UnixNano()),
+			ConfigData: configData,
 		}
 		if err := db.Create(&initialConfig).Error; err != nil {
 			return fmt.Errorf("failed to seed initial configuration: %w", err)
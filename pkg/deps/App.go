@@ -1,6 +1,7 @@
 package deps
 
 import (
+	"github.com/Alwanly/service-distribute-management/pkg/lock"
 	"github.com/Alwanly/service-distribute-management/pkg/logger"
 	"github.com/Alwanly/service-distribute-management/pkg/middleware"
 	"github.com/Alwanly/service-distribute-management/pkg/poll"
@@ -16,4 +17,6 @@ type App struct {
 	Middleware *middleware.AuthMiddleware
 	Poller     poll.Poller
 	Pub        pubsub.PubSub
+	// Locker is nil unless Pub is backed by Redis
+	Locker lock.Locker
 }
@@ -0,0 +1,118 @@
+package hostallow
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// List is an allowlist of hosts. An entry is either an exact hostname or IP
+// ("api.example.com", "10.0.0.5"), or "*." followed by a domain, which
+// matches every subdomain of that domain at any depth but not the domain
+// itself ("*.example.com" matches "a.example.com" and "a.b.example.com").
+// Hosts are compared case-insensitively, without port or trailing dot.
+//
+// An empty List allows every host.
+type List struct {
+	exact    map[string]struct{}
+	suffixes []string
+}
+
+// New builds a List from entries, rejecting any that cannot match a host
+func New(entries []string) (List, error) {
+	var l List
+	for _, entry := range entries {
+		host := normalize(entry)
+		if strings.HasPrefix(host, "*.") {
+			domain := host[2:]
+			if err := checkName(domain); err != nil {
+				return List{}, fmt.Errorf("entry %q: %w", entry, err)
+			}
+			l.suffixes = append(l.suffixes, "."+domain)
+			continue
+		}
+		if err := checkName(host); err != nil {
+			return List{}, fmt.Errorf("entry %q: %w", entry, err)
+		}
+		if l.exact == nil {
+			l.exact = make(map[string]struct{})
+		}
+		l.exact[host] = struct{}{}
+	}
+	return l, nil
+}
+
+// Empty reports whether the list allows every host
+func (l List) Empty() bool {
+	return len(l.exact) == 0 && len(l.suffixes) == 0
+}
+
+// Allows reports whether host, optionally with a port, is on the list
+func (l List) Allows(host string) bool {
+	if l.Empty() {
+		return true
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = normalize(host)
+	if host == "" {
+		return false
+	}
+	if _, ok := l.exact[host]; ok {
+		return true
+	}
+	for _, suffix := range l.suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckURL returns an error unless the host of the absolute URL raw is on
+// the list
+func (l List) CheckURL(raw string) error {
+	if l.Empty() {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if !l.Allows(u.Hostname()) {
+		return fmt.Errorf("target host %q is not on the allowlist", u.Hostname())
+	}
+	return nil
+}
+
+func normalize(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	host = strings.TrimPrefix(host, "[")
+	host = strings.TrimSuffix(host, "]")
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+// checkName rejects entries that are not a bare hostname or IP, such as
+// URLs, host:port pairs and wildcards outside the leading label
+func checkName(host string) error {
+	if host == "" {
+		return fmt.Errorf("host is empty")
+	}
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	if strings.ContainsAny(host, "/:@?#* ") {
+		return fmt.Errorf("must be a hostname, an IP or *.domain")
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" {
+			return fmt.Errorf("hostname has an empty label")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package hostallow
+
+import "testing"
+
+func TestList_Allows(t *testing.T) {
+	list, err := New([]string{"api.example.com", "*.internal.example", "10.0.0.5", "[::1]", "Trailing.Example."})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{host: "api.example.com", want: true},
+		{host: "API.Example.com", want: true},
+		{host: "api.example.com:8443", want: true},
+		{host: "api.example.com.", want: true},
+		{host: "example.com", want: false},
+		{host: "www.example.com", want: false},
+		{host: "evil-api.example.com", want: false},
+		{host: "api.example.com.evil.test", want: false},
+
+		// *.domain matches subdomains at any depth but not the domain itself
+		{host: "a.internal.example", want: true},
+		{host: "a.b.internal.example", want: true},
+		{host: "internal.example", want: false},
+		{host: "notinternal.example", want: false},
+
+		{host: "10.0.0.5", want: true},
+		{host: "10.0.0.5:80", want: true},
+		{host: "10.0.0.6", want: false},
+		{host: "::1", want: true},
+		{host: "[::1]:8080", want: true},
+		{host: "0:0:0:0:0:0:0:1", want: true},
+
+		{host: "trailing.example", want: true},
+		{host: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := list.Allows(tt.host); got != tt.want {
+			t.Errorf("Allows(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestList_EmptyAllowsAll(t *testing.T) {
+	list, err := New(nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if !list.Empty() || !list.Allows("anything.test") || list.CheckURL("http://169.254.169.254/") != nil {
+		t.Fatal("expected an empty list to allow every host")
+	}
+}
+
+func TestList_CheckURL(t *testing.T) {
+	list, err := New([]string{"*.example.com"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := list.CheckURL("https://api.example.com:8443/path?q=1"); err != nil {
+		t.Errorf("expected subdomain url to be allowed, got %v", err)
+	}
+	if err := list.CheckURL("http://user@other.test/"); err == nil {
+		t.Error("expected other host to be rejected")
+	}
+	if err := list.CheckURL("http://[::1"); err == nil {
+		t.Error("expected a malformed url to be rejected")
+	}
+}
+
+func TestNew_RejectsInvalidEntries(t *testing.T) {
+	for _, entry := range []string{
+		"",
+		"*",
+		"*.",
+		"http://example.com",
+		"example.com:8080",
+		"api.*.example.com",
+		"example..com",
+		"exa mple.com",
+	} {
+		if _, err := New([]string{entry}); err == nil {
+			t.Errorf("New(%q): expected an error", entry)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Alwanly/service-distribute-management/pkg/httpurl"
+	"github.com/Alwanly/service-distribute-management/pkg/tracing"
+)
+
+// maxErrorBody bounds how much of a non-2xx response body StatusError keeps
+const maxErrorBody = 4 << 10
+
+// StatusError is returned for a response outside the 2xx range
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("status %d: %s", e.StatusCode, e.Body)
+}
+
+// DefaultRetryableStatusCodes are the statuses RetryableStatus retries when
+// none are configured: rate limiting and gateway failures
+var DefaultRetryableStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryableStatus returns a retry.Config RetryIf predicate. An error with a
+// *StatusError is retried only when its status is one of codes (or of
+// DefaultRetryableStatusCodes when codes is empty); an error without a
+// response, such as a refused connection or a timeout, is always retried.
+func RetryableStatus(codes []int) func(error) bool {
+	if len(codes) == 0 {
+		codes = DefaultRetryableStatusCodes
+	}
+	retryable := make(map[int]bool, len(codes))
+	for _, code := range codes {
+		retryable[code] = true
+	}
+	return func(err error) bool {
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) {
+			return true
+		}
+		return retryable[statusErr.StatusCode]
+	}
+}
+
+// Response is the status and headers of a completed call
+type Response struct {
+	StatusCode int
+	Header     http.Header
+}
+
+// DoJSON sends body as JSON (nil sends no body) with headers and decodes a
+// 2xx response into out (nil discards it). Headers with an empty value are
+// skipped. It returns the response status, or 0 when no response arrived;
+// any status outside 2xx comes back with a *StatusError.
+func DoJSON(ctx context.Context, client *http.Client, method, url string, body interface{}, headers map[string]string, out interface{}) (int, error) {
+	resp, err := Do(ctx, client, method, url, body, headers, out)
+	if resp == nil {
+		return 0, err
+	}
+	return resp.StatusCode, err
+}
+
+// Do is DoJSON for callers that also need the response headers. The
+// Response is non-nil whenever the server answered, including on errors.
+// Each call is traced as a client span whose context is sent in the
+// traceparent header; the span records the URL redacted.
+func Do(ctx context.Context, client *http.Client, method, url string, body interface{}, headers map[string]string, out interface{}) (resp *Response, err error) {
+	ctx, span := tracing.Start(ctx, "HTTP "+method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("http.request.method", method), attribute.String("url.full", httpurl.Redact(url))))
+	defer func() {
+		if resp != nil {
+			span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		}
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("marshal request body: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, value := range headers {
+		if value != "" {
+			req.Header.Set(key, value)
+		}
+	}
+	tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	httpResp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	resp = &Response{StatusCode: httpResp.StatusCode, Header: httpResp.Header}
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(httpResp.Body, maxErrorBody))
+		return resp, &StatusError{StatusCode: httpResp.StatusCode, Body: strings.TrimSpace(string(b))}
+	}
+
+	if out == nil || httpResp.StatusCode == http.StatusNoContent {
+		_, _ = io.Copy(io.Discard, httpResp.Body)
+		return resp, nil
+	}
+	if err := json.NewDecoder(httpResp.Body).Decode(out); err != nil {
+		return resp, fmt.Errorf("decode response: %w", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,159 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDoJSON_Success(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		if got := r.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("content type = %q, want application/json", got)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("authorization = %q, want Bearer token", got)
+		}
+		if _, ok := r.Header["X-Agent-Id"]; ok {
+			t.Error("empty header value was sent")
+		}
+
+		var in struct{ Name string }
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.Name != "agent" {
+			t.Errorf("body = %+v (%v), want name agent", in, err)
+		}
+		w.Header().Set("X-Poll-Interval-Seconds", "30")
+		_, _ = w.Write([]byte(`{"id":"agent-1"}`))
+	}))
+	defer srv.Close()
+
+	var out struct {
+		ID string `json:"id"`
+	}
+	resp, err := Do(context.Background(), srv.Client(), http.MethodPost, srv.URL,
+		map[string]string{"Name": "agent"},
+		map[string]string{"Authorization": "Bearer token", "X-Agent-ID": ""},
+		&out)
+	if err != nil {
+		t.Fatalf("do: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || out.ID != "agent-1" {
+		t.Fatalf("got status %d id %q, want 200 agent-1", resp.StatusCode, out.ID)
+	}
+	if got := resp.Header.Get("X-Poll-Interval-Seconds"); got != "30" {
+		t.Errorf("response header = %q, want 30", got)
+	}
+}
+
+func TestDoJSON_NoBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > 0 || r.Header.Get("Content-Type") != "" {
+			t.Errorf("got body of %d bytes with content type %q, want none", r.ContentLength, r.Header.Get("Content-Type"))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	var out struct{}
+	status, err := DoJSON(context.Background(), srv.Client(), http.MethodGet, srv.URL, nil, nil, &out)
+	if err != nil || status != http.StatusNoContent {
+		t.Fatalf("got %d, %v; want 204 without error", status, err)
+	}
+}
+
+func TestDoJSON_NonSuccessStatus(t *testing.T) {
+	for _, code := range []int{http.StatusNotModified, http.StatusUnauthorized, http.StatusServiceUnavailable} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+			if code != http.StatusNotModified {
+				_, _ = w.Write([]byte("controller unavailable\n"))
+			}
+		}))
+
+		out := struct{ ID string }{ID: "untouched"}
+		status, err := DoJSON(context.Background(), srv.Client(), http.MethodGet, srv.URL, nil, nil, &out)
+		srv.Close()
+
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) {
+			t.Fatalf("%d: got %v, want *StatusError", code, err)
+		}
+		if status != code || statusErr.StatusCode != code {
+			t.Errorf("%d: got status %d / %d", code, status, statusErr.StatusCode)
+		}
+		if code != http.StatusNotModified && statusErr.Body != "controller unavailable" {
+			t.Errorf("%d: body = %q, want the trimmed response body", code, statusErr.Body)
+		}
+		if out.ID != "untouched" {
+			t.Errorf("%d: out was decoded from an error response", code)
+		}
+	}
+}
+
+func TestDoJSON_DecodeError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":`))
+	}))
+	defer srv.Close()
+
+	var out struct{ ID string }
+	status, err := DoJSON(context.Background(), srv.Client(), http.MethodGet, srv.URL, nil, nil, &out)
+	if err == nil {
+		t.Fatal("expected a decode error")
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		t.Fatalf("got status error %v, want a decode error", err)
+	}
+	if status != http.StatusOK {
+		t.Errorf("status = %d, want 200", status)
+	}
+}
+
+func TestDoJSON_TransportError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := srv.URL
+	srv.Close()
+
+	status, err := DoJSON(context.Background(), http.DefaultClient, http.MethodGet, url, nil, nil, nil)
+	if err == nil || status != 0 {
+		t.Fatalf("got %d, %v; want 0 and an error", status, err)
+	}
+}
+
+func TestDoJSON_MarshalError(t *testing.T) {
+	status, err := DoJSON(context.Background(), http.DefaultClient, http.MethodPost, "http://unused", make(chan int), nil, nil)
+	if err == nil || status != 0 {
+		t.Fatalf("got %d, %v; want 0 and a marshal error", status, err)
+	}
+}
+
+func TestRetryableStatus(t *testing.T) {
+	wrapped := func(code int) error { return fmt.Errorf("call failed: %w", &StatusError{StatusCode: code}) }
+	tests := []struct {
+		name  string
+		codes []int
+		err   error
+		want  bool
+	}{
+		{"default 503", nil, wrapped(http.StatusServiceUnavailable), true},
+		{"default 429", nil, wrapped(http.StatusTooManyRequests), true},
+		{"default 500", nil, wrapped(http.StatusInternalServerError), false},
+		{"default 401", nil, wrapped(http.StatusUnauthorized), false},
+		{"configured 500", []int{500}, wrapped(http.StatusInternalServerError), true},
+		{"configured list replaces defaults", []int{500}, wrapped(http.StatusServiceUnavailable), false},
+		{"no response", []int{500}, errors.New("connection refused"), true},
+	}
+	for _, tt := range tests {
+		if got := RetryableStatus(tt.codes)(tt.err); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
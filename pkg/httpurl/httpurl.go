@@ -0,0 +1,110 @@
+package httpurl
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Parse checks that raw is an absolute http or https URL with a host and
+// returns it parsed
+func Parse(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := check(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Join resolves ref against base. An absolute ref replaces base and is
+// returned as is once validated; a scheme-relative one ("//host/path")
+// replaces it too, taking base's scheme. A relative ref is appended to base's path,
+// so a base behind a path prefix keeps it: joining "/config" to
+// "http://host/api" gives "http://host/api/config". Slashes between the two
+// are collapsed to one.
+func Join(base, ref string) (string, error) {
+	b, err := Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid base URL %q: %w", base, err)
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL reference %q: %w", ref, err)
+	}
+	if r.IsAbs() || r.Host != "" {
+		if !r.IsAbs() {
+			r.Scheme = b.Scheme
+		}
+		if err := check(r); err != nil {
+			return "", fmt.Errorf("invalid URL %q: %w", ref, err)
+		}
+		return r.String(), nil
+	}
+
+	// ResolveReference replaces the last segment of a base without a
+	// trailing slash, and the whole path for a ref with a leading one
+	if !strings.HasSuffix(b.Path, "/") {
+		b.Path += "/"
+		if b.RawPath != "" {
+			b.RawPath += "/"
+		}
+	}
+	r.Path = strings.TrimLeft(r.Path, "/")
+	r.RawPath = strings.TrimLeft(r.RawPath, "/")
+	return b.ResolveReference(r).String(), nil
+}
+
+// sensitiveParams are fragments of query parameter names whose values
+// Redact masks, compared case-insensitively
+var sensitiveParams = []string{"token", "key", "secret", "password", "passwd", "sig", "auth", "credential", "session"}
+
+// Redact returns raw with its password and the values of sensitive query
+// parameters (tokens, API keys, signatures, ...) masked, safe to log or
+// show. A URL that does not parse is returned as "[invalid]".
+func Redact(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "[invalid]"
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		masked := false
+		for name, values := range query {
+			if !sensitiveParam(name) {
+				continue
+			}
+			for i := range values {
+				values[i] = "xxxxx"
+			}
+			masked = true
+		}
+		if masked {
+			u.RawQuery = query.Encode()
+		}
+	}
+	return u.Redacted()
+}
+
+func sensitiveParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, fragment := range sensitiveParams {
+		if strings.Contains(name, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+func check(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("scheme must be http or https")
+	}
+	if u.Hostname() == "" {
+		return errors.New("missing host")
+	}
+	return nil
+}
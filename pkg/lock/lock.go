@@ -0,0 +1,62 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Locker hands out named locks shared by every process using the same
+// backend, e.g. the replicas of a service
+type Locker interface {
+	// TryAcquire takes key for ttl without waiting. It returns false when
+	// another holder has the key. The lock lapses after ttl unless released.
+	TryAcquire(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// Release gives up key if this locker still holds it
+	Release(ctx context.Context, key string) error
+}
+
+// keyPrefix namespaces lock keys in the shared Redis
+const keyPrefix = "dcm:lock:"
+
+// releaseScript deletes the key only while it holds this locker's token, so
+// a lock that lapsed and was taken by someone else is left alone
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// RedisLocker implements Locker with SET NX and a TTL
+type RedisLocker struct {
+	client redis.Cmdable
+	// token identifies this locker as the holder of its keys
+	token string
+}
+
+var _ Locker = (*RedisLocker)(nil)
+
+func NewRedisLocker(client redis.Cmdable) *RedisLocker {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return &RedisLocker{client: client, token: hex.EncodeToString(b)}
+}
+
+func (l *RedisLocker) TryAcquire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	ok, err := l.client.SetNX(ctx, keyPrefix+key, l.token, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("acquire lock %s: %w", key, err)
+	}
+	return ok, nil
+}
+
+func (l *RedisLocker) Release(ctx context.Context, key string) error {
+	if err := releaseScript.Run(ctx, l.client, []string{keyPrefix + key}, l.token).Err(); err != nil {
+		return fmt.Errorf("release lock %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newRedisLocker(t *testing.T, addr string) *RedisLocker {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { _ = client.Close() })
+	return NewRedisLocker(client)
+}
+
+func TestRedisLocker_OneHolderAtATime(t *testing.T) {
+	srv, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("start miniredis: %v", err)
+	}
+	defer srv.Close()
+	ctx := context.Background()
+
+	first := newRedisLocker(t, srv.Addr())
+	second := newRedisLocker(t, srv.Addr())
+
+	if ok, err := first.TryAcquire(ctx, "publish", time.Minute); err != nil || !ok {
+		t.Fatalf("first acquire = %v, %v; want the lock", ok, err)
+	}
+	if ok, err := second.TryAcquire(ctx, "publish", time.Minute); err != nil || ok {
+		t.Fatalf("second acquire = %v, %v; want it refused while held", ok, err)
+	}
+	if ok, err := second.TryAcquire(ctx, "other", time.Minute); err != nil || !ok {
+		t.Fatalf("acquire of another key = %v, %v; want the lock", ok, err)
+	}
+
+	// Only the holder can release
+	if err := second.Release(ctx, "publish"); err != nil {
+		t.Fatalf("release by non-holder: %v", err)
+	}
+	if ok, _ := second.TryAcquire(ctx, "publish", time.Minute); ok {
+		t.Fatal("a non-holder released the lock")
+	}
+	if err := first.Release(ctx, "publish"); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if ok, err := second.TryAcquire(ctx, "publish", time.Minute); err != nil || !ok {
+		t.Fatalf("acquire after release = %v, %v; want the lock", ok, err)
+	}
+}
+
+func TestRedisLocker_LapsesAfterTTL(t *testing.T) {
+	srv, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("start miniredis: %v", err)
+	}
+	defer srv.Close()
+	ctx := context.Background()
+
+	first := newRedisLocker(t, srv.Addr())
+	second := newRedisLocker(t, srv.Addr())
+
+	if ok, _ := first.TryAcquire(ctx, "publish", time.Minute); !ok {
+		t.Fatal("expected the first acquire to succeed")
+	}
+	srv.FastForward(2 * time.Minute)
+	if ok, err := second.TryAcquire(ctx, "publish", time.Minute); err != nil || !ok {
+		t.Fatalf("acquire after ttl = %v, %v; want the lock", ok, err)
+	}
+}
+
+func TestRedisLocker_Unreachable(t *testing.T) {
+	srv, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("start miniredis: %v", err)
+	}
+	locker := newRedisLocker(t, srv.Addr())
+	srv.Close()
+
+	if ok, err := locker.TryAcquire(context.Background(), "publish", time.Minute); err == nil || ok {
+		t.Fatalf("acquire = %v, %v; want an error", ok, err)
+	}
+}
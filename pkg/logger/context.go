@@ -4,6 +4,7 @@ import (
 	"context"
 	"sync"
 
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
@@ -17,6 +18,9 @@ const (
 	correlationKey contextKey = "correlation_id"
 )
 
+// HeaderCorrelationID carries the correlation ID between controller, agent and worker
+const HeaderCorrelationID = "X-Correlation-ID"
+
 const (
 	FieldRequestID     = "request_id"
 	FieldOperation     = "operation"
@@ -26,6 +30,8 @@ const (
 	FieldProxyStatus   = "proxy_status"
 	FieldSuccess       = "success"
 	FieldETag          = "etag"
+	FieldCorrelationID = "correlation_id"
+	FieldTraceID       = "trace_id"
 
 	// Poller-specific field names
 	FieldPollName     = "poll_name"
@@ -110,3 +116,18 @@ func GetCorrelationID(ctx context.Context) string {
 	}
 	return ""
 }
+
+// NewCorrelationID returns a time-ordered (UUIDv7) correlation ID
+func NewCorrelationID() string {
+	return uuid.Must(uuid.NewV7()).String()
+}
+
+// EnsureCorrelationID returns ctx's correlation ID, generating and attaching a
+// new one when ctx has none
+func EnsureCorrelationID(ctx context.Context) (context.Context, string) {
+	if id := GetCorrelationID(ctx); id != "" {
+		return ctx, id
+	}
+	id := NewCorrelationID()
+	return WithCorrelationID(ctx, id), id
+}
@@ -0,0 +1,77 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Log file rotation defaults: rotate at 100 MB, keep 5 old files for 30 days
+const (
+	defaultLogFileMaxSizeMB  = 100
+	defaultLogFileMaxBackups = 5
+	defaultLogFileMaxAgeDays = 30
+)
+
+// logFileFromEnv returns the rotating log file set by LOG_FILE, or nil when
+// logging to a file is not configured. LOG_FILE_MAX_SIZE_MB,
+// LOG_FILE_MAX_BACKUPS and LOG_FILE_MAX_AGE_DAYS control rotation; 0 backups
+// or 0 days keeps old files regardless of count or age.
+func logFileFromEnv() (*lumberjack.Logger, error) {
+	path := os.Getenv("LOG_FILE")
+	if path == "" {
+		return nil, nil
+	}
+
+	maxSize, err := envInt("LOG_FILE_MAX_SIZE_MB", defaultLogFileMaxSizeMB)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize == 0 {
+		return nil, fmt.Errorf("LOG_FILE_MAX_SIZE_MB must be at least 1")
+	}
+	maxBackups, err := envInt("LOG_FILE_MAX_BACKUPS", defaultLogFileMaxBackups)
+	if err != nil {
+		return nil, err
+	}
+	maxAge, err := envInt("LOG_FILE_MAX_AGE_DAYS", defaultLogFileMaxAgeDays)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    maxSize,
+		MaxBackups: maxBackups,
+		MaxAge:     maxAge,
+	}, nil
+}
+
+// withFile tees core into w, encoding entries the way cfg encodes them for
+// the console
+func withFile(core zapcore.Core, cfg zap.Config, w zapcore.WriteSyncer) zapcore.Core {
+	var encoder zapcore.Encoder
+	if cfg.Encoding == "console" {
+		encoder = zapcore.NewConsoleEncoder(cfg.EncoderConfig)
+	} else {
+		encoder = zapcore.NewJSONEncoder(cfg.EncoderConfig)
+	}
+	return zapcore.NewTee(core, zapcore.NewCore(encoder, w, cfg.Level))
+}
+
+// envInt reads a non-negative whole number from the environment, or def when unset
+func envInt(key string, def int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("%s=%q is not a whole number", key, v)
+	}
+	return i, nil
+}
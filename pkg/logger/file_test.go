@@ -0,0 +1,141 @@
+package logger
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewLoggerFromEnv_WritesLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "controller.log")
+	t.Setenv("LOG_FORMAT", "json")
+	t.Setenv("LOG_FILE", path)
+	t.Setenv("LOG_SAMPLING_INITIAL", "0")
+
+	log, err := NewLoggerFromEnv("controller")
+	if err != nil {
+		t.Fatalf("new logger: %v", err)
+	}
+	log.Info("config updated", String("etag", "abc"))
+	log.Error("publish failed")
+	log.Sync()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read log file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines in the log file, got %d: %s", len(lines), b)
+	}
+	if !strings.Contains(lines[0], `"msg":"config updated"`) || !strings.Contains(lines[0], `"etag":"abc"`) ||
+		!strings.Contains(lines[0], `"component":"controller"`) {
+		t.Fatalf("unexpected first line %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"level":"error"`) {
+		t.Fatalf("unexpected second line %s", lines[1])
+	}
+}
+
+func TestLogFileFromEnv_Rotates(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("LOG_FILE", filepath.Join(dir, "worker.log"))
+	t.Setenv("LOG_FILE_MAX_SIZE_MB", "1")
+	t.Setenv("LOG_FILE_MAX_BACKUPS", "3")
+	t.Setenv("LOG_FILE_MAX_AGE_DAYS", "7")
+
+	file, err := logFileFromEnv()
+	if err != nil || file == nil {
+		t.Fatalf("log file: %v", err)
+	}
+	defer file.Close()
+	if file.MaxSize != 1 || file.MaxBackups != 3 || file.MaxAge != 7 {
+		t.Fatalf("rotation settings not applied: %+v", file)
+	}
+
+	// 2.5 MB in 64 KB writes has to rotate at 1 MB
+	chunk := append(bytes.Repeat([]byte("x"), 64<<10-1), '\n')
+	for i := 0; i < 40; i++ {
+		if _, err := file.Write(chunk); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	// Backups are named by rotation time in milliseconds, so two rotations
+	// within the same millisecond leave one
+	if len(entries) < 2 {
+		t.Fatalf("expected the log file and a rotated backup, got %d files", len(entries))
+	}
+	info, err := os.Stat(filepath.Join(dir, "worker.log"))
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Size() > 1<<20 {
+		t.Fatalf("expected the current file to stay under 1 MB, got %d bytes", info.Size())
+	}
+}
+
+func TestClose_ClosesLogFile(t *testing.T) {
+	if _, err := os.Stat("/proc/self/fd"); err != nil {
+		t.Skip("needs /proc to list open files")
+	}
+	path := filepath.Join(t.TempDir(), "agent.log")
+	t.Setenv("LOG_FILE", path)
+
+	log, err := NewLoggerFromEnv("agent")
+	if err != nil {
+		t.Fatalf("new logger: %v", err)
+	}
+	log.Error("worker unreachable")
+	if !fileOpen(t, path) {
+		t.Fatal("expected the log file to be open after logging")
+	}
+	if err := log.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if fileOpen(t, path) {
+		t.Fatal("log file still open after Close")
+	}
+}
+
+// fileOpen reports whether the process holds a descriptor for path
+func fileOpen(t *testing.T, path string) bool {
+	t.Helper()
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Fatalf("list open files: %v", err)
+	}
+	for _, fd := range fds {
+		if target, err := os.Readlink(filepath.Join("/proc/self/fd", fd.Name())); err == nil && target == path {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLogFileFromEnv(t *testing.T) {
+	t.Setenv("LOG_FILE", "")
+	if file, err := logFileFromEnv(); err != nil || file != nil {
+		t.Fatalf("expected no log file when LOG_FILE is unset, got %+v: %v", file, err)
+	}
+
+	t.Setenv("LOG_FILE", filepath.Join(t.TempDir(), "agent.log"))
+	file, err := logFileFromEnv()
+	if err != nil {
+		t.Fatalf("log file: %v", err)
+	}
+	if file.MaxSize != defaultLogFileMaxSizeMB || file.MaxBackups != defaultLogFileMaxBackups || file.MaxAge != defaultLogFileMaxAgeDays {
+		t.Fatalf("expected default rotation settings, got %+v", file)
+	}
+
+	t.Setenv("LOG_FILE_MAX_SIZE_MB", "0")
+	if _, err := logFileFromEnv(); err == nil {
+		t.Fatal("expected an error for a zero max size")
+	}
+}
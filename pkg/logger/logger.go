@@ -1,13 +1,17 @@
 package logger
 
 import (
+	"io"
 	"os"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 type CanonicalLogger struct {
 	l *zap.Logger
+	// file is the LOG_FILE output, closed by Close; nil when not configured
+	file io.Closer
 }
 
 // NewLoggerFromEnv creates a new logger based on the LOG_FORMAT environment variable.
@@ -17,6 +21,15 @@ type CanonicalLogger struct {
 //
 // The logger automatically skips one caller frame to report the actual calling code
 // instead of the wrapper function location.
+//
+// Entries below error level are sampled per second: the first
+// LOG_SAMPLING_INITIAL entries with the same level and message are logged,
+// then every LOG_SAMPLING_THEREAFTER-th. Errors are never sampled. Sampling
+// defaults to 100/100 for JSON output and is off for console output; set
+// LOG_SAMPLING_INITIAL=0 to turn it off.
+//
+// When LOG_FILE is set, entries are also written to that file, rotated by
+// size (see logFileFromEnv). This suits deployments without a log shipper.
 func NewLoggerFromEnv(component string) (*CanonicalLogger, error) {
 	// Read LOG_FORMAT environment variable with default to "production"
 	logFormat := os.Getenv("LOG_FORMAT")
@@ -32,25 +45,63 @@ func NewLoggerFromEnv(component string) (*CanonicalLogger, error) {
 		cfg = zap.NewProductionConfig()
 	}
 
+	initial, thereafter, err := samplingFromEnv(cfg.Sampling)
+	if err != nil {
+		return nil, err
+	}
+	// zap's own sampler would drop errors too; sampling is applied below instead
+	cfg.Sampling = nil
+
+	logFile, err := logFileFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
 	// Build logger with AddCallerSkip(1) to skip the wrapper frame
 	// This ensures the caller field shows the actual calling code, not the wrapper
 	zapLogger, err := cfg.Build(
 		zap.AddCallerSkip(1),
+		// Wrap before adding fields so the file output gets them too
+		zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			if logFile != nil {
+				core = withFile(core, cfg, zapcore.AddSync(logFile))
+			}
+			return sampleBelowError(core, initial, thereafter)
+		}),
 		zap.Fields(zap.String("component", component)),
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	return &CanonicalLogger{
-		l: zapLogger,
-	}, nil
+	log := &CanonicalLogger{l: zapLogger}
+	if logFile != nil {
+		log.file = logFile
+	}
+	return log, nil
+}
+
+// New wraps an existing zap logger. It is mainly useful in tests where the
+// output needs to be captured or discarded.
+func New(l *zap.Logger) *CanonicalLogger {
+	return &CanonicalLogger{l: l}
 }
 
 func (c *CanonicalLogger) Sync() {
 	_ = c.l.Sync()
 }
 
+// Close flushes buffered entries and closes the LOG_FILE output, if any.
+// Call it on the logger NewLoggerFromEnv returned, once the service is done
+// logging.
+func (c *CanonicalLogger) Close() error {
+	_ = c.l.Sync()
+	if c.file == nil {
+		return nil
+	}
+	return c.file.Close()
+}
+
 func (c *CanonicalLogger) Info(msg string, fields ...zap.Field) {
 	c.l.Info(msg, fields...)
 }
@@ -59,6 +110,10 @@ func (c *CanonicalLogger) Debug(msg string, fields ...zap.Field) {
 	c.l.Debug(msg, fields...)
 }
 
+func (c *CanonicalLogger) Warn(msg string, fields ...zap.Field) {
+	c.l.Warn(msg, fields...)
+}
+
 func (c *CanonicalLogger) Error(msg string, fields ...zap.Field) {
 	c.l.Error(msg, fields...)
 }
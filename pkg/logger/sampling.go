@@ -0,0 +1,71 @@
+package logger
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// samplingTick is the window the sampling counts are kept for
+const samplingTick = time.Second
+
+// defaultSamplingThereafter applies when sampling is turned on for a format
+// that does not sample by default
+const defaultSamplingThereafter = 100
+
+// samplingFromEnv reads LOG_SAMPLING_INITIAL and LOG_SAMPLING_THEREAFTER,
+// falling back to the format's default sampling (nil means off)
+func samplingFromEnv(def *zap.SamplingConfig) (initial, thereafter int, err error) {
+	thereafter = defaultSamplingThereafter
+	if def != nil {
+		initial, thereafter = def.Initial, def.Thereafter
+	}
+	if initial, err = envInt("LOG_SAMPLING_INITIAL", initial); err != nil {
+		return 0, 0, err
+	}
+	if thereafter, err = envInt("LOG_SAMPLING_THEREAFTER", thereafter); err != nil {
+		return 0, 0, err
+	}
+	return initial, thereafter, nil
+}
+
+// sampleBelowError samples entries below error level: per second, the first
+// initial entries with the same level and message are kept, then every
+// thereafter-th (none when thereafter is 0). Errors and above always pass.
+// An initial of 0 or less returns core unchanged.
+func sampleBelowError(core zapcore.Core, initial, thereafter int) zapcore.Core {
+	if initial <= 0 {
+		return core
+	}
+	errorsOnly, err := zapcore.NewIncreaseLevelCore(core, zapcore.ErrorLevel)
+	if err != nil {
+		// core only logs above error level; there is nothing to sample
+		return core
+	}
+	return zapcore.NewTee(
+		zapcore.NewSamplerWithOptions(belowLevelCore{Core: core, max: zapcore.ErrorLevel}, samplingTick, initial, thereafter),
+		errorsOnly,
+	)
+}
+
+// belowLevelCore passes only entries below max to the wrapped core
+type belowLevelCore struct {
+	zapcore.Core
+	max zapcore.Level
+}
+
+func (c belowLevelCore) Enabled(level zapcore.Level) bool {
+	return level < c.max && c.Core.Enabled(level)
+}
+
+func (c belowLevelCore) With(fields []zapcore.Field) zapcore.Core {
+	return belowLevelCore{Core: c.Core.With(fields), max: c.max}
+}
+
+func (c belowLevelCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(entry.Level) {
+		return checked
+	}
+	return c.Core.Check(entry, checked)
+}
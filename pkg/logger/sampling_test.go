@@ -0,0 +1,70 @@
+package logger
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestSampleBelowError_KeepsErrors(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	log := New(zap.New(sampleBelowError(core, 5, 0)))
+
+	for i := 0; i < 100; i++ {
+		log.Info("request completed")
+		log.Error("request failed")
+	}
+
+	if n := logs.FilterMessage("request completed").Len(); n != 5 {
+		t.Fatalf("expected the info burst to be sampled down to 5 lines, got %d", n)
+	}
+	if n := logs.FilterMessage("request failed").Len(); n != 100 {
+		t.Fatalf("expected every error to be logged, got %d", n)
+	}
+}
+
+func TestSampleBelowError_Thereafter(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	log := New(zap.New(sampleBelowError(core, 2, 10)))
+
+	for i := 0; i < 52; i++ {
+		log.Warn("slow upstream")
+	}
+	// 2 initial, then every 10th of the remaining 50
+	if n := logs.Len(); n != 7 {
+		t.Fatalf("expected 7 sampled lines, got %d", n)
+	}
+}
+
+func TestSampleBelowError_Disabled(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	log := New(zap.New(sampleBelowError(core, 0, 0)))
+
+	for i := 0; i < 100; i++ {
+		log.Info("request completed")
+	}
+	if n := logs.Len(); n != 100 {
+		t.Fatalf("expected no sampling, got %d lines", n)
+	}
+}
+
+func TestSamplingFromEnv(t *testing.T) {
+	t.Setenv("LOG_SAMPLING_INITIAL", "")
+	t.Setenv("LOG_SAMPLING_THEREAFTER", "")
+	if initial, thereafter, err := samplingFromEnv(&zap.SamplingConfig{Initial: 100, Thereafter: 100}); err != nil || initial != 100 || thereafter != 100 {
+		t.Fatalf("expected the format default, got %d/%d: %v", initial, thereafter, err)
+	}
+
+	t.Setenv("LOG_SAMPLING_INITIAL", "10")
+	t.Setenv("LOG_SAMPLING_THEREAFTER", "50")
+	if initial, thereafter, err := samplingFromEnv(nil); err != nil || initial != 10 || thereafter != 50 {
+		t.Fatalf("expected 10/50, got %d/%d: %v", initial, thereafter, err)
+	}
+
+	t.Setenv("LOG_SAMPLING_INITIAL", "lots")
+	if _, _, err := samplingFromEnv(nil); err == nil {
+		t.Fatal("expected an error for a non-numeric value")
+	}
+}
@@ -0,0 +1,47 @@
+// Package mergepatch implements JSON Merge Patch as described in RFC 7386.
+package mergepatch
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Apply applies a JSON merge patch to the original JSON document and returns
+// the patched document. Members set to null in the patch are removed, objects
+// are merged recursively and any other value replaces the original one.
+func Apply(original, patch []byte) ([]byte, error) {
+	var patchValue interface{}
+	if err := json.Unmarshal(patch, &patchValue); err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+
+	var originalValue interface{}
+	if len(original) > 0 {
+		if err := json.Unmarshal(original, &originalValue); err != nil {
+			return nil, fmt.Errorf("invalid original document: %w", err)
+		}
+	}
+
+	return json.Marshal(merge(originalValue, patchValue))
+}
+
+func merge(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = make(map[string]interface{})
+	}
+
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+			continue
+		}
+		targetObj[key] = merge(targetObj[key], value)
+	}
+	return targetObj
+}
@@ -23,7 +23,7 @@ func AgentTokenAuth(db *gorm.DB, log *logger.CanonicalLogger) fiber.Handler {
 				zap.String("path", c.Path()),
 				zap.String("ip", c.IP()),
 			)
-			return c.Status(fiber.StatusUnauthorized).JSON(wrapper.ResponseFailed(http.StatusUnauthorized, "missing authorization header", nil))
+			return c.Status(fiber.StatusUnauthorized).JSON(wrapper.ResponseUnauthorized("missing authorization header"))
 		}
 
 		parts := strings.SplitN(authHeader, " ", 2)
@@ -32,7 +32,7 @@ func AgentTokenAuth(db *gorm.DB, log *logger.CanonicalLogger) fiber.Handler {
 				zap.String("path", c.Path()),
 				zap.String("header", authHeader),
 			)
-			return c.Status(fiber.StatusUnauthorized).JSON(wrapper.ResponseFailed(http.StatusUnauthorized, "malformed authorization header", nil))
+			return c.Status(fiber.StatusUnauthorized).JSON(wrapper.ResponseUnauthorized("malformed authorization header"))
 		}
 
 		token := parts[1]
@@ -40,7 +40,7 @@ func AgentTokenAuth(db *gorm.DB, log *logger.CanonicalLogger) fiber.Handler {
 			log.Debug("empty bearer token",
 				zap.String("path", c.Path()),
 			)
-			return c.Status(fiber.StatusUnauthorized).JSON(wrapper.ResponseFailed(http.StatusUnauthorized, "empty bearer token", nil))
+			return c.Status(fiber.StatusUnauthorized).JSON(wrapper.ResponseUnauthorized("empty bearer token"))
 		}
 
 		var agent models.AgentConfig
@@ -50,7 +50,7 @@ func AgentTokenAuth(db *gorm.DB, log *logger.CanonicalLogger) fiber.Handler {
 					zap.String("path", c.Path()),
 					zap.String("ip", c.IP()),
 				)
-				return c.Status(fiber.StatusUnauthorized).JSON(wrapper.ResponseFailed(http.StatusUnauthorized, "invalid api token", nil))
+				return c.Status(fiber.StatusUnauthorized).JSON(wrapper.ResponseUnauthorized("invalid api token"))
 			}
 
 			log.Error("database error during token lookup",
@@ -60,6 +60,15 @@ func AgentTokenAuth(db *gorm.DB, log *logger.CanonicalLogger) fiber.Handler {
 			return c.Status(fiber.StatusInternalServerError).JSON(wrapper.ResponseFailed(http.StatusInternalServerError, "authentication failed", nil))
 		}
 
+		if agent.Revoked {
+			log.Debug("revoked api token",
+				zap.String("agent_id", agent.ID),
+				zap.String("path", c.Path()),
+				zap.String("ip", c.IP()),
+			)
+			return c.Status(fiber.StatusForbidden).JSON(wrapper.ResponseFailed(http.StatusForbidden, "api token revoked", nil))
+		}
+
 		c.Locals(AgentIDContextKey, agent.ID)
 
 		log.Debug("agent authenticated",
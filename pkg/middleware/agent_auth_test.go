@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/Alwanly/service-distribute-management/internal/server/controller/repository"
+	"github.com/Alwanly/service-distribute-management/pkg/database"
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+)
+
+func TestAgentTokenAuth_RevokeAndRotate(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	repo := repository.NewRepository(db, nil)
+
+	agent, err := repo.CreateAgent("host-a", nil)
+	if err != nil {
+		t.Fatalf("create agent: %v", err)
+	}
+
+	app := fiber.New()
+	app.Get("/config", AgentTokenAuth(db, logger.New(zap.NewNop())), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	status := func(token string) int {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/config", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if got := status(agent.APIToken); got != fiber.StatusOK {
+		t.Fatalf("before revoke: got %d, want 200", got)
+	}
+
+	if _, err := repo.RevokeAgentToken(agent.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if got := status(agent.APIToken); got != fiber.StatusForbidden {
+		t.Fatalf("after revoke: got %d, want 403", got)
+	}
+
+	newToken, err := repo.RotateAgentToken(agent.ID)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if got := status(newToken); got != fiber.StatusOK {
+		t.Fatalf("after rotate: got %d, want 200", got)
+	}
+	if got := status(agent.APIToken); got != fiber.StatusUnauthorized {
+		t.Fatalf("old token after rotate: got %d, want 401", got)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	authentication "github.com/Alwanly/service-distribute-management/pkg/auth"
+	"github.com/Alwanly/service-distribute-management/pkg/wrapper"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -87,13 +88,7 @@ func (a *AuthMiddleware) BasicAuthAdmin() fiber.Handler {
 	}
 }
 
-func responseUnauthorized(c *fiber.Ctx, _ string, message ...string) error {
+func responseUnauthorized(c *fiber.Ctx, _ string, message string) error {
 	c.Set("WWW-Authenticate", "Basic realm=Restricted")
-	response := fiber.Map{
-		"message": message[0],
-	}
-	if len(message) > 1 {
-		response["statusCode"] = message[1]
-	}
-	return c.Status(http.StatusUnauthorized).JSON(response)
+	return c.Status(http.StatusUnauthorized).JSON(wrapper.ResponseUnauthorized(message))
 }
@@ -13,6 +13,11 @@ func CanonicalLoggerMiddleware(log *logger.CanonicalLogger) fiber.Handler {
 		logCtx := logger.NewLogContext()
 		c.Locals("log_context", logCtx)
 		userCtx := logger.WithLogContext(c.UserContext(), logCtx)
+		// Continue the caller's correlation ID so one update can be followed across services
+		if corr := c.Get(logger.HeaderCorrelationID); corr != "" {
+			userCtx = logger.WithCorrelationID(userCtx, corr)
+			logCtx.AddField(zap.String(logger.FieldCorrelationID, corr))
+		}
 		c.SetUserContext(userCtx)
 		if reqID := c.Locals("requestid"); reqID != nil {
 			if id, ok := reqID.(string); ok {
@@ -31,6 +36,10 @@ func CanonicalLoggerMiddleware(log *logger.CanonicalLogger) fiber.Handler {
 				zap.Int("status", status),
 				zap.Duration("duration", duration),
 				zap.Int64("duration_ms", duration.Milliseconds()),
+				zap.Int("bytes_in", requestSize(c)),
+				zap.Int("bytes_out", responseSize(c)),
+				zap.String("remote_ip", c.IP()),
+				zap.String("user_agent", c.Get(fiber.HeaderUserAgent)),
 			}
 			fields = append(fields, logCtx.Fields()...)
 			if status >= 500 {
@@ -46,3 +55,20 @@ func CanonicalLoggerMiddleware(log *logger.CanonicalLogger) fiber.Handler {
 		return c.Next()
 	}
 }
+
+// requestSize returns the request body size, preferring Content-Length
+func requestSize(c *fiber.Ctx) int {
+	if n := c.Request().Header.ContentLength(); n >= 0 {
+		return n
+	}
+	return len(c.Request().Body())
+}
+
+// responseSize returns the response body size. Streamed bodies are not read
+// so their size comes from Content-Length (-1 when unknown).
+func responseSize(c *fiber.Ctx) int {
+	if c.Response().IsBodyStream() {
+		return c.Response().Header.ContentLength()
+	}
+	return len(c.Response().Body())
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+)
+
+func TestCanonicalLoggerMiddleware_AccessFields(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	app := fiber.New()
+	app.Use(CanonicalLoggerMiddleware(logger.New(zap.New(core))))
+
+	responseBody := strings.Repeat("x", 4096)
+	app.Post("/hit", func(c *fiber.Ctx) error {
+		return c.SendString(responseBody)
+	})
+
+	req := httptest.NewRequest("POST", "/hit", strings.NewReader(`{"hello":"world"}`))
+	req.Header.Set("User-Agent", "test-agent/1.0")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+
+	entries := logs.FilterMessage("http_request").All()
+	if len(entries) != 1 {
+		t.Fatalf("expected one access log entry, got %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+
+	if got := fields["bytes_in"]; got != int64(len(`{"hello":"world"}`)) {
+		t.Errorf("bytes_in = %v", got)
+	}
+	if got := fields["bytes_out"]; got != int64(len(responseBody)) {
+		t.Errorf("bytes_out = %v, want %d", got, len(responseBody))
+	}
+	if got := fields["user_agent"]; got != "test-agent/1.0" {
+		t.Errorf("user_agent = %v", got)
+	}
+	if got, ok := fields["remote_ip"].(string); !ok || got == "" {
+		t.Errorf("remote_ip = %v, want non-empty", fields["remote_ip"])
+	}
+}
+
+func TestCanonicalLoggerMiddleware_CorrelationID(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	app := fiber.New()
+	app.Use(CanonicalLoggerMiddleware(logger.New(zap.New(core))))
+
+	var got string
+	app.Post("/config", func(c *fiber.Ctx) error {
+		got = logger.GetCorrelationID(c.UserContext())
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	req := httptest.NewRequest("POST", "/config", nil)
+	req.Header.Set(logger.HeaderCorrelationID, "corr-42")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+
+	if got != "corr-42" {
+		t.Errorf("correlation ID in context = %q, want corr-42", got)
+	}
+	entries := logs.FilterMessage("http_request").All()
+	if len(entries) != 1 || entries[0].ContextMap()[logger.FieldCorrelationID] != "corr-42" {
+		t.Errorf("expected access log to carry correlation_id, got %v", entries)
+	}
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"github.com/Alwanly/service-distribute-management/pkg/logger"
+	"github.com/Alwanly/service-distribute-management/pkg/wrapper"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -14,8 +15,6 @@ func ErrorHandler(log *logger.CanonicalLogger) fiber.ErrorHandler {
 
 		log.HTTPError(c.Method(), c.Path(), code, err)
 
-		return c.Status(code).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return c.Status(code).JSON(wrapper.ResponseFailed(code, err.Error(), nil))
 	}
 }
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+	"github.com/Alwanly/service-distribute-management/pkg/wrapper"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// BootstrapTokenContextKey holds the bootstrap token a registration
+// authenticated with
+const BootstrapTokenContextKey = "bootstrap_token"
+
+// BootstrapTokenChecker reports whether a bootstrap token is valid without
+// using it up
+type BootstrapTokenChecker func(ctx context.Context, token string) (bool, error)
+
+// RegistrationAuth accepts either the shared agent Basic Auth credentials or a
+// bootstrap token sent as "Authorization: Bearer <token>". The token is only
+// checked here and stored under BootstrapTokenContextKey; the handler uses it
+// up when the registration succeeds, so a rejected or failed request keeps
+// the use.
+func RegistrationAuth(a *AuthMiddleware, check BootstrapTokenChecker, log *logger.CanonicalLogger) fiber.Handler {
+	basic := a.BasicAuth()
+	return func(c *fiber.Ctx) error {
+		parts := strings.SplitN(c.Get(fiber.HeaderAuthorization), " ", 2)
+		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+			return basic(c)
+		}
+
+		token := strings.TrimSpace(parts[1])
+		if token == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(wrapper.ResponseUnauthorized("empty bootstrap token"))
+		}
+
+		ok, err := check(c.UserContext(), token)
+		if err != nil {
+			log.Error("failed to check bootstrap token", zap.Error(err), zap.String("path", c.Path()))
+			return c.Status(fiber.StatusInternalServerError).JSON(wrapper.ResponseFailed(http.StatusInternalServerError, "authentication failed", nil))
+		}
+		if !ok {
+			log.Debug("invalid bootstrap token", zap.String("path", c.Path()), zap.String("ip", c.IP()))
+			return c.Status(fiber.StatusUnauthorized).JSON(wrapper.ResponseUnauthorized("invalid or expired bootstrap token"))
+		}
+
+		logger.AddToContext(c.UserContext(), zap.String("auth_method", "bootstrap_token"))
+		c.Locals(BootstrapTokenContextKey, token)
+		return c.Next()
+	}
+}
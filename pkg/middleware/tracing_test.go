@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/Alwanly/service-distribute-management/pkg/httpclient"
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+)
+
+// recordSpans installs a tracer provider that keeps every ended span
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return rec
+}
+
+// forwardTo answers by POSTing to target with the request's context
+func forwardTo(target string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, err := httpclient.DoJSON(c.UserContext(), http.DefaultClient, http.MethodPost, target, struct{}{}, nil, nil); err != nil {
+			return fiber.NewError(fiber.StatusBadGateway, err.Error())
+		}
+		return c.SendStatus(fiber.StatusOK)
+	}
+}
+
+func TestTracingMiddleware_PropagatesControllerToAgentToWorker(t *testing.T) {
+	rec := recordSpans(t)
+
+	worker := fiber.New()
+	worker.Use(TracingMiddleware())
+	worker.Post("/config", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	workerSrv := httptest.NewServer(adaptor.FiberApp(worker))
+	defer workerSrv.Close()
+
+	agent := fiber.New()
+	agent.Use(TracingMiddleware())
+	agent.Post("/config-updates", forwardTo(workerSrv.URL+"/config"))
+	agentSrv := httptest.NewServer(adaptor.FiberApp(agent))
+	defer agentSrv.Close()
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	controller := fiber.New()
+	controller.Use(CanonicalLoggerMiddleware(logger.New(zap.New(core))))
+	controller.Use(TracingMiddleware())
+	controller.Post("/config", forwardTo(agentSrv.URL+"/config-updates"))
+
+	resp, err := controller.Test(httptest.NewRequest(http.MethodPost, "/config", nil), -1)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	spans := rec.Ended()
+	if len(spans) != 5 {
+		t.Fatalf("expected 3 server and 2 client spans, got %d", len(spans))
+	}
+	byKind := map[trace.SpanKind][]sdktrace.ReadOnlySpan{}
+	traceID := spans[0].SpanContext().TraceID()
+	for _, s := range spans {
+		if s.SpanContext().TraceID() != traceID {
+			t.Fatalf("span %q is in trace %s, want %s", s.Name(), s.SpanContext().TraceID(), traceID)
+		}
+		byKind[s.SpanKind()] = append(byKind[s.SpanKind()], s)
+	}
+
+	// Spans end innermost first: worker, agent's call, agent, controller's call, controller
+	servers, clients := byKind[trace.SpanKindServer], byKind[trace.SpanKindClient]
+	if len(servers) != 3 || len(clients) != 2 {
+		t.Fatalf("got %d server and %d client spans", len(servers), len(clients))
+	}
+	workerSpan, agentSpan, controllerSpan := servers[0], servers[1], servers[2]
+	agentCall, controllerCall := clients[0], clients[1]
+
+	if controllerSpan.Parent().IsValid() {
+		t.Fatal("expected the controller span to start the trace")
+	}
+	chain := []struct {
+		child, parent sdktrace.ReadOnlySpan
+	}{
+		{controllerCall, controllerSpan},
+		{agentSpan, controllerCall},
+		{agentCall, agentSpan},
+		{workerSpan, agentCall},
+	}
+	for _, link := range chain {
+		if link.child.Parent().SpanID() != link.parent.SpanContext().SpanID() {
+			t.Errorf("span %q is not a child of %q", link.child.Name(), link.parent.Name())
+		}
+	}
+	if workerSpan.Name() != "POST /config" || agentSpan.Name() != "POST /config-updates" {
+		t.Errorf("unexpected server span names %q, %q", workerSpan.Name(), agentSpan.Name())
+	}
+
+	entries := logs.FilterMessage("http_request").All()
+	if len(entries) != 1 || entries[0].ContextMap()[logger.FieldTraceID] != traceID.String() {
+		t.Fatalf("expected the access log to carry trace_id %s", traceID)
+	}
+}
+
+func TestTracingMiddleware_ContinuesIncomingTrace(t *testing.T) {
+	rec := recordSpans(t)
+
+	app := fiber.New()
+	app.Use(TracingMiddleware())
+	app.Get("/agents/:id", func(c *fiber.Ctx) error { return fiber.ErrInternalServerError })
+
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest(http.MethodGet, "/agents/agent-1", nil)
+	req.Header.Set("traceparent", parent)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+
+	spans := rec.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected one span, got %d", len(spans))
+	}
+	s := spans[0]
+	if got := s.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace id = %s, want the incoming one", got)
+	}
+	if got := s.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("parent span id = %s, want the incoming one", got)
+	}
+	if s.Name() != "GET /agents/:id" {
+		t.Errorf("span name = %q, want the route", s.Name())
+	}
+	if s.Status().Code != codes.Error {
+		t.Errorf("status = %v, want an error for a 500", s.Status())
+	}
+}
+
+func TestHTTPClientSpan_RedactsURL(t *testing.T) {
+	rec := recordSpans(t)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	target := strings.Replace(upstream.URL, "http://", "http://user:hunter2@", 1) + "/config?api_key=s3cret&page=2"
+	if _, err := httpclient.DoJSON(context.Background(), http.DefaultClient, http.MethodGet, target, nil, nil, nil); err != nil {
+		t.Fatalf("request: %v", err)
+	}
+
+	spans := rec.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected one span, got %d", len(spans))
+	}
+	for _, attr := range spans[0].Attributes() {
+		if attr.Key != "url.full" {
+			continue
+		}
+		got := attr.Value.AsString()
+		if strings.Contains(got, "hunter2") || strings.Contains(got, "s3cret") || !strings.Contains(got, "page=2") {
+			t.Errorf("url.full = %q, want the password and api_key masked", got)
+		}
+		return
+	}
+	t.Error("span has no url.full attribute")
+}
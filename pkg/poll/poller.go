@@ -2,8 +2,10 @@ package poll
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Alwanly/service-distribute-management/pkg/logger"
@@ -11,6 +13,13 @@ import (
 	"go.uber.org/zap"
 )
 
+var (
+	// ErrNotRegistered is returned when updating a fetch function that was never registered
+	ErrNotRegistered = errors.New("fetch function not registered")
+	// ErrInvalidInterval is returned for a non-positive poll interval
+	ErrInvalidInterval = errors.New("invalid interval: must be positive")
+)
+
 // poller implements the Poller interface
 type poller struct {
 	logger    *logger.CanonicalLogger
@@ -19,6 +28,10 @@ type poller struct {
 	stopChans map[string]chan struct{}
 	mu        sync.RWMutex
 	started   bool
+	// unit is the length of one interval step; always a second outside tests
+	unit    time.Duration
+	loops   sync.WaitGroup
+	running atomic.Int32
 }
 
 type pollMeta struct {
@@ -32,6 +45,7 @@ func NewPoller(logger *logger.CanonicalLogger) Poller {
 		fetchMeta: make(map[string]pollMeta),
 		tickers:   make(map[string]*time.Ticker),
 		stopChans: make(map[string]chan struct{}),
+		unit:      time.Second,
 	}
 }
 
@@ -59,19 +73,24 @@ func (p *poller) Start(ctx context.Context) error {
 	p.started = true
 
 	for name, meta := range p.fetchMeta {
-		interval := time.Duration(meta.PollIntervalSeconds) * time.Second
-		p.tickers[name] = time.NewTicker(interval)
+		p.tickers[name] = time.NewTicker(time.Duration(meta.PollIntervalSeconds) * p.unit)
 		p.stopChans[name] = make(chan struct{})
 
+		p.loops.Add(1)
+		p.running.Add(1)
 		go p.pollLoop(ctx, name, meta.FetchFunc, p.tickers[name], p.stopChans[name])
 	}
+	count := len(p.fetchMeta)
 	p.mu.Unlock()
 
-	p.logger.Info("poller started", zap.Int("fetch_functions", len(p.fetchMeta)))
+	p.logger.Info("poller started", zap.Int("fetch_functions", count))
 	return nil
 }
 
 func (p *poller) pollLoop(ctx context.Context, name string, fetchFunc FetchFunc, ticker *time.Ticker, stopChan chan struct{}) {
+	defer p.loops.Done()
+	defer p.running.Add(-1)
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -95,17 +114,20 @@ func (p *poller) pollLoop(ctx context.Context, name string, fetchFunc FetchFunc,
 	}
 }
 
+// UpdateInterval changes the interval of a registered fetch function. A
+// running poll loop keeps going and its ticker is reset in place, so the
+// update is safe to call from the fetch function itself.
 func (p *poller) UpdateInterval(name string, newIntervalSeconds int) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	if newIntervalSeconds <= 0 {
-		return fmt.Errorf("invalid interval: must be positive, got %d", newIntervalSeconds)
+		return fmt.Errorf("%w, got %d", ErrInvalidInterval, newIntervalSeconds)
 	}
 
 	meta, exists := p.fetchMeta[name]
 	if !exists {
-		return fmt.Errorf("fetch function %q not registered", name)
+		return fmt.Errorf("%w: %q", ErrNotRegistered, name)
 	}
 
 	if meta.PollIntervalSeconds == newIntervalSeconds {
@@ -119,23 +141,8 @@ func (p *poller) UpdateInterval(name string, newIntervalSeconds int) error {
 	meta.PollIntervalSeconds = newIntervalSeconds
 	p.fetchMeta[name] = meta
 
-	if p.started {
-		if ticker, ok := p.tickers[name]; ok {
-			ticker.Stop()
-		}
-
-		newInterval := time.Duration(newIntervalSeconds) * time.Second
-		p.tickers[name] = time.NewTicker(newInterval)
-
-		if stopChan, ok := p.stopChans[name]; ok {
-			close(stopChan)
-		}
-
-		p.stopChans[name] = make(chan struct{})
-
-		ctx := context.Background()
-		go p.pollLoop(ctx, name, meta.FetchFunc, p.tickers[name], p.stopChans[name])
-
+	if ticker, ok := p.tickers[name]; ok && p.started {
+		ticker.Reset(time.Duration(newIntervalSeconds) * p.unit)
 		p.logger.Info("poll interval updated",
 			zap.String("name", name),
 			zap.Int("new_interval_seconds", newIntervalSeconds),
@@ -145,11 +152,11 @@ func (p *poller) UpdateInterval(name string, newIntervalSeconds int) error {
 	return nil
 }
 
+// Stop ends every poll loop and waits for in-flight fetches to return
 func (p *poller) Stop() error {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-
 	if !p.started {
+		p.mu.Unlock()
 		return fmt.Errorf("poller not started")
 	}
 
@@ -159,8 +166,13 @@ func (p *poller) Stop() error {
 			close(stopChan)
 		}
 	}
-
+	p.tickers = make(map[string]*time.Ticker)
+	p.stopChans = make(map[string]chan struct{})
 	p.started = false
+	p.mu.Unlock()
+
+	// A fetch in progress may call UpdateInterval, so wait without the lock
+	p.loops.Wait()
 	p.logger.Info("poller stopped")
 	return nil
 }
@@ -0,0 +1,121 @@
+package poll
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+)
+
+// newTestPoller returns a poller whose intervals are in milliseconds
+func newTestPoller() *poller {
+	p := NewPoller(logger.New(zap.NewNop())).(*poller)
+	p.unit = time.Millisecond
+	return p
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestUpdateInterval_KeepsSinglePollLoop(t *testing.T) {
+	p := newTestPoller()
+
+	var fetches atomic.Int32
+	p.RegisterFetchFunc("config", func(ctx context.Context, log *logger.CanonicalLogger) error {
+		fetches.Add(1)
+		return nil
+	}, PollerConfig{PollIntervalSeconds: 60_000})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := p.Start(ctx); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	for _, interval := range []int{30_000, 45_000, 20_000, 10} {
+		if err := p.UpdateInterval("config", interval); err != nil {
+			t.Fatalf("update to %d: %v", interval, err)
+		}
+	}
+	if n := p.running.Load(); n != 1 {
+		t.Fatalf("expected 1 poll loop, got %d", n)
+	}
+
+	// Only the latest (10ms) interval can produce fetches this quickly
+	waitFor(t, "fetches at the latest interval", func() bool { return fetches.Load() >= 5 })
+	if got := p.fetchMeta["config"].PollIntervalSeconds; got != 10 {
+		t.Fatalf("expected stored interval 10, got %d", got)
+	}
+
+	if err := p.Stop(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if n := p.running.Load(); n != 0 {
+		t.Fatalf("expected no poll loops after stop, got %d", n)
+	}
+}
+
+func TestUpdateInterval_FromFetchFunc(t *testing.T) {
+	p := newTestPoller()
+
+	// Like the agent's GetConfigure, the fetch function applies the interval
+	// the controller returned on every run
+	var fetches atomic.Int32
+	p.RegisterFetchFunc("config", func(ctx context.Context, log *logger.CanonicalLogger) error {
+		n := fetches.Add(1)
+		return p.UpdateInterval("config", 5+int(n%3))
+	}, PollerConfig{PollIntervalSeconds: 5})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := p.Start(ctx); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	waitFor(t, "several interval changes", func() bool { return fetches.Load() >= 10 })
+	if n := p.running.Load(); n != 1 {
+		t.Fatalf("expected 1 poll loop, got %d", n)
+	}
+
+	if err := p.Stop(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if n := p.running.Load(); n != 0 {
+		t.Fatalf("expected no poll loops after stop, got %d", n)
+	}
+}
+
+func TestUpdateInterval_Errors(t *testing.T) {
+	p := newTestPoller()
+	p.RegisterFetchFunc("config", func(ctx context.Context, log *logger.CanonicalLogger) error {
+		return nil
+	}, PollerConfig{PollIntervalSeconds: 5})
+
+	if err := p.UpdateInterval("other", 10); !errors.Is(err, ErrNotRegistered) {
+		t.Fatalf("expected ErrNotRegistered, got %v", err)
+	}
+	if err := p.UpdateInterval("config", 0); !errors.Is(err, ErrInvalidInterval) {
+		t.Fatalf("expected ErrInvalidInterval, got %v", err)
+	}
+
+	// Before Start only the registered interval changes
+	if err := p.UpdateInterval("config", 10); err != nil {
+		t.Fatalf("update before start: %v", err)
+	}
+	if got := p.fetchMeta["config"].PollIntervalSeconds; got != 10 {
+		t.Fatalf("expected interval 10, got %d", got)
+	}
+}
@@ -1,6 +1,17 @@
 package pubsub
 
-import "context"
+import (
+	"context"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrNoChannels is returned by Subscribe when called without any channel
+var ErrNoChannels = errors.New("pubsub: no channels to subscribe to")
+
+// ErrClosed is returned by Subscribe after Close
+var ErrClosed = errors.New("pubsub: closed")
 
 // Message represents a pub/sub message
 type Message struct {
@@ -10,14 +21,34 @@ type Message struct {
 
 // Publisher defines the interface for publishing messages
 type Publisher interface {
-	// Publish publishes a message to a channel
-	Publish(ctx context.Context, channel string, message string) error
+	// Publish publishes a message to a channel and returns how many
+	// subscribers received it
+	Publish(ctx context.Context, channel string, message string) (int64, error)
 	Close() error
 }
 
+// Pinger is implemented by backends that can check their connection
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// RedisClientProvider is implemented by Redis backends so other features,
+// e.g. distributed locks, can share their connection
+type RedisClientProvider interface {
+	RedisClient() redis.Cmdable
+}
+
+// DropCounter is implemented by subscribers that drop messages their reader
+// does not keep up with
+type DropCounter interface {
+	DroppedMessages() int64
+}
+
 // Subscriber defines the interface for subscribing to messages
 type Subscriber interface {
-	// Subscribe subscribes to one or more channels and returns a message channel
+	// Subscribe subscribes to one or more channels and returns a message
+	// channel. It returns ErrNoChannels when channels is empty and never a
+	// nil channel without an error.
 	Subscribe(ctx context.Context, channels ...string) (<-chan Message, error)
 	Unsubscribe(ctx context.Context, channels ...string) error
 	Close() error
@@ -0,0 +1,91 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ConfigUpdatesChannel carries ConfigUpdateNotification payloads
+const ConfigUpdatesChannel = "config-updates"
+
+// NotificationSchemaVersion is the newest ConfigUpdateNotification schema
+// this build understands. Version 2 added interval updates; config updates
+// are still published as version 1 so older agents keep acting on them,
+// while they ignore interval updates they cannot apply.
+const NotificationSchemaVersion = 2
+
+// configUpdateSchemaVersion is the schema config update notifications use
+const configUpdateSchemaVersion = 1
+
+// NotificationTypeIntervalUpdate tells an agent its poll interval changed.
+// Notifications without a type are config updates.
+const NotificationTypeIntervalUpdate = "interval-update"
+
+// ErrUnsupportedNotificationSchema is returned when a notification uses a
+// newer schema than this build understands
+var ErrUnsupportedNotificationSchema = errors.New("pubsub: unsupported notification schema version")
+
+// ConfigUpdateNotification tells agents a new config version is available,
+// or with Type NotificationTypeIntervalUpdate, that their poll interval
+// changed. AgentID targets a single agent; empty means every agent.
+type ConfigUpdateNotification struct {
+	SchemaVersion int    `json:"schema_version"`
+	Type          string `json:"type,omitempty"`
+	AgentID       string `json:"agent_id"`
+	ETag          string `json:"etag"`
+	CorrelationID string `json:"correlation_id"`
+	// TraceParent continues the publisher's trace in the agent
+	TraceParent string `json:"traceparent,omitempty"`
+	// PollIntervalSeconds is the agent's new effective poll interval in an
+	// interval update
+	PollIntervalSeconds int `json:"poll_interval_seconds,omitempty"`
+}
+
+// NewConfigUpdateNotification builds a config update notification
+func NewConfigUpdateNotification(agentID, etag, correlationID string) ConfigUpdateNotification {
+	return ConfigUpdateNotification{
+		SchemaVersion: configUpdateSchemaVersion,
+		AgentID:       agentID,
+		ETag:          etag,
+		CorrelationID: correlationID,
+	}
+}
+
+// NewIntervalUpdateNotification builds a notification telling agentID to
+// poll every intervalSeconds from now on
+func NewIntervalUpdateNotification(agentID string, intervalSeconds int, correlationID string) ConfigUpdateNotification {
+	return ConfigUpdateNotification{
+		SchemaVersion:       NotificationSchemaVersion,
+		Type:                NotificationTypeIntervalUpdate,
+		AgentID:             agentID,
+		CorrelationID:       correlationID,
+		PollIntervalSeconds: intervalSeconds,
+	}
+}
+
+// Encode returns the notification as a message payload
+func (n ConfigUpdateNotification) Encode() (string, error) {
+	b, err := json.Marshal(n)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal config update notification: %w", err)
+	}
+	return string(b), nil
+}
+
+// DecodeConfigUpdateNotification parses a message payload. Payloads without a
+// schema version predate versioning and are read as version 1. A newer
+// version returns ErrUnsupportedNotificationSchema.
+func DecodeConfigUpdateNotification(payload string) (ConfigUpdateNotification, error) {
+	var n ConfigUpdateNotification
+	if err := json.Unmarshal([]byte(payload), &n); err != nil {
+		return ConfigUpdateNotification{}, fmt.Errorf("failed to unmarshal config update notification: %w", err)
+	}
+	if n.SchemaVersion == 0 {
+		n.SchemaVersion = 1
+	}
+	if n.SchemaVersion > NotificationSchemaVersion {
+		return n, fmt.Errorf("%w: %d", ErrUnsupportedNotificationSchema, n.SchemaVersion)
+	}
+	return n, nil
+}
@@ -0,0 +1,70 @@
+package pubsub
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConfigUpdateNotification_RoundTrip(t *testing.T) {
+	want := NewConfigUpdateNotification("agent-1", "etag-1", "corr-1")
+	payload, err := want.Encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	got, err := DecodeConfigUpdateNotification(payload)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if got.SchemaVersion != 1 || got.Type != "" {
+		t.Fatalf("expected config updates to stay readable by version 1 agents, got %+v", got)
+	}
+}
+
+func TestIntervalUpdateNotification_RoundTrip(t *testing.T) {
+	want := NewIntervalUpdateNotification("agent-1", 45, "corr-1")
+	payload, err := want.Encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	got, err := DecodeConfigUpdateNotification(payload)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got != want || got.Type != NotificationTypeIntervalUpdate || got.PollIntervalSeconds != 45 {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeConfigUpdateNotification(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     string
+		wantVersion int
+		wantErr     error
+	}{
+		{name: "legacy payload without version", payload: `{"agent_id":"","etag":"e1","correlation_id":"c1"}`, wantVersion: 1},
+		{name: "current version", payload: `{"schema_version":1,"etag":"e1"}`, wantVersion: 1},
+		{name: "interval update version", payload: `{"schema_version":2,"type":"interval-update","etag":"e1","poll_interval_seconds":45}`, wantVersion: 2},
+		{name: "future version", payload: `{"schema_version":3,"etag":"e1","extra":true}`, wantVersion: 3, wantErr: ErrUnsupportedNotificationSchema},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := DecodeConfigUpdateNotification(tt.payload)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got err %v, want %v", err, tt.wantErr)
+			}
+			if n.SchemaVersion != tt.wantVersion || n.ETag != "e1" {
+				t.Errorf("got %+v, want schema %d and etag e1", n, tt.wantVersion)
+			}
+		})
+	}
+
+	if _, err := DecodeConfigUpdateNotification("not json"); err == nil {
+		t.Error("expected malformed payload to fail")
+	}
+}
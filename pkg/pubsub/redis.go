@@ -3,24 +3,44 @@ package pubsub
 import (
 	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
 
 	"github.com/Alwanly/service-distribute-management/pkg/logger"
 	"github.com/redis/go-redis/v9"
 )
 
+// DefaultMessageBuffer is how many received messages wait for the
+// subscriber when RedisConfig.MessageBuffer is not set
+const DefaultMessageBuffer = 16
+
 type RedisConfig struct {
 	Host     string
 	Port     int
 	Password string
 	DB       int
+	// MessageBuffer is how many received messages wait for the subscriber
+	// to read them; when it is full the oldest is dropped
+	MessageBuffer int
 }
 
 type redisPubSub struct {
 	client    *redis.Client
-	pubsub    *redis.PubSub
 	logger    *logger.CanonicalLogger
 	messageCh chan Message
-	cancel    context.CancelFunc
+
+	// mu guards the subscription and closed
+	mu     sync.Mutex
+	pubsub *redis.PubSub
+	cancel context.CancelFunc
+	closed bool
+	// listeners tracks the listen goroutines; Close closes messageCh only
+	// once they have all returned
+	listeners sync.WaitGroup
+	// dropped counts messages dropped from a full messageCh; saturated is
+	// set from the first drop until the subscriber empties the buffer
+	dropped   atomic.Int64
+	saturated atomic.Bool
 }
 
 func NewRedisPubSub(cfg RedisConfig, log *logger.CanonicalLogger) (PubSub, error) {
@@ -36,10 +56,14 @@ func NewRedisPubSub(cfg RedisConfig, log *logger.CanonicalLogger) (PubSub, error
 		return nil, fmt.Errorf("failed to connect to redis at %s: %w", addr, err)
 	}
 
+	buffer := cfg.MessageBuffer
+	if buffer <= 0 {
+		buffer = DefaultMessageBuffer
+	}
 	r := &redisPubSub{
 		client:    client,
 		logger:    log,
-		messageCh: make(chan Message, 16),
+		messageCh: make(chan Message, buffer),
 	}
 
 	log.Info("redis client initialized", logger.String("addr", addr))
@@ -47,13 +71,21 @@ func NewRedisPubSub(cfg RedisConfig, log *logger.CanonicalLogger) (PubSub, error
 	return r, nil
 }
 
-// Publish publishes a message to a Redis channel
-func (r *redisPubSub) Publish(ctx context.Context, channel string, message string) error {
-	if err := r.client.Publish(ctx, channel, message).Err(); err != nil {
+// Publish publishes a message to a Redis channel and returns the number of
+// subscribers that received it
+func (r *redisPubSub) Publish(ctx context.Context, channel string, message string) (int64, error) {
+	receivers, err := r.client.Publish(ctx, channel, message).Result()
+	if err != nil {
 		r.logger.WithError(err).Error("failed to publish message to redis")
-		return err
+		return 0, err
 	}
-	return nil
+	return receivers, nil
+}
+
+// RedisClient returns the underlying client so other Redis features, such
+// as pkg/lock, share the connection pool
+func (r *redisPubSub) RedisClient() redis.Cmdable {
+	return r.client
 }
 
 // Ping checks if Redis connection is healthy
@@ -69,15 +101,19 @@ func (r *redisPubSub) IsHealthy(ctx context.Context) bool {
 // Subscribe subscribes to Redis channels
 func (r *redisPubSub) Subscribe(ctx context.Context, channels ...string) (<-chan Message, error) {
 	if len(channels) == 0 {
-		return nil, nil
+		return nil, ErrNoChannels
 	}
 
-	r.pubsub = r.client.Subscribe(ctx, channels...)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, ErrClosed
+	}
 
-	// Start listening
-	listenCtx, cancel := context.WithCancel(ctx)
-	r.cancel = cancel
-	go r.listen(listenCtx)
+	// A subscribe after a lost connection replaces the previous subscription
+	r.stopListening()
+	r.pubsub = r.client.Subscribe(ctx, channels...)
+	r.startListening(ctx, r.pubsub.Channel())
 
 	r.logger.Info("subscribed to redis channels", logger.Any("channels", channels))
 	return r.messageCh, nil
@@ -85,33 +121,67 @@ func (r *redisPubSub) Subscribe(ctx context.Context, channels ...string) (<-chan
 
 // Unsubscribe unsubscribes from Redis channels
 func (r *redisPubSub) Unsubscribe(ctx context.Context, channels ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	if r.pubsub == nil {
 		return nil
 	}
 	return r.pubsub.Unsubscribe(ctx, channels...)
 }
 
-// Close closes the Redis connection
+// Close stops the listener, closes the message channel and then the Redis
+// connection. Calls after the first do nothing.
 func (r *redisPubSub) Close() error {
-	if r.cancel != nil {
-		r.cancel()
-	}
-	if r.pubsub != nil {
-		_ = r.pubsub.Close()
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
 	}
+	r.closed = true
+	r.stopListening()
+	r.mu.Unlock()
+
+	// A listener blocked on a full messageCh returns on its cancelled
+	// context; closing messageCh before it has would panic its send
+	r.listeners.Wait()
+	close(r.messageCh)
+
 	if r.client != nil {
 		if err := r.client.Close(); err != nil {
 			r.logger.WithError(err).Error("failed to close redis client")
 			return err
 		}
 	}
-	close(r.messageCh)
 	return nil
 }
 
+// startListening forwards messages from ch to messageCh until ctx is done
+// or stopListening is called. The caller holds mu.
+func (r *redisPubSub) startListening(ctx context.Context, ch <-chan *redis.Message) {
+	listenCtx, cancel := context.WithCancel(ctx)
+	r.cancel = cancel
+	r.listeners.Add(1)
+	go func() {
+		defer r.listeners.Done()
+		r.listen(listenCtx, ch)
+	}()
+}
+
+// stopListening cancels the listener and closes the subscription. The
+// caller holds mu.
+func (r *redisPubSub) stopListening() {
+	if r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+	if r.pubsub != nil {
+		_ = r.pubsub.Close()
+		r.pubsub = nil
+	}
+}
+
 // listen listens for messages from subscribed channels
-func (r *redisPubSub) listen(ctx context.Context) {
-	ch := r.pubsub.Channel()
+func (r *redisPubSub) listen(ctx context.Context, ch <-chan *redis.Message) {
 	for {
 		select {
 		case <-ctx.Done():
@@ -122,7 +192,43 @@ func (r *redisPubSub) listen(ctx context.Context) {
 				r.logger.Info("redis pubsub channel closed")
 				return
 			}
-			r.messageCh <- Message{Channel: m.Channel, Payload: m.Payload}
+			r.deliver(Message{Channel: m.Channel, Payload: m.Payload})
 		}
 	}
 }
+
+// deliver queues m for the subscriber without blocking. When the buffer is
+// full the oldest message is dropped, so a slow subscriber never stops the
+// listener reading from Redis; a config notification is superseded by any
+// newer one, so the newest are the ones to keep.
+func (r *redisPubSub) deliver(m Message) {
+	for {
+		if len(r.messageCh) == 0 {
+			r.saturated.Store(false)
+		}
+		select {
+		case r.messageCh <- m:
+			return
+		default:
+		}
+		select {
+		case old := <-r.messageCh:
+			dropped := r.dropped.Add(1)
+			if !r.saturated.Swap(true) {
+				r.logger.Warn("redis message buffer full, dropping oldest messages",
+					logger.Int("buffer", cap(r.messageCh)),
+					logger.String("dropped_channel", old.Channel),
+					logger.Int64("dropped_total", dropped),
+				)
+			}
+		default:
+			// The subscriber read a message meanwhile; retry the send
+		}
+	}
+}
+
+// DroppedMessages returns how many messages were dropped because the
+// subscriber did not keep up
+func (r *redisPubSub) DroppedMessages() int64 {
+	return r.dropped.Load()
+}
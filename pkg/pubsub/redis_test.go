@@ -0,0 +1,158 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+func TestSubscribe_NoChannels(t *testing.T) {
+	r := &redisPubSub{logger: logger.New(zap.NewNop()), messageCh: make(chan Message, 1)}
+
+	ch, err := r.Subscribe(context.Background())
+	if !errors.Is(err, ErrNoChannels) {
+		t.Fatalf("got %v, want ErrNoChannels", err)
+	}
+	if ch != nil {
+		t.Fatal("got a message channel alongside the error")
+	}
+}
+
+func TestClose_WhileMessagesArrive(t *testing.T) {
+	for _, drain := range []bool{false, true} {
+		r := &redisPubSub{logger: logger.New(zap.NewNop()), messageCh: make(chan Message, 1)}
+		src := make(chan *redis.Message)
+		stop := make(chan struct{})
+		r.mu.Lock()
+		r.startListening(context.Background(), src)
+		r.mu.Unlock()
+
+		// Without a reader the listener ends up blocked on the full messageCh
+		go func() {
+			for {
+				select {
+				case src <- &redis.Message{Channel: "config", Payload: "etag"}:
+				case <-stop:
+					return
+				}
+			}
+		}()
+		drained := make(chan struct{})
+		go func() {
+			defer close(drained)
+			if !drain {
+				return
+			}
+			for range r.messageCh {
+			}
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		closed := make(chan error, 1)
+		go func() { closed <- r.Close() }()
+		select {
+		case err := <-closed:
+			if err != nil {
+				t.Fatalf("drain=%v: close: %v", drain, err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("drain=%v: Close did not return", drain)
+		}
+		close(stop)
+		<-drained
+
+		if _, err := r.Subscribe(context.Background(), "config"); !errors.Is(err, ErrClosed) {
+			t.Fatalf("drain=%v: subscribe after close: got %v, want ErrClosed", drain, err)
+		}
+		if err := r.Close(); err != nil {
+			t.Fatalf("drain=%v: second close: %v", drain, err)
+		}
+	}
+}
+
+func TestListen_DropsOldestWhenBufferFull(t *testing.T) {
+	const buffer, sent = 4, 100
+	r := &redisPubSub{logger: logger.New(zap.NewNop()), messageCh: make(chan Message, buffer)}
+	src := make(chan *redis.Message)
+	r.mu.Lock()
+	r.startListening(context.Background(), src)
+	r.mu.Unlock()
+
+	// Nobody reads messageCh; every send to the unbuffered src must still
+	// be taken by the listener
+	flooded := make(chan struct{})
+	go func() {
+		defer close(flooded)
+		for i := 0; i < sent; i++ {
+			src <- &redis.Message{Channel: "config", Payload: strconv.Itoa(i)}
+		}
+	}()
+	select {
+	case <-flooded:
+	case <-time.After(2 * time.Second):
+		t.Fatal("listener blocked on the full buffer")
+	}
+
+	// The last send may still be on its way into the buffer
+	deadline := time.Now().Add(2 * time.Second)
+	for r.DroppedMessages() != sent-buffer && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := r.DroppedMessages(); got != sent-buffer {
+		t.Fatalf("dropped %d messages, want %d", got, sent-buffer)
+	}
+	for i := sent - buffer; i < sent; i++ {
+		if m := <-r.messageCh; m.Payload != strconv.Itoa(i) {
+			t.Fatalf("got payload %q, want the newest messages in order, next %d", m.Payload, i)
+		}
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
+
+func TestListen_SlowReaderKeepsNewestMessage(t *testing.T) {
+	r := &redisPubSub{logger: logger.New(zap.NewNop()), messageCh: make(chan Message, 2)}
+	src := make(chan *redis.Message)
+	r.mu.Lock()
+	r.startListening(context.Background(), src)
+	r.mu.Unlock()
+
+	last := make(chan string, 1)
+	go func() {
+		var payload string
+		for m := range r.messageCh {
+			payload = m.Payload
+			time.Sleep(50 * time.Microsecond)
+		}
+		last <- payload
+	}()
+
+	const sent = 2000
+	for i := 0; i < sent; i++ {
+		src <- &redis.Message{Channel: "config", Payload: strconv.Itoa(i)}
+	}
+	// Give the reader time to take what is left in the buffer
+	time.Sleep(20 * time.Millisecond)
+	if err := r.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	select {
+	case got := <-last:
+		if got != strconv.Itoa(sent-1) {
+			t.Fatalf("reader last saw %q, want the newest message %d", got, sent-1)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("reader did not finish after Close")
+	}
+	if r.DroppedMessages() == 0 {
+		t.Fatal("expected the slow reader to cause drops")
+	}
+}
@@ -2,6 +2,7 @@ package retry
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
@@ -22,10 +23,32 @@ type Config struct {
 
 	// Jitter adds randomness to backoff duration to prevent thundering herd.
 	Jitter bool
+
+	// RetryIf reports whether a failed attempt is worth retrying; an error
+	// it rejects is returned as is. Nil retries every error.
+	RetryIf func(error) bool
 }
 
 type Operation func(ctx context.Context) error
 
+// permanentError marks an error that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so WithExponentialBackoff stops and returns err as is
+// instead of retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
 func WithExponentialBackoff(ctx context.Context, cfg Config, op Operation) error {
 	var attempt int
 	var err error
@@ -38,6 +61,13 @@ func WithExponentialBackoff(ctx context.Context, cfg Config, op Operation) error
 		if err == nil {
 			return nil
 		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+		if cfg.RetryIf != nil && !cfg.RetryIf(err) {
+			return err
+		}
 
 		// Check if we should retry
 		if cfg.MaxRetries >= 0 && attempt > cfg.MaxRetries {
@@ -98,6 +98,57 @@ func TestWithExponentialBackoff_ExhaustsRetries(t *testing.T) {
 	}
 }
 
+func TestWithExponentialBackoff_PermanentStopsRetrying(t *testing.T) {
+	cfg := Config{
+		MaxRetries:     3,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     100 * time.Millisecond,
+		Multiplier:     2.0,
+	}
+
+	attempts := 0
+	rejected := errors.New("rejected")
+	op := func(ctx context.Context) error {
+		attempts++
+		return Permanent(rejected)
+	}
+
+	err := WithExponentialBackoff(context.Background(), cfg, op)
+	if attempts != 1 {
+		t.Errorf("expected a single attempt, got %d", attempts)
+	}
+	if err != rejected {
+		t.Errorf("expected the unwrapped error %v, got %v", rejected, err)
+	}
+}
+
+func TestWithExponentialBackoff_RetryIf(t *testing.T) {
+	transient := errors.New("transient")
+	fatal := errors.New("fatal")
+	cfg := Config{
+		MaxRetries:     3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		Multiplier:     2.0,
+		RetryIf:        func(err error) bool { return errors.Is(err, transient) },
+	}
+
+	attempts := 0
+	err := WithExponentialBackoff(context.Background(), cfg, func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return transient
+		}
+		return fatal
+	})
+	if attempts != 3 {
+		t.Errorf("expected retries until the rejected error, got %d attempts", attempts)
+	}
+	if err != fatal {
+		t.Errorf("expected the rejected error as is, got %v", err)
+	}
+}
+
 func TestWithExponentialBackoff_ContextCancellation(t *testing.T) {
 	cfg := Config{
 		MaxRetries:     10,
@@ -0,0 +1,135 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+)
+
+// DefaultTimeout bounds the whole shutdown when none is given
+const DefaultTimeout = 10 * time.Second
+
+// ErrTimeout is returned when the cleanups did not finish within the timeout
+var ErrTimeout = errors.New("shutdown timed out")
+
+// Func releases one resource. It should return promptly once ctx is done.
+type Func func(ctx context.Context) error
+
+type cleanup struct {
+	name string
+	fn   Func
+}
+
+// Manager coordinates graceful shutdown. Cleanups run one at a time in
+// reverse registration order, like defer, so a resource registered after
+// its dependencies is released before them. Register an HTTP server last:
+// it then stops accepting requests before anything its handlers use is
+// released, and work cancelled during shutdown cannot be replaced by
+// requests still arriving.
+type Manager struct {
+	log     *logger.CanonicalLogger
+	timeout time.Duration
+
+	mutex    sync.Mutex
+	cleanups []cleanup
+	once     sync.Once
+	err      error
+}
+
+func New(log *logger.CanonicalLogger, timeout time.Duration) *Manager {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Manager{log: log, timeout: timeout}
+}
+
+// Add registers a cleanup to run on shutdown
+func (m *Manager) Add(name string, fn Func) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.cleanups = append(m.cleanups, cleanup{name: name, fn: fn})
+}
+
+// Wait blocks until SIGINT or SIGTERM arrives or ctx is cancelled, then runs
+// the cleanups and returns once they complete or the timeout expires
+func (m *Manager) Wait(ctx context.Context) error {
+	sigCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	m.log.Info("listening for shutdown signals")
+	<-sigCtx.Done()
+	if ctx.Err() == nil {
+		m.log.Info("shutdown signal received")
+	}
+
+	return m.Shutdown(context.Background())
+}
+
+// Shutdown runs the cleanups once; later calls return the first result.
+// Cleanups not reached before the timeout are skipped and ErrTimeout is
+// returned along with any cleanup errors.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.once.Do(func() {
+		m.err = m.run(ctx)
+	})
+	return m.err
+}
+
+func (m *Manager) run(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	m.mutex.Lock()
+	cleanups := make([]cleanup, len(m.cleanups))
+	copy(cleanups, m.cleanups)
+	m.mutex.Unlock()
+
+	var (
+		errsMutex sync.Mutex
+		errs      []error
+		finished  bool
+	)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			if ctx.Err() != nil {
+				return
+			}
+			c := cleanups[i]
+			start := time.Now()
+			if err := c.fn(ctx); err != nil {
+				errsMutex.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+				errsMutex.Unlock()
+				m.log.WithError(err).Error("shutdown step failed", logger.String("step", c.name))
+				continue
+			}
+			m.log.Info("shutdown step completed",
+				logger.String("step", c.name),
+				logger.Duration("duration", time.Since(start)),
+			)
+		}
+		finished = true
+	}()
+
+	select {
+	case <-done:
+		if finished {
+			return errors.Join(errs...)
+		}
+	case <-ctx.Done():
+	}
+
+	m.log.Error("shutdown timed out", logger.Duration("timeout", m.timeout))
+	errsMutex.Lock()
+	defer errsMutex.Unlock()
+	return errors.Join(append([]error{ErrTimeout}, errs...)...)
+}
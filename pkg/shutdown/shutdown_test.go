@@ -0,0 +1,154 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Alwanly/service-distribute-management/pkg/logger"
+	"go.uber.org/zap"
+)
+
+func newTestManager(timeout time.Duration) *Manager {
+	return New(logger.New(zap.NewNop()), timeout)
+}
+
+func TestShutdown_RunsCleanupsInReverseOrder(t *testing.T) {
+	m := newTestManager(time.Second)
+
+	var mu sync.Mutex
+	var order []string
+	for _, name := range []string{"database", "poller", "http"} {
+		name := name
+		m.Add(name, func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return nil
+		})
+	}
+
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if want := []string{"http", "poller", "database"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("got order %v, want %v", order, want)
+	}
+
+	// A second call does not run the cleanups again
+	_ = m.Shutdown(context.Background())
+	if len(order) != 3 {
+		t.Fatalf("cleanups ran %d times, want 3", len(order))
+	}
+}
+
+func TestShutdown_ContinuesAfterErrors(t *testing.T) {
+	m := newTestManager(time.Second)
+	errClose := errors.New("close failed")
+
+	ran := false
+	m.Add("database", func(ctx context.Context) error { ran = true; return nil })
+	m.Add("http", func(ctx context.Context) error { return errClose })
+
+	err := m.Shutdown(context.Background())
+	if !errors.Is(err, errClose) {
+		t.Fatalf("got %v, want the cleanup error", err)
+	}
+	if !ran {
+		t.Fatal("later cleanup skipped after an earlier one failed")
+	}
+}
+
+func TestShutdown_Timeout(t *testing.T) {
+	m := newTestManager(50 * time.Millisecond)
+
+	skipped := true
+	m.Add("database", func(ctx context.Context) error { skipped = false; return nil })
+	m.Add("stuck", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	start := time.Now()
+	err := m.Shutdown(context.Background())
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("got %v, want ErrTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("shutdown took %v, want it bounded by the 50ms timeout", elapsed)
+	}
+	if !skipped {
+		t.Fatal("cleanup after the stuck one ran past the timeout")
+	}
+}
+
+func TestShutdown_TimeoutWhenCleanupHonorsContext(t *testing.T) {
+	m := newTestManager(20 * time.Millisecond)
+	m.Add("database", func(ctx context.Context) error { return nil })
+	m.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+
+	if err := m.Shutdown(context.Background()); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("got %v, want ErrTimeout", err)
+	}
+}
+
+func TestWait(t *testing.T) {
+	t.Run("context cancelled", func(t *testing.T) {
+		m := newTestManager(time.Second)
+		ran := make(chan struct{})
+		m.Add("http", func(ctx context.Context) error { close(ran); return nil })
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := m.Wait(ctx); err != nil {
+			t.Fatalf("wait: %v", err)
+		}
+		select {
+		case <-ran:
+		default:
+			t.Fatal("cleanup did not run")
+		}
+	})
+
+	t.Run("signal", func(t *testing.T) {
+		m := newTestManager(time.Second)
+		ran := make(chan struct{})
+		m.Add("http", func(ctx context.Context) error { close(ran); return nil })
+
+		// Catch SIGTERM in the test too so an early signal can't kill the process
+		sigs := make(chan os.Signal, 16)
+		signal.Notify(sigs, syscall.SIGTERM)
+		defer signal.Stop(sigs)
+
+		result := make(chan error, 1)
+		go func() { result <- m.Wait(context.Background()) }()
+
+		// Keep signalling until Wait has installed its handler and returned
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		deadline := time.After(2 * time.Second)
+		for {
+			select {
+			case err := <-result:
+				if err != nil {
+					t.Fatalf("wait: %v", err)
+				}
+				<-ran
+				return
+			case <-ticker.C:
+				_ = syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+			case <-deadline:
+				t.Fatal("wait did not return after SIGTERM")
+			}
+		}
+	})
+}
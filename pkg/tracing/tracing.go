@@ -0,0 +1,97 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HeaderTraceParent carries the W3C trace context between controller, agent
+// and worker, next to logger.HeaderCorrelationID
+const HeaderTraceParent = "traceparent"
+
+// instrumentationName names the tracer every service span comes from
+const instrumentationName = "github.com/Alwanly/service-distribute-management"
+
+// Config configures trace export for one service
+type Config struct {
+	ServiceName string
+	// Endpoint is the collector's OTLP/HTTP URL; empty disables export
+	Endpoint string
+	// SampleRatio is the fraction of new traces recorded. Requests that
+	// arrive with a traceparent follow the caller's sampling decision.
+	SampleRatio float64
+}
+
+// Setup installs the W3C trace context propagator and, when cfg.Endpoint is
+// set, a tracer provider exporting spans over OTLP/HTTP. Without an endpoint
+// spans are not recorded but incoming trace context is still passed on, so
+// one service without a collector does not break the trace. The returned
+// function flushes and stops the exporter.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP trace exporter: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span named name as a child of the span in ctx
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// Inject writes ctx's trace context into outgoing headers
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+}
+
+// Extract returns ctx continuing the trace context found in incoming headers
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
+// TraceParent returns ctx's trace context as a traceparent value for
+// messages that do not travel as HTTP, e.g. pub/sub notifications. It is
+// empty when ctx carries no trace.
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	Inject(ctx, carrier)
+	return carrier[HeaderTraceParent]
+}
+
+// WithTraceParent returns ctx continuing the trace in a traceparent value
+// from TraceParent. An empty or malformed value leaves ctx unchanged.
+func WithTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return Extract(ctx, propagation.MapCarrier{HeaderTraceParent: traceParent})
+}
+
+// TraceID returns the ID of ctx's trace, or "" when it has none
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
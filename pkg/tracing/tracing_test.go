@@ -0,0 +1,48 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceParent_RoundTrip(t *testing.T) {
+	if _, err := Setup(context.Background(), Config{ServiceName: "test"}); err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+	tp := TraceParent(trace.ContextWithSpanContext(context.Background(), sc))
+	if tp != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Fatalf("TraceParent = %q", tp)
+	}
+
+	got := trace.SpanContextFromContext(WithTraceParent(context.Background(), tp))
+	if !got.IsRemote() || got.TraceID() != sc.TraceID() || got.SpanID() != sc.SpanID() {
+		t.Fatalf("WithTraceParent = %+v, want the remote span %+v", got, sc)
+	}
+	if TraceID(WithTraceParent(context.Background(), tp)) != sc.TraceID().String() {
+		t.Fatal("TraceID does not match the continued trace")
+	}
+}
+
+func TestTraceParent_NoTrace(t *testing.T) {
+	if _, err := Setup(context.Background(), Config{ServiceName: "test"}); err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+
+	if tp := TraceParent(context.Background()); tp != "" {
+		t.Fatalf("TraceParent without a span = %q, want empty", tp)
+	}
+	for _, tp := range []string{"", "not-a-traceparent"} {
+		ctx := WithTraceParent(context.Background(), tp)
+		if trace.SpanContextFromContext(ctx).IsValid() || TraceID(ctx) != "" {
+			t.Errorf("WithTraceParent(%q) produced a trace", tp)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package validator
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/Alwanly/service-distribute-management/pkg/wrapper"
+)
+
+// BodyError is a request body BindJSON refused. Code is 415 for a body not
+// sent as JSON and 400 for JSON that does not decode.
+type BodyError struct {
+	Code    int
+	Message string
+	Err     error
+}
+
+func (e *BodyError) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %v", e.Message, e.Err)
+}
+
+func (e *BodyError) Unwrap() error {
+	return e.Err
+}
+
+// RequireJSON checks that the request body is sent as JSON: application/json
+// or a +json type such as application/merge-patch+json. Errors are
+// *BodyError with code 415.
+func RequireJSON(c *fiber.Ctx) error {
+	contentType := c.Get(fiber.HeaderContentType)
+	if contentType == "" {
+		return &BodyError{Code: http.StatusUnsupportedMediaType, Message: "missing Content-Type, expected application/json"}
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || (mediaType != fiber.MIMEApplicationJSON && !strings.HasSuffix(mediaType, "+json")) {
+		return &BodyError{
+			Code:    http.StatusUnsupportedMediaType,
+			Message: fmt.Sprintf("unsupported Content-Type %q, expected application/json", contentType),
+		}
+	}
+	return nil
+}
+
+// BindJSON decodes the request body into out. Unlike c.BodyParser it only
+// accepts JSON (see RequireJSON), so a form post or a body without a
+// Content-Type is reported as such rather than as an invalid body. Errors
+// are *BodyError.
+func BindJSON(c *fiber.Ctx, out interface{}) error {
+	if err := RequireJSON(c); err != nil {
+		return err
+	}
+	if err := c.App().Config().JSONDecoder(c.Body(), out); err != nil {
+		return &BodyError{Code: http.StatusBadRequest, Message: "malformed JSON body", Err: err}
+	}
+	return nil
+}
+
+// BodyErrorResponse is the failure envelope for an error from BindJSON or
+// RequireJSON
+func BodyErrorResponse(err error) wrapper.JSONResult {
+	var bodyErr *BodyError
+	if !errors.As(err, &bodyErr) {
+		return wrapper.ResponseBadRequest("Invalid request body")
+	}
+	return wrapper.ResponseFailed(bodyErr.Code, bodyErr.Error(), nil)
+}
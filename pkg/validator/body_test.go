@@ -0,0 +1,57 @@
+package validator
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRequireJSON(t *testing.T) {
+	app := fiber.New()
+	app.Post("/", func(c *fiber.Ctx) error {
+		if err := RequireJSON(c); err != nil {
+			res := BodyErrorResponse(err)
+			return c.Status(res.Code).JSON(res)
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	tests := []struct {
+		contentType string
+		want        int
+	}{
+		{contentType: "application/json", want: http.StatusNoContent},
+		{contentType: "Application/JSON; charset=utf-8", want: http.StatusNoContent},
+		{contentType: "application/merge-patch+json", want: http.StatusNoContent},
+		{contentType: "", want: http.StatusUnsupportedMediaType},
+		{contentType: "text/plain", want: http.StatusUnsupportedMediaType},
+		{contentType: "application/xml", want: http.StatusUnsupportedMediaType},
+		{contentType: "application/jsonp", want: http.StatusUnsupportedMediaType},
+		{contentType: "json", want: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+		if tt.contentType != "" {
+			req.Header.Set(fiber.HeaderContentType, tt.contentType)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("Content-Type %q: status = %d, want %d", tt.contentType, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestBodyErrorResponse_OtherErrors(t *testing.T) {
+	res := BodyErrorResponse(errors.New("boom"))
+	if res.Code != http.StatusBadRequest || res.Message != "Invalid request body" {
+		t.Fatalf("got %+v, want the generic 400", res)
+	}
+}
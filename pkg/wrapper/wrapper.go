@@ -1,5 +1,7 @@
 package wrapper
 
+import "net/http"
+
 type JSONResult struct {
 	Code    int         `json:"-"`
 	Success bool        `json:"success"`
@@ -24,3 +26,23 @@ func ResponseFailed(httpCode int, message string, data interface{}) JSONResult {
 		Data:    data,
 	}
 }
+
+// ResponseBadRequest is the 400 failure envelope for message
+func ResponseBadRequest(message string) JSONResult {
+	return ResponseFailed(http.StatusBadRequest, message, nil)
+}
+
+// ResponseUnauthorized is the 401 failure envelope for message
+func ResponseUnauthorized(message string) JSONResult {
+	return ResponseFailed(http.StatusUnauthorized, message, nil)
+}
+
+// ResponseNotFound is the 404 failure envelope for message
+func ResponseNotFound(message string) JSONResult {
+	return ResponseFailed(http.StatusNotFound, message, nil)
+}
+
+// ResponseConflict is the 409 failure envelope for message
+func ResponseConflict(message string) JSONResult {
+	return ResponseFailed(http.StatusConflict, message, nil)
+}
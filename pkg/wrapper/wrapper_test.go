@@ -0,0 +1,45 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestFailureHelpers(t *testing.T) {
+	tests := []struct {
+		name   string
+		result JSONResult
+		code   int
+	}{
+		{name: "bad request", result: ResponseBadRequest("invalid request body"), code: http.StatusBadRequest},
+		{name: "unauthorized", result: ResponseUnauthorized("invalid request body"), code: http.StatusUnauthorized},
+		{name: "not found", result: ResponseNotFound("invalid request body"), code: http.StatusNotFound},
+		{name: "conflict", result: ResponseConflict("invalid request body"), code: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.result.Code != tt.code {
+				t.Fatalf("code = %d, want %d", tt.result.Code, tt.code)
+			}
+			if tt.result != ResponseFailed(tt.code, "invalid request body", nil) {
+				t.Fatalf("got %+v, want the ResponseFailed envelope", tt.result)
+			}
+
+			body, err := json.Marshal(tt.result)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			var envelope map[string]interface{}
+			if err := json.Unmarshal(body, &envelope); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if len(envelope) != 3 || envelope["success"] != false || envelope["message"] != "invalid request body" || envelope["data"] != nil {
+				t.Fatalf("unexpected envelope %s", body)
+			}
+			if _, ok := envelope["data"]; !ok {
+				t.Fatalf("envelope %s has no data field", body)
+			}
+		})
+	}
+}